@@ -5,8 +5,12 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strings"
 	"syscall"
+	"time"
+
+	"golang.org/x/term"
 )
 
 type Agent struct {
@@ -17,6 +21,23 @@ type Agent struct {
 	tools      *ToolRegistry
 	totalUsage Usage
 	agentFile  *AgentFile
+	sink       func(AgentEvent)    // when set, loop events go here instead of the terminal
+	paused     bool                // stopped by Ctrl+C, max_turns or the budget; /continue resumes
+	prompts    *promptChangelog    // system prompt versions of the current session, for /prompt-diff
+	redactor   *Redactor           // masks secrets in user input and tool output; nil when off
+	otel       *otelExporter       // OTLP span export; nil unless otel.endpoint is set
+	llm        Provider            // provider of the current call: provider, or a models.* route
+	llmModel   string              // model of the current call
+	routes     map[string]Provider // routed providers by "provider:model"; nil entry = failed to create
+	fitNote    string              // last context-window trimming notice, so each shows once
+	rolling    *rollingSummary     // the session's rolling summary, loaded by summary()
+	shellOut   []string            // !command output the user chose to send with the next message
+	turnStart  time.Time           // start of the running turn, for notify; zero between turns
+	// budgetWarned is the last budget warning shown (day, level), so each shows once
+	budgetWarned struct {
+		day   string
+		level int
+	}
 }
 
 func NewAgent(provider Provider, cfg Config, session *Session, af *AgentFile) *Agent {
@@ -30,6 +51,25 @@ func NewAgent(provider Provider, cfg Config, session *Session, af *AgentFile) *A
 		if len(af.Deny) > 0 || len(af.Allow) > 0 {
 			toolsCfg = af.ToolsConfig()
 		}
+		// Command rules override independently of tool deny/allow
+		if af.Commands.IsEmpty() {
+			toolsCfg.Commands = cfg.Tools.Commands
+		} else {
+			toolsCfg.Commands = af.Commands
+		}
+		toolsCfg.HTTP = cfg.Tools.HTTP
+		if len(af.HTTP.Allow) > 0 || len(af.HTTP.Deny) > 0 {
+			toolsCfg.HTTP = af.HTTP
+		}
+		toolsCfg.Clipboard = cfg.Tools.Clipboard
+		toolsCfg.Paths = cfg.Tools.Paths
+		if !af.Paths.IsEmpty() {
+			toolsCfg.Paths = af.Paths
+		}
+		toolsCfg.Permissions = cfg.Tools.Permissions
+		if len(af.Permissions) > 0 {
+			toolsCfg.Permissions = af.Permissions
+		}
 	}
 
 	a := &Agent{
@@ -39,20 +79,63 @@ func NewAgent(provider Provider, cfg Config, session *Session, af *AgentFile) *A
 		mode:      ModePlan,
 		tools:     NewToolRegistry(toolsCfg),
 		agentFile: af,
+		redactor:  NewRedactor(cfg.Redact),
+		otel:      newOTelExporter(cfg.OTel, filepath.Base(agentDir)),
+	}
+
+	if af != nil {
+		registerSkillTool(a.tools, af.Skills)
+	}
+	registerScratchpadTools(a.tools, func() string { return a.session.ID })
+	registerDocsTool(a.tools, cfg)
+	registerPRTool(a.tools, cfg.Forge, func() *Session { return a.session })
+	registerIssueTools(a.tools, cfg.Forge)
+	a.useRole(a.modeRole())
+	a.tools.Confirm = a.confirm
+	a.tools.ShowDiff = func(path, before, after string) {
+		if a.sink == nil && !plainOutput {
+			renderDiff(path, before, after)
+		}
+	}
+	a.tools.FormatOnWrite = cfg.Tools.FormatOnWrite
+	a.tools.Safety = &SafetyCheck{Threshold: cfg.Safety.Threshold, Dangerous: cfg.Safety.ConfirmDangerous}
+	if cfg.Safety.ModelCheck {
+		a.tools.Safety.Model = func(command string) (int, error) {
+			return modelSafetyScore(a.provider, command)
+		}
 	}
 
 	bashTimeout = cfg.BashTimeout
+	askUserPolicy = cfg.AskUser
+	askUserNotify = func(question string) { a.notify("simpleagent needs input", question) }
 	initRenderer()
 
 	return a
 }
 
+// confirm asks a yes/no question on the terminal. Without one (serve mode,
+// piped stdin) the answer is always no.
+func (a *Agent) confirm(question string) bool {
+	if a.sink != nil || !term.IsTerminal(int(os.Stdin.Fd())) {
+		return false
+	}
+	a.notify("simpleagent needs input", question)
+	fmt.Printf("\033[33m? %s [y/N]: \033[0m", question)
+	line, err := a.readLineSimple()
+	if err != nil {
+		return false
+	}
+	answer := strings.ToLower(strings.TrimSpace(line))
+	return answer == "y" || answer == "yes"
+}
+
 func (a *Agent) systemPrompt() string {
 	cwd, _ := os.Getwd()
 
-	var sb strings.Builder
+	var sb promptBuilder
 
 	// Persona: agent file prompt or default
+	sb.Section("persona")
 	if a.agentFile != nil && a.agentFile.Prompt != "" {
 		sb.WriteString(a.agentFile.Prompt)
 		sb.WriteString("\n\n")
@@ -61,26 +144,71 @@ func (a *Agent) systemPrompt() string {
 	}
 
 	// Always append: working dir, mode, tools, rules, mode instructions, memory
+	sb.Section("environment")
 	sb.WriteString("Working directory: " + cwd + "\n")
-	sb.WriteString("Current mode: " + a.mode.String() + "\n\n")
+	sb.WriteString("Current mode: " + a.mode.String() + "\n")
+	if a.tools.Scratch != "" {
+		sb.WriteString("Scratch directory: " + a.tools.Scratch + "\n")
+		sb.WriteString("Put throwaway files (temp scripts, test output, notes) in the scratch directory, never in the project. It is deleted when the session ends. Writes there are allowed in plan mode and are not staged by dry-run.\n")
+	}
+	sb.WriteString("\n")
+
+	sb.Section("dryrun")
+	if a.tools.DryRun != nil {
+		sb.WriteString("DRY-RUN is on: write_file, edit_file, patch, and delete are staged for the user to review, not written to disk. read_file shows staged content. Other commands (bash etc.) still run for real, so do not use them to modify files.\n\n")
+	}
 
+	sb.Section("tools")
 	sb.WriteString("Available tools:\n")
-	sb.WriteString("  Files: read_file, write_file, edit_file, list_dir, delete, move, copy, file_info, make_dir, chmod\n")
+	sb.WriteString("  Files: read_file, write_file, edit_file, list_dir, delete, move, copy, file_info, make_dir, chmod, hash_file\n")
 	sb.WriteString("  Exec: bash, start_process, write_stdin, read_output, kill_process, list_processes\n")
+	sb.WriteString("  Tests: run_tests (use it instead of running go test/pytest/jest/cargo test in bash)\n")
+	sb.WriteString("  Build: build (compiler errors as file:line; use it instead of running go build/cargo build/npm run build/make in bash)\n")
+	sb.WriteString("  Lint: lint (formatting diff and lint problems for changed files; fix: true to apply formatting)\n")
 	sb.WriteString("  Search: grep, find_files\n")
 	sb.WriteString("  Diff: diff, patch\n")
-	sb.WriteString("  User: ask_user\n\n")
+	sb.WriteString("  Notebooks: read_notebook, edit_notebook_cell (use these for .ipynb, never read_file/write_file)\n")
+	sb.WriteString("  Archives: archive_create, archive_extract (zip, tar, tar.gz; use instead of tar/zip commands)\n")
+	sb.WriteString("  User: ask_user\n")
+	if a.tools.Available("search_docs") {
+		sb.WriteString("  Docs: search_docs (the project's specs, runbooks and design docs; search them before guessing how things should work)\n")
+	}
+	sb.WriteString("  Notes: scratchpad_write, scratchpad_read (this conversation's notes; plans and findings to keep across turns)\n")
+	sb.WriteString("  Web: http_request (use it instead of curl)\n")
+	if a.tools.Available("create_pr") {
+		sb.WriteString("  Git: create_pr (pushes the current branch and opens a pull request; only when the user asks for one)\n")
+	}
+	if a.tools.Available("github_issue_get") {
+		sb.WriteString("  Issues: github_issue_get, github_issue_list, github_issue_comment (read the issue you're asked to work on first; comment with a summary when the fix is done)\n")
+	}
+	if plugins := a.tools.Plugins(); len(plugins) > 0 {
+		sb.WriteString("  Plugins: " + strings.Join(plugins, ", ") + " (user-installed; see each tool's description)\n")
+	}
+	sb.WriteString("\n")
+
+	sb.Section("scratchpad")
+	writeScratchpad(&sb, a.session.ID)
 
+	sb.Section("skills")
+	if a.agentFile != nil {
+		writeSkills(&sb, a.agentFile.Skills)
+	}
+
+	sb.Section("rules")
 	sb.WriteString("CRITICAL RULES:\n")
 	sb.WriteString("- ACT, don't narrate. NEVER say \"I'll do X\" or \"Let me X\" without immediately calling the tool in the same response. If you need to explore, call list_dir RIGHT NOW — do not just say you will.\n")
 	sb.WriteString("- Every response MUST include at least one tool call unless you are answering a pure knowledge question.\n")
-	sb.WriteString("- Read files before editing. Use edit_file for small changes, write_file for new files or full rewrites.\n")
-	sb.WriteString("- NEVER use bash for servers, watchers, or anything long-running. bash BLOCKS until the command exits. Use start_process instead, then read_output to check it.\n")
+	sb.WriteString("- Read files before editing. Use edit_file for small changes, write_file for new files or full rewrites. Write very large files in parts with write_file mode begin/continue/commit.\n")
+	sb.WriteString("- NEVER use bash for servers, watchers, or anything long-running. bash BLOCKS until the command exits. Use start_process instead, then read_output to check it (with wait_for to block until it is ready, not sleep).\n")
 	sb.WriteString("- Be concise. No filler. Short text + tool calls.\n")
-	sb.WriteString("- When presenting choices, format as numbered options.\n\n")
+	if a.redactor != nil {
+		sb.WriteString("- Secrets in user messages and tool output are masked as [REDACTED:<kind>]. Never write these placeholders into files. If you truly need a raw value, repeat the tool call with \"unredacted\": true; the user must approve.\n")
+	}
+	sb.WriteString("- When presenting choices, format as numbered options. To have the user pick one, call ask_user with options.\n\n")
 
+	sb.Section("mode")
 	if a.mode == ModePlan {
-		sb.WriteString("PLAN mode: Use read-only tools (read_file, list_dir, grep, find_files, file_info, diff, ask_user). Write tools are blocked.\n")
+		sb.WriteString("PLAN mode: Use read-only tools (read_file, list_dir, grep, find_files, file_info, diff, ask_user, http_request with GET). Write tools are blocked.\n")
 		sb.WriteString("Your goal is to GATHER INFORMATION and BUILD A PLAN before any code is written.\n")
 		sb.WriteString("- Explore the codebase thoroughly. Read files, search, understand the current state.\n")
 		sb.WriteString("- Ask the user about EVERYTHING you're unsure of. Use ask_user liberally. Clarify requirements, preferences, constraints, tech choices, naming, scope.\n")
@@ -95,11 +223,43 @@ func (a *Agent) systemPrompt() string {
 		sb.WriteString("- If you hit an error, debug and fix it yourself. Don't ask the user unless you're truly stuck after multiple attempts.\n\n")
 	}
 
-	if mem := loadMemory(); mem != "" {
+	sb.Section("project")
+	if instr := loadProjectInstructions(); instr != "" {
+		sb.WriteString(instr)
+	}
+
+	sb.Section("context")
+	if a.cfg.ProjectCtx {
+		sb.WriteString(loadProjectContext())
+	}
+
+	sb.Section("conventions")
+	if a.cfg.Conventions {
+		sb.WriteString(loadConventions())
+	}
+
+	sb.Section("memory")
+	if mem := loadMemory(a.cfg, a.lastUserMessage()); mem != "" {
 		sb.WriteString(mem)
 	}
 
-	return sb.String()
+	sb.Section("summary")
+	writeSummary(&sb, a.summary())
+
+	secs := sb.Sections()
+	a.trackPrompt(secs)
+	return joinSections(secs)
+}
+
+// lastUserMessage returns the most recent user-typed message, for memory retrieval.
+func (a *Agent) lastUserMessage() string {
+	msgs := a.session.Messages
+	for i := len(msgs) - 1; i >= 0; i-- {
+		if msgs[i].Role == "user" {
+			return msgs[i].Content
+		}
+	}
+	return ""
 }
 
 func (a *Agent) prompt() string {
@@ -107,8 +267,9 @@ func (a *Agent) prompt() string {
 }
 
 func (a *Agent) RunOnce(input string) {
-	a.session.Messages = append(a.session.Messages, Message{Role: "user", Content: input})
+	a.addUserMessage(a.expandInput(input))
 	a.runAgentLoop()
+	cleanScratch(a.session.ID)
 }
 
 func (a *Agent) RunLoop() {
@@ -120,7 +281,7 @@ func (a *Agent) RunLoop() {
 		// Check if last message needs LLM response (pending tool results)
 		if len(a.session.Messages) > 0 {
 			last := a.session.Messages[len(a.session.Messages)-1]
-			if last.Role == "tool" || last.Role == "user" {
+			if !a.paused && (last.Role == "tool" || last.Role == "user") {
 				a.runAgentLoop()
 				continue
 			}
@@ -131,6 +292,7 @@ func (a *Agent) RunLoop() {
 		input, err := a.readLine()
 		if err != nil {
 			fmt.Println("Goodbye!")
+			cleanScratch(a.session.ID)
 			break
 		}
 
@@ -139,97 +301,387 @@ func (a *Agent) RunLoop() {
 			continue
 		}
 
-		// Handle slash commands
-		if strings.HasPrefix(input, "/") {
+		switch {
+		case input == "/editor":
+			// The composed text is always a message, even if it starts with / or !
+			text, err := composeInEditor("")
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			}
+			if text == "" {
+				continue
+			}
+			fmt.Println(text)
+			input = text
+		case strings.HasPrefix(input, "!"):
+			a.shellEscape(strings.TrimSpace(input[1:]))
+			continue
+		case strings.HasPrefix(input, "/"):
 			if a.handleSlashCommand(input) {
 				continue
 			}
 		}
 
-		a.session.Messages = append(a.session.Messages, Message{Role: "user", Content: input})
+		if a.cfg.TrackPrompts {
+			trackPrompt(a.session.ID, a.redactor.Redact(input))
+		}
+
+		input = a.expandInput(input)
+		a.paused = false
+		a.addUserMessage(input)
 		a.runAgentLoop()
 	}
 }
 
 func (a *Agent) runAgentLoop() {
-	for {
-		ctx, cancel := context.WithCancel(context.Background())
+	a.runAgentLoopCtx(context.Background())
+}
 
-		// Handle Ctrl+C to cancel streaming
+// runAgentLoopCtx drives LLM turns until the assistant answers without tool calls.
+// Cancelling parent aborts the current stream (serve mode uses the request context).
+func (a *Agent) runAgentLoopCtx(parent context.Context) {
+	// One context for the whole user turn: Ctrl+C cancels the stream and any
+	// pending tool calls, then control returns to the prompt.
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+	a.tools.Scratch = scratchDir(a.session.ID)
+	os.MkdirAll(a.tools.Scratch, 0755)
+	os.Chtimes(a.tools.Scratch, time.Now(), time.Now()) // in use: keep pruneScratch away
+	if a.sink == nil {
 		sigCh := make(chan os.Signal, 1)
 		signal.Notify(sigCh, syscall.SIGINT)
+		defer signal.Stop(sigCh)
 		go func() {
-			<-sigCh
-			cancel()
-			signal.Stop(sigCh)
+			select {
+			case <-sigCh:
+				cancel()
+			case <-ctx.Done():
+			}
 		}()
-
-		ch, err := a.provider.SendStream(ctx, a.session.Messages, a.tools.Definitions(), a.systemPrompt())
+	}
+	toolCtx = ctx
+	defer func() { toolCtx = context.Background() }()
+
+	a.useRole(a.modeRole())
+	a.foldHistory(ctx)
+
+	turns := 0
+	retries := 0 // 429 retries this turn
+	turnStart := time.Now()
+	a.turnStart = turnStart
+	var times turnTimes
+	a.otel.startTurn()
+	defer func() {
+		a.otel.endTurn(a, turns)
+		a.logTurn(turnStart, turns)
+		a.notifyTurnEnd(ctx.Err() != nil)
+		a.turnStart = time.Time{}
+	}()
+	for {
+		if !a.allowTurn(turns) || !a.checkBudget() {
+			return
+		}
+		turns++
+
+		a.useRole(a.modeRole())
+		systemPrompt := a.systemPrompt()
+		toolDefs := a.tools.Definitions()
+		msgs := a.fitMessages(relevantResults(a.cfg, a.history()), systemPrompt, toolDefs)
+		if tracksRateLimits(a.llm.Name()) {
+			need := estimateContextTokens(systemPrompt, msgs, toolDefs, a.llm.Name())
+			if !a.paceRateLimit(ctx, need) {
+				if ctx.Err() != nil {
+					a.interrupted(parent)
+				}
+				return
+			}
+		}
+		callStart := time.Now()
+		ch, err := a.llm.SendStream(ctx, msgs, toolDefs, systemPrompt)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "\nError: %v\n", err)
-			cancel()
-			signal.Stop(sigCh)
+			a.logLLMCall(callStart, systemPrompt, len(toolDefs), nil, Message{}, err)
+			if ctx.Err() != nil {
+				a.interrupted(parent)
+				return
+			}
+			if retries < rateRetries && rateLimitedSince(a.llm.Name(), callStart) {
+				retries++
+				turns-- // the retry is the same call; paceRateLimit waits out the 429
+				continue
+			}
+			if retries < rateRetries && timedOutSince(a.llm.Name(), callStart) {
+				retries++
+				turns--
+				a.retryTimeout(err)
+				continue
+			}
+			a.reportError(err)
 			return
 		}
 
-		assistantMsg, usage := a.consumeStream(ch)
-		cancel()
-		signal.Stop(sigCh)
+		assistantMsg, usage := a.consumeStream(ctx, ch)
+		if ctx.Err() == nil {
+			assistantMsg, usage = a.continueTruncated(ctx, systemPrompt, toolDefs, assistantMsg, usage)
+		}
+		callTime := time.Since(callStart)
+		assistantMsg.DurationMs = callTime.Milliseconds()
+		times.llm += callTime
+		times.calls++
+		stopped := ctx.Err() != nil
+		if stopped {
+			// Keep the partial text; tool call arguments may be cut off mid-JSON
+			assistantMsg.ToolCalls = nil
+			if assistantMsg.Content != "" {
+				assistantMsg.Content += "\n\n[interrupted by user]"
+			}
+		}
+
+		// A stalled stream is dropped, partial reply and all, and sent again
+		if !stopped && usage == nil && retries < rateRetries && timedOutSince(a.llm.Name(), callStart) {
+			a.logLLMCall(callStart, systemPrompt, len(toolDefs), nil, assistantMsg, fmt.Errorf("request_timeout"))
+			retries++
+			turns--
+			a.retryTimeout(nil)
+			continue
+		}
+
+		// Backends like Ollama may omit usage — estimate it locally
+		if usage == nil && (assistantMsg.Content != "" || len(assistantMsg.ToolCalls) > 0) {
+			usage = estimateUsage(systemPrompt, msgs, toolDefs, assistantMsg, a.llm.Name())
+		}
+		var callErr error
+		if stopped {
+			callErr = ctx.Err()
+		}
+		a.logLLMCall(callStart, systemPrompt, len(toolDefs), usage, assistantMsg, callErr)
+
+		// A 429 mid-stream leaves nothing behind; wait and make the call again
+		if !stopped && usage == nil && assistantMsg.Content == "" && len(assistantMsg.ToolCalls) == 0 &&
+			retries < rateRetries && rateLimitedSince(a.llm.Name(), callStart) {
+			retries++
+			turns--
+			continue
+		}
 
 		if usage != nil {
-			a.totalUsage.InputTokens += usage.InputTokens
-			a.totalUsage.OutputTokens += usage.OutputTokens
-			a.session.TokensUsed = a.totalUsage.InputTokens + a.totalUsage.OutputTokens
+			a.addUsage(usage)
+			if a.sink != nil {
+				a.sink(AgentEvent{Type: "usage", Usage: usage})
+			} else if usage.Truncated() {
+				renderTruncated(a.cfg.MaxTokens)
+			}
 		}
 
-		a.session.Messages = append(a.session.Messages, assistantMsg)
+		if stopped {
+			if assistantMsg.Content != "" {
+				a.session.Append(assistantMsg)
+			}
+			a.interrupted(parent)
+			return
+		}
+
+		// The transcript gets secrets redacted; the calls run with the originals
+		recorded := redactToolCalls(assistantMsg)
+		a.session.Append(recorded)
 
 		if len(assistantMsg.ToolCalls) > 0 {
-			for _, tc := range assistantMsg.ToolCalls {
-				blocked := a.mode == ModePlan && a.tools.IsWriteTool(tc.Name)
-				renderToolCall(tc.Name, string(tc.Args), blocked)
+			for i, tc := range assistantMsg.ToolCalls {
+				// Every tool call needs a result, even the ones skipped by an interrupt
+				if ctx.Err() != nil {
+					a.session.Append(Message{
+						Role:       "tool",
+						Content:    "interrupted by user: not run",
+						ToolCallID: tc.ID,
+						IsError:    true,
+					})
+					continue
+				}
+
+				blocked := a.mode == ModePlan && (a.tools.IsWriteTool(tc.Name) || writesRemote(tc.Name, tc.Args) || lintFixes(tc.Name, tc.Args))
+				if a.sink != nil {
+					a.sink(AgentEvent{Type: "tool_call", ID: tc.ID, Name: tc.Name, Args: recorded.ToolCalls[i].Args})
+				} else {
+					renderToolCall(tc.Name, string(tc.Args), blocked)
+				}
 
 				askUserMode = a.mode
-				result, err := a.tools.Execute(tc.Name, tc.Args, a.mode)
-				if err != nil {
-					result = fmt.Sprintf("error: %v", err)
+				askUserInteractive = a.sink == nil
+				bashLive = a.sink == nil && a.cfg.StreamBash
+				toolStart := time.Now()
+				res := a.tools.Execute(tc.Name, tc.Args, a.mode)
+				toolTime := time.Since(toolStart)
+				times.tools += toolTime
+				times.toolCalls++
+				a.logToolCall(tc, recorded.ToolCalls[i].Args, toolStart, res, ctx.Err() != nil)
+				result := a.redactResult(tc, res.Content)
+				if ctx.Err() != nil {
+					result += "\n[interrupted by user]"
+					res.IsError = true
+				}
+				if a.sink != nil {
+					a.sink(AgentEvent{Type: "tool_result", ID: tc.ID, Name: tc.Name, Result: result, Error: res.IsError})
+				} else if !plainOutput && tc.Name != "ask_user" {
+					renderToolResult(result, toolTime)
 				}
 
-				a.session.Messages = append(a.session.Messages, Message{
+				a.session.Append(Message{
 					Role:       "tool",
 					Content:    result,
 					ToolCallID: tc.ID,
+					IsError:    res.IsError,
+					DurationMs: toolTime.Milliseconds(),
 				})
 			}
 			a.session.Save()
+			if ctx.Err() != nil {
+				a.interrupted(parent)
+				return
+			}
 			continue // back to LLM with tool results
 		}
 
 		// Plain text response
-		if assistantMsg.Content != "" {
-			fmt.Println()
+		if a.sink == nil {
+			if assistantMsg.Content != "" {
+				fmt.Println()
+			}
+			if plainOutput {
+				renderContextLine(usage, a.llm.MaxContext())
+			} else {
+				renderCodeBlocks(codeBlocks(assistantMsg.Content))
+				times.total = time.Since(turnStart)
+				renderTurnTimes(times)
+				model := a.llm.Name() + "/" + a.llmModel
+				renderStatusLine(a.mode, model, usage, a.llm.MaxContext(), a.totalUsage)
+			}
 		}
-		renderContextLine(usage, a.provider.MaxContext())
+		a.titleSession(ctx)
 		a.session.Save()
 		return
 	}
 }
 
-func (a *Agent) consumeStream(ch <-chan StreamChunk) (Message, *Usage) {
+// addUsage adds one LLM call to the session's token totals.
+func (a *Agent) addUsage(usage *Usage) {
+	a.totalUsage.InputTokens += usage.InputTokens
+	a.totalUsage.OutputTokens += usage.OutputTokens
+	a.totalUsage.CacheCreationTokens += usage.CacheCreationTokens
+	a.totalUsage.CacheReadTokens += usage.CacheReadTokens
+	a.session.TokensUsed = a.totalUsage.PromptTokens() + a.totalUsage.OutputTokens
+	a.recordCall(usage)
+}
+
+// interrupted ends a turn the user stopped with Ctrl+C. The partial output
+// stays in the session; the next message redirects, /continue picks up.
+func (a *Agent) interrupted(parent context.Context) {
+	a.paused = true
+	a.session.Save()
+	if a.sink != nil || parent.Err() != nil {
+		return // serve client went away; nothing to show
+	}
+	fmt.Printf("\n\033[33m⏹ interrupted — type a message to redirect, or /continue\033[0m\n")
+}
+
+// allowTurn enforces max_turns: after that many LLM calls for one user
+// message, ask whether to keep going. Without a terminal to ask (headless,
+// serve) the loop pauses.
+func (a *Agent) allowTurn(turns int) bool {
+	max := a.cfg.MaxTurns
+	if max <= 0 || turns == 0 || turns%max != 0 {
+		return true
+	}
+	if a.sink == nil && a.confirm(fmt.Sprintf("Agent has run %d turns on this message. Continue?", turns)) {
+		return true
+	}
+
+	a.paused = true
+	a.session.Save()
+	msg := fmt.Sprintf("paused after %d turns (max_turns)", turns)
+	if a.sink != nil {
+		a.sink(AgentEvent{Type: "paused", Text: msg})
+	} else {
+		fmt.Printf("\033[33m%s — /continue to resume\033[0m\n", msg)
+	}
+	return false
+}
+
+// reportError surfaces a loop error to the terminal or the event sink.
+func (a *Agent) reportError(err error) {
+	if a.sink != nil {
+		a.sink(AgentEvent{Type: "error", Text: err.Error()})
+		return
+	}
+	fmt.Fprintf(os.Stderr, "\nError: %v\n", err)
+}
+
+// retryTimeout says a call that hit request_timeout is being made again. err
+// is nil when consumeStream already reported it.
+func (a *Agent) retryTimeout(err error) {
+	msg := "retrying"
+	if err != nil {
+		msg = err.Error() + "; retrying"
+	}
+	if a.sink != nil {
+		a.sink(AgentEvent{Type: "warning", Text: msg})
+		return
+	}
+	fmt.Fprintf(os.Stderr, "\033[33m%s\033[0m\n", msg)
+}
+
+func (a *Agent) consumeStream(ctx context.Context, ch <-chan StreamChunk) (Message, *Usage) {
 	msg := Message{Role: "assistant"}
 	var usage *Usage
 
 	// For accumulating tool call deltas
 	toolCalls := make(map[int]*ToolCall)
 
+	// Spinner until the first chunk arrives
+	var spin *spinner
+	if a.sink == nil && !plainOutput {
+		spin = startSpinner("thinking")
+	}
+	defer spin.Stop()
+
+	// Markdown is rendered block by block as it streams
+	var md *mdStream
+	if a.sink == nil && !plainOutput && mdRenderer != nil {
+		md = newMDStream()
+	}
+
+	// Tool calls get a live one-line preview while their arguments stream
+	var preview *toolPreview
+	previewing := false
+	if a.sink == nil && !plainOutput {
+		preview = &toolPreview{}
+	}
+	defer preview.clear()
+
 	for chunk := range ch {
+		spin.Stop()
+
 		if chunk.Err != nil {
-			fmt.Fprintf(os.Stderr, "\nStream error: %v\n", chunk.Err)
+			preview.clear()
+			if ctx.Err() != nil {
+				break // interrupted; not an error worth showing
+			}
+			if a.sink != nil {
+				a.sink(AgentEvent{Type: "error", Text: chunk.Err.Error()})
+			} else {
+				fmt.Fprintf(os.Stderr, "\nStream error: %v\n", chunk.Err)
+			}
 			break
 		}
 
 		if chunk.Text != "" {
-			fmt.Print(chunk.Text)
+			preview.clear()
+			switch {
+			case a.sink != nil:
+				a.sink(AgentEvent{Type: "text", Text: chunk.Text})
+			case md != nil:
+				md.Write(chunk.Text)
+			default:
+				fmt.Print(chunk.Text)
+			}
 			msg.Content += chunk.Text
 		}
 
@@ -249,6 +701,19 @@ func (a *Agent) consumeStream(ch <-chan StreamChunk) (Message, *Usage) {
 			if d.Args != "" {
 				tc.Args = append(tc.Args, []byte(d.Args)...)
 			}
+			if preview != nil {
+				if !previewing {
+					// End the text above so the preview gets its own line
+					if md != nil {
+						md.Finish()
+						md = nil
+					} else if msg.Content != "" && !strings.HasSuffix(msg.Content, "\n") {
+						fmt.Println()
+					}
+					previewing = true
+				}
+				preview.update(tc.Name, string(tc.Args))
+			}
 		}
 
 		if chunk.Usage != nil {
@@ -256,6 +721,10 @@ func (a *Agent) consumeStream(ch <-chan StreamChunk) (Message, *Usage) {
 		}
 	}
 
+	if md != nil {
+		md.Finish()
+	}
+
 	// Collect tool calls in order, auto-generate IDs if missing
 	for i := 0; i < len(toolCalls); i++ {
 		if tc, ok := toolCalls[i]; ok {
@@ -280,6 +749,9 @@ func (a *Agent) handleSlashCommand(input string) bool {
 	switch cmd {
 	case "/exit", "/quit":
 		fmt.Println("Goodbye!")
+		cleanScratch(a.session.ID)
+		shutdownProcesses()
+		unlockSessions()
 		os.Exit(0)
 	case "/plan":
 		a.mode = ModePlan
@@ -289,8 +761,12 @@ func (a *Agent) handleSlashCommand(input string) bool {
 		fmt.Println("Switched to ACTION mode.")
 	case "/new":
 		a.session.Save()
+		cleanScratch(a.session.ID)
+		unlockSession(a.session.ID)
 		a.session = NewSession(a.provider.Name(), "")
+		lockSession(a.session.ID, false)
 		a.totalUsage = Usage{}
+		a.paused = false
 		fmt.Println("Started new session.")
 	case "/rename":
 		if arg == "" {
@@ -300,13 +776,38 @@ func (a *Agent) handleSlashCommand(input string) bool {
 			fmt.Printf("Session renamed to %q.\n", arg)
 		}
 	case "/sessions":
-		listAllSessions()
+		listAllSessions(arg == "--json")
+	case "/history":
+		handleHistoryCommand(arg)
+	case "/tools":
+		if arg == "--json" {
+			printJSON(a.tools.List())
+		} else {
+			renderToolList(a.tools.List(), a.mode)
+		}
+	case "/stats":
+		runStats(strings.Fields(arg))
 	case "/compact":
 		a.compactSession()
+	case "/config":
+		loaded, src := configReport()
+		printConfig(a.cfg, loaded, src)
+		if term.IsTerminal(int(os.Stdin.Fd())) {
+			editConfig(a.readLineSimple, loaded, src)
+		}
+	case "/rewind":
+		a.rewind(arg)
+	case "/redo":
+		a.redo()
 	case "/model":
 		if arg == "" {
 			pc := a.cfg.ProviderCfg(a.cfg.Provider)
 			fmt.Printf("Current model: %s\n", pc.Model)
+			for _, role := range []string{"plan", "action", "compact", "title"} {
+				if spec := a.cfg.Models.spec(role); spec != "" {
+					fmt.Printf("  %-8s %s\n", role+":", spec)
+				}
+			}
 		} else {
 			pc := a.cfg.Providers[a.cfg.Provider]
 			pc.Model = arg
@@ -316,12 +817,17 @@ func (a *Agent) handleSlashCommand(input string) bool {
 				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			} else {
 				a.provider = newProvider
+				a.resetRoutes()
 				fmt.Printf("Model switched to %s.\n", arg)
 			}
 		}
 	case "/provider":
 		if arg == "" {
-			fmt.Printf("Current provider: %s\n", a.provider.Name())
+			if a.cfg.Profile != "" {
+				fmt.Printf("Current provider: %s (profile %s)\n", a.provider.Name(), a.cfg.Profile)
+			} else {
+				fmt.Printf("Current provider: %s\n", a.provider.Name())
+			}
 		} else {
 			a.cfg.Provider = arg
 			newProvider, err := NewProvider(arg, a.cfg)
@@ -329,18 +835,88 @@ func (a *Agent) handleSlashCommand(input string) bool {
 				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			} else {
 				a.provider = newProvider
+				a.resetRoutes()
 				fmt.Printf("Provider switched to %s.\n", arg)
 			}
 		}
+	case "/copy":
+		a.copyCommand(arg)
+	case "/save-code":
+		a.saveCodeCommand(arg)
+	case "/commit":
+		a.commitCommand(arg)
+	case "/pr":
+		a.prCommand(arg)
 	case "/memory":
-		if arg == "" {
-			fmt.Println("Usage: /memory <text to remember>")
+		handleMemoryCommand(arg)
+	case "/snippet":
+		if msg := a.snippetCommand(arg); msg != "" {
+			a.paused = false
+			a.addUserMessage(a.expandFileRefs(msg))
+		}
+	case "/conventions":
+		resetConventions()
+		if c := loadConventions(); c != "" {
+			fmt.Print(c)
 		} else {
-			if err := appendMemory(arg); err != nil {
-				fmt.Fprintf(os.Stderr, "Error saving memory: %v\n", err)
+			fmt.Println("No project conventions detected.")
+		}
+	case "/prompt-diff":
+		a.promptDiff(arg)
+	case "/init":
+		if a.mode == ModePlan {
+			a.mode = ModeAction
+			fmt.Println("Switched to ACTION mode.")
+		}
+		a.session.Append(Message{Role: "user", Content: initPrompt})
+	case "/suggest-agent":
+		prompt := suggestAgentPrompt()
+		if prompt == "" {
+			if !a.cfg.TrackPrompts {
+				fmt.Println("No prompt history. Enable it with \"track_prompts\": true in config.json.")
 			} else {
-				fmt.Println("Memory saved.")
+				fmt.Println("No recurring prompts yet.")
 			}
+		} else {
+			a.session.Append(Message{Role: "user", Content: prompt})
+		}
+	case "/dryrun":
+		if a.tools.DryRun == nil {
+			a.tools.DryRun = NewDryRun()
+			fmt.Println("Dry-run ON: file changes are staged. /apply to write them, /discard to drop them.")
+		} else if n := a.tools.DryRun.Pending(); n > 0 {
+			fmt.Printf("%d staged change(s) pending — /apply or /discard first.\n", n)
+		} else {
+			a.tools.DryRun = nil
+			fmt.Println("Dry-run OFF.")
+		}
+	case "/apply":
+		if a.tools.DryRun == nil || a.tools.DryRun.Pending() == 0 {
+			fmt.Println("No staged changes.")
+		} else {
+			for _, line := range a.tools.DryRun.Apply() {
+				fmt.Println("  " + line)
+			}
+		}
+	case "/discard":
+		if a.tools.DryRun == nil || a.tools.DryRun.Pending() == 0 {
+			fmt.Println("No staged changes.")
+		} else {
+			for _, line := range a.tools.DryRun.Summary() {
+				fmt.Println("  dropped " + line)
+			}
+			a.tools.DryRun.Discard()
+		}
+	case "/continue":
+		if !a.paused {
+			fmt.Println("Nothing to continue.")
+		} else {
+			a.paused = false
+			// Interrupted mid-reply: the transcript ends with the assistant, so ask it to go on
+			if last := a.session.Messages[len(a.session.Messages)-1]; last.Role == "assistant" {
+				a.session.Append(Message{Role: "user", Content: "Continue."})
+			}
+			a.runAgentLoop()
 		}
 	case "/help":
 		printHelp()
@@ -350,31 +926,6 @@ func (a *Agent) handleSlashCommand(input string) bool {
 	return true
 }
 
-func (a *Agent) compactSession() {
-	fmt.Println("Compacting session...")
-
-	compactPrompt := "Summarize the entire conversation so far into a concise summary that preserves all important context, decisions made, code changes, and current state. This summary will replace the conversation history."
-
-	a.session.Messages = append(a.session.Messages, Message{Role: "user", Content: compactPrompt})
-
-	ctx := context.Background()
-	ch, err := a.provider.SendStream(ctx, a.session.Messages, nil, a.systemPrompt())
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		return
-	}
-
-	msg, _ := a.consumeStream(ch)
-
-	// Replace history with summary
-	a.session.Messages = []Message{
-		{Role: "user", Content: "Previous conversation summary:"},
-		{Role: "assistant", Content: msg.Content},
-	}
-	a.session.Save()
-	fmt.Println("\nSession compacted.")
-}
-
 func printHelp() {
 	fmt.Println(`Commands:
   /plan          Switch to plan mode (read-only)
@@ -382,15 +933,38 @@ func printHelp() {
   /new           Start a new session
   /rename <name> Name the current session
   /sessions      List all sessions
-  /compact       Compress conversation history
+  /history <sub>  search <terms>: find past sessions by message text
+  /tools         List tools and their status
+  /stats [--days N] Token, cost, tool and turn statistics
+  /compact       Fold all but the latest exchange into the session summary
+  /rewind [n]    Drop the last n exchanges; /rewind restore undoes it
+  /redo          Edit your last message in $EDITOR and resend it
+  /editor        Write a message in $EDITOR and send it (also Ctrl+X Ctrl+E)
+  /config        Show effective settings and where each comes from; edit them
   /model <name>  Switch model
   /provider <n>  Switch provider
+  /copy [code]   Copy the last reply, or its last code block, to the clipboard
+  /save-code [n] <path> Write the reply's nth code block (default last) to a file
+  /commit [hint] Commit staged (or all) changes with a generated message
+  /pr [hint]     Push the branch and open a pull request with a generated description
   /memory <text> Save a note to memory
+  /memory <sub>  show, search <terms>, forget <n|date>, edit
+  /snippet <sub> list, save <name> [text], use <name>, show, edit, delete
+  /init          Generate AGENTS.md for this project
+  /conventions   Re-detect and show project conventions
+  /prompt-diff   System prompt versions this session; diff [N [M]]
+  /suggest-agent Propose an .agent file from recurring prompts
+  /dryrun        Toggle dry-run (stage file changes as diffs)
+  /apply         Write all staged dry-run changes
+  /discard       Drop all staged dry-run changes
+  /continue      Resume after an interrupt or the max_turns pause
   /help          Show this help
   /exit          Quit
 
+Listings (/sessions, /tools, /history search, /stats) accept --json.
+
 Keys:
   Shift+Tab      Toggle plan/action mode
-  Ctrl+C         Interrupt streaming or exit
+  Ctrl+C         Stop the current turn, or exit at the prompt
   Ctrl+D         Exit`)
 }
@@ -1,23 +1,38 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
 	"os"
+	"regexp"
 	"strings"
+
+	"gopkg.in/yaml.v3"
 )
 
 // AgentFile represents a parsed .agent file.
-// Format: optional --- delimited frontmatter with key: value pairs, body = system prompt.
+// Format: optional --- delimited YAML frontmatter, body = system prompt.
 type AgentFile struct {
 	Path        string
 	Description string
 	Deny        []string
 	Allow       []string
+	Commands    CommandPolicy             // deny_commands, allow_commands, confirm_commands
+	HTTP        HTTPPolicy                // tools.http
+	Permissions map[string]ToolPermission // tools.permissions
+	Paths       PathPolicy                // paths_allow, paths_deny
 	Model       string
 	Provider    string
 	URL         string
-	Prompt      string
+	Providers   map[string]ProviderConfig // per-provider model/url, without keys
+	Env         map[string]string         // set for the agent's tools
+	Prompt      string                    // body without skill sections
+	Skills      []Skill                   // "# skill: Name" sections, loaded on demand
 }
 
+// frontmatterEnd is the closing --- line.
+var frontmatterEnd = regexp.MustCompile(`(?m)^---[ \t]*$`)
+
 // ParseAgentFile reads and parses an .agent file.
 // Frontmatter (between --- lines) contains key: value pairs.
 // Everything after frontmatter is the system prompt.
@@ -44,12 +59,15 @@ func ParseAgentFile(path string) (*AgentFile, error) {
 		start := strings.Index(content, "---")
 		rest := content[start+3:]
 
-		// Find closing ---
-		end := strings.Index(rest, "---")
-		if end >= 0 {
-			frontmatter := rest[:end]
-			af.Prompt = strings.TrimSpace(rest[end+3:])
-			parseFrontmatter(frontmatter, af)
+		// Find closing --- on a line of its own
+		if loc := frontmatterEnd.FindStringIndex(rest); loc != nil {
+			frontmatter := rest[:loc[0]]
+			af.Prompt = strings.TrimSpace(rest[loc[1]:])
+			if err := parseYAMLFrontmatter(frontmatter, af); err != nil {
+				// Older flat headers aren't always valid YAML ("description: a: b")
+				parseFrontmatter(frontmatter, af)
+			}
+			warnCommandPolicy(af.Path, af.Commands)
 		} else {
 			// No closing ---, treat entire file as prompt
 			af.Prompt = strings.TrimSpace(content)
@@ -57,10 +75,116 @@ func ParseAgentFile(path string) (*AgentFile, error) {
 	} else {
 		af.Prompt = strings.TrimSpace(content)
 	}
+	af.Prompt, af.Skills = splitSkills(af.Prompt)
 
 	return af, nil
 }
 
+// csvList is a list field written as a YAML list or, as in the original flat
+// format, a comma-separated string.
+type csvList []string
+
+func (l *csvList) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		*l = splitCSV(n.Value)
+		return nil
+	}
+	var items []string
+	if err := n.Decode(&items); err != nil {
+		return err
+	}
+	*l = items
+	return nil
+}
+
+type commandLists struct {
+	Deny    csvList `yaml:"deny"`
+	Allow   csvList `yaml:"allow"`
+	Confirm csvList `yaml:"confirm"`
+}
+
+// agentFrontmatter is the YAML header. The flat keys are the original
+// format; tools, providers, and env are nested.
+type agentFrontmatter struct {
+	Description     string  `yaml:"description"`
+	Deny            csvList `yaml:"deny"`
+	Allow           csvList `yaml:"allow"`
+	DenyCommands    csvList `yaml:"deny_commands"`
+	AllowCommands   csvList `yaml:"allow_commands"`
+	ConfirmCommands csvList `yaml:"confirm_commands"`
+	PathsAllow      csvList `yaml:"paths_allow"`
+	PathsDeny       csvList `yaml:"paths_deny"`
+	Model           string  `yaml:"model"`
+	Provider        string  `yaml:"provider"`
+	URL             string  `yaml:"url"`
+	Tools           struct {
+		Deny     csvList      `yaml:"deny"`
+		Allow    csvList      `yaml:"allow"`
+		Commands commandLists `yaml:"commands"`
+		HTTP     struct {
+			Allow csvList `yaml:"allow"`
+			Deny  csvList `yaml:"deny"`
+		} `yaml:"http"`
+		Paths struct {
+			Allow csvList `yaml:"allow"`
+			Deny  csvList `yaml:"deny"`
+		} `yaml:"paths"`
+		Permissions map[string]ToolPermission `yaml:"permissions"`
+	} `yaml:"tools"`
+	Providers map[string]struct {
+		Model  string `yaml:"model"`
+		URL    string `yaml:"url"`
+		APIKey string `yaml:"api_key"`
+	} `yaml:"providers"`
+	Env map[string]string `yaml:"env"`
+}
+
+func parseYAMLFrontmatter(fm string, af *AgentFile) error {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(fm), &doc); err != nil {
+		return err
+	}
+	interpolateYAML(af.Path, &doc)
+	var h agentFrontmatter
+	if len(doc.Content) > 0 {
+		if err := doc.Decode(&h); err != nil {
+			return err
+		}
+	}
+	af.Description = strings.TrimSpace(h.Description)
+	af.Deny = append(h.Deny, h.Tools.Deny...)
+	af.Allow = append(h.Allow, h.Tools.Allow...)
+	af.Commands = CommandPolicy{
+		Deny:    append(h.DenyCommands, h.Tools.Commands.Deny...),
+		Allow:   append(h.AllowCommands, h.Tools.Commands.Allow...),
+		Confirm: append(h.ConfirmCommands, h.Tools.Commands.Confirm...),
+	}
+	af.HTTP = HTTPPolicy{Allow: h.Tools.HTTP.Allow, Deny: h.Tools.HTTP.Deny}
+	af.Paths = PathPolicy{
+		Allow: append(h.PathsAllow, h.Tools.Paths.Allow...),
+		Deny:  append(h.PathsDeny, h.Tools.Paths.Deny...),
+	}
+	af.Permissions = h.Tools.Permissions
+	for name, p := range af.Permissions {
+		if problem := p.problem(); problem != "" {
+			fmt.Fprintf(os.Stderr, "Warning: %s: tools.permissions.%s: %s; calls to it are blocked\n", af.Path, name, problem)
+		}
+	}
+	af.Model, af.Provider, af.URL = h.Model, h.Provider, h.URL
+	for name, p := range h.Providers {
+		if p.APIKey != "" {
+			fmt.Fprintf(os.Stderr, "Warning: %s: api_key ignored for %s; keys belong in config or the environment\n", af.Path, name)
+		}
+		if af.Providers == nil {
+			af.Providers = make(map[string]ProviderConfig)
+		}
+		af.Providers[name] = ProviderConfig{Model: p.Model, URL: p.URL}
+	}
+	af.Env = h.Env
+	return nil
+}
+
+// parseFrontmatter reads the original flat format, one key: value per line.
 func parseFrontmatter(fm string, af *AgentFile) {
 	for _, line := range strings.Split(fm, "\n") {
 		line = strings.TrimSpace(line)
@@ -74,7 +198,8 @@ func parseFrontmatter(fm string, af *AgentFile) {
 		}
 
 		key := strings.TrimSpace(line[:idx])
-		val := strings.TrimSpace(line[idx+1:])
+		val, problems := interpolate(strings.TrimSpace(line[idx+1:]))
+		warnInterpolation(af.Path, problems)
 
 		switch key {
 		case "description":
@@ -83,6 +208,16 @@ func parseFrontmatter(fm string, af *AgentFile) {
 			af.Deny = splitCSV(val)
 		case "allow":
 			af.Allow = splitCSV(val)
+		case "deny_commands":
+			af.Commands.Deny = splitCSV(val)
+		case "allow_commands":
+			af.Commands.Allow = splitCSV(val)
+		case "confirm_commands":
+			af.Commands.Confirm = splitCSV(val)
+		case "paths_allow":
+			af.Paths.Allow = splitCSV(val)
+		case "paths_deny":
+			af.Paths.Deny = splitCSV(val)
 		case "model":
 			af.Model = val
 		case "provider":
@@ -108,32 +243,61 @@ func splitCSV(s string) []string {
 	return result
 }
 
+// ApplyEnv sets the agent's env variables for this process, so the tools it
+// runs (bash, start_process, plugins) inherit them.
+func (af *AgentFile) ApplyEnv() {
+	for k, v := range af.Env {
+		os.Setenv(k, v)
+	}
+}
+
 // ToolsConfig returns a ToolsConfig from the agent file's deny/allow fields.
 func (af *AgentFile) ToolsConfig() ToolsConfig {
 	return ToolsConfig{
-		Deny:  af.Deny,
-		Allow: af.Allow,
+		Deny:     af.Deny,
+		Allow:    af.Allow,
+		Commands: af.Commands,
 	}
 }
 
-// BuilderPrompt returns a system prompt for creating new .agent files.
-func BuilderPrompt(target string) (agentFile *AgentFile, firstMsg string) {
-	prompt := `You help create .agent files through conversation. The format:
-
-` + "```" + `
+// agentFileFormat is the .agent file reference shown to the model when it writes one.
+const agentFileFormat = "```" + `
 #!/usr/bin/env simpleagent
 ---
 description: One-line description
 deny: tool1, tool2
 allow: tool1, tool2
+deny_commands: git push --force, re:curl.*\|\s*sh
+confirm_commands: rm -rf, git reset --hard
+paths_allow: docs/**, README.md
+paths_deny: docs/generated/
 model: model-name
 provider: provider-name
 url: custom-endpoint-url
+tools:
+  http:
+    allow: [api.github.com]
+  permissions:
+    bash: ask
+    write_file: {policy: allow, paths: [./generated/]}
+providers:
+  ollama: {model: qwen2.5-coder:14b}
+env:
+  KUBECONFIG: ~/.kube/staging
 ---
 
 System prompt goes here.
-Skills are markdown sections (# skill: Name).
-` + "```" + `
+
+# skill: Name
+One-line summary (shown in the prompt; the rest loads on demand).
+Detailed steps...
+` + "```"
+
+// BuilderPrompt returns a system prompt for creating new .agent files.
+func BuilderPrompt(target string) (agentFile *AgentFile, firstMsg string) {
+	prompt := `You help create .agent files through conversation. The format:
+
+` + agentFileFormat + `
 
 All header fields are optional. The body is what makes the agent — clear instructions the LLM follows.
 
@@ -144,7 +308,7 @@ WORKFLOW:
 2. Ask about specific skills, tools it needs, and any restrictions (deny/allow).
 3. Ask ONE question at a time. Keep it conversational.
 4. Do NOT generate the file until the user indicates they're ready (e.g. "done", "that's it", "looks good", "go ahead", "create it").
-5. When ready, write the file with write_file. Then ask if they want any changes.
+5. When ready, write the file with write_file. The user sees a preview and must confirm; if they decline, ask what to change. Then ask if they want any changes.
 6. If they request changes, apply them with edit_file and ask again.
 
 Be concise in your questions. Don't overwhelm with options — ask naturally.`
@@ -183,3 +347,53 @@ Be concise. One question at a time.`
 	firstMsg = "Review this agent file and ask what I'd like to change."
 	return af, firstMsg
 }
+
+// previewAgentWrite wraps write_file for --new: .agent files are shown in full
+// and written only after the user confirms (or edits them in $EDITOR).
+// Other paths pass straight through to the normal handler.
+func (a *Agent) previewAgentWrite(next ToolHandler) ToolHandler {
+	return func(args json.RawMessage) (string, error) {
+		var params struct {
+			Path    string `json:"path"`
+			Content string `json:"content"`
+			Mode    string `json:"mode"`
+		}
+		if err := json.Unmarshal(args, &params); err != nil {
+			return "", err
+		}
+		// Only whole-file writes are previewed; parts go straight through.
+		if !strings.HasSuffix(params.Path, ".agent") || (params.Mode != "" && params.Mode != "overwrite") {
+			return next(args)
+		}
+
+		content := params.Content
+		for {
+			fmt.Printf("\n\033[1mProposed %s:\033[0m\n", params.Path)
+			renderMarkdown("```markdown\n" + content + "\n```")
+			fmt.Print("Write this file? [y]es / [n]o / [e]dit: ")
+
+			line, err := a.readLineSimple()
+			if err != nil {
+				return "user did not confirm; file not written", nil
+			}
+			switch strings.ToLower(strings.TrimSpace(line)) {
+			case "y", "yes":
+				args, _ = json.Marshal(map[string]string{"path": params.Path, "content": content})
+				result, err := next(args)
+				if err == nil && content != params.Content {
+					result += " (user edited the content before writing; read the file before further edits)"
+				}
+				return result, err
+			case "e", "edit":
+				edited, err := openInEditor(content, ".agent")
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					continue
+				}
+				content = edited
+			default:
+				return "user declined to write the file; ask what they want changed", nil
+			}
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// AgentEntry is an .agent file found in one of the agent directories.
+type AgentEntry struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Path        string `json:"path"`
+	Scope       string `json:"scope"` // "project" or "user"
+}
+
+// agentSearchDirs are searched by agent name, project first so ./agents/
+// can override ~/.simpleagent/agents/.
+func agentSearchDirs() []AgentEntry {
+	dirs := []AgentEntry{{Path: "agents", Scope: "project"}}
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, AgentEntry{Path: filepath.Join(home, ".simpleagent", "agents"), Scope: "user"})
+	}
+	return dirs
+}
+
+// discoverAgents lists every named agent, sorted by name. A project agent
+// hides a user agent of the same name.
+func discoverAgents() []AgentEntry {
+	seen := make(map[string]bool)
+	var agents []AgentEntry
+	for _, dir := range agentSearchDirs() {
+		paths, _ := filepath.Glob(filepath.Join(dir.Path, "*.agent"))
+		for _, path := range paths {
+			name := strings.TrimSuffix(filepath.Base(path), ".agent")
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			e := AgentEntry{Name: name, Path: path, Scope: dir.Scope}
+			if af, err := ParseAgentFile(path); err == nil {
+				e.Description = af.Description
+			}
+			agents = append(agents, e)
+		}
+	}
+	sort.Slice(agents, func(i, j int) bool { return agents[i].Name < agents[j].Name })
+	return agents
+}
+
+// resolveAgent finds the .agent file for a name ("reviewer" or
+// "reviewer.agent"), or returns "" if no agent directory has it.
+func resolveAgent(name string) string {
+	if name == "" || strings.ContainsRune(name, filepath.Separator) {
+		return ""
+	}
+	name = strings.TrimSuffix(name, ".agent")
+	for _, dir := range agentSearchDirs() {
+		path := filepath.Join(dir.Path, name+".agent")
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+	}
+	return ""
+}
+
+// listAgents prints the discovered agents (--list-agents).
+func listAgents(asJSON bool) {
+	agents := discoverAgents()
+	if asJSON {
+		if agents == nil {
+			agents = []AgentEntry{}
+		}
+		printJSON(agents)
+		return
+	}
+	if len(agents) == 0 {
+		fmt.Println("No agents found. Put .agent files in ./agents/ or ~/.simpleagent/agents/.")
+		return
+	}
+	for _, e := range agents {
+		desc := e.Description
+		if desc == "" {
+			desc = "(no description)"
+		}
+		path := e.Path
+		if !plainOutput {
+			path = "\033[2m" + path + "\033[0m"
+		}
+		fmt.Printf("  %-20s %s  %s\n", e.Name, desc, path)
+	}
+	fmt.Println("\nRun one with: simpleagent <name> [prompt]")
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/term"
+)
+
+// writeFileAtomic writes a temp file in path's directory, syncs it and
+// renames it over path, so a crash, a power loss or a reader in another
+// process never sees a partial or empty file. The temp name is unique, so
+// concurrent writers (serve) don't share one.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Chmod(perm)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	// Make the rename itself durable; not possible on every platform
+	if dir, err := os.Open(filepath.Dir(path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	return nil
+}
+
+// writeWithBackup replaces a JSON file atomically, first copying the current
+// version to path.bak. A current file that doesn't parse is not copied, so a
+// corrupt file never replaces a good backup.
+func writeWithBackup(path string, data []byte, perm os.FileMode) error {
+	if old, err := os.ReadFile(path); err == nil && json.Valid(old) {
+		writeFileAtomic(path+".bak", old, perm)
+	}
+	return writeFileAtomic(path, data, perm)
+}
+
+var (
+	backupMu     sync.Mutex
+	backupWarned = map[string]bool{} // paths already reported this run
+)
+
+// loadBackup is called when the JSON file at path (described by what, e.g.
+// "config") fails to parse with cause. It offers path.bak instead: on a
+// terminal the user can restore it, keeping the broken file as
+// path.corrupt; otherwise the backup is read instead, with a warning, and
+// the file is left for the next save to replace.
+// Returns the backup's content, or false when there is no usable backup or
+// the user declines.
+func loadBackup(path, what string, cause error) ([]byte, bool) {
+	backupMu.Lock()
+	defer backupMu.Unlock()
+	bak, err := os.ReadFile(path + ".bak")
+	if err != nil || !json.Valid(bak) {
+		if !backupWarned[path] {
+			backupWarned[path] = true
+			fmt.Fprintf(os.Stderr, "Warning: %s %s is corrupt (%v) and has no usable backup\n", what, path, cause)
+		}
+		return nil, false
+	}
+	saved := ""
+	if info, err := os.Stat(path + ".bak"); err == nil {
+		saved = ", saved " + info.ModTime().Format("2006-01-02 15:04")
+	}
+
+	if term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd())) {
+		fmt.Printf("\033[33m? %s %s is corrupt (%v).\n  Restore the previous version from %s.bak%s? [Y/n]: \033[0m", what, path, cause, path, saved)
+		answer := strings.ToLower(strings.TrimSpace(readStdinLine()))
+		if answer != "" && answer != "y" && answer != "yes" {
+			return nil, false
+		}
+		perm := os.FileMode(0644)
+		if info, err := os.Stat(path); err == nil {
+			perm = info.Mode().Perm()
+		}
+		os.Rename(path, path+".corrupt")
+		if err := writeFileAtomic(path, bak, perm); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: restoring %s: %v (using the backup for this run)\n", path, err)
+		} else {
+			fmt.Printf("Restored %s; the corrupt version is %s.corrupt\n", path, path)
+		}
+		return bak, true
+	}
+
+	if !backupWarned[path] {
+		backupWarned[path] = true
+		fmt.Fprintf(os.Stderr, "Warning: %s %s is corrupt (%v); using %s.bak%s instead\n", what, path, cause, path, saved)
+	}
+	return bak, true
+}
+
+// readStdinLine reads one line a byte at a time, so nothing after it is
+// buffered away from the prompt that reads stdin next.
+func readStdinLine() string {
+	var buf []byte
+	b := make([]byte, 1)
+	for {
+		n, err := os.Stdin.Read(b)
+		if err != nil || n == 0 || b[0] == '\n' {
+			return string(buf)
+		}
+		if b[0] != '\r' {
+			buf = append(buf, b[0])
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// clipboardMaxRead caps what clipboard_read hands the model.
+const clipboardMaxRead = 100 * 1024
+
+// clipboardCommands are the programs tried in order to copy (write) and
+// paste (read) on this OS. Wayland's tools come first on Linux when a
+// Wayland session is running.
+func clipboardCommands(write bool) [][]string {
+	switch runtime.GOOS {
+	case "darwin":
+		if write {
+			return [][]string{{"pbcopy"}}
+		}
+		return [][]string{{"pbpaste"}}
+	case "windows":
+		if write {
+			return [][]string{{"powershell", "-NoProfile", "-Command", "[Console]::In.ReadToEnd() | Set-Clipboard"}}
+		}
+		return [][]string{{"powershell", "-NoProfile", "-Command", "Get-Clipboard -Raw"}}
+	}
+	var cmds [][]string
+	if write {
+		if os.Getenv("WAYLAND_DISPLAY") != "" {
+			cmds = append(cmds, []string{"wl-copy"})
+		}
+		return append(cmds, []string{"xclip", "-selection", "clipboard"}, []string{"xsel", "--clipboard", "--input"})
+	}
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		cmds = append(cmds, []string{"wl-paste", "--no-newline"})
+	}
+	return append(cmds, []string{"xclip", "-selection", "clipboard", "-o"}, []string{"xsel", "--clipboard", "--output"})
+}
+
+// copyToClipboard puts text on the system clipboard and says how. Without a
+// clipboard program it falls back to the OSC 52 escape, which most terminals
+// (also over SSH) turn into a copy.
+func copyToClipboard(text string) (string, error) {
+	var errs []string
+	for _, argv := range clipboardCommands(true) {
+		if _, err := exec.LookPath(argv[0]); err != nil {
+			continue
+		}
+		cmd := exec.Command(argv[0], argv[1:]...)
+		cmd.Stdin = strings.NewReader(text)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v %s", argv[0], err, strings.TrimSpace(string(out))))
+			continue
+		}
+		return argv[0], nil
+	}
+	if term.IsTerminal(int(os.Stdout.Fd())) {
+		fmt.Printf("\033]52;c;%s\a", base64.StdEncoding.EncodeToString([]byte(text)))
+		return "terminal (OSC 52)", nil
+	}
+	if len(errs) > 0 {
+		return "", errors.New(strings.Join(errs, "; "))
+	}
+	return "", errors.New("no clipboard program found (install wl-clipboard, xclip or xsel)")
+}
+
+// readClipboard returns the system clipboard's text.
+func readClipboard() (string, error) {
+	var errs []string
+	for _, argv := range clipboardCommands(false) {
+		if _, err := exec.LookPath(argv[0]); err != nil {
+			continue
+		}
+		var stdout, stderr bytes.Buffer
+		cmd := exec.Command(argv[0], argv[1:]...)
+		cmd.Stdout, cmd.Stderr = &stdout, &stderr
+		if err := cmd.Run(); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v %s", argv[0], err, strings.TrimSpace(stderr.String())))
+			continue
+		}
+		return stdout.String(), nil
+	}
+	if len(errs) > 0 {
+		return "", errors.New(strings.Join(errs, "; "))
+	}
+	return "", errors.New("no clipboard program found (install wl-clipboard, xclip or xsel)")
+}
+
+// registerClipboardTools adds clipboard_read, which only exists when config
+// turns it on ("tools": {"clipboard": true}): the clipboard often holds
+// things the user never meant to share.
+func registerClipboardTools(r *ToolRegistry) {
+	r.Register(ToolDef{
+		Name:        "clipboard_read",
+		Description: "Read the text on the user's clipboard, e.g. when they say they copied an error, a snippet or a URL.",
+		Parameters: map[string]any{
+			"type":       "object",
+			"properties": map[string]any{},
+		},
+	}, toolClipboardRead, false)
+}
+
+func toolClipboardRead(args json.RawMessage) (string, error) {
+	text, err := readClipboard()
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(text) == "" {
+		return "(clipboard is empty)", nil
+	}
+	if len(text) > clipboardMaxRead {
+		text = text[:clipboardMaxRead] + fmt.Sprintf("\n... (truncated, %d bytes total)", len(text))
+	}
+	return text, nil
+}
+
+// copyCommand handles /copy: the last reply, or with "code" its last code
+// block (the latest reply that has one).
+func (a *Agent) copyCommand(arg string) {
+	if arg != "" && arg != "code" {
+		fmt.Println("Usage: /copy [code]")
+		return
+	}
+	msgs := a.session.Messages
+	for i := len(msgs) - 1; i >= 0; i-- {
+		m := msgs[i]
+		if m.Role != "assistant" || strings.TrimSpace(m.Content) == "" {
+			continue
+		}
+		text, what := strings.TrimSpace(m.Content), "last reply"
+		if arg == "code" {
+			blocks := codeBlocks(m.Content)
+			if len(blocks) == 0 {
+				continue
+			}
+			text, what = blocks[len(blocks)-1].Code, "last code block"
+		}
+		via, err := copyToClipboard(text)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: copy failed: %v\n", err)
+			return
+		}
+		fmt.Printf("Copied %s (%d lines) via %s.\n", what, lineCount(text), via)
+		return
+	}
+	if arg == "code" {
+		fmt.Println("No code block to copy.")
+	} else {
+		fmt.Println("No reply to copy.")
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// codeBlock is one fenced block of a reply.
+type codeBlock struct {
+	Lang string // info string after the fence, "" when none
+	Code string
+}
+
+// codeBlocks returns the fenced (``` or ~~~) blocks of a reply in order. An
+// unclosed block at the end is left out: the reply was cut off.
+func codeBlocks(text string) []codeBlock {
+	var blocks []codeBlock
+	var lines []string
+	var lang, fence string
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case fence == "" && (strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~")):
+			fence = trimmed[:3]
+			lang = strings.TrimSpace(strings.TrimLeft(trimmed, fence[:1]))
+			lines = nil
+		case fence != "" && strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "":
+			blocks = append(blocks, codeBlock{Lang: lang, Code: strings.Join(lines, "\n")})
+			fence = ""
+		case fence != "":
+			lines = append(lines, line)
+		}
+	}
+	return blocks
+}
+
+// lineCount is the number of lines in s, for listings.
+func lineCount(s string) int {
+	return strings.Count(strings.TrimSuffix(s, "\n"), "\n") + 1
+}
+
+// saveCodeCommand handles /save-code [n] <path>: writes the nth code block
+// of the latest reply that has any (the last one without n) to path.
+func (a *Agent) saveCodeCommand(arg string) {
+	fields := strings.Fields(arg)
+	n := 0
+	if len(fields) == 2 {
+		var err error
+		if n, err = strconv.Atoi(fields[0]); err != nil || n < 1 {
+			fmt.Println("Usage: /save-code [n] <path>")
+			return
+		}
+		fields = fields[1:]
+	}
+	if len(fields) != 1 {
+		fmt.Println("Usage: /save-code [n] <path>")
+		return
+	}
+	path := fields[0]
+
+	var blocks []codeBlock
+	msgs := a.session.Messages
+	for i := len(msgs) - 1; i >= 0 && len(blocks) == 0; i-- {
+		if msgs[i].Role == "assistant" {
+			blocks = codeBlocks(msgs[i].Content)
+		}
+	}
+	if len(blocks) == 0 {
+		fmt.Println("No code block to save.")
+		return
+	}
+	if n == 0 {
+		n = len(blocks)
+	}
+	if n > len(blocks) {
+		fmt.Printf("The last reply has %d code block(s).\n", len(blocks))
+		return
+	}
+	code := blocks[n-1].Code
+	if !strings.HasSuffix(code, "\n") {
+		code += "\n"
+	}
+
+	if _, err := os.Stat(path); err == nil && !a.confirm(fmt.Sprintf("%s exists. Overwrite it?", path)) {
+		fmt.Println("Not saved.")
+		return
+	}
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return
+		}
+	}
+	if err := os.WriteFile(path, []byte(code), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return
+	}
+	fmt.Printf("Saved code block %d (%d lines) to %s.\n", n, lineCount(code), path)
+}
+
+// renderCodeBlocks lists a reply's code blocks when it has several, so each
+// can be saved with /save-code instead of copied out of the scrollback.
+func renderCodeBlocks(blocks []codeBlock) {
+	if len(blocks) < 2 {
+		return
+	}
+	var items []string
+	for i, b := range blocks {
+		lang := b.Lang
+		if lang == "" {
+			lang = "text"
+		}
+		lines := lineCount(b.Code)
+		unit := "lines"
+		if lines == 1 {
+			unit = "line"
+		}
+		items = append(items, fmt.Sprintf("%d %s (%d %s)", i+1, lang, lines, unit))
+	}
+	fmt.Printf("\033[2m⧉ %s · /save-code <n> <path>\033[0m\n", strings.Join(items, " · "))
+}
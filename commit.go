@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// commitDiffMax caps how much of the diff the commit model sees.
+const commitDiffMax = 40000
+
+// commitCommand handles /commit [hint]: the commit model (models.commit,
+// else models.title, else the main model) writes a message for the staged
+// changes, or for every change to tracked files when nothing is staged, and
+// after the user accepts or edits it the commit is made. hint is passed on,
+// e.g. "fixes #12".
+func (a *Agent) commitCommand(hint string) {
+	if err := exec.Command("git", "rev-parse", "--git-dir").Run(); err != nil {
+		fmt.Println("Not a git repository.")
+		return
+	}
+	all := false
+	diff, err := gitOutput("diff", "--cached")
+	if err == nil && strings.TrimSpace(diff) == "" {
+		all = true
+		diff, err = gitOutput("diff", "HEAD")
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return
+	}
+	if strings.TrimSpace(diff) == "" {
+		fmt.Println("Nothing to commit.")
+		return
+	}
+	statArgs := []string{"diff", "--cached", "--stat"}
+	if all {
+		statArgs = []string{"diff", "HEAD", "--stat"}
+	}
+	stat, _ := gitOutput(statArgs...)
+
+	cwd, _ := os.Getwd()
+	style := detectCommitStyle(cwd)
+	if style == "" {
+		style = "Conventional Commits: type(scope): subject, with type one of feat, fix, docs, refactor, test, build, ci, chore"
+	}
+	if len(diff) > commitDiffMax {
+		diff = strings.ToValidUTF8(diff[:commitDiffMax], "") + "\n[diff truncated]"
+	}
+	prompt := "Write the commit message for this change.\n" +
+		"Style: " + style + ".\n" +
+		"The subject is at most 72 characters, imperative mood, and says what the change does. " +
+		"The body (may be empty for small changes) explains what and why in a few short lines wrapped at 72 columns; don't list every file.\n"
+	if hint != "" {
+		prompt += "The user adds: " + hint + "\n"
+	}
+	prompt += "\nFiles:\n" + stat + "\nDiff:\n" + a.redactor.Redact(diff)
+
+	var reply struct {
+		Subject string `json:"subject"`
+		Body    string `json:"body"`
+	}
+	schema := jsonObject(map[string]any{
+		"subject": map[string]any{"type": "string"},
+		"body":    map[string]any{"type": "string"},
+	})
+	a.useRole("commit")
+	defer a.useRole(a.modeRole())
+	fmt.Printf("\033[2mWriting a commit message with %s...\033[0m\n", a.llmModel)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	usage, err := completeJSON(ctx, a.llm, prompt, schema, &reply)
+	if usage != nil {
+		a.addUsage(usage)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return
+	}
+	msg := strings.TrimSpace(reply.Subject)
+	if body := strings.TrimSpace(reply.Body); body != "" {
+		msg += "\n\n" + body
+	}
+	if msg == "" {
+		fmt.Fprintln(os.Stderr, "Error: the model returned an empty message")
+		return
+	}
+
+	what := "staged changes"
+	if all {
+		what = "all changes to tracked files"
+	}
+	fmt.Printf("\nCommit %s:\n%s\n", what, strings.TrimRight(stat, "\n"))
+	fmt.Printf("\n\033[1m%s\033[0m\n\n", msg)
+	if a.sink != nil || !term.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Println("Not committed: no terminal to approve the message.")
+		return
+	}
+	fmt.Print("\033[33m? Commit with this message? [y/e(dit)/N]: \033[0m")
+	line, err := a.readLineSimple()
+	if err != nil {
+		return
+	}
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "y", "yes":
+	case "e", "edit":
+		edited, err := openInEditor(msg+"\n", ".txt")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return
+		}
+		if msg = strings.TrimSpace(edited); msg == "" {
+			fmt.Println("Empty message, not committed.")
+			return
+		}
+	default:
+		fmt.Println("Not committed.")
+		return
+	}
+
+	args := []string{"commit", "-F", "-"}
+	if all {
+		args = append(args, "-a")
+	}
+	cmd := exec.Command("git", args...)
+	cmd.Stdin = strings.NewReader(msg + "\n")
+	out, err := cmd.CombinedOutput()
+	fmt.Print(string(out))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: git commit: %v\n", err)
+		return
+	}
+	if !all {
+		return
+	}
+	if untracked, _ := gitOutput("ls-files", "--others", "--exclude-standard"); strings.TrimSpace(untracked) != "" {
+		n := len(strings.Split(strings.TrimSpace(untracked), "\n"))
+		fmt.Printf("\033[2m%d untracked file(s) not included; git add them and /commit again.\033[0m\n", n)
+	}
+}
+
+// gitOutput runs git in the working directory and returns its stdout, with
+// stderr in the error.
+func gitOutput(args ...string) (string, error) {
+	var stderr strings.Builder
+	cmd := exec.Command("git", args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %v %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return string(out), nil
+}
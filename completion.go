@@ -0,0 +1,455 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// subcommand is a first word with its own completion: flags, or a fixed set
+// of words for the next argument.
+type subcommand struct {
+	name  string
+	desc  string
+	flags func() *flag.FlagSet
+	words []string
+}
+
+// subcommands is what completion offers as the first argument, next to
+// agent names and .agent files.
+var subcommands = []subcommand{
+	{name: "serve", desc: "HTTP API (REST + SSE) for an agent", flags: func() *flag.FlagSet { return serveFlags(new(serveOptions)) }},
+	{name: "auth", desc: "Store, remove or show provider credentials", words: []string{"login", "logout", "status"}},
+	{name: "config", desc: "Show the effective config and edit it"},
+	{name: "doctor", desc: "Check config, environment, sessions and provider connectivity", words: []string{"--offline"}},
+	{name: "stats", desc: "Token, cost, tool and turn statistics across sessions", words: []string{"--days", "--json"}},
+	{name: "eval", desc: "Run a YAML suite of prompts against an agent and check assertions", flags: func() *flag.FlagSet { return evalFlags(new(evalOptions)) }},
+	{name: "pipeline", desc: "Run a .pipeline file of agent steps", words: []string{"run"}},
+	{name: "review", desc: "Review a diff and report findings by file, line and severity", flags: func() *flag.FlagSet { return reviewFlags(new(reviewOptions)) }},
+	{name: "docs", desc: "Ingest project documents for the search_docs tool", words: []string{"ingest", "list", "remove"}},
+	{name: "run", desc: "Run a named agent from ./agents/ or ~/.simpleagent/agents/"},
+	{name: "completion", desc: "Print a shell completion script", words: []string{"bash", "zsh", "fish"}},
+}
+
+// flagCompleters names the `__complete` list for flags whose values can be
+// completed. Other value flags complete nothing.
+var flagCompleters = map[string]string{"provider": "providers", "session": "sessions", "replay": "sessions", "profile": "profiles"}
+
+// runCompletion handles `simpleagent completion bash|zsh|fish`. It must run
+// after the top-level flags are defined, since it reads them from
+// flag.CommandLine.
+func runCompletion(args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: simpleagent completion bash|zsh|fish")
+		os.Exit(1)
+	}
+	switch args[0] {
+	case "bash":
+		fmt.Print(bashCompletion())
+	case "zsh":
+		fmt.Print(zshCompletion())
+	case "fish":
+		fmt.Print(fishCompletion())
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown shell %q (bash, zsh, fish)\n", args[0])
+		os.Exit(1)
+	}
+}
+
+// runComplete handles the hidden `simpleagent __complete <list>` the
+// generated scripts call for values that change: one candidate per line.
+func runComplete(args []string) {
+	if len(args) != 1 {
+		return
+	}
+	var out []string
+	switch args[0] {
+	case "providers":
+		out = providerNames
+	case "keyed":
+		out = keyedProviders
+	case "agents":
+		for _, e := range discoverAgents() {
+			out = append(out, e.Name)
+		}
+	case "sessions":
+		out = completeSessions()
+	case "profiles":
+		out = profileNames(fileConfig())
+	}
+	for _, s := range out {
+		fmt.Println(s)
+	}
+}
+
+// fileConfig is the config files alone: no env or profile, which
+// completion has no use for.
+func fileConfig() Config {
+	cfg := DefaultConfig()
+	if home, err := os.UserHomeDir(); err == nil {
+		mergeConfigFile(filepath.Join(home, ".simpleagent", "config.json"), &cfg)
+	}
+	mergeConfigFile(filepath.Join(".simpleagent", "config.json"), &cfg)
+	return cfg
+}
+
+// completeSessions lists session names (IDs for unnamed sessions) across
+// every agent directory in ./.simpleagent/.
+func completeSessions() []string {
+	sessionStorage = fileConfig().Storage
+
+	dirs, _ := filepath.Glob(filepath.Join(".simpleagent", "*", "sessions"))
+	var out []string
+	for _, dir := range dirs {
+		ResolveAgentDir(filepath.Base(filepath.Dir(dir)))
+		entries, _ := store().List()
+		for _, e := range entries {
+			if e.Name != "" {
+				out = append(out, e.Name)
+			} else {
+				out = append(out, e.ID)
+			}
+		}
+	}
+	sort.Strings(out)
+	return slices.Compact(out)
+}
+
+// completeMention lists what an @word typed at the prompt can become (word
+// without the @): snippet names and paths.
+func completeMention(word string) []string {
+	var out []string
+	if !strings.Contains(word, "/") {
+		for _, name := range listSnippets() {
+			if strings.HasPrefix(name, word) {
+				out = append(out, name)
+			}
+		}
+	}
+	out = append(out, completePath(word)...)
+	sort.Strings(out)
+	return slices.Compact(out)
+}
+
+// completePath lists the paths word can become, directories with a trailing
+// slash. Dotfiles are offered only once word's last part starts with a dot.
+func completePath(word string) []string {
+	var out []string
+	dir, base := filepath.Split(word)
+	entries, _ := os.ReadDir(orDefault(dir, "."))
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, base) || (strings.HasPrefix(name, ".") && !strings.HasPrefix(base, ".")) {
+			continue
+		}
+		if info, err := os.Stat(filepath.Join(dir, name)); err == nil && info.IsDir() {
+			name += "/"
+		}
+		out = append(out, dir+name)
+	}
+	return out
+}
+
+// completeShell completes a word of a !command line: the first word from
+// bash's command names (compgen -c), later ones as paths. Without bash,
+// commands complete to nothing.
+func completeShell(word string, command bool) []string {
+	if !command {
+		return completePath(word)
+	}
+	out, err := exec.Command("bash", "-c", `compgen -c -- "$1"`, "compgen", word).Output()
+	if err != nil {
+		return nil
+	}
+	names := strings.Fields(string(out))
+	sort.Strings(names)
+	return slices.Compact(names)
+}
+
+// compFlag is one flag as the scripts spell it.
+type compFlag struct {
+	name     string // with dashes: -m, --model
+	long     string // bare name
+	desc     string
+	value    bool   // takes an argument
+	complete string // flagCompleters entry, if any
+}
+
+func completionFlags(fs *flag.FlagSet) []compFlag {
+	var out []compFlag
+	fs.VisitAll(func(f *flag.Flag) {
+		b, ok := f.Value.(interface{ IsBoolFlag() bool })
+		cf := compFlag{
+			name:     "--" + f.Name,
+			long:     f.Name,
+			desc:     f.Usage,
+			value:    !ok || !b.IsBoolFlag(),
+			complete: flagCompleters[f.Name],
+		}
+		if len(f.Name) == 1 {
+			cf.name = "-" + f.Name
+		}
+		out = append(out, cf)
+	})
+	return out
+}
+
+func flagNames(flags []compFlag) []string {
+	var names []string
+	for _, f := range flags {
+		names = append(names, f.name)
+	}
+	return names
+}
+
+// valueCases is the shell case labels ("--provider|-provider") of the value
+// flags, grouped by completer ("" for none).
+func valueCases(flags []compFlag) map[string][]string {
+	cases := make(map[string][]string)
+	for _, f := range flags {
+		if f.value {
+			cases[f.complete] = append(cases[f.complete], f.name, "-"+strings.TrimLeft(f.name, "-"))
+		}
+	}
+	for k, v := range cases {
+		sort.Strings(v)
+		cases[k] = slices.Compact(v)
+	}
+	return cases
+}
+
+func sortedKeys(m map[string][]string) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func bashCompletion() string {
+	top := completionFlags(flag.CommandLine)
+	var sb strings.Builder
+	sb.WriteString("# bash completion for simpleagent (generated by `simpleagent completion bash`)\n")
+	sb.WriteString("# Load it with: source <(simpleagent completion bash)\n\n")
+	sb.WriteString("_simpleagent() {\n")
+	sb.WriteString("    local IFS=$'\\n'\n")
+	sb.WriteString("    local cur=\"${COMP_WORDS[COMP_CWORD]}\" prev=\"${COMP_WORDS[COMP_CWORD-1]}\" cmd=\"${COMP_WORDS[1]}\"\n")
+	sb.WriteString("    COMPREPLY=()\n\n")
+
+	writeValueCase := func(indent string, flags []compFlag) {
+		cases := valueCases(flags)
+		if len(cases) == 0 {
+			return
+		}
+		fmt.Fprintf(&sb, "%scase \"$prev\" in\n", indent)
+		for _, list := range sortedKeys(cases) {
+			fmt.Fprintf(&sb, "%s    %s)\n", indent, strings.Join(cases[list], "|"))
+			if list != "" {
+				fmt.Fprintf(&sb, "%s        COMPREPLY=($(compgen -W \"$(simpleagent __complete %s 2>/dev/null)\" -- \"$cur\"))\n", indent, list)
+			}
+			fmt.Fprintf(&sb, "%s        return ;;\n", indent)
+		}
+		fmt.Fprintf(&sb, "%sesac\n", indent)
+	}
+
+	sb.WriteString("    case \"$cmd\" in\n")
+	for _, sc := range subcommands {
+		fmt.Fprintf(&sb, "    %s)\n", sc.name)
+		switch {
+		case sc.flags != nil:
+			flags := completionFlags(sc.flags())
+			writeValueCase("        ", flags)
+			fmt.Fprintf(&sb, "        if [[ $cur == -* ]]; then\n")
+			fmt.Fprintf(&sb, "            COMPREPLY=($(compgen -W '%s' -- \"$cur\"))\n", strings.Join(flagNames(flags), "\n"))
+			fmt.Fprintf(&sb, "        else\n")
+			fmt.Fprintf(&sb, "            compopt -o filenames 2>/dev/null\n")
+			fmt.Fprintf(&sb, "            COMPREPLY=($(compgen -f -X '!*.agent' -- \"$cur\") $(compgen -d -- \"$cur\"))\n")
+			fmt.Fprintf(&sb, "        fi\n")
+		case sc.name == "auth":
+			fmt.Fprintf(&sb, "        if [[ $COMP_CWORD -eq 2 ]]; then\n")
+			fmt.Fprintf(&sb, "            COMPREPLY=($(compgen -W '%s' -- \"$cur\"))\n", strings.Join(sc.words, "\n"))
+			fmt.Fprintf(&sb, "        elif [[ $COMP_CWORD -eq 3 && $prev != status ]]; then\n")
+			fmt.Fprintf(&sb, "            COMPREPLY=($(compgen -W \"$(simpleagent __complete keyed 2>/dev/null)\" -- \"$cur\"))\n")
+			fmt.Fprintf(&sb, "        fi\n")
+		case sc.name == "run":
+			fmt.Fprintf(&sb, "        [[ $COMP_CWORD -eq 2 ]] && COMPREPLY=($(compgen -W \"$(simpleagent __complete agents 2>/dev/null)\" -- \"$cur\"))\n")
+		default:
+			fmt.Fprintf(&sb, "        [[ $COMP_CWORD -eq 2 ]] && COMPREPLY=($(compgen -W '%s' -- \"$cur\"))\n", strings.Join(sc.words, "\n"))
+		}
+		sb.WriteString("        return ;;\n")
+	}
+	sb.WriteString("    esac\n\n")
+
+	writeValueCase("    ", top)
+	fmt.Fprintf(&sb, "    if [[ $cur == -* ]]; then\n")
+	fmt.Fprintf(&sb, "        COMPREPLY=($(compgen -W '%s' -- \"$cur\"))\n", strings.Join(flagNames(top), "\n"))
+	fmt.Fprintf(&sb, "        return\n")
+	fmt.Fprintf(&sb, "    fi\n")
+	var names []string
+	for _, sc := range subcommands {
+		names = append(names, sc.name)
+	}
+	fmt.Fprintf(&sb, "    compopt -o filenames 2>/dev/null\n")
+	fmt.Fprintf(&sb, "    COMPREPLY=($(compgen -W \"%s\n$(simpleagent __complete agents 2>/dev/null)\" -- \"$cur\") $(compgen -f -X '!*.agent' -- \"$cur\"))\n", strings.Join(names, "\n"))
+	sb.WriteString("}\n\ncomplete -F _simpleagent simpleagent\n")
+	return sb.String()
+}
+
+// zshQuote quotes s as a single-quoted zsh word.
+func zshQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func zshCompletion() string {
+	top := completionFlags(flag.CommandLine)
+	var sb strings.Builder
+	sb.WriteString("#compdef simpleagent\n")
+	sb.WriteString("# zsh completion for simpleagent (generated by `simpleagent completion zsh`)\n")
+	sb.WriteString("# Save it as _simpleagent in a directory on $fpath, or: source <(simpleagent completion zsh)\n\n")
+
+	writeDescribe := func(indent, array string, flags []compFlag) {
+		fmt.Fprintf(&sb, "%slocal -a %s=(\n", indent, array)
+		for _, f := range flags {
+			fmt.Fprintf(&sb, "%s    %s\n", indent, zshQuote(f.name+":"+f.desc))
+		}
+		fmt.Fprintf(&sb, "%s)\n", indent)
+	}
+	writeValueCase := func(indent string, flags []compFlag) {
+		cases := valueCases(flags)
+		if len(cases) == 0 {
+			return
+		}
+		fmt.Fprintf(&sb, "%scase $prev in\n", indent)
+		for _, list := range sortedKeys(cases) {
+			fmt.Fprintf(&sb, "%s    %s)\n", indent, strings.Join(cases[list], "|"))
+			if list != "" {
+				fmt.Fprintf(&sb, "%s        compadd -- ${(f)\"$(simpleagent __complete %s 2>/dev/null)\"}\n", indent, list)
+			} else {
+				fmt.Fprintf(&sb, "%s        _message 'value'\n", indent)
+			}
+			fmt.Fprintf(&sb, "%s        return ;;\n", indent)
+		}
+		fmt.Fprintf(&sb, "%sesac\n", indent)
+	}
+
+	sb.WriteString("_simpleagent() {\n")
+	sb.WriteString("    local prev=${words[CURRENT-1]} cmd=${words[2]}\n\n")
+	sb.WriteString("    if (( CURRENT > 2 )); then\n")
+	sb.WriteString("        case $cmd in\n")
+	for _, sc := range subcommands {
+		fmt.Fprintf(&sb, "        %s)\n", sc.name)
+		switch {
+		case sc.flags != nil:
+			flags := completionFlags(sc.flags())
+			writeValueCase("            ", flags)
+			writeDescribe("            ", "flags", flags)
+			sb.WriteString("            if [[ $PREFIX == -* ]]; then\n")
+			sb.WriteString("                _describe 'flag' flags\n")
+			sb.WriteString("            else\n")
+			sb.WriteString("                _files -g '*.agent'\n")
+			sb.WriteString("            fi\n")
+		case sc.name == "auth":
+			fmt.Fprintf(&sb, "            if (( CURRENT == 3 )); then\n")
+			fmt.Fprintf(&sb, "                compadd -- %s\n", strings.Join(sc.words, " "))
+			fmt.Fprintf(&sb, "            elif (( CURRENT == 4 )) && [[ $prev != status ]]; then\n")
+			fmt.Fprintf(&sb, "                compadd -- ${(f)\"$(simpleagent __complete keyed 2>/dev/null)\"}\n")
+			fmt.Fprintf(&sb, "            fi\n")
+		case sc.name == "run":
+			fmt.Fprintf(&sb, "            (( CURRENT == 3 )) && compadd -- ${(f)\"$(simpleagent __complete agents 2>/dev/null)\"}\n")
+		default:
+			fmt.Fprintf(&sb, "            (( CURRENT == 3 )) && compadd -- %s\n", strings.Join(sc.words, " "))
+		}
+		sb.WriteString("            return ;;\n")
+	}
+	sb.WriteString("        esac\n")
+	sb.WriteString("    fi\n\n")
+
+	writeValueCase("    ", top)
+	writeDescribe("    ", "flags", top)
+	sb.WriteString("    if [[ $PREFIX == -* ]]; then\n")
+	sb.WriteString("        _describe 'flag' flags\n")
+	sb.WriteString("        return\n")
+	sb.WriteString("    fi\n")
+	sb.WriteString("    local -a cmds=(\n")
+	for _, sc := range subcommands {
+		fmt.Fprintf(&sb, "        %s\n", zshQuote(sc.name+":"+sc.desc))
+	}
+	sb.WriteString("    )\n")
+	sb.WriteString("    _describe 'command' cmds\n")
+	sb.WriteString("    compadd -- ${(f)\"$(simpleagent __complete agents 2>/dev/null)\"}\n")
+	sb.WriteString("    _files -g '*.agent'\n")
+	sb.WriteString("}\n\n")
+	sb.WriteString("if [[ $zsh_eval_context[-1] == loadautofunc ]]; then\n")
+	sb.WriteString("    _simpleagent \"$@\"\n")
+	sb.WriteString("else\n")
+	sb.WriteString("    compdef _simpleagent simpleagent\n")
+	sb.WriteString("fi\n")
+	return sb.String()
+}
+
+// fishQuote quotes s as a single-quoted fish string.
+func fishQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return "'" + strings.ReplaceAll(s, "'", `\'`) + "'"
+}
+
+func fishCompletion() string {
+	var sb strings.Builder
+	sb.WriteString("# fish completion for simpleagent (generated by `simpleagent completion fish`)\n")
+	sb.WriteString("# Save it as ~/.config/fish/completions/simpleagent.fish\n\n")
+	sb.WriteString("complete -c simpleagent -f\n\n")
+
+	var names []string
+	for _, sc := range subcommands {
+		names = append(names, sc.name)
+	}
+	noSub := "not __fish_seen_subcommand_from " + strings.Join(names, " ")
+
+	writeFlags := func(cond string, flags []compFlag) {
+		for _, f := range flags {
+			opt := "-l " + f.long
+			if len(f.long) == 1 {
+				opt = "-s " + f.long
+			}
+			line := fmt.Sprintf("complete -c simpleagent -n %s %s", fishQuote(cond), opt)
+			if f.value {
+				line += " -x"
+				if f.complete != "" {
+					line += fmt.Sprintf(" -a '(simpleagent __complete %s 2>/dev/null)'", f.complete)
+				}
+			}
+			sb.WriteString(line + " -d " + fishQuote(f.desc) + "\n")
+		}
+	}
+
+	writeFlags(noSub, completionFlags(flag.CommandLine))
+	sb.WriteString("\n")
+	for _, sc := range subcommands {
+		fmt.Fprintf(&sb, "complete -c simpleagent -n '__fish_use_subcommand' -a %s -d %s\n", sc.name, fishQuote(sc.desc))
+	}
+	sb.WriteString("complete -c simpleagent -n '__fish_use_subcommand' -a '(simpleagent __complete agents 2>/dev/null)' -d 'Agent'\n")
+	sb.WriteString("complete -c simpleagent -n '__fish_use_subcommand' -a '(__fish_complete_suffix .agent)'\n\n")
+
+	for _, sc := range subcommands {
+		cond := "__fish_seen_subcommand_from " + sc.name
+		switch {
+		case sc.flags != nil:
+			writeFlags(cond, completionFlags(sc.flags()))
+			fmt.Fprintf(&sb, "complete -c simpleagent -n %s -a '(__fish_complete_suffix .agent)'\n", fishQuote(cond))
+		case sc.name == "auth":
+			fmt.Fprintf(&sb, "complete -c simpleagent -n %s -a %s\n", fishQuote(cond+"; and not __fish_seen_subcommand_from "+strings.Join(sc.words, " ")), fishQuote(strings.Join(sc.words, " ")))
+			fmt.Fprintf(&sb, "complete -c simpleagent -n %s -a '(simpleagent __complete keyed 2>/dev/null)'\n", fishQuote(cond+"; and __fish_seen_subcommand_from login logout"))
+		case sc.name == "run":
+			fmt.Fprintf(&sb, "complete -c simpleagent -n %s -a '(simpleagent __complete agents 2>/dev/null)'\n", fishQuote(cond+"; and test (count (commandline -opc)) -eq 2"))
+		default:
+			fmt.Fprintf(&sb, "complete -c simpleagent -n %s -a %s\n", fishQuote(cond+"; and test (count (commandline -opc)) -eq 2"), fishQuote(strings.Join(sc.words, " ")))
+		}
+	}
+	return sb.String()
+}
@@ -2,13 +2,20 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
 )
 
 var agentDir string // .simpleagent/<agent-name>/ — sessions + AGENT.md live here
 
+// configProfile is the --profile flag; set in main before LoadConfig.
+// Empty falls back to SIMPLEAGENT_PROFILE.
+var configProfile string
+
 // ResolveAgentDir sets agentDir in the current working directory.
 // .simpleagent/<agent-name>/ for sessions + AGENT.md.
 // If no agent file, uses "default" as the subdirectory.
@@ -26,19 +33,142 @@ type ProviderConfig struct {
 	APIKey string `json:"api_key,omitempty"`
 	Model  string `json:"model,omitempty"`
 	URL    string `json:"url,omitempty"`
+
+	OAuth *OAuthConfig `json:"oauth,omitempty"` // plan sign-in via --auth (anthropic, openai)
+
+	// Seconds; 0 = default (connect 30, request 300), negative = no limit.
+	// request_timeout is how long a response may go without sending data.
+	ConnectTimeout int `json:"connect_timeout,omitempty"`
+	RequestTimeout int `json:"request_timeout,omitempty"`
+
+	// Corporate networks. HTTPS_PROXY/NO_PROXY apply unless proxy is set
+	// ("none" ignores them); ca_cert is a PEM bundle trusted on top of the
+	// system roots, for proxies that intercept TLS.
+	Proxy              string `json:"proxy,omitempty"`
+	CACert             string `json:"ca_cert,omitempty"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify,omitempty"`
+
+	// Ollama only
+	NumCtx    int    `json:"num_ctx,omitempty"`    // context window to load the model with; 0 = model's length, at most 32k
+	KeepAlive string `json:"keep_alive,omitempty"` // how long the model stays loaded after a request: "30m", "-1" (forever), "0"
+
+	// Mock only
+	Fixture string `json:"fixture,omitempty"` // scripted replies (JSON); empty = echo the last user message
+}
+
+// OAuthConfig sets up --auth for a provider. Only client_id is required; the
+// endpoints and scopes default per provider (see oauthDefaults).
+type OAuthConfig struct {
+	ClientID string   `json:"client_id"`
+	AuthURL  string   `json:"auth_url,omitempty"`
+	TokenURL string   `json:"token_url,omitempty"`
+	Scopes   []string `json:"scopes,omitempty"`
+	Port     int      `json:"port,omitempty"` // loopback callback port; 0 = any free port
 }
 
 type ToolsConfig struct {
-	Deny  []string `json:"deny"`
-	Allow []string `json:"allow"`
+	Deny     []string      `json:"deny"`
+	Allow    []string      `json:"allow"`
+	Commands CommandPolicy `json:"commands,omitempty"`
+	HTTP     HTTPPolicy    `json:"http,omitempty"`
+	// Paths limits where the file and exec tools may read and write
+	Paths PathPolicy `json:"paths,omitempty"`
+	// Permissions sets allow/deny/ask per tool, with optional argument constraints
+	Permissions map[string]ToolPermission `json:"permissions,omitempty"`
+	// FormatOnWrite runs the file's formatter after write_file, edit_file and patch
+	FormatOnWrite bool `json:"format_on_write,omitempty"`
+	// Clipboard adds the clipboard_read tool
+	Clipboard bool `json:"clipboard,omitempty"`
+}
+
+// MemoryConfig controls how AGENT.md entries reach the system prompt.
+type MemoryConfig struct {
+	TopK       int    `json:"top_k"`                     // inject at most this many entries; 0 = all
+	Embeddings string `json:"embeddings,omitempty"`      // "local" (default), "openai", "ollama", "gemini"
+	Model      string `json:"embedding_model,omitempty"` // embedding model for remote backends
+	// Conversation tiers: recent messages verbatim, older ones in a rolling
+	// summary, AGENT.md entries for the long term; each within its budget.
+	Summarize       bool `json:"summarize"`                  // fold messages that leave the recent window into the summary
+	RecentTokens    int  `json:"recent_tokens,omitempty"`    // recent messages sent verbatim; 0 = half the context budget
+	SummaryTokens   int  `json:"summary_tokens,omitempty"`   // rolling summary size; 0 = 2000
+	LongTermTokens  int  `json:"long_term_tokens,omitempty"` // AGENT.md entries in the prompt; 0 = no limit beyond top_k
+	RelevantResults int  `json:"relevant_results,omitempty"` // past tool results sent whole: the N closest to the latest user message; 0 = all
+}
+
+// InputConfig controls the interactive prompt's line editor.
+type InputConfig struct {
+	Keybindings string `json:"keybindings,omitempty"` // "emacs" (default) or "vi"
+}
+
+// NotifyConfig alerts a user who switched away when a long turn ends or
+// the agent needs an answer.
+type NotifyConfig struct {
+	Bell    bool `json:"bell"`          // ring the terminal bell
+	Desktop bool `json:"desktop"`       // OS notification: osascript, notify-send, or BurntToast on Windows
+	After   int  `json:"after_seconds"` // only once the turn has run this long
+}
+
+// SafetyConfig controls the destructive-command check for bash and start_process.
+type SafetyConfig struct {
+	Threshold  int  `json:"threshold"`             // ask before commands scoring this or higher (0-100); 0 = off
+	ModelCheck bool `json:"model_check,omitempty"` // also ask the model to score commands the rules pass
+	// ConfirmDangerous always asks before rm -rf /, mkfs, dd to a device, git reset --hard, DROP TABLE...
+	ConfirmDangerous bool `json:"confirm_dangerous"`
+}
+
+// RedactConfig controls masking of secrets in user input and tool output.
+type RedactConfig struct {
+	Enabled  bool     `json:"enabled"`            // on by default
+	Patterns []string `json:"patterns,omitempty"` // extra regexes; a capture group masks only that part
+}
+
+// OTelConfig enables OTLP/HTTP export of turn, model-call, and tool spans.
+type OTelConfig struct {
+	Endpoint    string            `json:"endpoint,omitempty"`     // collector base URL, e.g. http://localhost:4318; "" = off
+	Headers     map[string]string `json:"headers,omitempty"`      // sent with each export (auth for hosted backends)
+	ServiceName string            `json:"service_name,omitempty"` // resource service.name (default "simpleagent")
+}
+
+// BudgetConfig sets daily soft limits on usage across all sessions, summed
+// from the ledger in ~/.simpleagent/usage/.
+type BudgetConfig struct {
+	DailyTokens int                   `json:"daily_tokens"`        // 0 = no token limit
+	DailyUSD    float64               `json:"daily_usd"`           // 0 = no dollar limit
+	WarnPercent int                   `json:"warn_percent"`        // warn once usage reaches this share of a limit
+	HardStop    bool                  `json:"hard_stop,omitempty"` // pause instead of calling the model past a limit
+	Prices      map[string]ModelPrice `json:"prices,omitempty"`    // USD per million tokens, keyed by model ID substring
 }
 
 type Config struct {
-	Provider    string                    `json:"provider"`
-	Providers   map[string]ProviderConfig `json:"providers"`
-	MaxTokens   int                       `json:"max_tokens"`
-	BashTimeout int                       `json:"bash_timeout"`
-	Tools       ToolsConfig               `json:"tools"`
+	Provider     string                    `json:"provider"`
+	Providers    map[string]ProviderConfig `json:"providers"`
+	MaxTokens    int                       `json:"max_tokens"`
+	BashTimeout  int                       `json:"bash_timeout"`
+	StreamBash   bool                      `json:"stream_bash"` // echo bash output live to the terminal while it runs
+	Logs         bool                      `json:"logs"`        // JSONL log of model calls and tool runs in .simpleagent/<agent>/logs/
+	MaxTurns     int                       `json:"max_turns"`   // LLM calls per user message before pausing; 0 = unlimited
+	Storage      string                    `json:"storage"`     // session store: "json" (default) or "sqlite"
+	AskUser      string                    `json:"ask_user"`    // action-mode ask_user: "options" (default), "always", "never"
+	Tools        ToolsConfig               `json:"tools"`
+	TrackPrompts bool                      `json:"track_prompts,omitempty"` // opt-in prompt history for /suggest-agent
+	Conventions  bool                      `json:"conventions"`             // inject detected project conventions into the system prompt
+	ProjectCtx   bool                      `json:"project_context"`         // inject languages, manifests, test command, git state
+	Transcript   bool                      `json:"transcript,omitempty"`    // keep .simpleagent/<agent>/transcript-<id>.md updated
+	ServeToken   string                    `json:"serve_token,omitempty"`   // bearer token for serve; empty = a new one each start
+	Memory       MemoryConfig              `json:"memory"`
+	Input        InputConfig               `json:"input"`
+	Notify       NotifyConfig              `json:"notify"`
+	Safety       SafetyConfig              `json:"safety"`
+	Budget       BudgetConfig              `json:"budget"`
+	Redact       RedactConfig              `json:"redact"`
+	OTel         OTelConfig                `json:"otel"`
+	Models       ModelRoutes               `json:"models"` // per-task models: compact, title, commit, review, plan, action
+	Forge        ForgeConfig               `json:"forge"`  // GitHub/GitLab access for /pr and create_pr
+
+	// Profiles are named partial configs ("work", "personal", ...) merged
+	// over the files and env when selected with --profile/SIMPLEAGENT_PROFILE.
+	Profiles map[string]json.RawMessage `json:"profiles,omitempty"`
+	Profile  string                     `json:"-"` // the selected profile, if any
 }
 
 func DefaultConfig() Config {
@@ -51,9 +181,22 @@ func DefaultConfig() Config {
 			"gemini":     {Model: "gemini-2.5-flash"},
 			"ollama":     {Model: "qwen2.5-coder:14b", URL: "http://localhost:11434"},
 			"bedrock":    {Model: "anthropic.claude-sonnet-4-20250514-v1:0"},
+			"mock":       {Model: "mock"},
 		},
 		MaxTokens:   8192,
 		BashTimeout: 120,
+		StreamBash:  true,
+		Logs:        true,
+		MaxTurns:    40,
+		Storage:     "json",
+		AskUser:     "options",
+		Conventions: true,
+		ProjectCtx:  true,
+		Memory:      MemoryConfig{TopK: 10, Embeddings: "local", Summarize: true},
+		Notify:      NotifyConfig{After: 30},
+		Safety:      SafetyConfig{Threshold: 60, ConfirmDangerous: true},
+		Budget:      BudgetConfig{WarnPercent: 80},
+		Redact:      RedactConfig{Enabled: true},
 	}
 }
 
@@ -76,6 +219,16 @@ func (c *Config) ApplyAgentFile(af *AgentFile) {
 	if c.Providers == nil {
 		c.Providers = make(map[string]ProviderConfig)
 	}
+	for name, p := range af.Providers {
+		pc := c.Providers[name]
+		if p.Model != "" {
+			pc.Model = p.Model
+		}
+		if p.URL != "" {
+			pc.URL = p.URL
+		}
+		c.Providers[name] = pc
+	}
 	pc := c.Providers[c.Provider]
 	if af.Model != "" {
 		pc.Model = af.Model
@@ -91,20 +244,47 @@ func (c *Config) ApplyAgentFile(af *AgentFile) {
 // 2. ~/.simpleagent/config.json (user-wide)
 // 3. .simpleagent/config.json (project)
 // 4. Environment variables
+// 5. The selected profile
 func LoadConfig() Config {
+	return loadConfig(nil)
+}
+
+// projectConfigPath is the project layer's config file.
+const projectConfigPath = ".simpleagent/config.json"
+
+// loadConfig applies the layers in order. trace, if set, is called after
+// each one with the layer's name and its file ("" for env and profile), so
+// `config` can tell where a value came from. Keys in the OS credential store
+// are not a layer: ProviderKeyCfg reads them when a provider is used.
+func loadConfig(trace func(layer, path string, cfg *Config)) Config {
 	cfg := DefaultConfig()
+	note := func(layer, path string) {
+		if trace != nil {
+			trace(layer, path, &cfg)
+		}
+	}
+	note("default", "")
 
 	// User-wide config
 	if home, err := os.UserHomeDir(); err == nil {
-		mergeConfigFile(filepath.Join(home, ".simpleagent", "config.json"), &cfg)
+		path := filepath.Join(home, ".simpleagent", "config.json")
+		mergeConfigFile(path, &cfg)
+		note("user", path)
 	}
 
 	// Project config (CWD)
-	mergeConfigFile(filepath.Join(".simpleagent", "config.json"), &cfg)
+	mergeConfigFile(filepath.FromSlash(projectConfigPath), &cfg)
+	note("project", filepath.FromSlash(projectConfigPath))
 
 	// Env var overrides
 	applyEnvOverrides(&cfg)
+	note("env", "")
+
+	// Named profile, chosen explicitly, so it wins over the files and env
+	applyProfile(&cfg)
+	note("profile", "")
 
+	warnCommandPolicy("config", cfg.Tools.Commands)
 	return cfg
 }
 
@@ -115,17 +295,63 @@ func mergeConfigFile(path string, cfg *Config) {
 	if err != nil {
 		return
 	}
+	var check any
+	if err := json.Unmarshal(data, &check); err != nil {
+		bak, ok := loadBackup(path, "config", err)
+		if !ok {
+			return
+		}
+		data = bak
+	}
+	data = interpolateJSON(path, data)
 
 	// First, check for and migrate old-format fields
 	migrateOldConfig(data, cfg)
 
+	// Profiles are kept whole; a project profile replaces a user one of the same name
+	var profiles struct {
+		Profiles map[string]json.RawMessage `json:"profiles"`
+	}
+	if json.Unmarshal(data, &profiles) == nil && len(profiles.Profiles) > 0 {
+		if cfg.Profiles == nil {
+			cfg.Profiles = make(map[string]json.RawMessage)
+		}
+		for name, p := range profiles.Profiles {
+			cfg.Profiles[name] = p
+		}
+	}
+
+	mergeConfigJSON(data, cfg)
+}
+
+// mergeConfigJSON deep-merges one config layer (a file or a profile) into cfg.
+func mergeConfigJSON(data []byte, cfg *Config) {
 	// Parse into intermediate struct for deep merge
 	var raw struct {
-		Provider    string                       `json:"provider"`
-		Providers   map[string]json.RawMessage   `json:"providers"`
-		MaxTokens   *int                         `json:"max_tokens"`
-		BashTimeout *int                         `json:"bash_timeout"`
-		Tools       *ToolsConfig                 `json:"tools"`
+		Provider     string                     `json:"provider"`
+		Storage      string                     `json:"storage"`
+		AskUser      string                     `json:"ask_user"`
+		Providers    map[string]json.RawMessage `json:"providers"`
+		MaxTokens    *int                       `json:"max_tokens"`
+		BashTimeout  *int                       `json:"bash_timeout"`
+		StreamBash   *bool                      `json:"stream_bash"`
+		Logs         *bool                      `json:"logs"`
+		MaxTurns     *int                       `json:"max_turns"`
+		Tools        *ToolsConfig               `json:"tools"`
+		TrackPrompts *bool                      `json:"track_prompts"`
+		Conventions  *bool                      `json:"conventions"`
+		ProjectCtx   *bool                      `json:"project_context"`
+		Transcript   *bool                      `json:"transcript"`
+		ServeToken   string                     `json:"serve_token"`
+		Memory       json.RawMessage            `json:"memory"`
+		Input        json.RawMessage            `json:"input"`
+		Notify       json.RawMessage            `json:"notify"`
+		Safety       json.RawMessage            `json:"safety"`
+		Budget       json.RawMessage            `json:"budget"`
+		Redact       json.RawMessage            `json:"redact"`
+		OTel         json.RawMessage            `json:"otel"`
+		Models       json.RawMessage            `json:"models"`
+		Forge        json.RawMessage            `json:"forge"`
 	}
 	if err := json.Unmarshal(data, &raw); err != nil {
 		return
@@ -134,15 +360,72 @@ func mergeConfigFile(path string, cfg *Config) {
 	if raw.Provider != "" {
 		cfg.Provider = raw.Provider
 	}
+	if raw.Storage != "" {
+		cfg.Storage = raw.Storage
+	}
+	if raw.AskUser != "" {
+		cfg.AskUser = raw.AskUser
+	}
 	if raw.MaxTokens != nil {
 		cfg.MaxTokens = *raw.MaxTokens
 	}
 	if raw.BashTimeout != nil {
 		cfg.BashTimeout = *raw.BashTimeout
 	}
+	if raw.StreamBash != nil {
+		cfg.StreamBash = *raw.StreamBash
+	}
+	if raw.Logs != nil {
+		cfg.Logs = *raw.Logs
+	}
+	if raw.MaxTurns != nil {
+		cfg.MaxTurns = *raw.MaxTurns
+	}
 	if raw.Tools != nil {
 		cfg.Tools = *raw.Tools
 	}
+	if raw.TrackPrompts != nil {
+		cfg.TrackPrompts = *raw.TrackPrompts
+	}
+	if raw.Conventions != nil {
+		cfg.Conventions = *raw.Conventions
+	}
+	if raw.ProjectCtx != nil {
+		cfg.ProjectCtx = *raw.ProjectCtx
+	}
+	if raw.Transcript != nil {
+		cfg.Transcript = *raw.Transcript
+	}
+	if raw.ServeToken != "" {
+		cfg.ServeToken = raw.ServeToken
+	}
+	if raw.Memory != nil {
+		json.Unmarshal(raw.Memory, &cfg.Memory) // field-wise: unset keys keep their value
+	}
+	if raw.Input != nil {
+		json.Unmarshal(raw.Input, &cfg.Input)
+	}
+	if raw.Notify != nil {
+		json.Unmarshal(raw.Notify, &cfg.Notify)
+	}
+	if raw.Safety != nil {
+		json.Unmarshal(raw.Safety, &cfg.Safety)
+	}
+	if raw.Budget != nil {
+		json.Unmarshal(raw.Budget, &cfg.Budget)
+	}
+	if raw.Redact != nil {
+		json.Unmarshal(raw.Redact, &cfg.Redact)
+	}
+	if raw.OTel != nil {
+		json.Unmarshal(raw.OTel, &cfg.OTel)
+	}
+	if raw.Models != nil {
+		json.Unmarshal(raw.Models, &cfg.Models)
+	}
+	if raw.Forge != nil {
+		json.Unmarshal(raw.Forge, &cfg.Forge)
+	}
 
 	// Deep-merge each provider entry
 	for name, rawPC := range raw.Providers {
@@ -160,10 +443,71 @@ func mergeConfigFile(path string, cfg *Config) {
 		if pc.URL != "" {
 			existing.URL = pc.URL
 		}
+		if pc.OAuth != nil {
+			existing.OAuth = pc.OAuth
+		}
+		if pc.ConnectTimeout != 0 {
+			existing.ConnectTimeout = pc.ConnectTimeout
+		}
+		if pc.RequestTimeout != 0 {
+			existing.RequestTimeout = pc.RequestTimeout
+		}
+		if pc.Proxy != "" {
+			existing.Proxy = pc.Proxy
+		}
+		if pc.CACert != "" {
+			existing.CACert = pc.CACert
+		}
+		if pc.InsecureSkipVerify {
+			existing.InsecureSkipVerify = true
+		}
+		if pc.NumCtx != 0 {
+			existing.NumCtx = pc.NumCtx
+		}
+		if pc.KeepAlive != "" {
+			existing.KeepAlive = pc.KeepAlive
+		}
+		if pc.Fixture != "" {
+			existing.Fixture = pc.Fixture
+		}
 		cfg.Providers[name] = existing
 	}
 }
 
+// applyProfile merges the profile named by --profile (or SIMPLEAGENT_PROFILE)
+// into cfg. Naming a profile that isn't defined is fatal, rather than quietly
+// running with the wrong account.
+func applyProfile(cfg *Config) {
+	name := configProfile
+	if name == "" {
+		name = os.Getenv("SIMPLEAGENT_PROFILE")
+	}
+	if name == "" {
+		return
+	}
+	data, ok := cfg.Profiles[name]
+	if !ok {
+		have := "none defined"
+		if names := profileNames(*cfg); len(names) > 0 {
+			have = "have: " + strings.Join(names, ", ")
+		}
+		fmt.Fprintf(os.Stderr, "Error: unknown profile %q (%s)\n", name, have)
+		os.Exit(1)
+	}
+	mergeConfigJSON(data, cfg)
+	cfg.Profile = name
+}
+
+// profileNames lists the configured profiles, sorted.
+func profileNames(cfg Config) []string {
+	var names []string
+	for name := range cfg.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // migrateOldConfig maps old flat config fields into the new providers structure.
 func migrateOldConfig(data []byte, cfg *Config) {
 	var old struct {
@@ -227,27 +571,32 @@ func SaveConfig(path string, cfg Config) error {
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(path, data, 0644)
+	perm := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+	return writeWithBackup(path, data, perm)
 }
 
 // providerReady returns true if the active provider has enough config to initialize.
 func providerReady(cfg Config) bool {
-	pc := cfg.ProviderCfg(cfg.Provider)
+	pc := cfg.ProviderKeyCfg(cfg.Provider)
 	switch cfg.Provider {
-	case "ollama", "bedrock":
-		return true // ollama needs no key, bedrock uses AWS SDK
+	case "ollama", "bedrock", "mock":
+		return true // ollama and mock need no key, bedrock uses AWS SDK
 	default:
-		return pc.APIKey != ""
+		return pc.APIKey != "" || hasOAuthToken(cfg.Provider)
 	}
 }
 
 func applyEnvOverrides(cfg *Config) {
 	envMap := map[string]struct{ provider, field string }{
-		"ANTHROPIC_API_KEY":  {"anthropic", "api_key"},
-		"OPENAI_API_KEY":     {"openai", "api_key"},
-		"OPENROUTER_API_KEY": {"openrouter", "api_key"},
-		"GEMINI_API_KEY":     {"gemini", "api_key"},
-		"OLLAMA_HOST":        {"ollama", "url"},
+		"ANTHROPIC_API_KEY":        {"anthropic", "api_key"},
+		"OPENAI_API_KEY":           {"openai", "api_key"},
+		"OPENROUTER_API_KEY":       {"openrouter", "api_key"},
+		"GEMINI_API_KEY":           {"gemini", "api_key"},
+		"OLLAMA_HOST":              {"ollama", "url"},
+		"SIMPLEAGENT_MOCK_FIXTURE": {"mock", "fixture"},
 	}
 	for env, target := range envMap {
 		if v := os.Getenv(env); v != "" {
@@ -257,11 +606,35 @@ func applyEnvOverrides(cfg *Config) {
 				pc.APIKey = v
 			case "url":
 				pc.URL = v
+			case "fixture":
+				pc.Fixture = v
 			}
 			cfg.Providers[target.provider] = pc
 		}
 	}
 
+	// Standard OpenTelemetry variables
+	if v := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); v != "" {
+		cfg.OTel.Endpoint = v
+	}
+	if v := os.Getenv("OTEL_SERVICE_NAME"); v != "" {
+		cfg.OTel.ServiceName = v
+	}
+
+	// Forge tokens, under the names gh and glab use
+	for _, env := range []string{"GITHUB_TOKEN", "GH_TOKEN"} {
+		if v := os.Getenv(env); v != "" {
+			cfg.Forge.GitHubToken = v
+		}
+	}
+	if v := os.Getenv("GITLAB_TOKEN"); v != "" {
+		cfg.Forge.GitLabToken = v
+	}
+
+	if v := os.Getenv("SIMPLEAGENT_SERVE_TOKEN"); v != "" {
+		cfg.ServeToken = v
+	}
+
 	if v := os.Getenv("SIMPLEAGENT_MAX_TOKENS"); v != "" {
 		if n, err := strconv.Atoi(v); err == nil {
 			cfg.MaxTokens = n
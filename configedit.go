@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// flattenJSON adds the leaves of v to out under dotted keys
+// ("providers.anthropic.model"). Arrays are leaves; nulls are skipped, and so
+// are profiles, which `config` lists separately.
+func flattenJSON(prefix string, v any, out map[string]any) {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, child := range v {
+			if prefix == "" && k == "profiles" {
+				continue
+			}
+			key := k
+			if prefix != "" {
+				key = prefix + "." + k
+			}
+			flattenJSON(key, child, out)
+		}
+	case nil:
+	default:
+		out[prefix] = v
+	}
+}
+
+// flattenRaw flattens a JSON document; invalid JSON adds nothing.
+func flattenRaw(data []byte, out map[string]any) {
+	var v any
+	if json.Unmarshal(data, &v) == nil {
+		flattenJSON("", v, out)
+	}
+}
+
+func flattenConfig(cfg Config) map[string]any {
+	data, _ := json.Marshal(cfg)
+	out := make(map[string]any)
+	flattenRaw(data, out)
+	return out
+}
+
+// configReport loads the config and records, for each leaf key, the last
+// layer that set it: changed its value, or (files, profile) named it.
+func configReport() (Config, map[string]string) {
+	src := make(map[string]string)
+	var prev map[string]any
+	cfg := loadConfig(func(layer, path string, cfg *Config) {
+		cur := flattenConfig(*cfg)
+		named := make(map[string]any)
+		if path != "" {
+			if data, err := os.ReadFile(path); err == nil {
+				flattenRaw(data, named)
+			}
+		}
+		if layer == "profile" && cfg.Profile != "" {
+			flattenRaw(cfg.Profiles[cfg.Profile], named)
+			layer = "profile:" + cfg.Profile
+		}
+		for k, v := range cur {
+			_, set := named[k]
+			if prev == nil || set || !reflect.DeepEqual(prev[k], v) {
+				src[k] = layer
+			}
+		}
+		prev = cur
+	})
+	return cfg, src
+}
+
+// secretKey reports whether a config value should be masked when shown.
+func secretKey(key string) bool {
+	return strings.HasSuffix(key, "api_key") || strings.HasSuffix(key, "_token") || strings.HasPrefix(key, "otel.headers.")
+}
+
+// printConfig lists every effective setting with the layer it came from.
+// Settings where effective differs from loaded came from the .agent file or
+// a flag.
+func printConfig(effective, loaded Config, src map[string]string) {
+	cur, base := flattenConfig(effective), flattenConfig(loaded)
+	keys := make([]string, 0, len(cur))
+	width := 0
+	for k := range cur {
+		keys = append(keys, k)
+		width = max(width, len(k))
+	}
+	sort.Strings(keys)
+
+	header := "Effective config"
+	if effective.Profile != "" {
+		header += " (profile " + effective.Profile + ")"
+	}
+	if names := profileNames(effective); len(names) > 0 {
+		header += " — profiles: " + strings.Join(names, ", ")
+	}
+	fmt.Println(header)
+	for _, k := range keys {
+		source := src[k]
+		if !reflect.DeepEqual(cur[k], base[k]) {
+			source = "agent/flag"
+		}
+		val, _ := json.Marshal(cur[k])
+		shown := string(val)
+		if s, ok := cur[k].(string); ok && secretKey(k) {
+			shown = maskKey(s)
+		}
+		fmt.Printf("  %-*s  %s  \033[2m%s\033[0m\n", width, k, shown, source)
+	}
+}
+
+// configField reports whether key starts with a setting Config knows.
+func configField(key string) bool {
+	top := strings.SplitN(key, ".", 2)[0]
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		if name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]; name == top && name != "-" {
+			return true
+		}
+	}
+	return false
+}
+
+// configLayerPath returns the file a layer is written to and the key prefix
+// inside it: profiles.<name>. for the active profile, in whichever file
+// defines it (project first, as it wins).
+func configLayerPath(layer string, cfg Config) (string, string, error) {
+	switch layer {
+	case "user":
+		return UserConfigPath(), "", nil
+	case "project":
+		return filepath.FromSlash(projectConfigPath), "", nil
+	case "profile":
+		if cfg.Profile == "" {
+			return "", "", fmt.Errorf("no profile selected")
+		}
+		for _, path := range []string{filepath.FromSlash(projectConfigPath), UserConfigPath()} {
+			data, _ := os.ReadFile(path)
+			var f struct {
+				Profiles map[string]json.RawMessage `json:"profiles"`
+			}
+			if json.Unmarshal(data, &f) == nil && f.Profiles[cfg.Profile] != nil {
+				return path, "profiles." + cfg.Profile + ".", nil
+			}
+		}
+		return "", "", fmt.Errorf("profile %s not found in a config file", cfg.Profile)
+	}
+	return "", "", fmt.Errorf("unknown layer %q (user, project, profile)", layer)
+}
+
+// setConfigValue writes key = raw into the config file at path, leaving the
+// rest of the file (including ${VAR} references) as it was. raw is parsed as
+// JSON when it can be, else taken as a string; "-" removes the key.
+func setConfigValue(path, key, raw string) error {
+	doc := make(map[string]any)
+	mode := os.FileMode(0644)
+	if data, err := os.ReadFile(path); err == nil {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		if err := dec.Decode(&doc); err != nil {
+			return fmt.Errorf("%s is not valid JSON: %w", path, err)
+		}
+		if info, err := os.Stat(path); err == nil {
+			mode = info.Mode().Perm()
+		}
+	}
+
+	parts := strings.Split(key, ".")
+	m := doc
+	for _, p := range parts[:len(parts)-1] {
+		next, ok := m[p].(map[string]any)
+		if !ok {
+			if _, exists := m[p]; exists && raw != "-" {
+				return fmt.Errorf("%s is not an object in %s", p, path)
+			}
+			if raw == "-" {
+				return nil // nothing to remove
+			}
+			next = make(map[string]any)
+			m[p] = next
+		}
+		m = next
+	}
+	last := parts[len(parts)-1]
+	if raw == "-" {
+		delete(m, last)
+	} else {
+		var v any
+		dec := json.NewDecoder(strings.NewReader(raw))
+		dec.UseNumber()
+		if dec.Decode(&v) != nil || dec.More() {
+			v = raw
+		}
+		m[last] = v
+	}
+
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	// A type mismatch would make the whole file be skipped on load
+	var check Config
+	if err := json.Unmarshal(data, &check); err != nil {
+		return fmt.Errorf("invalid value for %s: %v", key, err)
+	}
+	if strings.HasPrefix(key, "profiles.") {
+		for name, p := range check.Profiles {
+			if err := json.Unmarshal(p, &Config{}); err != nil {
+				return fmt.Errorf("invalid value in profile %s: %v", name, err)
+			}
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return writeWithBackup(path, append(data, '\n'), mode)
+}
+
+// editConfig prompts for settings to change until a blank key, writing each
+// to the layer it already comes from (user when that isn't a file).
+func editConfig(readLine func() (string, error), cfg Config, src map[string]string) {
+	ask := func(q string) (string, bool) {
+		fmt.Print(q)
+		line, err := readLine()
+		return strings.TrimSpace(line), err == nil
+	}
+	for {
+		key, ok := ask("\nSetting to change (blank to finish): ")
+		if !ok || key == "" {
+			return
+		}
+		if !configField(key) {
+			fmt.Printf("Unknown setting %q.\n", key)
+			continue
+		}
+		if v, ok := flattenConfig(cfg)[key]; ok {
+			cur, _ := json.Marshal(v)
+			if s, isStr := v.(string); isStr && secretKey(key) {
+				cur = []byte(maskKey(s))
+			}
+			fmt.Printf("  now %s (%s)\n", cur, src[key])
+		}
+		val, ok := ask("New value (JSON or text, - to remove): ")
+		if !ok || val == "" {
+			continue
+		}
+
+		layer := "user"
+		switch s := src[key]; {
+		case s == "project":
+			layer = "project"
+		case strings.HasPrefix(s, "profile:"):
+			layer = "profile"
+		}
+		if in, ok := ask(fmt.Sprintf("Write to user, project or profile [%s]: ", layer)); ok && in != "" {
+			layer = in
+		}
+		path, prefix, err := configLayerPath(layer, cfg)
+		if err == nil {
+			err = setConfigValue(path, prefix+key, val)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			continue
+		}
+		fmt.Printf("Saved to %s. Takes effect on the next start.\n", path)
+		if s := src[key]; layerRank(s) > layerRank(layer) {
+			fmt.Printf("Note: %s still overrides it.\n", src[key])
+		}
+	}
+}
+
+// layerRank orders the layers of loadConfig, later winning.
+func layerRank(layer string) int {
+	for i, l := range []string{"default", "user", "project", "env", "profile"} {
+		if strings.HasPrefix(layer, l) {
+			return i
+		}
+	}
+	return 0
+}
+
+// runConfig handles `simpleagent config`: show the effective config, then
+// edit it when stdin is a terminal.
+func runConfig(args []string) {
+	if len(args) > 0 {
+		fmt.Println("Usage: simpleagent config   (SIMPLEAGENT_PROFILE selects a profile)")
+		os.Exit(1)
+	}
+	cfg, src := configReport()
+	printConfig(cfg, cfg, src)
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return
+	}
+	in := bufio.NewReader(os.Stdin)
+	editConfig(func() (string, error) { return in.ReadString('\n') }, cfg, src)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// prunedHead is how much of a trimmed tool result is kept, so the model
+// still sees what the output was.
+const prunedHead = 300
+
+// contextBudget is how many input tokens a request may use: the provider's
+// window minus room for the reply, less 5% for estimation error.
+func contextBudget(maxContext, maxTokens int) int {
+	budget := maxContext - maxTokens
+	return budget - budget/20
+}
+
+// fitContext returns msgs trimmed to fit budget tokens: the oldest tool
+// results, which dominate a long session, are cut to their first lines one
+// at a time until the estimate fits. User and assistant turns are never
+// touched, and msgs itself isn't modified. Returns how many results were cut
+// and the final estimate, which can still be over budget.
+func fitContext(msgs []Message, systemPrompt string, tools []ToolDef, provider string, budget int) ([]Message, int, int) {
+	total := estimateContextTokens(systemPrompt, msgs, tools, provider)
+	if budget <= 0 || total <= budget {
+		return msgs, 0, total
+	}
+	out := append([]Message(nil), msgs...)
+	pruned := 0
+	for i := range out {
+		if total <= budget {
+			break
+		}
+		m := out[i]
+		if m.Role != "tool" || len(m.Content) <= prunedHead+200 {
+			continue
+		}
+		before := estimateMessageTokens(m, provider)
+		m.Content = pruneToolResult(m.Content)
+		total -= before - estimateMessageTokens(m, provider)
+		out[i] = m
+		pruned++
+	}
+	return out, pruned, total
+}
+
+// pruneToolResult keeps the head of a tool result, cut at a line break, and
+// says how much was dropped.
+func pruneToolResult(s string) string {
+	head := s[:prunedHead]
+	if i := strings.LastIndexByte(head, '\n'); i > 0 {
+		head = head[:i]
+	}
+	head = strings.ToValidUTF8(head, "")
+	return fmt.Sprintf("%s\n[... %d of %d characters trimmed to fit the context window]", head, len(s)-len(head), len(s))
+}
+
+// fitMessages trims msgs to the current provider's window before a request,
+// telling the user when that changes what is sent. The session keeps the
+// full results.
+func (a *Agent) fitMessages(msgs []Message, systemPrompt string, tools []ToolDef) []Message {
+	maxCtx := a.llm.MaxContext()
+	budget := contextBudget(maxCtx, a.cfg.MaxTokens)
+	out, pruned, total := fitContext(msgs, systemPrompt, tools, a.llm.Name(), budget)
+	note := ""
+	switch {
+	case total > budget:
+		note = fmt.Sprintf("conversation is over the %dk context window even with old tool output trimmed; /compact to summarize it", maxCtx/1000)
+	case pruned > 0:
+		note = fmt.Sprintf("trimmed %d old tool result(s) to fit the %dk context window; /compact to summarize instead", pruned, maxCtx/1000)
+	}
+	if note == "" || note == a.fitNote {
+		a.fitNote = note
+		return out
+	}
+	a.fitNote = note
+	if a.sink != nil {
+		a.sink(AgentEvent{Type: "warning", Text: note})
+	} else {
+		fmt.Printf("\033[2m✂ %s\033[0m\n", note)
+	}
+	return out
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// maxContinuations bounds how many extra requests one reply may take.
+const maxContinuations = 4
+
+// continueTruncated extends a reply cut off by max_tokens and stitches the
+// parts into one message. Cut-off text is continued as text; a cut-off tool
+// call (typically a large write_file) gets the rest of its JSON arguments.
+// Tokens spent on all but the last request go straight into totalUsage.
+func (a *Agent) continueTruncated(ctx context.Context, systemPrompt string, toolDefs []ToolDef, msg Message, usage *Usage) (Message, *Usage) {
+	for i := 1; i <= maxContinuations && usage != nil && usage.Truncated() && ctx.Err() == nil; i++ {
+		n := len(msg.ToolCalls)
+		if n > 0 && json.Valid(msg.ToolCalls[n-1].Args) {
+			break // cut off after a complete call; nothing to stitch
+		}
+		a.addUsage(usage)
+
+		if a.sink == nil {
+			fmt.Printf("\n\033[2m↻ reply hit max_tokens, continuing (%d/%d)\033[0m\n", i, maxContinuations)
+		}
+
+		if n > 0 {
+			rest, u, err := a.continueToolArgs(ctx, systemPrompt, msg)
+			if err != nil {
+				a.reportError(err)
+				return msg, nil
+			}
+			msg.ToolCalls[n-1].Args = append(msg.ToolCalls[n-1].Args, []byte(rest)...)
+			usage = u
+			continue
+		}
+
+		history := append(append([]Message{}, relevantResults(a.cfg, a.history())...), msg, Message{
+			Role:    "user",
+			Content: "Your reply was cut off by the output token limit. Continue exactly where it stopped, without repeating anything or adding commentary.",
+		})
+		ch, err := a.llm.SendStream(ctx, a.fitMessages(history, systemPrompt, toolDefs), toolDefs, systemPrompt)
+		if err != nil {
+			a.reportError(err)
+			return msg, nil
+		}
+		cont, u := a.consumeStream(ctx, ch)
+		msg.Content += cont.Content
+		for _, tc := range cont.ToolCalls {
+			tc.ID = fmt.Sprintf("%s_%d", tc.ID, i) // keep IDs unique across parts
+			msg.ToolCalls = append(msg.ToolCalls, tc)
+		}
+		usage = u
+	}
+	return msg, usage
+}
+
+// continueToolArgs asks for the remainder of the last tool call's arguments.
+// The partial call can't be replayed to the provider, so the tail of what was
+// written is quoted back and the model answers in plain text.
+func (a *Agent) continueToolArgs(ctx context.Context, systemPrompt string, msg Message) (string, *Usage, error) {
+	tc := msg.ToolCalls[len(msg.ToolCalls)-1]
+	tail := string(tc.Args)
+	if len(tail) > 400 {
+		tail = tail[len(tail)-400:]
+	}
+
+	history := append([]Message{}, relevantResults(a.cfg, a.history())...)
+	if msg.Content != "" {
+		history = append(history, Message{Role: "assistant", Content: msg.Content})
+	}
+	history = append(history, Message{
+		Role: "user",
+		Content: fmt.Sprintf("Your %s tool call was cut off by the output token limit while writing its JSON arguments. "+
+			"Output ONLY the remaining characters of the arguments, starting immediately after the text below. "+
+			"No code fences, no commentary.\n\n%s", tc.Name, tail),
+	})
+
+	ch, err := a.llm.SendStream(ctx, a.fitMessages(history, systemPrompt, nil), nil, systemPrompt)
+	if err != nil {
+		return "", nil, err
+	}
+	var sb strings.Builder
+	var usage *Usage
+	for chunk := range ch {
+		if chunk.Err != nil {
+			return "", nil, chunk.Err
+		}
+		sb.WriteString(chunk.Text)
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		}
+	}
+	return stripCodeFence(sb.String()), usage, nil
+}
+
+// stripCodeFence removes a ``` wrapper the model adds despite instructions.
+func stripCodeFence(s string) string {
+	t := strings.TrimSpace(s)
+	if !strings.HasPrefix(t, "```") || !strings.HasSuffix(t, "```") {
+		return s
+	}
+	t = strings.TrimSuffix(t, "```")
+	if i := strings.IndexByte(t, '\n'); i >= 0 {
+		return strings.TrimSuffix(t[i+1:], "\n")
+	}
+	return s
+}
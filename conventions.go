@@ -0,0 +1,434 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// conventionsCache holds the detected block for one working directory; the
+// system prompt is rebuilt every turn and detection walks the tree.
+var conventionsCache struct {
+	dir  string
+	text string
+}
+
+// loadConventions returns the "Project conventions" system prompt block for
+// the project containing the working directory, or "" if nothing was found.
+func loadConventions() string {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	if conventionsCache.dir == cwd {
+		return conventionsCache.text
+	}
+	text := formatConventions(detectConventions(projectRoot(cwd)))
+	conventionsCache.dir, conventionsCache.text = cwd, text
+	return text
+}
+
+// resetConventions forces the next loadConventions to detect again.
+func resetConventions() {
+	conventionsCache.dir = ""
+}
+
+func formatConventions(notes []string) string {
+	if len(notes) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("## Project conventions (detected)\n")
+	sb.WriteString("Match these in code you write unless the project instructions say otherwise.\n")
+	for _, n := range notes {
+		sb.WriteString("- " + n + "\n")
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+// projectRoot returns the nearest directory at or above dir holding .git, or dir.
+func projectRoot(dir string) string {
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(filepath.Join(d, ".git")); err == nil {
+			return d
+		}
+		if filepath.Dir(d) == d {
+			return dir
+		}
+	}
+}
+
+// detectConventions inspects formatter and lint configs, test layout, and
+// recent commit subjects under root. Each note is one line for the prompt.
+func detectConventions(root string) []string {
+	var notes []string
+	add := func(label string, items []string) {
+		if len(items) > 0 {
+			notes = append(notes, label+": "+strings.Join(items, "; "))
+		}
+	}
+	py := readPyproject(root)
+	add("Formatting", detectFormatters(root, py))
+	add("Linting", detectLinters(root, py))
+	add("Editor settings", detectEditorConfig(root))
+	add("Tests", detectTestLayout(root, py))
+	if c := detectCommitStyle(root); c != "" {
+		notes = append(notes, "Commits: "+c)
+	}
+	return notes
+}
+
+// conventionTool is a tool recognized by the presence of any of its files.
+type conventionTool struct {
+	name  string
+	files []string
+}
+
+var formatterTools = []conventionTool{
+	{"gofmt", []string{"go.mod"}},
+	{"Prettier", []string{".prettierrc", ".prettierrc.json", ".prettierrc.yaml", ".prettierrc.yml", ".prettierrc.js", ".prettierrc.cjs", ".prettierrc.mjs", ".prettierrc.toml", "prettier.config.js", "prettier.config.cjs", "prettier.config.mjs"}},
+	{"Biome", []string{"biome.json", "biome.jsonc"}},
+	{"rustfmt", []string{"rustfmt.toml", ".rustfmt.toml", "Cargo.toml"}},
+	{"clang-format", []string{".clang-format"}},
+	{"dart format", []string{"pubspec.yaml"}},
+}
+
+var linterTools = []conventionTool{
+	{"ESLint", []string{".eslintrc", ".eslintrc.js", ".eslintrc.cjs", ".eslintrc.json", ".eslintrc.yml", ".eslintrc.yaml", "eslint.config.js", "eslint.config.mjs", "eslint.config.cjs", "eslint.config.ts"}},
+	{"golangci-lint", []string{".golangci.yml", ".golangci.yaml", ".golangci.toml", ".golangci.json"}},
+	{"Ruff", []string{"ruff.toml", ".ruff.toml"}},
+	{"flake8", []string{".flake8"}},
+	{"Pylint", []string{".pylintrc", "pylintrc"}},
+	{"Clippy", []string{"clippy.toml", ".clippy.toml"}},
+	{"RuboCop", []string{".rubocop.yml"}},
+	{"Stylelint", []string{".stylelintrc", ".stylelintrc.json", ".stylelintrc.yml", "stylelint.config.js"}},
+	{"markdownlint", []string{".markdownlint.json", ".markdownlint.yaml", ".markdownlint.yml", ".markdownlint-cli2.yaml"}},
+	{"pre-commit hooks", []string{".pre-commit-config.yaml"}},
+}
+
+func findTools(root string, tools []conventionTool) []string {
+	var found []string
+	for _, t := range tools {
+		for _, f := range t.files {
+			if fileExists(filepath.Join(root, f)) {
+				found = append(found, t.name+" ("+f+")")
+				break
+			}
+		}
+	}
+	return found
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func detectFormatters(root string, py map[string]map[string]string) []string {
+	found := findTools(root, formatterTools)
+	for i, f := range found {
+		if strings.HasPrefix(f, "Prettier") {
+			if opts := prettierOptions(root); opts != "" {
+				found[i] = "Prettier with " + opts
+			}
+		}
+	}
+	found = append(found, pyprojectTools(py, "black", "isort", "ruff.format")...)
+	return found
+}
+
+func detectLinters(root string, py map[string]map[string]string) []string {
+	found := findTools(root, linterTools)
+	found = append(found, pyprojectTools(py, "ruff", "pylint", "mypy", "flake8")...)
+	if data, err := os.ReadFile(filepath.Join(root, "tsconfig.json")); err == nil {
+		if regexp.MustCompile(`"strict"\s*:\s*true`).Match(data) {
+			found = append(found, "TypeScript strict mode")
+		}
+	}
+	return found
+}
+
+// prettierOptions summarizes scalar settings from a JSON prettierrc or the
+// "prettier" key of package.json, e.g. "semi=false, singleQuote=true".
+func prettierOptions(root string) string {
+	var opts map[string]any
+	for _, name := range []string{".prettierrc", ".prettierrc.json"} {
+		if data, err := os.ReadFile(filepath.Join(root, name)); err == nil {
+			json.Unmarshal(data, &opts)
+			break
+		}
+	}
+	if opts == nil {
+		var pkg struct {
+			Prettier map[string]any `json:"prettier"`
+		}
+		if data, err := os.ReadFile(filepath.Join(root, "package.json")); err == nil {
+			json.Unmarshal(data, &pkg)
+		}
+		opts = pkg.Prettier
+	}
+
+	var parts []string
+	for k, v := range opts {
+		switch v.(type) {
+		case string, bool, float64:
+			parts = append(parts, fmt.Sprintf("%s=%v", k, v))
+		}
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ", ")
+}
+
+// readPyproject returns pyproject.toml's [tool.*] tables with their simple
+// key = value lines, keyed by the part after "tool." (e.g. "ruff.format").
+func readPyproject(root string) map[string]map[string]string {
+	f, err := os.Open(filepath.Join(root, "pyproject.toml"))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	tables := make(map[string]map[string]string)
+	var cur map[string]string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			cur = nil
+			name := strings.Trim(line, "[] ")
+			if after, ok := strings.CutPrefix(name, "tool."); ok {
+				cur = make(map[string]string)
+				tables[after] = cur
+			}
+			continue
+		}
+		if k, v, ok := strings.Cut(line, "="); ok && cur != nil {
+			cur[strings.TrimSpace(k)] = strings.Trim(strings.TrimSpace(v), `"'`)
+		}
+	}
+	return tables
+}
+
+// pyprojectTools lists the named [tool.*] tables present, with line length if set.
+func pyprojectTools(py map[string]map[string]string, names ...string) []string {
+	var found []string
+	for _, name := range names {
+		t, ok := py[name]
+		if !ok {
+			continue
+		}
+		s := name + " (pyproject.toml)"
+		if n := t["line-length"]; n != "" {
+			s += ", line length " + n
+		}
+		found = append(found, s)
+	}
+	return found
+}
+
+// detectEditorConfig reports the [*] section of .editorconfig.
+func detectEditorConfig(root string) []string {
+	f, err := os.Open(filepath.Join(root, ".editorconfig"))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	keys := []string{"indent_style", "indent_size", "end_of_line", "max_line_length", "insert_final_newline", "trim_trailing_whitespace"}
+	var found []string
+	overrides := false
+	inAll := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			inAll = line == "[*]"
+			overrides = overrides || !inAll
+			continue
+		}
+		k, v, ok := strings.Cut(line, "=")
+		k = strings.TrimSpace(k)
+		if ok && inAll && slices.Contains(keys, k) {
+			found = append(found, k+"="+strings.TrimSpace(v))
+		}
+	}
+	if len(found) > 0 && overrides {
+		found = append(found, "per-file overrides in .editorconfig")
+	}
+	return found
+}
+
+// testDirs are directory names that hold tests apart from the code.
+var testDirs = []string{"test", "tests", "__tests__", "spec", "testing"}
+
+// skipDirs are never walked when sampling the tree.
+var skipDirs = []string{"node_modules", "vendor", "target", "dist", "build", "venv", "__pycache__"}
+
+// testPattern names the test-file convention a file follows, or "".
+func testPattern(path, name string) string {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	switch {
+	case strings.HasSuffix(name, "_test.go"):
+		return "*_test.go"
+	case ext == ".py" && strings.HasPrefix(name, "test_"):
+		return "test_*.py"
+	case ext == ".py" && strings.HasSuffix(base, "_test"):
+		return "*_test.py"
+	case ext == ".rb" && strings.HasSuffix(base, "_spec"):
+		return "*_spec.rb"
+	case ext == ".java" && strings.HasSuffix(base, "Test"):
+		return "*Test.java"
+	case ext == ".rs" && filepath.Base(filepath.Dir(path)) == "tests":
+		return "tests/*.rs"
+	}
+	for _, kind := range []string{".test", ".spec"} {
+		if strings.HasSuffix(base, kind) && slices.Contains([]string{".js", ".jsx", ".ts", ".tsx", ".mjs", ".cjs"}, ext) {
+			return "*" + kind + ext
+		}
+	}
+	return ""
+}
+
+// detectTestLayout samples up to 20000 files for test naming patterns and
+// whether tests sit beside the code or in separate test directories.
+func detectTestLayout(root string, py map[string]map[string]string) []string {
+	type layout struct{ files, inTestDir int }
+	counts := make(map[string]*layout)
+	seen := 0
+
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		name := d.Name()
+		if d.IsDir() {
+			if path != root && (strings.HasPrefix(name, ".") || slices.Contains(skipDirs, name)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if seen++; seen > 20000 {
+			return filepath.SkipAll
+		}
+		p := testPattern(path, name)
+		if p == "" {
+			return nil
+		}
+		l := counts[p]
+		if l == nil {
+			l = &layout{}
+			counts[p] = l
+		}
+		l.files++
+		rel, _ := filepath.Rel(root, path)
+		for _, part := range strings.Split(filepath.Dir(rel), string(filepath.Separator)) {
+			if slices.Contains(testDirs, part) {
+				l.inTestDir++
+				break
+			}
+		}
+		return nil
+	})
+
+	var found []string
+	for p, l := range counts {
+		where := "beside the code"
+		if l.inTestDir*2 > l.files {
+			where = "in separate test directories"
+		}
+		found = append(found, fmt.Sprintf("%s files %s (%d)", p, where, l.files))
+	}
+	sort.Strings(found)
+
+	if runner := testRunner(root, py); runner != "" {
+		found = append(found, "run with "+runner)
+	}
+	return found
+}
+
+// testRunner returns the project's test command when it is declared somewhere obvious.
+func testRunner(root string, py map[string]map[string]string) string {
+	var pkg struct {
+		Scripts map[string]string `json:"scripts"`
+	}
+	if data, err := os.ReadFile(filepath.Join(root, "package.json")); err == nil {
+		if json.Unmarshal(data, &pkg) == nil && pkg.Scripts["test"] != "" {
+			return "`npm test` (" + pkg.Scripts["test"] + ")"
+		}
+	}
+	if _, ok := py["pytest.ini_options"]; ok || fileExists(filepath.Join(root, "pytest.ini")) || fileExists(filepath.Join(root, "conftest.py")) {
+		return "pytest"
+	}
+	return ""
+}
+
+var (
+	conventionalCommit = regexp.MustCompile(`^(feat|fix|docs|style|refactor|perf|test|build|ci|chore|revert)(\([^)]*\))?!?: `)
+	bracketPrefix      = regexp.MustCompile(`^\[[^\]]+\] `)
+	ticketPrefix       = regexp.MustCompile(`^[A-Z][A-Z0-9]+-[0-9]+\b`)
+)
+
+// detectCommitStyle describes the subject lines of the last 50 non-merge commits.
+func detectCommitStyle(root string) string {
+	out, err := exec.Command("git", "-C", root, "log", "-n", "50", "--no-merges", "--format=%s").Output()
+	if err != nil {
+		return ""
+	}
+	var subjects []string
+	for _, s := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if s = strings.TrimSpace(s); s != "" {
+			subjects = append(subjects, s)
+		}
+	}
+	if len(subjects) < 5 {
+		return "" // too few to call it a convention
+	}
+
+	count := func(match func(string) bool) (n int, example string) {
+		for _, s := range subjects {
+			if match(s) {
+				if n == 0 {
+					example = s
+				}
+				n++
+			}
+		}
+		return n, example
+	}
+	most := func(n int) bool { return n*2 > len(subjects) }
+
+	if n, ex := count(conventionalCommit.MatchString); most(n) {
+		return fmt.Sprintf("Conventional Commits, e.g. %q", ex)
+	}
+	if n, ex := count(bracketPrefix.MatchString); most(n) {
+		return fmt.Sprintf("subjects start with a [tag], e.g. %q", ex)
+	}
+	if n, ex := count(ticketPrefix.MatchString); most(n) {
+		return fmt.Sprintf("subjects start with a ticket ID, e.g. %q", ex)
+	}
+
+	var style []string
+	if n, _ := count(func(s string) bool { return s[0] >= 'A' && s[0] <= 'Z' }); most(n) {
+		style = append(style, "capitalized")
+	} else {
+		style = append(style, "lowercase")
+	}
+	if n, _ := count(func(s string) bool { return strings.HasSuffix(s, ".") }); !most(n) {
+		style = append(style, "no trailing period")
+	}
+	total := 0
+	for _, s := range subjects {
+		total += len(s)
+	}
+	return fmt.Sprintf("%s subjects, about %d characters, e.g. %q", strings.Join(style, ", "), total/len(subjects), subjects[0])
+}
@@ -0,0 +1,492 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// docsStorePath is the project's document store, shared by its agents.
+const docsStorePath = ".simpleagent/docs.json"
+
+// docsChunkSize is the target chunk length in characters; paragraphs are
+// kept whole unless one alone is longer.
+const docsChunkSize = 1500
+
+// docsEmbedBatch is how many chunks go to the embedder per request.
+const docsEmbedBatch = 64
+
+// docsExtensions are the files `simpleagent docs ingest` reads from a directory.
+var docsExtensions = []string{".md", ".markdown", ".txt", ".rst", ".html", ".htm", ".pdf"}
+
+// docStore is the ingested documents: chunks with their vectors, and per
+// source file a hash so unchanged files aren't embedded again.
+type docStore struct {
+	Embedder string               `json:"embedder"`
+	Sources  map[string]docSource `json:"sources"`
+	Chunks   []docChunk           `json:"chunks"`
+}
+
+type docSource struct {
+	SHA      string `json:"sha"`
+	Chunks   int    `json:"chunks"`
+	Ingested string `json:"ingested"`
+}
+
+type docChunk struct {
+	Source  string    `json:"source"`
+	Heading string    `json:"heading,omitempty"` // nearest heading path, "Deploy › Rollback"
+	Text    string    `json:"text"`
+	Vector  []float32 `json:"vector"`
+}
+
+func loadDocStore() (*docStore, error) {
+	s := &docStore{Sources: map[string]docSource{}}
+	data, err := os.ReadFile(filepath.FromSlash(docsStorePath))
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("%s: %w", docsStorePath, err)
+	}
+	if s.Sources == nil {
+		s.Sources = map[string]docSource{}
+	}
+	return s, nil
+}
+
+func (s *docStore) save() error {
+	if len(s.Sources) == 0 {
+		err := os.Remove(filepath.FromSlash(docsStorePath))
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	os.MkdirAll(filepath.Dir(filepath.FromSlash(docsStorePath)), 0755)
+	return os.WriteFile(filepath.FromSlash(docsStorePath), data, 0644)
+}
+
+// drop removes a source and its chunks.
+func (s *docStore) drop(source string) {
+	delete(s.Sources, source)
+	s.Chunks = slices.DeleteFunc(s.Chunks, func(c docChunk) bool { return c.Source == source })
+}
+
+const docsUsage = `Usage:
+  simpleagent docs ingest [path...]   Add files or directories (md, txt, rst, html, pdf); no path re-ingests changed sources
+  simpleagent docs list               Show ingested sources
+  simpleagent docs remove <path...>   Drop sources from the store`
+
+// runDocs handles `simpleagent docs`: the project's document store that the
+// search_docs tool searches.
+func runDocs(args []string) {
+	if len(args) == 0 {
+		fmt.Println(docsUsage)
+		os.Exit(1)
+	}
+	store, err := loadDocStore()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	switch args[0] {
+	case "ingest":
+		ResolveAgentDir("")
+		cfg := LoadConfig()
+		if err := ingestDocs(store, cfg, args[1:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	case "list":
+		if len(store.Sources) == 0 {
+			fmt.Println("No documents ingested. Add some with: simpleagent docs ingest <path>")
+			return
+		}
+		names := make([]string, 0, len(store.Sources))
+		for name := range store.Sources {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			src := store.Sources[name]
+			fmt.Printf("  %-50s %4d chunks  %s\n", name, src.Chunks, src.Ingested)
+		}
+		fmt.Printf("%d source(s), %d chunks, embedder %s\n", len(names), len(store.Chunks), store.Embedder)
+	case "remove":
+		if len(args) < 2 {
+			fmt.Println(docsUsage)
+			os.Exit(1)
+		}
+		for _, arg := range args[1:] {
+			name := docSourceName(arg)
+			if _, ok := store.Sources[name]; !ok {
+				fmt.Printf("Not in the store: %s\n", name)
+				continue
+			}
+			store.drop(name)
+			fmt.Printf("Removed %s.\n", name)
+		}
+		if err := store.save(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	default:
+		fmt.Println(docsUsage)
+		os.Exit(1)
+	}
+}
+
+// docSourceName is how a file is keyed in the store: relative to the
+// working directory when inside it, slash-separated.
+func docSourceName(path string) string {
+	abs, _ := filepath.Abs(path)
+	if cwd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(cwd, abs); err == nil && !strings.HasPrefix(rel, "..") {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return filepath.ToSlash(abs)
+}
+
+// ingestDocs chunks and embeds the files under paths (every known source
+// when none are given), skipping files whose content hasn't changed.
+// Switching embedders re-embeds everything.
+func ingestDocs(store *docStore, cfg Config, paths []string) error {
+	emb, err := NewEmbedder(cfg)
+	if err != nil {
+		return err
+	}
+	if store.Embedder != emb.ID() && len(store.Sources) > 0 {
+		fmt.Printf("Embedder changed (%s → %s); re-embedding every source.\n", store.Embedder, emb.ID())
+		for name := range store.Sources {
+			store.Sources[name] = docSource{}
+		}
+		store.Chunks = nil
+	}
+	reembed := store.Embedder != emb.ID()
+	store.Embedder = emb.ID()
+
+	var files []string
+	if len(paths) == 0 || reembed {
+		for name := range store.Sources {
+			files = append(files, name)
+		}
+		sort.Strings(files)
+		if len(files) == 0 && len(paths) == 0 {
+			return fmt.Errorf("nothing to ingest\n%s", docsUsage)
+		}
+	}
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			files = append(files, p)
+			continue
+		}
+		filepath.WalkDir(p, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if d.IsDir() {
+				if path != p && (strings.HasPrefix(d.Name(), ".") || slices.Contains(skipDirs, d.Name())) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if slices.Contains(docsExtensions, strings.ToLower(filepath.Ext(path))) {
+				files = append(files, path)
+			}
+			return nil
+		})
+	}
+
+	ctx := context.Background()
+	added, unchanged, failed := 0, 0, 0
+	seen := map[string]bool{}
+	for _, file := range files {
+		name := docSourceName(file)
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		data, err := os.ReadFile(file)
+		if err != nil {
+			if os.IsNotExist(err) {
+				if _, known := store.Sources[name]; !known {
+					fmt.Printf("  ✗ %s: %v\n", name, err)
+					failed++
+					continue
+				}
+				store.drop(name)
+				fmt.Printf("  - %s (gone, removed)\n", name)
+				continue
+			}
+			fmt.Printf("  ✗ %s: %v\n", name, err)
+			failed++
+			continue
+		}
+		sum := sha256.Sum256(data)
+		sha := hex.EncodeToString(sum[:])
+		if store.Sources[name].SHA == sha {
+			unchanged++
+			continue
+		}
+		text, err := docText(file, data)
+		if err != nil {
+			fmt.Printf("  ✗ %s: %v\n", name, err)
+			failed++
+			continue
+		}
+		chunks := chunkDoc(name, text)
+		if len(chunks) == 0 {
+			fmt.Printf("  ✗ %s: no text\n", name)
+			failed++
+			continue
+		}
+		for start := 0; start < len(chunks); start += docsEmbedBatch {
+			batch := chunks[start:min(start+docsEmbedBatch, len(chunks))]
+			texts := make([]string, len(batch))
+			for i, c := range batch {
+				texts[i] = c.Heading + "\n" + c.Text
+			}
+			vecs, err := emb.Embed(ctx, texts)
+			if err != nil {
+				return fmt.Errorf("embedding %s: %w", name, err)
+			}
+			for i := range batch {
+				if i < len(vecs) {
+					batch[i].Vector = vecs[i]
+				}
+			}
+		}
+		store.drop(name)
+		store.Chunks = append(store.Chunks, chunks...)
+		store.Sources[name] = docSource{SHA: sha, Chunks: len(chunks), Ingested: time.Now().Format(time.RFC3339)}
+		fmt.Printf("  + %s (%d chunks)\n", name, len(chunks))
+		added++
+	}
+	if err := store.save(); err != nil {
+		return err
+	}
+	fmt.Printf("%d ingested, %d unchanged, %d failed · %d chunks in %s\n", added, unchanged, failed, len(store.Chunks), docsStorePath)
+	return nil
+}
+
+var (
+	reHTMLDrop    = regexp.MustCompile(`(?is)<(script|style|head|nav|noscript)\b.*?</(script|style|head|nav|noscript)>|<!--.*?-->`)
+	reHTMLHeading = regexp.MustCompile(`(?i)<h([1-6])\b[^>]*>`)
+	reHTMLBlock   = regexp.MustCompile(`(?i)</?(p|div|br|li|tr|h[1-6]|section|article|pre|table|ul|ol|blockquote)\b[^>]*>`)
+	reHTMLTag     = regexp.MustCompile(`<[^>]*>`)
+	reBlankLines  = regexp.MustCompile(`\n{3,}`)
+)
+
+// docText extracts a document's text: markdown and text as is, HTML with
+// headings kept as markdown ones, PDF through pdftotext (poppler).
+func docText(path string, data []byte) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".pdf":
+		if _, err := exec.LookPath("pdftotext"); err != nil {
+			return "", fmt.Errorf("PDFs need pdftotext (poppler-utils) installed")
+		}
+		out, err := exec.Command("pdftotext", "-enc", "UTF-8", path, "-").Output()
+		if err != nil {
+			return "", fmt.Errorf("pdftotext: %w", err)
+		}
+		return string(out), nil
+	case ".html", ".htm":
+		s := reHTMLDrop.ReplaceAllString(string(data), "")
+		s = reHTMLHeading.ReplaceAllStringFunc(s, func(tag string) string {
+			return "\n\n" + strings.Repeat("#", int(tag[2]-'0')) + " "
+		})
+		s = reHTMLBlock.ReplaceAllString(s, "\n\n")
+		s = html.UnescapeString(reHTMLTag.ReplaceAllString(s, ""))
+		var lines []string
+		for _, line := range strings.Split(s, "\n") {
+			lines = append(lines, strings.Join(strings.Fields(line), " "))
+		}
+		return reBlankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"), nil
+	}
+	return string(data), nil
+}
+
+// chunkDoc splits text into chunks of about docsChunkSize at paragraph
+// boundaries, starting a new one at every markdown heading, which becomes
+// the chunk's heading path.
+func chunkDoc(source, text string) []docChunk {
+	var chunks []docChunk
+	var headings []string // by level, "" where a level is skipped
+	var buf strings.Builder
+	inFence := false
+	flush := func() {
+		t := strings.TrimSpace(buf.String())
+		buf.Reset()
+		if t == "" {
+			return
+		}
+		var path []string
+		for _, h := range headings {
+			if h != "" {
+				path = append(path, h)
+			}
+		}
+		chunks = append(chunks, docChunk{Source: source, Heading: strings.Join(path, " › "), Text: t})
+	}
+	add := func(para string) {
+		for len(para) > docsChunkSize {
+			cut := strings.LastIndexAny(para[:docsChunkSize], " \n")
+			if cut <= 0 {
+				cut = docsChunkSize
+			}
+			flush()
+			buf.WriteString(para[:cut])
+			flush()
+			para = strings.TrimLeft(para[cut:], " \n")
+		}
+		if buf.Len() > 0 && buf.Len()+len(para) > docsChunkSize {
+			flush()
+		}
+		if buf.Len() > 0 {
+			buf.WriteString("\n\n")
+		}
+		buf.WriteString(para)
+	}
+
+	var para []string
+	endPara := func() {
+		if len(para) > 0 {
+			add(strings.Join(para, "\n"))
+			para = nil
+		}
+	}
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inFence = !inFence
+		}
+		if !inFence && strings.HasPrefix(trimmed, "#") {
+			level := len(trimmed) - len(strings.TrimLeft(trimmed, "#"))
+			if level <= 6 && len(trimmed) > level && trimmed[level] == ' ' {
+				endPara()
+				flush()
+				for len(headings) < level {
+					headings = append(headings, "")
+				}
+				headings = append(headings[:level-1], strings.TrimSpace(trimmed[level:]))
+				continue
+			}
+		}
+		if trimmed == "" && !inFence {
+			endPara()
+			continue
+		}
+		para = append(para, strings.TrimRight(line, " \t\f"))
+	}
+	endPara()
+	flush()
+	return chunks
+}
+
+// docHit is one search_docs result.
+type docHit struct {
+	chunk docChunk
+	score float64
+}
+
+// searchDocs ranks the store's chunks against query.
+func searchDocs(store *docStore, emb Embedder, query string, limit int) ([]docHit, error) {
+	if store.Embedder != emb.ID() {
+		return nil, fmt.Errorf("the document store was embedded with %s but memory.embeddings is now %s; run simpleagent docs ingest", store.Embedder, emb.ID())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	vecs, err := emb.Embed(ctx, []string{query})
+	if err != nil || len(vecs) == 0 {
+		return nil, fmt.Errorf("embedding query: %v", err)
+	}
+	var hits []docHit
+	for _, c := range store.Chunks {
+		if score := cosine(vecs[0], c.Vector); score > 0 {
+			hits = append(hits, docHit{c, score})
+		}
+	}
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].score > hits[j].score })
+	return hits[:min(limit, len(hits))], nil
+}
+
+// registerDocsTool adds search_docs when the project has ingested documents.
+// The store is read on each call, so an ingest during the session counts.
+func registerDocsTool(r *ToolRegistry, cfg Config) {
+	if _, err := os.Stat(filepath.FromSlash(docsStorePath)); err != nil {
+		return
+	}
+	r.Register(ToolDef{
+		Name: "search_docs",
+		Description: "Search the project's ingested documents (specs, runbooks, design docs) and return the most relevant excerpts with their source. " +
+			"Use it before guessing how the project is supposed to work.",
+		Parameters: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"query": map[string]any{"type": "string", "description": "What to look for, in words likely to appear in the documents"},
+				"limit": map[string]any{"type": "integer", "description": "Excerpts to return (default 5, max 20)"},
+			},
+			"required": []string{"query"},
+		},
+	}, func(args json.RawMessage) (string, error) {
+		var params struct {
+			Query string `json:"query"`
+			Limit int    `json:"limit"`
+		}
+		if err := json.Unmarshal(args, &params); err != nil {
+			return "", err
+		}
+		if params.Limit <= 0 {
+			params.Limit = 5
+		}
+		store, err := loadDocStore()
+		if err != nil {
+			return "", err
+		}
+		emb, err := memoryEmbedder(cfg)
+		if err != nil {
+			return "", err
+		}
+		hits, err := searchDocs(store, emb, params.Query, min(params.Limit, 20))
+		if err != nil {
+			return "", err
+		}
+		if len(hits) == 0 {
+			return "no matching documents", nil
+		}
+		var sb strings.Builder
+		for i, h := range hits {
+			where := h.chunk.Source
+			if h.chunk.Heading != "" {
+				where += " › " + h.chunk.Heading
+			}
+			fmt.Fprintf(&sb, "[%d] %s (score %.2f)\n%s\n\n", i+1, where, h.score, h.chunk.Text)
+		}
+		return strings.TrimSpace(sb.String()), nil
+	}, false)
+}
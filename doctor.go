@@ -0,0 +1,373 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// doctorPingTimeout bounds each provider ping.
+const doctorPingTimeout = 30 * time.Second
+
+// legacyConfigKeys are old flat fields migrateOldConfig still reads.
+var legacyConfigKeys = []string{"anthropic_api_key", "openai_api_key", "openrouter_api_key", "gemini_api_key", "ollama_host", "model"}
+
+// doctor collects check results and prints them as it goes.
+type doctor struct {
+	failed, warned int
+}
+
+func (d *doctor) section(name string) {
+	fmt.Printf("\n%s\n", name)
+}
+
+func (d *doctor) ok(format string, a ...any) {
+	d.line("\033[32m✓\033[0m", "ok  ", fmt.Sprintf(format, a...), "")
+}
+
+func (d *doctor) warn(fix, format string, a ...any) {
+	d.warned++
+	d.line("\033[33m!\033[0m", "warn", fmt.Sprintf(format, a...), fix)
+}
+
+func (d *doctor) fail(fix, format string, a ...any) {
+	d.failed++
+	d.line("\033[31m✗\033[0m", "FAIL", fmt.Sprintf(format, a...), fix)
+}
+
+func (d *doctor) line(mark, plain, msg, fix string) {
+	if plainOutput {
+		mark = plain
+	}
+	fmt.Printf("  %s %s\n", mark, msg)
+	if fix != "" {
+		fmt.Printf("      → %s\n", fix)
+	}
+}
+
+// runDoctor handles `simpleagent doctor`: config, environment, session
+// store and provider checks, each failure with a suggested fix. Exits 1 when
+// anything failed.
+func runDoctor(args []string) {
+	skipPing := slices.Contains(args, "--offline")
+	plainOutput = !term.IsTerminal(int(os.Stdout.Fd()))
+	d := &doctor{}
+	fmt.Printf("simpleagent v%s (%s/%s)\n", version, runtime.GOOS, runtime.GOARCH)
+
+	d.section("Config")
+	d.checkConfigFile(UserConfigPath())
+	d.checkConfigFile(filepath.FromSlash(projectConfigPath))
+	cfg := LoadConfig()
+	sessionStorage = cfg.Storage
+	d.checkConfigValues(cfg)
+
+	d.section("Environment")
+	d.checkEnvironment()
+
+	d.section("Sessions")
+	d.checkSessions()
+
+	d.section("Providers")
+	if skipPing {
+		fmt.Println("  (skipped: --offline)")
+	} else {
+		d.checkProviders(cfg)
+	}
+
+	fmt.Println()
+	switch {
+	case d.failed > 0:
+		fmt.Printf("%d problem(s), %d warning(s).\n", d.failed, d.warned)
+		os.Exit(1)
+	case d.warned > 0:
+		fmt.Printf("No problems, %d warning(s).\n", d.warned)
+	default:
+		fmt.Println("Everything looks good.")
+	}
+}
+
+// checkConfigFile validates one config file: JSON syntax, value types (a type
+// error makes mergeConfigFile skip the whole file), and unknown keys.
+func (d *doctor) checkConfigFile(path string) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		d.ok("%s: not present", path)
+		return
+	}
+	if err != nil {
+		d.fail("check the file's permissions", "%s: %v", path, err)
+		return
+	}
+	data = interpolateJSON(path, data)
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		d.fail("fix the JSON syntax (a trailing comma is the usual culprit); the whole file is ignored until then", "%s: %v", path, err)
+		return
+	}
+	if err := json.Unmarshal(data, &Config{}); err != nil {
+		d.fail("fix the value's type; the whole file is ignored until then (`simpleagent config` shows what is in effect)", "%s: %v", path, err)
+		return
+	}
+	var profiles map[string]json.RawMessage
+	json.Unmarshal(raw["profiles"], &profiles)
+	for name, p := range profiles {
+		if err := json.Unmarshal(p, &Config{}); err != nil {
+			d.fail("fix the profile's value types", "%s: profile %s: %v", path, name, err)
+		}
+	}
+	var unknown []string
+	for k := range raw {
+		if !configField(k) && !slices.Contains(legacyConfigKeys, k) {
+			unknown = append(unknown, k)
+		}
+	}
+	slices.Sort(unknown)
+	if len(unknown) > 0 {
+		d.warn("check the spelling; unknown keys are ignored", "%s: unknown key(s) %s", path, strings.Join(unknown, ", "))
+		return
+	}
+	d.ok("%s: valid", path)
+}
+
+// checkConfigValues checks settings whose values are an enumeration.
+func (d *doctor) checkConfigValues(cfg Config) {
+	bad := func(field, value string, allowed []string) {
+		d.fail(fmt.Sprintf("set %s to one of: %s", field, strings.Join(allowed, ", ")), "%s %q is not recognized", field, value)
+	}
+	if !slices.Contains(providerNames, cfg.Provider) {
+		bad("provider", cfg.Provider, providerNames)
+	}
+	if s := cfg.Storage; s != "" && s != "json" && s != "sqlite" {
+		bad("storage", s, []string{"json", "sqlite"})
+	}
+	if s := cfg.AskUser; s != "" && !slices.Contains([]string{"options", "always", "never"}, s) {
+		bad("ask_user", s, []string{"options", "always", "never"})
+	}
+	if s := cfg.Memory.Embeddings; s != "" && !slices.Contains([]string{"local", "openai", "ollama", "gemini"}, s) {
+		bad("memory.embeddings", s, []string{"local", "openai", "ollama", "gemini"})
+	}
+	budgets := []struct {
+		field string
+		n     int
+	}{{"recent_tokens", cfg.Memory.RecentTokens}, {"summary_tokens", cfg.Memory.SummaryTokens}, {"long_term_tokens", cfg.Memory.LongTermTokens}, {"relevant_results", cfg.Memory.RelevantResults}}
+	for _, b := range budgets {
+		if b.n < 0 {
+			d.fail("set memory."+b.field+" to 0 (the default) or more", "memory.%s is negative (%d)", b.field, b.n)
+		}
+	}
+	if s := cfg.Input.Keybindings; s != "" && s != "emacs" && s != "vi" {
+		bad("input.keybindings", s, []string{"emacs", "vi"})
+	}
+	for _, problem := range cfg.Tools.Commands.problems() {
+		d.fail("fix the pattern in tools.commands in config", "tools.commands: %s", problem)
+	}
+	for name, p := range cfg.Tools.Permissions {
+		if problem := p.problem(); problem != "" {
+			d.fail("fix tools.permissions."+name+" in config", "tools.permissions.%s: %s", name, problem)
+		}
+	}
+	if cfg.Profile != "" {
+		d.ok("profile %s selected", cfg.Profile)
+	}
+	for _, name := range providerNames {
+		pc := cfg.ProviderCfg(name)
+		if _, err := providerTransport(name, pc); err != nil {
+			d.fail(fmt.Sprintf("fix providers.%s in config", name), "%v", err)
+		}
+		if pc.InsecureSkipVerify {
+			d.warn(fmt.Sprintf("set providers.%s.ca_cert to your proxy's CA bundle instead", name), "TLS verification is off for %s", name)
+		}
+	}
+	if !providerReady(cfg) {
+		d.fail(fmt.Sprintf("run `simpleagent auth login %s`, set its API key env var, or run `simpleagent --setup`", cfg.Provider), "provider %s has no credentials", cfg.Provider)
+	} else {
+		d.ok("provider %s, model %s", cfg.Provider, cfg.ProviderCfg(cfg.Provider).Model)
+	}
+}
+
+// checkEnvironment covers what tools and rendering rely on: sh for bash and
+// processes, a capable terminal, and optional helpers.
+func (d *doctor) checkEnvironment() {
+	if path, err := exec.LookPath("sh"); err != nil {
+		fix := "install a POSIX shell and put it on PATH"
+		if runtime.GOOS == "windows" {
+			fix = "install Git for Windows and add its usr\\bin to PATH"
+		}
+		d.fail(fix, "sh not found: bash and start_process won't work")
+	} else if out, err := exec.Command(path, "-c", "echo ok").Output(); err != nil || strings.TrimSpace(string(out)) != "ok" {
+		d.fail("check that "+path+" is a working shell", "sh at %s doesn't run commands", path)
+	} else {
+		d.ok("sh: %s", path)
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		d.warn("install git for project context, /init and session branch tracking", "git not found")
+	} else {
+		d.ok("git found")
+	}
+
+	stdinTTY := term.IsTerminal(int(os.Stdin.Fd()))
+	stdoutTTY := term.IsTerminal(int(os.Stdout.Fd()))
+	switch {
+	case stdinTTY && stdoutTTY:
+		if w, h, err := term.GetSize(int(os.Stdout.Fd())); err == nil {
+			if w < 60 {
+				d.warn("widen the window; tool previews and diffs wrap below ~60 columns", "terminal is %dx%d", w, h)
+			} else {
+				d.ok("terminal %dx%d", w, h)
+			}
+		}
+	case !stdoutTTY:
+		d.ok("stdout is not a terminal: plain output (no spinner, status line or markdown)")
+	default:
+		d.warn("", "stdin is not a terminal: confirmations are answered no, interactive mode needs a TTY")
+	}
+	if t := os.Getenv("TERM"); t == "dumb" || (t == "" && runtime.GOOS != "windows") {
+		d.warn("set TERM (e.g. xterm-256color) for colors and cursor control", "TERM is %q", t)
+	}
+	if runtime.GOOS != "windows" {
+		locale := os.Getenv("LC_ALL")
+		if locale == "" {
+			locale = os.Getenv("LC_CTYPE")
+		}
+		if locale == "" {
+			locale = os.Getenv("LANG")
+		}
+		if l := strings.ToLower(locale); !strings.Contains(l, "utf-8") && !strings.Contains(l, "utf8") {
+			d.warn("export LANG=en_US.UTF-8 (or another UTF-8 locale) so ✓ ▶ ↳ render", "locale %q is not UTF-8", locale)
+		}
+	}
+	if store := keychain(); store != nil {
+		d.ok("credential store: %s", store.Name())
+	} else {
+		d.warn("keys must come from config or env vars; install secret-tool (libsecret) to use `auth login`", "no OS credential store")
+	}
+}
+
+// checkSessions opens the store of every agent in ./.simpleagent/ and loads
+// each session.
+func (d *doctor) checkSessions() {
+	dirs, _ := filepath.Glob(filepath.Join(".simpleagent", "*", "sessions"))
+	if len(dirs) == 0 {
+		d.ok("no sessions in this directory yet")
+		return
+	}
+	defer ResolveAgentDir("")
+	for _, dir := range dirs {
+		agent := filepath.Base(filepath.Dir(dir))
+		ResolveAgentDir(agent)
+		s, err := NewSessionStore(sessionStorage)
+		if err != nil {
+			d.fail(`set "storage": "json" or remove the damaged sessions.db (sessions are imported from JSON again)`, "%s: can't open %s store: %v", agent, sessionStorage, err)
+			continue
+		}
+		if q, ok := s.(*sqliteStore); ok {
+			var res string
+			if err := q.db.QueryRow("PRAGMA quick_check").Scan(&res); err != nil || res != "ok" {
+				d.fail("restore sessions.db from a backup, or move it aside to start a fresh store", "%s: sessions.db integrity check failed: %v %s", agent, err, res)
+				continue
+			}
+		}
+		entries, err := s.List()
+		if err != nil {
+			d.fail("the session index is damaged; move it aside and it is rebuilt as sessions are saved", "%s: listing sessions: %v", agent, err)
+			continue
+		}
+		var broken []string
+		for _, e := range entries {
+			if _, err := s.Load(e.ID); err != nil {
+				broken = append(broken, e.ID)
+			}
+		}
+		if len(broken) > 0 {
+			d.warn("those sessions can't be resumed; delete them from "+dir, "%s: %d of %d session(s) unreadable: %s", agent, len(broken), len(entries), strings.Join(broken[:min(len(broken), 3)], ", "))
+		} else {
+			d.ok("%s: %d session(s), %s store", agent, len(entries), sessionStorage)
+		}
+	}
+}
+
+// checkProviders sends a one-word request to the active provider and every
+// other provider with credentials, with max_tokens cut to keep it cheap.
+func (d *doctor) checkProviders(cfg Config) {
+	var names []string
+	if providerReady(cfg) {
+		names = append(names, cfg.Provider) // else already reported above
+	}
+	for _, name := range providerNames {
+		if name == cfg.Provider {
+			continue
+		}
+		if isKeyedProvider(name) && (cfg.ProviderKeyCfg(name).APIKey != "" || hasOAuthToken(name)) {
+			names = append(names, name)
+		}
+	}
+	ping := cfg
+	ping.MaxTokens = 16
+	for _, name := range names {
+		pc := cfg.ProviderCfg(name)
+		p, err := NewProvider(name, ping)
+		if err != nil {
+			d.fail(providerFix(name, err), "%s: %v", name, err)
+			continue
+		}
+		start := time.Now()
+		err = pingProvider(p)
+		if err != nil {
+			d.fail(providerFix(name, err), "%s (%s): %v", name, pc.Model, err)
+			continue
+		}
+		d.ok("%s (%s): responded in %s", name, pc.Model, time.Since(start).Round(10*time.Millisecond))
+	}
+}
+
+func pingProvider(p Provider) error {
+	ctx, cancel := context.WithTimeout(context.Background(), doctorPingTimeout)
+	defer cancel()
+	ch, err := p.SendStream(ctx, []Message{{Role: "user", Content: "Reply with: ok"}}, nil, "")
+	if err != nil {
+		return err
+	}
+	for chunk := range ch {
+		if chunk.Err != nil {
+			return chunk.Err
+		}
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("no answer within %s", doctorPingTimeout)
+	}
+	return nil
+}
+
+// providerFix guesses the remedy from the error text.
+func providerFix(name string, err error) string {
+	msg := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(msg, "401") || strings.Contains(msg, "unauthorized") || strings.Contains(msg, "invalid x-api-key") || strings.Contains(msg, "api key not valid") || strings.Contains(msg, "api_key not set"):
+		return fmt.Sprintf("check the %s API key (`simpleagent config` shows where it comes from; `simpleagent auth login %s` replaces it)", name, name)
+	case strings.Contains(msg, "404") || strings.Contains(msg, "not_found") || strings.Contains(msg, "model"):
+		return fmt.Sprintf("check providers.%s.model; the model may not exist or not be enabled for your account", name)
+	case strings.Contains(msg, "429") || strings.Contains(msg, "rate") || strings.Contains(msg, "quota") || strings.Contains(msg, "credit"):
+		return "the account is rate limited or out of credit; check its billing page"
+	case strings.Contains(msg, "x509") || strings.Contains(msg, "certificate"):
+		return fmt.Sprintf("a proxy may be intercepting TLS; point providers.%s.ca_cert at its CA bundle (PEM)", name)
+	case strings.Contains(msg, "proxyconnect") || strings.Contains(msg, ".proxy"):
+		return fmt.Sprintf("check HTTPS_PROXY or providers.%s.proxy", name)
+	case strings.Contains(msg, "connection refused") && name == "ollama":
+		return "start Ollama (`ollama serve`) or set providers.ollama.url"
+	case strings.Contains(msg, "no such host") || strings.Contains(msg, "connection refused") || strings.Contains(msg, "timeout") || strings.Contains(msg, "no answer"):
+		return fmt.Sprintf("check network access, proxy settings (HTTPS_PROXY or providers.%s.proxy), and providers.%s.url", name, name)
+	case name == "bedrock":
+		return "check AWS credentials and region (AWS_PROFILE, AWS_REGION) and that the model is enabled in Bedrock"
+	}
+	return "run with --trace to log the raw request and response"
+}
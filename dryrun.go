@@ -0,0 +1,315 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DryRun stages file changes instead of writing them. write_file, edit_file,
+// patch, and delete record the result here and show a diff; read_file sees
+// staged content so follow-up edits compose. /apply writes everything out.
+type DryRun struct {
+	changes map[string]*stagedChange
+	order   []string // first-staged order, for apply
+}
+
+type stagedChange struct {
+	Path      string
+	Existed   bool // on disk when first staged
+	Content   string
+	Deleted   bool
+	Recursive bool // delete a directory tree
+}
+
+func NewDryRun() *DryRun {
+	return &DryRun{changes: make(map[string]*stagedChange)}
+}
+
+// Pending returns the number of staged changes.
+func (d *DryRun) Pending() int {
+	return len(d.order)
+}
+
+// handle runs a dry-run version of tool name. ok is false for tools it doesn't cover.
+func (d *DryRun) handle(name string, args json.RawMessage) (result string, ok bool, err error) {
+	switch name {
+	case "write_file":
+		result, err = d.write(args)
+	case "edit_file":
+		result, err = d.edit(args)
+	case "patch":
+		result, err = d.patch(args)
+	case "delete":
+		result, err = d.delete(args)
+	case "edit_notebook_cell":
+		result, err = d.editNotebookCell(args)
+	case "read_file":
+		result, ok, err = d.read(args)
+		return result, ok, err
+	case "read_notebook":
+		result, ok, err = d.readNotebook(args)
+		return result, ok, err
+	default:
+		return "", false, nil
+	}
+	return result, true, err
+}
+
+// current returns the content of path as the agent should see it.
+func (d *DryRun) current(path string) (string, error) {
+	if c, ok := d.changes[cleanPath(path)]; ok {
+		if c.Deleted {
+			return "", fmt.Errorf("%s: deleted (staged)", path)
+		}
+		return c.Content, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// stage records new content for path and returns the diff against its previous state.
+func (d *DryRun) stage(path, content string, deleted, recursive bool) string {
+	key := cleanPath(path)
+	before, _ := d.current(path)
+
+	c, ok := d.changes[key]
+	if !ok {
+		_, err := os.Lstat(path)
+		c = &stagedChange{Path: path, Existed: err == nil}
+		d.changes[key] = c
+		d.order = append(d.order, key)
+	}
+	c.Content = content
+	c.Deleted = deleted
+	c.Recursive = recursive
+
+	diff := unifiedDiff(path, path, splitLines(before), splitLines(content), 3)
+	if deleted && recursive {
+		diff = "(directory " + path + " would be removed)\n"
+	}
+	return diff
+}
+
+func (d *DryRun) write(args json.RawMessage) (string, error) {
+	var params struct {
+		Path    string `json:"path"`
+		Content string `json:"content"`
+		Mode    string `json:"mode"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", err
+	}
+	content := params.Content
+	if params.Mode == "append" {
+		before, _ := d.current(params.Path)
+		content = before + params.Content
+	} else {
+		full, done, msg := addWritePart(params.Path, params.Mode, params.Content)
+		if !done {
+			return msg, nil
+		}
+		content = full
+	}
+	diff := d.stage(params.Path, content, false, false)
+	return d.report(params.Path, fmt.Sprintf("staged write of %d bytes to %s", len(content), params.Path), diff), nil
+}
+
+func (d *DryRun) edit(args json.RawMessage) (string, error) {
+	var params struct {
+		Path    string `json:"path"`
+		OldText string `json:"old_text"`
+		NewText string `json:"new_text"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", err
+	}
+	content, err := d.current(params.Path)
+	if err != nil {
+		return fmt.Sprintf("error: %v", err), nil
+	}
+	newContent, errMsg := replaceUnique(content, params.OldText, params.NewText)
+	if errMsg != "" {
+		return errMsg, nil
+	}
+	diff := d.stage(params.Path, newContent, false, false)
+	return d.report(params.Path, "staged edit of "+params.Path, diff), nil
+}
+
+func (d *DryRun) patch(args json.RawMessage) (string, error) {
+	var params struct {
+		Path  string `json:"path"`
+		Patch string `json:"patch"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", err
+	}
+	content, err := d.current(params.Path)
+	if err != nil {
+		return fmt.Sprintf("error reading file: %v", err), nil
+	}
+	output, n, err := applyPatch(content, params.Patch)
+	if err != nil {
+		return fmt.Sprintf("error %v", err), nil
+	}
+	diff := d.stage(params.Path, output, false, false)
+	return d.report(params.Path, fmt.Sprintf("staged patch of %s (%d hunks)", params.Path, n), diff), nil
+}
+
+func (d *DryRun) editNotebookCell(args json.RawMessage) (string, error) {
+	var params notebookEdit
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", err
+	}
+	content, err := d.current(params.Path)
+	if err != nil {
+		return fmt.Sprintf("error reading notebook: %v", err), nil
+	}
+	out, summary, err := editNotebook([]byte(content), params)
+	if err != nil {
+		return fmt.Sprintf("error: %s: %v", params.Path, err), nil
+	}
+	diff := d.stage(params.Path, string(out), false, false)
+	return d.report(params.Path, "staged: "+summary+" in "+params.Path, diff), nil
+}
+
+func (d *DryRun) delete(args json.RawMessage) (string, error) {
+	var params struct {
+		Path      string `json:"path"`
+		Recursive bool   `json:"recursive"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", err
+	}
+	if _, ok := d.changes[cleanPath(params.Path)]; !ok {
+		info, err := os.Lstat(params.Path)
+		if err != nil {
+			return fmt.Sprintf("error: %v", err), nil
+		}
+		if info.IsDir() && !params.Recursive {
+			return "error: path is a directory, set recursive=true to delete", nil
+		}
+	}
+	diff := d.stage(params.Path, "", true, params.Recursive)
+	return d.report(params.Path, "staged delete of "+params.Path, diff), nil
+}
+
+func (d *DryRun) read(args json.RawMessage) (string, bool, error) {
+	var params struct {
+		Path   string `json:"path"`
+		Offset int    `json:"offset"`
+		Limit  int    `json:"limit"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", true, err
+	}
+	c, ok := d.changes[cleanPath(params.Path)]
+	if !ok {
+		return "", false, nil // not staged — read from disk as usual
+	}
+	if c.Deleted {
+		return fmt.Sprintf("error: %s is deleted (staged in dry-run)", params.Path), true, nil
+	}
+	return numberLines(c.Content, params.Offset, params.Limit), true, nil
+}
+
+// readNotebook renders a staged notebook; unstaged ones are read from disk.
+func (d *DryRun) readNotebook(args json.RawMessage) (string, bool, error) {
+	var params struct {
+		Path    string `json:"path"`
+		Outputs bool   `json:"outputs"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", true, err
+	}
+	c, ok := d.changes[cleanPath(params.Path)]
+	if !ok {
+		return "", false, nil
+	}
+	if c.Deleted {
+		return fmt.Sprintf("error: %s is deleted (staged in dry-run)", params.Path), true, nil
+	}
+	out, err := renderNotebook(params.Path, []byte(c.Content), params.Outputs)
+	if err != nil {
+		return fmt.Sprintf("error: %s: %v", params.Path, err), true, nil
+	}
+	return out, true, nil
+}
+
+// report prints the diff for the user and returns the tool result for the model.
+func (d *DryRun) report(path, summary, diff string) string {
+	if diff == "" {
+		diff = "(no changes)\n"
+	}
+	if plainOutput {
+		fmt.Printf("\033[2m%s\033[0m\n", strings.TrimRight(diff, "\n"))
+	} else {
+		fmt.Print(colorizeDiff(diff, path))
+	}
+	return "dry-run: " + summary + " (not written; user reviews with /apply)\n" + diff
+}
+
+// Apply writes all staged changes to disk, in the order they were first staged.
+func (d *DryRun) Apply() []string {
+	var results []string
+	for _, key := range d.order {
+		c := d.changes[key]
+		var err error
+		switch {
+		case c.Deleted && c.Recursive:
+			err = os.RemoveAll(c.Path)
+		case c.Deleted:
+			if c.Existed {
+				err = os.Remove(c.Path)
+			}
+		default:
+			if err = os.MkdirAll(filepath.Dir(c.Path), 0755); err == nil {
+				err = os.WriteFile(c.Path, []byte(c.Content), 0644)
+			}
+		}
+		if err != nil {
+			results = append(results, fmt.Sprintf("error %s: %v", c.Path, err))
+		} else if c.Deleted {
+			results = append(results, "deleted "+c.Path)
+		} else {
+			results = append(results, "wrote "+c.Path)
+		}
+	}
+	d.Discard()
+	return results
+}
+
+// Discard drops all staged changes.
+func (d *DryRun) Discard() {
+	d.changes = make(map[string]*stagedChange)
+	d.order = nil
+}
+
+// Summary lists staged paths with their kind of change.
+func (d *DryRun) Summary() []string {
+	var lines []string
+	for _, key := range d.order {
+		c := d.changes[key]
+		kind := "modify"
+		switch {
+		case c.Deleted:
+			kind = "delete"
+		case !c.Existed:
+			kind = "create"
+		}
+		lines = append(lines, fmt.Sprintf("%-6s %s", kind, c.Path))
+	}
+	return lines
+}
+
+func cleanPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+	"google.golang.org/genai"
+)
+
+// Embedder turns texts into vectors for similarity search.
+type Embedder interface {
+	// ID identifies the embedding space; cached vectors from another ID are discarded.
+	ID() string
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// NewEmbedder builds the embedder named by memory config. "local" (the
+// default) needs no API; "openai", "ollama", and "gemini" reuse that
+// provider's credentials from the providers map.
+func NewEmbedder(cfg Config) (Embedder, error) {
+	mc := cfg.Memory
+	switch mc.Embeddings {
+	case "", "local":
+		return localEmbedder{}, nil
+	case "openai":
+		pc := cfg.ProviderKeyCfg("openai")
+		if pc.APIKey == "" {
+			return nil, fmt.Errorf("openai embeddings need providers.openai.api_key")
+		}
+		hc, err := embedderHTTPClient("openai", pc)
+		if err != nil {
+			return nil, err
+		}
+		opts := []option.RequestOption{option.WithAPIKey(pc.APIKey), option.WithHTTPClient(hc)}
+		if pc.URL != "" {
+			opts = append(opts, option.WithBaseURL(pc.URL))
+		}
+		return newOpenAIEmbedder("openai", orDefault(mc.Model, "text-embedding-3-small"), opts), nil
+	case "ollama":
+		pc := cfg.ProviderCfg("ollama")
+		url := pc.URL
+		if url == "" {
+			url = "http://localhost:11434"
+		}
+		hc, err := embedderHTTPClient("ollama", pc)
+		if err != nil {
+			return nil, err
+		}
+		opts := []option.RequestOption{option.WithBaseURL(url + "/v1/"), option.WithAPIKey("ollama"), option.WithHTTPClient(hc)}
+		return newOpenAIEmbedder("ollama", orDefault(mc.Model, "nomic-embed-text"), opts), nil
+	case "gemini":
+		pc := cfg.ProviderKeyCfg("gemini")
+		if pc.APIKey == "" {
+			return nil, fmt.Errorf("gemini embeddings need providers.gemini.api_key")
+		}
+		hc, err := embedderHTTPClient("gemini", pc)
+		if err != nil {
+			return nil, err
+		}
+		client, err := genai.NewClient(context.Background(), &genai.ClientConfig{APIKey: pc.APIKey, Backend: genai.BackendGeminiAPI, HTTPClient: hc})
+		if err != nil {
+			return nil, fmt.Errorf("creating gemini client: %w", err)
+		}
+		return &geminiEmbedder{client: client, model: orDefault(mc.Model, "text-embedding-004")}, nil
+	default:
+		return nil, fmt.Errorf("unknown embeddings backend: %s", mc.Embeddings)
+	}
+}
+
+// embedderHTTPClient uses the provider's proxy and TLS settings, but not its
+// timeouts or rate tracking, which belong to the agent loop's calls.
+func embedderHTTPClient(provider string, pc ProviderConfig) (*http.Client, error) {
+	rt, err := providerTransport(provider, pc)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Transport: rt}, nil
+}
+
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
+
+// --- OpenAI-compatible (OpenAI, Ollama) ---
+
+type openAIEmbedder struct {
+	client  openai.Client
+	backend string
+	model   string
+}
+
+func newOpenAIEmbedder(backend, model string, opts []option.RequestOption) *openAIEmbedder {
+	return &openAIEmbedder{client: openai.NewClient(opts...), backend: backend, model: model}
+}
+
+func (e *openAIEmbedder) ID() string { return e.backend + ":" + e.model }
+
+func (e *openAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	resp, err := e.client.Embeddings.New(ctx, openai.EmbeddingNewParams{
+		Model: e.model,
+		Input: openai.EmbeddingNewParamsInputUnion{OfArrayOfStrings: texts},
+	})
+	if err != nil {
+		return nil, err
+	}
+	vecs := make([][]float32, len(texts))
+	for _, d := range resp.Data {
+		if int(d.Index) >= len(vecs) {
+			continue
+		}
+		v := make([]float32, len(d.Embedding))
+		for i, f := range d.Embedding {
+			v[i] = float32(f)
+		}
+		vecs[d.Index] = v
+	}
+	return vecs, nil
+}
+
+// --- Gemini ---
+
+type geminiEmbedder struct {
+	client *genai.Client
+	model  string
+}
+
+func (e *geminiEmbedder) ID() string { return "gemini:" + e.model }
+
+func (e *geminiEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	var contents []*genai.Content
+	for _, t := range texts {
+		contents = append(contents, genai.NewContentFromText(t, genai.RoleUser))
+	}
+	resp, err := e.client.Models.EmbedContent(ctx, e.model, contents, nil)
+	if err != nil {
+		return nil, err
+	}
+	vecs := make([][]float32, len(texts))
+	for i, emb := range resp.Embeddings {
+		if i < len(vecs) && emb != nil {
+			vecs[i] = emb.Values
+		}
+	}
+	return vecs, nil
+}
+
+// --- Local hashed bag-of-words ---
+
+// localEmbedder hashes words and word bigrams into a fixed-size vector
+// (feature hashing). No model, no network — weaker than real embeddings
+// but enough to rank memory entries by shared vocabulary.
+type localEmbedder struct{}
+
+const localEmbedDims = 1024
+
+var reWord = regexp.MustCompile(`[\p{L}\p{N}_]{2,}`)
+
+var stopWords = map[string]bool{
+	"the": true, "and": true, "for": true, "are": true, "with": true, "this": true,
+	"that": true, "from": true, "you": true, "use": true, "was": true, "not": true,
+	"but": true, "have": true, "has": true, "its": true, "into": true, "when": true,
+	"all": true, "can": true, "should": true, "will": true, "our": true, "your": true,
+}
+
+func (localEmbedder) ID() string { return fmt.Sprintf("local:hash%d", localEmbedDims) }
+
+func (localEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vecs := make([][]float32, len(texts))
+	for i, t := range texts {
+		vecs[i] = hashEmbed(t)
+	}
+	return vecs, nil
+}
+
+func hashEmbed(text string) []float32 {
+	v := make([]float32, localEmbedDims)
+	var words []string
+	for _, w := range reWord.FindAllString(strings.ToLower(text), -1) {
+		if !stopWords[w] {
+			words = append(words, w)
+		}
+	}
+	add := func(term string, weight float32) {
+		h := fnv.New32a()
+		h.Write([]byte(term))
+		sum := h.Sum32()
+		sign := float32(1)
+		if sum&1 == 1 {
+			sign = -1 // signed hashing reduces collision bias
+		}
+		v[(sum>>1)%localEmbedDims] += sign * weight
+	}
+	for i, w := range words {
+		add(w, 1)
+		if i > 0 {
+			add(words[i-1]+" "+w, 0.5)
+		}
+	}
+	normalize(v)
+	return v
+}
+
+func normalize(v []float32) {
+	var sum float64
+	for _, f := range v {
+		sum += float64(f) * float64(f)
+	}
+	if sum == 0 {
+		return
+	}
+	n := float32(math.Sqrt(sum))
+	for i := range v {
+		v[i] /= n
+	}
+}
+
+// cosine returns the cosine similarity of two vectors (0 if lengths differ).
+func cosine(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
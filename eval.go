@@ -0,0 +1,353 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// evalSuite is a `simpleagent eval` file: prompts run headless against an
+// agent, each followed by assertions on what it did.
+type evalSuite struct {
+	Agent    string     `yaml:"agent"`     // .agent file, relative to the suite; empty = plain config
+	Setup    string     `yaml:"setup"`     // shell command before every case, e.g. resetting a fixture
+	MaxTurns int        `yaml:"max_turns"` // LLM calls per case; 0 = config's max_turns
+	Timeout  int        `yaml:"timeout"`   // seconds per case; 0 = none
+	Cases    []evalCase `yaml:"cases"`
+}
+
+type evalCase struct {
+	Name   string       `yaml:"name"`
+	Prompt string       `yaml:"prompt"`
+	Setup  string       `yaml:"setup"` // after the suite's setup
+	Assert []evalAssert `yaml:"assert"`
+}
+
+// evalAssert is one check; set one of its forms.
+type evalAssert struct {
+	FileExists string `yaml:"file_exists"` // path the agent must have created
+	Output     string `yaml:"output"`      // regexp the agent's replies must match
+	Command    string `yaml:"command"`     // validation command (sh -c) ...
+	ExitCode   int    `yaml:"exit_code"`   // ... and the exit code it must return
+}
+
+// evalResult is one case's outcome, also the --json output.
+type evalResult struct {
+	Name     string   `json:"name"`
+	Passed   bool     `json:"passed"`
+	Failures []string `json:"failures,omitempty"`
+	Session  string   `json:"session"`
+	Calls    int      `json:"llm_calls"`
+	Tools    int      `json:"tool_calls"`
+	Tokens   int      `json:"tokens"`
+	CostUSD  float64  `json:"cost_usd"`
+	Unpriced bool     `json:"unpriced,omitempty"` // some calls have no price
+	Seconds  float64  `json:"seconds"`
+}
+
+type evalOptions struct {
+	provider, model, profile, run string
+	json                          bool
+}
+
+func evalFlags(o *evalOptions) *flag.FlagSet {
+	fs := flag.NewFlagSet("eval", flag.ExitOnError)
+	fs.StringVar(&o.provider, "provider", "", "LLM provider")
+	fs.StringVar(&o.model, "model", "", "Model name")
+	fs.StringVar(&o.profile, "profile", "", "Config profile to use")
+	fs.StringVar(&o.run, "run", "", "Only cases whose name matches this regexp")
+	fs.BoolVar(&o.json, "json", false, "Print the results as JSON")
+	return fs
+}
+
+// runEval handles `simpleagent eval <suite.yaml>`: each case gets a fresh
+// session in action mode, like serve, then its assertions are checked.
+// Exits 1 when a case fails.
+func runEval(args []string) {
+	var opt evalOptions
+	fs := evalFlags(&opt)
+	// The suite may come before, between or after the flags
+	var path string
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		path = fs.Arg(0)
+		fs.Parse(fs.Args()[1:])
+	}
+	if path == "" {
+		fmt.Fprintln(os.Stderr, "Usage: simpleagent eval <suite.yaml> [--run regexp] [--provider p] [--model m] [--json]")
+		os.Exit(1)
+	}
+	suite, err := loadEvalSuite(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	var only *regexp.Regexp
+	if opt.run != "" {
+		if only, err = regexp.Compile(opt.run); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --run: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	configProfile = opt.profile
+	cfg := LoadConfig()
+	sessionStorage = cfg.Storage
+	var agentFile *AgentFile
+	var agentArg string // after --replay <id>: sessions live under the agent's dir
+	if suite.Agent != "" {
+		target := suite.Agent
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(path), target)
+		}
+		if agentFile, err = ParseAgentFile(target); err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading %s: %v\n", target, err)
+			os.Exit(1)
+		}
+		agentFile.ApplyEnv()
+		ResolveAgentDir(filepath.Base(target))
+		agentArg = " " + target
+	} else {
+		ResolveAgentDir("")
+	}
+	pruneScratch()
+	cfg.ApplyAgentFile(agentFile)
+	if opt.provider != "" {
+		cfg.Provider = opt.provider
+	}
+	if opt.model != "" {
+		pc := cfg.Providers[cfg.Provider]
+		pc.Model = opt.model
+		cfg.Providers[cfg.Provider] = pc
+	}
+	if suite.MaxTurns > 0 {
+		cfg.MaxTurns = suite.MaxTurns
+	}
+	if !providerReady(cfg) {
+		fmt.Fprintln(os.Stderr, "Error: no provider configured (run simpleagent --setup first)")
+		os.Exit(1)
+	}
+	llm, err := NewProvider(cfg.Provider, cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer shutdownProcesses()
+
+	var results []evalResult
+	for _, c := range suite.Cases {
+		if only != nil && !only.MatchString(c.Name) {
+			continue
+		}
+		if !opt.json && !plainOutput {
+			fmt.Printf("\033[2m… %s\033[0m", c.Name)
+		}
+		r := runEvalCase(llm, cfg, agentFile, suite, c)
+		results = append(results, r)
+		if !opt.json {
+			renderEvalResult(r, agentArg)
+		}
+	}
+
+	failed := 0
+	for _, r := range results {
+		if !r.Passed {
+			failed++
+		}
+	}
+	if opt.json {
+		printJSON(results)
+	} else {
+		renderEvalSummary(results, failed)
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// loadEvalSuite reads and checks a suite file.
+func loadEvalSuite(path string) (*evalSuite, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s evalSuite
+	if err := yaml.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(s.Cases) == 0 {
+		return nil, fmt.Errorf("%s: no cases", path)
+	}
+	for i, c := range s.Cases {
+		if c.Name == "" {
+			s.Cases[i].Name = fmt.Sprintf("case %d", i+1)
+		}
+		if strings.TrimSpace(c.Prompt) == "" {
+			return nil, fmt.Errorf("%s: %s has no prompt", path, s.Cases[i].Name)
+		}
+		for _, a := range c.Assert {
+			if a.Output != "" {
+				if _, err := regexp.Compile(a.Output); err != nil {
+					return nil, fmt.Errorf("%s: %s: output: %w", path, s.Cases[i].Name, err)
+				}
+			}
+			if a.FileExists == "" && a.Output == "" && a.Command == "" {
+				return nil, fmt.Errorf("%s: %s: an assertion needs file_exists, output or command", path, s.Cases[i].Name)
+			}
+		}
+	}
+	return &s, nil
+}
+
+// runEvalCase runs one prompt headless and checks its assertions.
+func runEvalCase(llm Provider, cfg Config, af *AgentFile, suite *evalSuite, c evalCase) evalResult {
+	start := time.Now()
+	r := evalResult{Name: c.Name}
+	for _, setup := range []string{suite.Setup, c.Setup} {
+		if setup == "" {
+			continue
+		}
+		if out, err := exec.Command("sh", "-c", setup).CombinedOutput(); err != nil {
+			r.Failures = append(r.Failures, fmt.Sprintf("setup %q: %v: %s", setup, err, truncate(strings.TrimSpace(string(out)), 200)))
+			r.Seconds = time.Since(start).Seconds()
+			return r
+		}
+	}
+
+	a := NewAgent(llm, cfg, nil, af)
+	a.mode = ModeAction
+	r.Session = a.session.ID
+	var output strings.Builder
+	a.sink = func(ev AgentEvent) {
+		switch ev.Type {
+		case "text":
+			output.WriteString(ev.Text)
+		case "tool_call":
+			r.Tools++
+		case "usage":
+			r.Calls++
+			r.Tokens += ev.Usage.PromptTokens() + ev.Usage.OutputTokens
+			price, ok := priceFor(a.llm.Name(), a.llmModel, cfg.Budget.Prices)
+			r.CostUSD += usageCost(ev.Usage, price)
+			r.Unpriced = r.Unpriced || !ok
+		case "error":
+			r.Failures = append(r.Failures, "error: "+ev.Text)
+		case "paused":
+			r.Failures = append(r.Failures, ev.Text)
+		}
+	}
+	ctx := context.Background()
+	if suite.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(suite.Timeout)*time.Second)
+		defer cancel()
+	}
+	a.addUserMessage(c.Prompt)
+	a.runAgentLoopCtx(ctx)
+	cleanScratch(a.session.ID)
+	if ctx.Err() != nil {
+		r.Failures = append(r.Failures, fmt.Sprintf("timed out after %ds", suite.Timeout))
+	}
+
+	for _, as := range c.Assert {
+		if msg := as.check(output.String()); msg != "" {
+			r.Failures = append(r.Failures, msg)
+		}
+	}
+	r.Passed = len(r.Failures) == 0
+	r.Seconds = time.Since(start).Seconds()
+	return r
+}
+
+// check returns why the assertion failed, "" when it holds.
+func (as evalAssert) check(output string) string {
+	if as.FileExists != "" {
+		if _, err := os.Stat(as.FileExists); err != nil {
+			return fmt.Sprintf("file_exists %s: not found", as.FileExists)
+		}
+	}
+	if as.Output != "" && !regexp.MustCompile(as.Output).MatchString(output) {
+		return fmt.Sprintf("output doesn't match %q", as.Output)
+	}
+	if as.Command != "" {
+		out, err := exec.Command("sh", "-c", as.Command).CombinedOutput()
+		code := 0
+		var exitErr *exec.ExitError
+		switch {
+		case errors.As(err, &exitErr):
+			code = exitErr.ExitCode()
+		case err != nil:
+			return fmt.Sprintf("command %q: %v", as.Command, err)
+		}
+		if code != as.ExitCode {
+			msg := fmt.Sprintf("command %q exited %d, want %d", as.Command, code, as.ExitCode)
+			if tail := strings.TrimSpace(string(out)); tail != "" {
+				msg += ": " + truncate(tail[max(0, strings.LastIndex(tail, "\n")+1):], 120)
+			}
+			return msg
+		}
+	}
+	return ""
+}
+
+// renderEvalResult prints one case; suffix follows the session ID in the
+// --replay hint (the agent file, if any).
+func renderEvalResult(r evalResult, suffix string) {
+	cost := fmt.Sprintf("$%.2f", r.CostUSD)
+	if r.Unpriced {
+		cost += "+?"
+	}
+	stats := fmt.Sprintf("llm %d, tools %d, %.1fk tokens, %s, %.1fs", r.Calls, r.Tools, float64(r.Tokens)/1000, cost, r.Seconds)
+	switch {
+	case plainOutput && r.Passed:
+		fmt.Printf("ok   %s  (%s)\n", r.Name, stats)
+	case plainOutput:
+		fmt.Printf("FAIL %s  (%s)\n", r.Name, stats)
+	case r.Passed:
+		fmt.Printf("\r\033[K\033[32m✓\033[0m %s  \033[2m(%s)\033[0m\n", r.Name, stats)
+	default:
+		fmt.Printf("\r\033[K\033[31m✗\033[0m %s  \033[2m(%s)\033[0m\n", r.Name, stats)
+	}
+	if r.Passed {
+		return
+	}
+	for _, f := range r.Failures {
+		fmt.Printf("    %s\n", f)
+	}
+	if r.Session != "" {
+		fmt.Printf("    replay: simpleagent --replay %s%s\n", r.Session, suffix)
+	}
+}
+
+func renderEvalSummary(results []evalResult, failed int) {
+	var tokens int
+	var cost float64
+	unpriced := false
+	for _, r := range results {
+		tokens += r.Tokens
+		cost += r.CostUSD
+		unpriced = unpriced || r.Unpriced
+	}
+	costStr := fmt.Sprintf("$%.2f", cost)
+	if unpriced {
+		costStr += "+?"
+	}
+	summary := fmt.Sprintf("%d/%d passed", len(results)-failed, len(results))
+	if !plainOutput {
+		color := "\033[32m"
+		if failed > 0 {
+			color = "\033[31m"
+		}
+		summary = color + summary + "\033[0m"
+	}
+	fmt.Printf("\n%s · %.1fk tokens · %s\n", summary, float64(tokens)/1000, costStr)
+}
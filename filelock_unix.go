@@ -0,0 +1,24 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// canReplaceLockedFile: a locked lock file can be removed and recreated,
+// which is how --force takes over a session.
+const canReplaceLockedFile = true
+
+// tryLockFile takes an exclusive flock on f without waiting; errLockHeld
+// when another open file holds it. The lock goes away with the descriptor,
+// including when the process dies.
+func tryLockFile(f *os.File) error {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return errLockHeld
+	}
+	return err
+}
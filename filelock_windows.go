@@ -0,0 +1,40 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32       = syscall.NewLazyDLL("kernel32.dll")
+	procLockFileEx = kernel32.NewProc("LockFileEx")
+)
+
+const (
+	lockfileFailImmediately = 1
+	lockfileExclusiveLock   = 2
+	errorLockViolation      = syscall.Errno(33)
+)
+
+// canReplaceLockedFile is false: the holder's open handle keeps the lock
+// file from being removed, so --force can't take over a live session.
+const canReplaceLockedFile = false
+
+// tryLockFile takes an exclusive LockFileEx lock on f without waiting;
+// errLockHeld when another handle holds it. The locked byte is far past
+// the PID written at the start, since Windows locks block reads of the
+// range they cover. The lock goes away with the handle.
+func tryLockFile(f *os.File) error {
+	ol := syscall.Overlapped{OffsetHigh: 1}
+	r, _, err := procLockFileEx.Call(f.Fd(), lockfileExclusiveLock|lockfileFailImmediately, 0, 1, 0, uintptr(unsafe.Pointer(&ol)))
+	if r != 0 {
+		return nil
+	}
+	if err == errorLockViolation {
+		return errLockHeld
+	}
+	return err
+}
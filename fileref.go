@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// @-mentions in user input: @name is a snippet (snippets.go), @path and
+// @path:from-to attach a file's contents to the message, numbered like
+// read_file, so the model doesn't spend a turn reading it.
+
+var (
+	mentionToken = regexp.MustCompile(`(^|\s)@(\S+)`)
+	fileRefRange = regexp.MustCompile(`^(.+):(\d+)(?:-(\d+))?$`)
+)
+
+const fileRefMaxBytes = 100 * 1024 // larger files need a line range
+
+// replaceMentions calls fn with each @reference in input and substitutes the
+// text it returns. When fn declines a reference that ends in punctuation
+// ("see @main.go."), it is offered again without it.
+func replaceMentions(input string, fn func(ref string) (string, bool)) string {
+	return mentionToken.ReplaceAllStringFunc(input, func(m string) string {
+		sub := mentionToken.FindStringSubmatch(m)
+		ref := sub[2]
+		if text, ok := fn(ref); ok {
+			return sub[1] + text
+		}
+		if trimmed := strings.TrimRight(ref, `.,;:!?)"'`); trimmed != ref && trimmed != "" {
+			if text, ok := fn(trimmed); ok {
+				return sub[1] + text + ref[len(trimmed):]
+			}
+		}
+		return m
+	})
+}
+
+// expandInput applies snippets, then file references (so a snippet can
+// name files too).
+func (a *Agent) expandInput(input string) string {
+	return a.expandFileRefs(expandSnippets(input))
+}
+
+// expandFileRefs replaces each @path that names a file with the bare path and
+// appends the file's contents to the message. References to nothing are left
+// as typed; directories, binary and oversized files are left with a warning.
+func (a *Agent) expandFileRefs(input string) string {
+	if !strings.Contains(input, "@") {
+		return input
+	}
+	var blocks, used []string
+	seen := make(map[string]bool)
+	out := replaceMentions(input, func(ref string) (string, bool) {
+		path, from, to := parseFileRef(ref)
+		content, err := a.refContent(path)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				fmt.Fprintf(os.Stderr, "Warning: @%s not attached: %v\n", ref, err)
+			}
+			return "", false
+		}
+		if !seen[ref] {
+			seen[ref] = true
+			block, desc, err := fileRefBlock(path, content, from, to)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: @%s not attached: %v\n", ref, err)
+				return "", false
+			}
+			blocks = append(blocks, block)
+			used = append(used, desc)
+		}
+		return ref, true
+	})
+	if len(blocks) == 0 {
+		return input
+	}
+	if !plainOutput {
+		fmt.Printf("\033[2m(attached %s)\033[0m\n", strings.Join(used, ", "))
+	}
+	return out + "\n\n" + strings.Join(blocks, "\n\n")
+}
+
+// parseFileRef splits path:from-to; from and to are 0 for the whole file, and
+// to equals from for a single line. A path that itself contains ":N" and
+// exists is taken as is.
+func parseFileRef(ref string) (path string, from, to int) {
+	m := fileRefRange.FindStringSubmatch(ref)
+	if m == nil || fileExists(ref) {
+		return ref, 0, 0
+	}
+	from, _ = strconv.Atoi(m[2])
+	to = from
+	if m[3] != "" {
+		to, _ = strconv.Atoi(m[3])
+	}
+	return m[1], from, to
+}
+
+// refContent reads a referenced file, staged content included in dry-run.
+func (a *Agent) refContent(path string) (string, error) {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return "", fmt.Errorf("%s is a directory", path)
+	}
+	return a.tools.fileContent(path)
+}
+
+// fileRefBlock formats the attachment for path and describes it for the
+// "(attached ...)" note.
+func fileRefBlock(path, content string, from, to int) (block, desc string, err error) {
+	if strings.IndexByte(content[:min(len(content), 8000)], 0) >= 0 {
+		return "", "", fmt.Errorf("binary file")
+	}
+	lines := strings.Count(strings.TrimSuffix(content, "\n"), "\n") + 1
+	if from == 0 {
+		if len(content) > fileRefMaxBytes {
+			return "", "", fmt.Errorf("%d KB is too large to attach; give a line range (@%s:1-200)", len(content)/1024, path)
+		}
+		return fmt.Sprintf("<file path=%q>\n%s</file>", path, numberLines(strings.TrimSuffix(content, "\n"), 0, 0)),
+			fmt.Sprintf("%s (%d line(s))", path, lines), nil
+	}
+	if to < from {
+		from, to = to, from
+	}
+	if from < 1 || from > lines {
+		return "", "", fmt.Errorf("line %d is out of range; %s has %d lines", from, path, lines)
+	}
+	to = min(to, lines)
+	text := numberLines(strings.TrimSuffix(content, "\n"), from, to-from+1)
+	if len(text) > fileRefMaxBytes {
+		return "", "", fmt.Errorf("lines %d-%d are %d KB; give a smaller range", from, to, len(text)/1024)
+	}
+	return fmt.Sprintf("<file path=%q lines=\"%d-%d\">\n%s</file>", path, from, to, text),
+		fmt.Sprintf("%s:%d-%d", path, from, to), nil
+}
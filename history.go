@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Prompt history (opt-in via "track_prompts": true) records top-level user
+// prompts per agent so recurring workflows can be turned into .agent files.
+
+const suggestThreshold = 3 // similar prompts before hinting at /suggest-agent
+
+type promptRecord struct {
+	Time    string `json:"time"`
+	Session string `json:"session"`
+	Text    string `json:"text"`
+}
+
+// promptPattern groups prompts that normalize to the same key.
+type promptPattern struct {
+	Key      string
+	Count    int
+	Examples []string
+}
+
+func promptHistoryPath() string {
+	return filepath.Join(agentDir, "prompt_history.jsonl")
+}
+
+// recordPrompt appends a prompt to the history file.
+func recordPrompt(sessionID, text string) {
+	os.MkdirAll(agentDir, 0755)
+	f, err := os.OpenFile(promptHistoryPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	data, _ := json.Marshal(promptRecord{Time: time.Now().Format(time.RFC3339), Session: sessionID, Text: text})
+	f.Write(append(data, '\n'))
+}
+
+func loadPromptHistory() []promptRecord {
+	f, err := os.Open(promptHistoryPath())
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var records []promptRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var r promptRecord
+		if json.Unmarshal(scanner.Bytes(), &r) == nil && r.Text != "" {
+			records = append(records, r)
+		}
+	}
+	return records
+}
+
+var (
+	reQuoted   = regexp.MustCompile(`"[^"]*"|'[^']*'|` + "`[^`]*`")
+	rePathLike = regexp.MustCompile(`\S*[/\\.]\S*`)
+	reNumber   = regexp.MustCompile(`\d+`)
+	reNonWord  = regexp.MustCompile(`[^a-z_ ]+`)
+)
+
+// normalizePrompt reduces a prompt to its leading intent words, dropping
+// paths, quoted strings, and numbers so "fix test in a.go" ≈ "fix test in b.go".
+func normalizePrompt(text string) string {
+	s := strings.ToLower(text)
+	s = reQuoted.ReplaceAllString(s, " ")
+	s = rePathLike.ReplaceAllString(s, " ")
+	s = reNumber.ReplaceAllString(s, " ")
+	s = reNonWord.ReplaceAllString(s, " ")
+	words := strings.Fields(s)
+	if len(words) > 5 {
+		words = words[:5]
+	}
+	return strings.Join(words, " ")
+}
+
+// recurringPatterns returns prompt groups seen at least min times, most frequent first.
+func recurringPatterns(records []promptRecord, min int) []promptPattern {
+	groups := make(map[string]*promptPattern)
+	for _, r := range records {
+		key := normalizePrompt(r.Text)
+		if key == "" {
+			continue
+		}
+		g, ok := groups[key]
+		if !ok {
+			g = &promptPattern{Key: key}
+			groups[key] = g
+		}
+		g.Count++
+		if len(g.Examples) < 5 {
+			g.Examples = append(g.Examples, truncate(r.Text, 200))
+		}
+	}
+
+	var result []promptPattern
+	for _, g := range groups {
+		if g.Count >= min {
+			result = append(result, *g)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Key < result[j].Key
+	})
+	return result
+}
+
+// trackPrompt records text and prints a hint once a pattern becomes recurring.
+func trackPrompt(sessionID, text string) {
+	recordPrompt(sessionID, text)
+	key := normalizePrompt(text)
+	for _, p := range recurringPatterns(loadPromptHistory(), suggestThreshold) {
+		if p.Key == key && p.Count == suggestThreshold {
+			fmt.Printf("\033[2m── you've run %d similar prompts; /suggest-agent can turn this into an .agent file ──\033[0m\n", p.Count)
+		}
+	}
+}
+
+// suggestAgentPrompt builds the request asking the model to propose an .agent
+// file for the recurring workflows. Returns "" when there is nothing recurring.
+func suggestAgentPrompt() string {
+	patterns := recurringPatterns(loadPromptHistory(), 2)
+	if len(patterns) == 0 {
+		return ""
+	}
+	if len(patterns) > 5 {
+		patterns = patterns[:5]
+	}
+
+	var sb strings.Builder
+	sb.WriteString("I keep running similar prompts. Propose a reusable .agent file that encapsulates the most common workflow below.\n\n")
+	for _, p := range patterns {
+		fmt.Fprintf(&sb, "Pattern %q (%d times):\n", p.Key, p.Count)
+		for _, ex := range p.Examples {
+			fmt.Fprintf(&sb, "  - %s\n", ex)
+		}
+		sb.WriteString("\n")
+	}
+	sb.WriteString("The .agent format:\n\n" + agentFileFormat + "\n\n")
+	sb.WriteString("Explore the project as needed so the prompt is specific. Show me the full file and a suggested filename (name.agent). ")
+	sb.WriteString("Use ask_user to confirm before writing it with write_file.")
+	return sb.String()
+}
@@ -3,13 +3,20 @@ package main
 import (
 	"fmt"
 	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strings"
+	"unicode/utf8"
 
 	"golang.org/x/term"
 )
 
-// readLine reads a line of input with raw mode support for Shift+Tab detection.
-// Returns the input string and whether the user toggled mode (via Shift+Tab).
-// On EOF (Ctrl+D), returns "", false with err set.
+// readLine reads the user's input in raw mode with the line editor
+// (lineedit.go): cursor keys, several lines, bracketed paste, Shift+Tab to
+// toggle the mode, Tab completion, and vi keys when input.keybindings is
+// "vi".
+// On EOF (Ctrl+D on an empty line), returns "" with err set.
 // Falls back to simple line reading if raw mode is unavailable.
 func (a *Agent) readLine() (string, error) {
 	fd := int(os.Stdin.Fd())
@@ -22,91 +29,96 @@ func (a *Agent) readLine() (string, error) {
 	if err != nil {
 		return a.readLineSimple()
 	}
-	defer term.Restore(fd, oldState)
-
-	var buf []byte
-	esc := make([]byte, 0, 4) // accumulate escape sequences
+	e := &lineEditor{a: a, vi: a.cfg.Input.Keybindings == "vi"}
+	fmt.Print("\033[?2004h") // bracketed paste: pasted newlines don't submit
+	e.cursorShape()
+	restore := func() {
+		fmt.Print("\033[?2004l")
+		if e.vi {
+			fmt.Print("\033[0 q") // the terminal's own cursor again
+		}
+		term.Restore(fd, oldState)
+	}
+	defer restore()
 
+	chunk := make([]byte, 4096)
+	var carry []byte // a UTF-8 sequence split between reads
 	for {
-		b := make([]byte, 1)
-		n, err := os.Stdin.Read(b)
+		n, err := os.Stdin.Read(chunk)
 		if err != nil || n == 0 {
-			// Restore before returning
-			term.Restore(fd, oldState)
 			return "", fmt.Errorf("EOF")
 		}
-
-		ch := b[0]
-
-		// If we're in an escape sequence
-		if len(esc) > 0 {
-			esc = append(esc, ch)
-
-			// ESC [ Z = Shift+Tab
-			if len(esc) == 3 && esc[0] == 0x1b && esc[1] == '[' && esc[2] == 'Z' {
-				esc = esc[:0]
-				a.toggleMode()
-				// Reprint the prompt on a new line
-				fmt.Print("\r\033[K" + a.prompt())
-				// Reprint current buffer
-				fmt.Print(string(buf))
-				continue
+		data := append(carry, chunk[:n]...)
+		carry = nil
+		pasted := false
+		for len(data) > 0 {
+			if data[0] != 0x1b && !utf8.FullRune(data) {
+				carry = slices.Clone(data)
+				break
 			}
-
-			// ESC [ <other> — other escape sequences, just discard
-			if len(esc) >= 3 {
-				esc = esc[:0]
+			k, size := parseKey(data)
+			data = data[size:]
+			// Without bracketed paste, an Enter with more input behind it in
+			// the same read is a pasted newline: typing sends it alone
+			if e.pasting || k.r == '\r' && len(data) > 0 || k.r == '\n' && e.pasteCR {
+				if k.name == "paste-end" {
+					e.pasting = false
+				} else {
+					e.paste(k)
+				}
+				pasted = true
 				continue
 			}
-
-			// ESC followed by something other than [
-			if len(esc) == 2 && esc[1] != '[' {
-				esc = esc[:0]
+			switch {
+			case k.name == "paste-start":
+				e.pasting, e.pasteCR = true, false
+				continue
+			case k.r == 0x03: // Ctrl+C
+				fmt.Print("^C\r\n")
+				restore()
+				unlockSessions()
+				os.Exit(0)
+			case k.r == 0x04: // Ctrl+D
+				if len(e.buf) == 0 {
+					fmt.Print("\r\n")
+					return "", fmt.Errorf("EOF")
+				}
 				continue
 			}
-
-			continue
-		}
-
-		switch ch {
-		case 0x1b: // ESC - start of escape sequence
-			esc = append(esc, ch)
-
-		case '\r', '\n': // Enter
-			fmt.Print("\r\n")
-			term.Restore(fd, oldState)
-			return string(buf), nil
-
-		case 0x03: // Ctrl+C
-			fmt.Print("^C\r\n")
-			term.Restore(fd, oldState)
-			os.Exit(0)
-
-		case 0x04: // Ctrl+D
-			if len(buf) == 0 {
-				fmt.Print("\r\n")
-				term.Restore(fd, oldState)
-				return "", fmt.Errorf("EOF")
-			}
-
-		case 0x7f, 0x08: // Backspace / Delete
-			if len(buf) > 0 {
-				buf = buf[:len(buf)-1]
-				fmt.Print("\b \b")
+			if e.key(k) {
+				return e.finish(), nil
 			}
-
-		case '\t': // Regular tab — insert spaces or ignore
-			// ignore tabs in input
-
-		default:
-			if ch >= 0x20 { // printable
-				buf = append(buf, ch)
-				fmt.Print(string(ch))
+			if e.edit {
+				e.edit = false
+				restore()
+				text, err := composeInEditor(string(e.buf))
+				fmt.Print("\033[?2004h")
+				e.cursorShape()
+				term.MakeRaw(fd)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "\r\nError: %v\r\n", err)
+					e.row = 0
+				} else if text != "" {
+					e.buf, e.pos = []rune(text), len([]rune(text))
+					e.redraw()
+					return e.finish(), nil
+				}
+				e.redraw()
 			}
 		}
+		if pasted {
+			e.redraw()
+		}
 	}
 }
 
+// composeInEditor opens the message in $EDITOR (Ctrl+X Ctrl+E, /editor)
+// and returns what was saved, trimmed; "" means nothing to send.
+func composeInEditor(initial string) (string, error) {
+	text, err := openInEditor(initial, ".md")
+	return strings.TrimSpace(text), err
+}
+
 func (a *Agent) readLineSimple() (string, error) {
 	var buf []byte
 	b := make([]byte, 1)
@@ -134,3 +146,82 @@ func (a *Agent) toggleMode() {
 		fmt.Print("\r\033[K\033[36mSwitched to PLAN mode.\033[0m\n")
 	}
 }
+
+// openInEditor lets the user edit text in $VISUAL / $EDITOR (vi, or notepad
+// on Windows) and returns the saved result. suffix picks the temp file extension.
+func openInEditor(initial, suffix string) (string, error) {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+		if runtime.GOOS == "windows" {
+			editor = "notepad"
+		}
+	}
+
+	f, err := os.CreateTemp("", "simpleagent-*"+suffix)
+	if err != nil {
+		return "", err
+	}
+	path := f.Name()
+	defer os.Remove(path)
+	if _, err := f.WriteString(initial); err != nil {
+		f.Close()
+		return "", err
+	}
+	f.Close()
+
+	// Run through the shell so EDITOR may carry flags ("code --wait")
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/c", editor+" "+path)
+	} else {
+		cmd = exec.Command("sh", "-c", editor+" "+shellQuote(path))
+	}
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("editor %s: %w", editor, err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// completeAt completes the word at the end of line: an @word (see
+// completeMention) anywhere, or any word of a !command line (see
+// completeShell). It returns the text to append — a single candidate in
+// full (no space after an @word, so a :from-to range can follow), or the
+// candidates' common prefix — and the candidates.
+func completeAt(line string) (added string, cands []string) {
+	start := strings.LastIndexAny(line, " \t\n") + 1
+	word := line[start:]
+	switch {
+	case strings.HasPrefix(word, "@"):
+		word = word[1:]
+		cands = completeMention(word)
+	case strings.HasPrefix(line, "!"):
+		command := start == 0
+		if command {
+			word = word[1:]
+		}
+		cands = completeShell(word, command)
+		if len(cands) == 1 && !strings.HasSuffix(cands[0], "/") {
+			cands[0] += " "
+		}
+	}
+	if len(cands) == 0 {
+		return "", nil
+	}
+	fill := cands[0]
+	for _, c := range cands[1:] {
+		for !strings.HasPrefix(c, fill) {
+			fill = fill[:len(fill)-1]
+		}
+	}
+	return fill[min(len(word), len(fill)):], cands
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// interpRef matches ${NAME}, ${NAME:-default}, and ${file:path}; $${ is a
+// literal ${.
+var interpRef = regexp.MustCompile(`\$?\$\{([^}]*)\}`)
+
+// interpolate expands references in a config or frontmatter value, so keys
+// and URLs can live in the environment or a secrets file instead of the
+// committed file. Unset variables and unreadable files expand to "" and are
+// reported in problems.
+func interpolate(s string) (out string, problems []string) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+	out = interpRef.ReplaceAllStringFunc(s, func(m string) string {
+		if strings.HasPrefix(m, "$$") {
+			return m[1:]
+		}
+		ref := m[2 : len(m)-1]
+		if path, ok := strings.CutPrefix(ref, "file:"); ok {
+			data, err := os.ReadFile(expandHome(strings.TrimSpace(path)))
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v", m, err))
+				return ""
+			}
+			return strings.TrimRight(string(data), "\r\n")
+		}
+		name, def, hasDef := strings.Cut(ref, ":-")
+		if v, ok := os.LookupEnv(name); ok && v != "" {
+			return v
+		}
+		if !hasDef {
+			problems = append(problems, fmt.Sprintf("%s: %s is not set", m, name))
+		}
+		return def
+	})
+	return out, problems
+}
+
+// expandHome replaces a leading ~/ with the home directory.
+func expandHome(path string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	return path
+}
+
+func warnInterpolation(source string, problems []string) {
+	for _, p := range problems {
+		fmt.Fprintf(os.Stderr, "Warning: %s: %s\n", source, p)
+	}
+}
+
+// interpolateJSON expands references in every string value of a JSON
+// document. Keys are left alone.
+func interpolateJSON(source string, data []byte) []byte {
+	if !bytes.Contains(data, []byte("${")) {
+		return data
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return data // let the caller report the syntax error
+	}
+	var problems []string
+	var walk func(v any) any
+	walk = func(v any) any {
+		switch v := v.(type) {
+		case string:
+			s, p := interpolate(v)
+			problems = append(problems, p...)
+			return s
+		case map[string]any:
+			for k, x := range v {
+				v[k] = walk(x)
+			}
+		case []any:
+			for i, x := range v {
+				v[i] = walk(x)
+			}
+		}
+		return v
+	}
+	doc = walk(doc)
+	warnInterpolation(source, problems)
+	out, err := json.Marshal(doc)
+	if err != nil {
+		return data
+	}
+	return out
+}
+
+// interpolateYAML expands references in every scalar value of a YAML node
+// tree. Mapping keys are left alone.
+func interpolateYAML(source string, n *yaml.Node) {
+	var problems []string
+	var walk func(n *yaml.Node)
+	walk = func(n *yaml.Node) {
+		switch n.Kind {
+		case yaml.ScalarNode:
+			var p []string
+			n.Value, p = interpolate(n.Value)
+			problems = append(problems, p...)
+		case yaml.MappingNode:
+			for i := 1; i < len(n.Content); i += 2 {
+				walk(n.Content[i])
+			}
+		default:
+			for _, c := range n.Content {
+				walk(c)
+			}
+		}
+	}
+	walk(n)
+	warnInterpolation(source, problems)
+}
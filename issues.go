@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// issueOutputMax caps what github_issue_get returns; long threads keep the
+// description and the newest comments.
+const issueOutputMax = 30000
+
+type githubIssue struct {
+	Number      int                      `json:"number"`
+	Title       string                   `json:"title"`
+	State       string                   `json:"state"`
+	Body        string                   `json:"body"`
+	HTMLURL     string                   `json:"html_url"`
+	Comments    int                      `json:"comments"`
+	CreatedAt   string                   `json:"created_at"`
+	User        struct{ Login string }   `json:"user"`
+	Labels      []struct{ Name string }  `json:"labels"`
+	Assignees   []struct{ Login string } `json:"assignees"`
+	PullRequest json.RawMessage          `json:"pull_request"` // set on pull requests, which the issues API lists too
+}
+
+type githubComment struct {
+	User      struct{ Login string } `json:"user"`
+	Body      string                 `json:"body"`
+	CreatedAt string                 `json:"created_at"`
+	HTMLURL   string                 `json:"html_url"`
+}
+
+// githubRepo is the GitHub repository the issue tools work on: repo
+// ("owner/name") when given, else the one forge.remote points to.
+func githubRepo(cfg ForgeConfig, repo string) (forgeRepo, error) {
+	if repo != "" {
+		if strings.Count(repo, "/") != 1 {
+			return forgeRepo{}, fmt.Errorf("repo must be owner/name, got %q", repo)
+		}
+		api := strings.TrimSuffix(cfg.API, "/")
+		if api == "" {
+			api = "https://api.github.com"
+		}
+		return forgeRepo{Kind: "github", Path: repo, API: api, Token: cfg.GitHubToken}, nil
+	}
+	cfg.Kind = "github"
+	return resolveForge(cfg)
+}
+
+func (i githubIssue) labels() string {
+	var names []string
+	for _, l := range i.Labels {
+		names = append(names, l.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// formatIssue renders an issue and its comments for the model. When the
+// whole thread is over issueOutputMax, the oldest comments are left out.
+func formatIssue(issue githubIssue, comments []githubComment) string {
+	var head strings.Builder
+	fmt.Fprintf(&head, "#%d %s [%s]\n", issue.Number, issue.Title, issue.State)
+	fmt.Fprintf(&head, "Opened by %s on %s · %s\n", issue.User.Login, dateOf(issue.CreatedAt), issue.HTMLURL)
+	if l := issue.labels(); l != "" {
+		fmt.Fprintf(&head, "Labels: %s\n", l)
+	}
+	if len(issue.Assignees) > 0 {
+		var names []string
+		for _, a := range issue.Assignees {
+			names = append(names, a.Login)
+		}
+		fmt.Fprintf(&head, "Assignees: %s\n", strings.Join(names, ", "))
+	}
+	body := strings.TrimSpace(issue.Body)
+	if body == "" {
+		body = "(no description)"
+	}
+	head.WriteString("\n" + body + "\n")
+
+	var parts []string
+	size := head.Len()
+	skipped := 0
+	for i := len(comments) - 1; i >= 0; i-- {
+		c := comments[i]
+		part := fmt.Sprintf("\n--- %s on %s:\n%s\n", c.User.Login, dateOf(c.CreatedAt), strings.TrimSpace(c.Body))
+		if size+len(part) > issueOutputMax {
+			skipped = i + 1
+			break
+		}
+		size += len(part)
+		parts = append(parts, part)
+	}
+	var sb strings.Builder
+	sb.WriteString(head.String())
+	if len(comments) > 0 {
+		fmt.Fprintf(&sb, "\n%d comment(s)", len(comments))
+		if skipped > 0 {
+			fmt.Fprintf(&sb, "; the oldest %d left out for length", skipped)
+		}
+		sb.WriteString(":\n")
+	}
+	for i := len(parts) - 1; i >= 0; i-- {
+		sb.WriteString(parts[i])
+	}
+	return sb.String()
+}
+
+// dateOf is the date part of a GitHub timestamp.
+func dateOf(ts string) string {
+	if t, err := time.Parse(time.RFC3339, ts); err == nil {
+		return t.Format("2006-01-02")
+	}
+	return ts
+}
+
+// registerIssueTools adds github_issue_get, github_issue_list and
+// github_issue_comment when a GitHub token is configured. Commenting
+// publishes, so it is a write tool and asks first (safety.confirm_dangerous).
+func registerIssueTools(r *ToolRegistry, cfg ForgeConfig) {
+	if cfg.GitHubToken == "" {
+		return
+	}
+	repoParam := map[string]any{"type": "string", "description": "owner/name (default: the repository of the git remote)"}
+
+	r.Register(ToolDef{
+		Name:        "github_issue_get",
+		Description: "Fetch a GitHub issue: title, state, labels, description and its comments. Use it when asked to work on an issue.",
+		Parameters: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"number":   map[string]any{"type": "integer", "description": "Issue number"},
+				"repo":     repoParam,
+				"comments": map[string]any{"type": "boolean", "description": "Include the comments (default true)"},
+			},
+			"required": []string{"number"},
+		},
+	}, func(args json.RawMessage) (string, error) {
+		var params struct {
+			Number   int    `json:"number"`
+			Repo     string `json:"repo"`
+			Comments *bool  `json:"comments"`
+		}
+		if err := json.Unmarshal(args, &params); err != nil {
+			return "", err
+		}
+		repo, err := githubRepo(cfg, params.Repo)
+		if err != nil {
+			return "error: " + err.Error(), nil
+		}
+		ctx, cancel := context.WithTimeout(toolCtx, time.Minute)
+		defer cancel()
+		base := fmt.Sprintf("/repos/%s/issues/%d", repo.Path, params.Number)
+		var issue githubIssue
+		if err := repo.call(ctx, "GET", base, nil, &issue); err != nil {
+			return "error: " + err.Error(), nil
+		}
+		var comments []githubComment
+		if (params.Comments == nil || *params.Comments) && issue.Comments > 0 {
+			for page := 1; len(comments) < issue.Comments && page <= 10; page++ {
+				var batch []githubComment
+				if err := repo.call(ctx, "GET", fmt.Sprintf("%s/comments?per_page=100&page=%d", base, page), nil, &batch); err != nil {
+					return "error: " + err.Error(), nil
+				}
+				if len(batch) == 0 {
+					break
+				}
+				comments = append(comments, batch...)
+			}
+		}
+		return formatIssue(issue, comments), nil
+	}, false)
+
+	r.Register(ToolDef{
+		Name:        "github_issue_list",
+		Description: "List GitHub issues (pull requests excluded), newest first, with number, state, title, labels and author.",
+		Parameters: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"repo":     repoParam,
+				"state":    map[string]any{"type": "string", "enum": []string{"open", "closed", "all"}, "description": "Default open"},
+				"labels":   map[string]any{"type": "string", "description": "Comma-separated labels the issues must all have"},
+				"assignee": map[string]any{"type": "string", "description": "Login, \"none\" or \"*\""},
+				"limit":    map[string]any{"type": "integer", "description": "Issues to return (default 20, max 100)"},
+			},
+		},
+	}, func(args json.RawMessage) (string, error) {
+		var params struct {
+			Repo     string `json:"repo"`
+			State    string `json:"state"`
+			Labels   string `json:"labels"`
+			Assignee string `json:"assignee"`
+			Limit    int    `json:"limit"`
+		}
+		if err := json.Unmarshal(args, &params); err != nil {
+			return "", err
+		}
+		repo, err := githubRepo(cfg, params.Repo)
+		if err != nil {
+			return "error: " + err.Error(), nil
+		}
+		if params.Limit <= 0 {
+			params.Limit = 20
+		}
+		params.Limit = min(params.Limit, 100)
+		q := url.Values{"per_page": {"100"}}
+		if params.State != "" {
+			q.Set("state", params.State)
+		}
+		if params.Labels != "" {
+			q.Set("labels", params.Labels)
+		}
+		if params.Assignee != "" {
+			q.Set("assignee", params.Assignee)
+		}
+		ctx, cancel := context.WithTimeout(toolCtx, time.Minute)
+		defer cancel()
+		var issues []githubIssue
+		for page := 1; len(issues) < params.Limit && page <= 5; page++ {
+			q.Set("page", strconv.Itoa(page))
+			var batch []githubIssue
+			if err := repo.call(ctx, "GET", "/repos/"+repo.Path+"/issues?"+q.Encode(), nil, &batch); err != nil {
+				return "error: " + err.Error(), nil
+			}
+			for _, issue := range batch {
+				if len(issue.PullRequest) == 0 && len(issues) < params.Limit {
+					issues = append(issues, issue)
+				}
+			}
+			if len(batch) < 100 {
+				break
+			}
+		}
+		if len(issues) == 0 {
+			return "no matching issues", nil
+		}
+		var sb strings.Builder
+		for _, issue := range issues {
+			fmt.Fprintf(&sb, "#%d [%s] %s", issue.Number, issue.State, issue.Title)
+			if l := issue.labels(); l != "" {
+				fmt.Fprintf(&sb, " (%s)", l)
+			}
+			fmt.Fprintf(&sb, " · %s, %s, %d comment(s)\n", issue.User.Login, dateOf(issue.CreatedAt), issue.Comments)
+		}
+		return sb.String(), nil
+	}, false)
+
+	r.Register(ToolDef{
+		Name: "github_issue_comment",
+		Description: "Post a comment on a GitHub issue or pull request, e.g. a summary of the fix once it is done. " +
+			"Markdown; say what changed and where (commit or pull request).",
+		Parameters: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"number": map[string]any{"type": "integer", "description": "Issue number"},
+				"body":   map[string]any{"type": "string", "description": "Comment in markdown"},
+				"repo":   repoParam,
+			},
+			"required": []string{"number", "body"},
+		},
+	}, func(args json.RawMessage) (string, error) {
+		var params struct {
+			Number int    `json:"number"`
+			Body   string `json:"body"`
+			Repo   string `json:"repo"`
+		}
+		if err := json.Unmarshal(args, &params); err != nil {
+			return "", err
+		}
+		if strings.TrimSpace(params.Body) == "" {
+			return "error: empty comment", nil
+		}
+		repo, err := githubRepo(cfg, params.Repo)
+		if err != nil {
+			return "error: " + err.Error(), nil
+		}
+		ctx, cancel := context.WithTimeout(toolCtx, time.Minute)
+		defer cancel()
+		var out githubComment
+		path := fmt.Sprintf("/repos/%s/issues/%d/comments", repo.Path, params.Number)
+		if err := repo.call(ctx, "POST", path, map[string]string{"body": params.Body}, &out); err != nil {
+			return "error: " + err.Error(), nil
+		}
+		return "commented " + out.HTMLURL, nil
+	}, true)
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"golang.org/x/term"
+)
+
+// keychainService is the service name API keys are stored under.
+const keychainService = "simpleagent"
+
+// errNoCredential is returned by Get when the store has no key for a provider.
+var errNoCredential = errors.New("no key stored")
+
+// credentialStore keeps provider API keys in the OS credential store
+// (macOS Keychain, libsecret, Windows Credential Manager).
+type credentialStore interface {
+	Name() string
+	Get(provider string) (string, error)
+	Set(provider, key string) error
+	Delete(provider string) error
+}
+
+// keychain returns the platform credential store, or nil when none is
+// usable (no `security` on macOS, no `secret-tool` on Linux/BSD).
+func keychain() credentialStore {
+	switch runtime.GOOS {
+	case "windows":
+		return windowsCredStore()
+	case "darwin":
+		if _, err := exec.LookPath("security"); err == nil {
+			return macKeychain{}
+		}
+	default:
+		if _, err := exec.LookPath("secret-tool"); err == nil {
+			return secretTool{}
+		}
+	}
+	return nil
+}
+
+// macKeychain stores keys as generic passwords via security(1).
+type macKeychain struct{}
+
+func (macKeychain) Name() string { return "macOS Keychain" }
+
+func (macKeychain) Get(provider string) (string, error) {
+	out, err := exec.Command("security", "find-generic-password", "-s", keychainService, "-a", provider, "-w").Output()
+	if err != nil {
+		return "", errNoCredential
+	}
+	return strings.TrimRight(string(out), "\n"), nil
+}
+
+func (macKeychain) Set(provider, key string) error {
+	// -U updates an existing item instead of failing. The command goes to
+	// `security -i` on stdin, so the key never shows in ps like an argument.
+	// Interactive mode exits 0 when a command fails; anything it prints
+	// besides its prompt is the error.
+	quote := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace
+	cmd := exec.Command("security", "-i")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s \"%s\" -a \"%s\" -w \"%s\"\n",
+		quote(keychainService), quote(provider), quote(key)))
+	out, err := cmd.CombinedOutput()
+	msg := strings.TrimSpace(strings.ReplaceAll(string(out), "security>", ""))
+	if err != nil || msg != "" {
+		return fmt.Errorf("security: %s", msg)
+	}
+	return nil
+}
+
+func (macKeychain) Delete(provider string) error {
+	if err := exec.Command("security", "delete-generic-password", "-s", keychainService, "-a", provider).Run(); err != nil {
+		return fmt.Errorf("%s: %w", provider, errNoCredential)
+	}
+	return nil
+}
+
+// secretTool stores keys in the freedesktop Secret Service (GNOME Keyring,
+// KWallet) via libsecret's secret-tool.
+type secretTool struct{}
+
+func (secretTool) Name() string { return "Secret Service (libsecret)" }
+
+func (secretTool) Get(provider string) (string, error) {
+	out, err := exec.Command("secret-tool", "lookup", "service", keychainService, "provider", provider).Output()
+	if err != nil || len(out) == 0 {
+		return "", errNoCredential
+	}
+	return strings.TrimRight(string(out), "\n"), nil
+}
+
+func (secretTool) Set(provider, key string) error {
+	cmd := exec.Command("secret-tool", "store", "--label", keychainService+" "+provider+" API key",
+		"service", keychainService, "provider", provider)
+	cmd.Stdin = strings.NewReader(key) // secret-tool reads the secret from stdin
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("secret-tool: %s", strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func (s secretTool) Delete(provider string) error {
+	if _, err := s.Get(provider); err != nil {
+		return fmt.Errorf("%s: %w", provider, errNoCredential)
+	}
+	out, err := exec.Command("secret-tool", "clear", "service", keychainService, "provider", provider).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("secret-tool: %s", strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// keyedProviders are the providers that authenticate with an API key.
+var keyedProviders = []string{"anthropic", "openai", "openrouter", "gemini"}
+
+func isKeyedProvider(name string) bool {
+	for _, p := range keyedProviders {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
+
+// storedKeys caches credential-store lookups by provider ("" when none is
+// stored), so each provider's store is asked at most once per run.
+var storedKeys = struct {
+	sync.Mutex
+	m map[string]string
+}{m: make(map[string]string)}
+
+// storedKey returns the key the OS credential store holds for provider, or "".
+func storedKey(provider string) string {
+	storedKeys.Lock()
+	defer storedKeys.Unlock()
+	if key, ok := storedKeys.m[provider]; ok {
+		return key
+	}
+	var key string
+	if store := keychain(); store != nil {
+		if k, err := store.Get(provider); err == nil {
+			key = k
+		}
+	}
+	storedKeys.m[provider] = key
+	return key
+}
+
+// ProviderKeyCfg is ProviderCfg with the API key of a keyed provider filled
+// in from the OS credential store when neither config nor env set one. The
+// store is only asked here, when a provider is about to be used, so a run
+// looks up the keys of the providers it talks to and no others.
+func (c Config) ProviderKeyCfg(name string) ProviderConfig {
+	pc := c.ProviderCfg(name)
+	if pc.APIKey == "" && isKeyedProvider(name) {
+		pc.APIKey = storedKey(name)
+	}
+	return pc
+}
+
+const authUsage = `Usage:
+  simpleagent auth login <provider>    Store an API key in the OS credential store
+  simpleagent auth logout <provider>   Remove it (and any --auth plan sign-in)
+  simpleagent auth status              Show where each provider's key comes from`
+
+// runAuth handles the auth subcommand.
+func runAuth(args []string) {
+	if len(args) == 0 {
+		fmt.Println(authUsage)
+		os.Exit(1)
+	}
+	if args[0] == "status" {
+		authStatus()
+		return
+	}
+	if (args[0] != "login" && args[0] != "logout") || len(args) != 2 {
+		fmt.Println(authUsage)
+		os.Exit(1)
+	}
+	provider := args[1]
+	if !isKeyedProvider(provider) {
+		fmt.Fprintf(os.Stderr, "Error: %s doesn't use an API key (keyed providers: %s)\n", provider, strings.Join(keyedProviders, ", "))
+		os.Exit(1)
+	}
+	store := keychain()
+	if args[0] == "logout" && deleteOAuthToken(provider) {
+		if store != nil {
+			store.Delete(provider) // a stored key goes too; a missing one is fine
+		}
+		fmt.Printf("Signed out of %s.\n", provider)
+		return
+	}
+	if store == nil {
+		fmt.Fprintln(os.Stderr, "Error: no OS credential store available (macOS Keychain, secret-tool, or Windows Credential Manager); set the key in config or the environment instead")
+		os.Exit(1)
+	}
+
+	if args[0] == "logout" {
+		if err := store.Delete(provider); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Removed the %s key from %s.\n", provider, store.Name())
+		return
+	}
+
+	key, err := readSecret(fmt.Sprintf("%s API key: ", provider))
+	if err != nil || key == "" {
+		fmt.Fprintln(os.Stderr, "Error: no key entered")
+		os.Exit(1)
+	}
+	if err := store.Set(provider, key); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Saved %s to %s.\n", maskKey(key), store.Name())
+	if pc := LoadConfig().ProviderCfg(provider); pc.APIKey != "" && pc.APIKey != key {
+		fmt.Println("Note: a key in config.json or the environment still takes precedence; remove it to use this one.")
+	}
+}
+
+// readSecret reads a line without echo when stdin is a terminal.
+func readSecret(prompt string) (string, error) {
+	fmt.Print(prompt)
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		b, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Println()
+		return strings.TrimSpace(string(b)), err
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// authStatus prints where each keyed provider's key comes from.
+func authStatus() {
+	cfg := DefaultConfig()
+	mergeConfigFile(UserConfigPath(), &cfg)
+	mergeConfigFile(filepath.Join(".simpleagent", "config.json"), &cfg)
+	store := keychain()
+	for _, name := range keyedProviders {
+		source := "not set"
+		envVar := strings.ToUpper(name) + "_API_KEY"
+		switch {
+		case os.Getenv(envVar) != "":
+			source = "environment (" + envVar + ")"
+		case cfg.ProviderCfg(name).APIKey != "":
+			source = "config.json"
+		case store != nil:
+			if key, err := store.Get(name); err == nil && key != "" {
+				source = store.Name()
+				break
+			}
+			fallthrough
+		default:
+			if hasOAuthToken(name) {
+				source = "plan sign-in (--auth)"
+			}
+		}
+		fmt.Printf("  %-12s %s\n", name, source)
+	}
+	if store == nil {
+		fmt.Println("\nNo OS credential store available.")
+	}
+}
@@ -0,0 +1,5 @@
+//go:build !windows
+
+package main
+
+func windowsCredStore() credentialStore { return nil }
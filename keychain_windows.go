@@ -0,0 +1,96 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	advapi32       = syscall.NewLazyDLL("advapi32.dll")
+	procCredReadW  = advapi32.NewProc("CredReadW")
+	procCredWriteW = advapi32.NewProc("CredWriteW")
+	procCredDelete = advapi32.NewProc("CredDeleteW")
+	procCredFree   = advapi32.NewProc("CredFree")
+)
+
+const (
+	credTypeGeneric         = 1
+	credPersistLocalMachine = 2
+	errorNotFound           = syscall.Errno(1168)
+)
+
+// winCredential mirrors CREDENTIALW.
+type winCredential struct {
+	Flags              uint32
+	Type               uint32
+	TargetName         *uint16
+	Comment            *uint16
+	LastWritten        syscall.Filetime
+	CredentialBlobSize uint32
+	CredentialBlob     *byte
+	Persist            uint32
+	AttributeCount     uint32
+	Attributes         uintptr
+	TargetAlias        *uint16
+	UserName           *uint16
+}
+
+// winCredStore stores keys as generic credentials named simpleagent:<provider>.
+type winCredStore struct{}
+
+func windowsCredStore() credentialStore {
+	if advapi32.Load() != nil {
+		return nil
+	}
+	return winCredStore{}
+}
+
+func (winCredStore) Name() string { return "Windows Credential Manager" }
+
+func credTarget(provider string) *uint16 {
+	p, _ := syscall.UTF16PtrFromString(keychainService + ":" + provider)
+	return p
+}
+
+func (winCredStore) Get(provider string) (string, error) {
+	var cred *winCredential
+	r, _, _ := procCredReadW.Call(uintptr(unsafe.Pointer(credTarget(provider))), credTypeGeneric, 0, uintptr(unsafe.Pointer(&cred)))
+	if r == 0 {
+		return "", errNoCredential
+	}
+	defer procCredFree.Call(uintptr(unsafe.Pointer(cred)))
+	return string(unsafe.Slice(cred.CredentialBlob, cred.CredentialBlobSize)), nil
+}
+
+func (winCredStore) Set(provider, key string) error {
+	blob := []byte(key)
+	user, _ := syscall.UTF16PtrFromString(provider)
+	cred := winCredential{
+		Type:               credTypeGeneric,
+		TargetName:         credTarget(provider),
+		CredentialBlobSize: uint32(len(blob)),
+		Persist:            credPersistLocalMachine,
+		UserName:           user,
+	}
+	if len(blob) > 0 {
+		cred.CredentialBlob = &blob[0]
+	}
+	if r, _, err := procCredWriteW.Call(uintptr(unsafe.Pointer(&cred)), 0); r == 0 {
+		return fmt.Errorf("CredWrite: %w", err)
+	}
+	return nil
+}
+
+func (winCredStore) Delete(provider string) error {
+	r, _, err := procCredDelete.Call(uintptr(unsafe.Pointer(credTarget(provider))), credTypeGeneric, 0)
+	if r == 0 {
+		if err == errorNotFound {
+			return fmt.Errorf("%s: %w", provider, errNoCredential)
+		}
+		return fmt.Errorf("CredDelete: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,677 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// lineEditor is the input being typed at the prompt in raw mode: a rune
+// buffer with a cursor, possibly several lines long. Both keymaps have
+// arrows, Home/End, Delete and Ctrl+A/E/K/U/W; with input.keybindings "vi",
+// Esc switches to a normal mode with vi motions (h j k l w b e W B E 0 ^ $
+// f F t T), operators (d c y with a motion, dd cc yy), x X D C s S r p P u
+// and counts.
+//
+// Enter submits unless the input ends in a backslash or has an unclosed
+// """; Ctrl+J inserts a newline, and a bracketed paste is inserted as is.
+// Ctrl+X Ctrl+E hands the input to $EDITOR (readLine does that).
+type lineEditor struct {
+	a       *Agent
+	buf     []rune
+	pos     int
+	row     int // the cursor's row below the prompt's, as last drawn
+	vi      bool
+	normal  bool // vi normal mode; insert mode otherwise
+	pasting bool // inside a bracketed paste
+	pasteCR bool // the last pasted rune was \r, so a \n after it is dropped
+	ctrlX   bool // Ctrl+X pressed; Ctrl+E next opens the editor
+	edit    bool // Ctrl+X Ctrl+E: compose the input in $EDITOR
+
+	count   int  // vi count typed so far
+	op      rune // vi operator waiting for its motion: d, c or y
+	opCount int  // count typed before the operator
+	pending rune // f, F, t, T or r waiting for its character
+	reg     []rune
+	undo    []rune // vi: buffer before the last change
+	undoPos int
+}
+
+// key is one keypress: a rune, or a named key for escape sequences.
+type key struct {
+	r    rune
+	name string // up, down, left, right, home, end, delete, shift-tab, esc, paste-start, paste-end
+}
+
+// contPrompt starts each line of the input after the first.
+const contPrompt = "... "
+
+// parseKey reads the key at the start of data and returns its length. A
+// terminal sends each escape sequence in one write, so a lone ESC at the end
+// of a read is the Esc key.
+func parseKey(data []byte) (key, int) {
+	if data[0] != 0x1b {
+		r, size := utf8.DecodeRune(data)
+		return key{r: r}, size
+	}
+	if len(data) == 1 {
+		return key{name: "esc"}, 1
+	}
+	switch data[1] {
+	case '[':
+		for i := 2; i < len(data); i++ {
+			if data[i] >= 0x40 && data[i] <= 0x7e {
+				names := map[string]string{"A": "up", "B": "down", "C": "right", "D": "left", "H": "home", "F": "end",
+					"Z": "shift-tab", "1~": "home", "7~": "home", "4~": "end", "8~": "end", "3~": "delete",
+					"200~": "paste-start", "201~": "paste-end"}
+				return key{name: names[string(data[2:i+1])]}, i + 1
+			}
+		}
+		return key{}, len(data)
+	case 'O':
+		if len(data) >= 3 {
+			names := map[byte]string{'A': "up", 'B': "down", 'C': "right", 'D': "left", 'H': "home", 'F': "end"}
+			return key{name: names[data[2]]}, 3
+		}
+	}
+	return key{name: "esc"}, 1
+}
+
+// redraw reprints the prompt and input from the prompt's row and puts the
+// cursor back. Lines wider than the terminal are not accounted for.
+func (e *lineEditor) redraw() {
+	var sb strings.Builder
+	if e.row > 0 {
+		fmt.Fprintf(&sb, "\033[%dA", e.row)
+	}
+	prompt := e.a.prompt()
+	lines := strings.Split(string(e.buf), "\n")
+	sb.WriteString("\r\033[J" + prompt + strings.Join(lines, "\r\n"+contPrompt))
+	row, col := e.rowCol(e.pos)
+	if up := len(lines) - 1 - row; up > 0 {
+		fmt.Fprintf(&sb, "\033[%dA", up)
+	}
+	if row == 0 {
+		col += utf8.RuneCountInString(prompt)
+	} else {
+		col += len(contPrompt)
+	}
+	sb.WriteString("\r")
+	if col > 0 {
+		fmt.Fprintf(&sb, "\033[%dC", col)
+	}
+	fmt.Print(sb.String())
+	e.row = row
+}
+
+// rowCol returns the line and column of buffer position p.
+func (e *lineEditor) rowCol(p int) (row, col int) {
+	start := e.lineStart(p)
+	return strings.Count(string(e.buf[:start]), "\n"), p - start
+}
+
+// lineStart and lineEnd bound the line holding position p; lineEnd is the
+// newline's position or the end of the buffer.
+func (e *lineEditor) lineStart(p int) int {
+	for p > 0 && e.buf[p-1] != '\n' {
+		p--
+	}
+	return p
+}
+
+func (e *lineEditor) lineEnd(p int) int {
+	for p < len(e.buf) && e.buf[p] != '\n' {
+		p++
+	}
+	return p
+}
+
+// vertical moves the cursor n lines down (up when negative), keeping its
+// column where the line is long enough. It reports false at the first or
+// last line.
+func (e *lineEditor) vertical(n int) bool {
+	_, col := e.rowCol(e.pos)
+	p := e.lineStart(e.pos)
+	for ; n < 0; n++ {
+		if p == 0 {
+			return false
+		}
+		p = e.lineStart(p - 1)
+	}
+	for ; n > 0; n-- {
+		end := e.lineEnd(p)
+		if end == len(e.buf) {
+			return false
+		}
+		p = end + 1
+	}
+	e.pos = min(p+col, e.lineEnd(p))
+	return true
+}
+
+// finish moves the cursor below the input, so the output starts on a fresh
+// line, and returns the input. An input wrapped in """ loses the quotes.
+func (e *lineEditor) finish() string {
+	if e.pos != len(e.buf) || e.row > 0 {
+		e.pos = len(e.buf)
+		e.redraw()
+	}
+	fmt.Print("\r\n")
+	text := string(e.buf)
+	if t := strings.TrimSpace(text); len(t) >= 6 && strings.HasPrefix(t, `"""`) && strings.HasSuffix(t, `"""`) {
+		text = strings.Trim(t[3:len(t)-3], "\n")
+	}
+	return text
+}
+
+// continues reports whether Enter should start another line instead of
+// submitting: after a trailing backslash (which it removes) or inside """.
+func (e *lineEditor) continues() bool {
+	if n := len(e.buf); n > 0 && e.buf[n-1] == '\\' {
+		e.buf[n-1] = '\n'
+		e.pos = n
+		e.redraw()
+		return true
+	}
+	if strings.Count(string(e.buf), `"""`)%2 == 1 {
+		e.insert('\n')
+		return true
+	}
+	return false
+}
+
+// paste inserts one key of a bracketed paste without drawing; readLine
+// redraws once per read. Line endings become \n.
+func (e *lineEditor) paste(k key) {
+	r := k.r
+	if k.name != "" || r == utf8.RuneError {
+		return
+	}
+	if r == '\n' && e.pasteCR {
+		e.pasteCR = false
+		return
+	}
+	e.pasteCR = r == '\r'
+	if r == '\r' {
+		r = '\n'
+	}
+	if r < 0x20 && r != '\n' && r != '\t' {
+		return
+	}
+	e.buf = slices.Insert(e.buf, e.pos, r)
+	e.pos++
+}
+
+// cursorShape shows a block cursor in vi normal mode and a bar otherwise.
+func (e *lineEditor) cursorShape() {
+	if !e.vi {
+		return
+	}
+	if e.normal {
+		fmt.Print("\033[2 q")
+	} else {
+		fmt.Print("\033[6 q")
+	}
+}
+
+func (e *lineEditor) setNormal(normal bool) {
+	e.normal = normal
+	e.cursorShape()
+}
+
+func (e *lineEditor) insert(rs ...rune) {
+	e.buf = slices.Insert(e.buf, e.pos, rs...)
+	e.pos += len(rs)
+	if e.pos == len(e.buf) && !slices.Contains(rs, '\n') {
+		fmt.Print(string(rs))
+	} else {
+		e.redraw()
+	}
+}
+
+// remove deletes buf[from:to] into the register.
+func (e *lineEditor) remove(from, to int) {
+	if from >= to {
+		return
+	}
+	e.reg = slices.Clone(e.buf[from:to])
+	e.buf = slices.Delete(e.buf, from, to)
+	e.pos = from
+}
+
+func (e *lineEditor) saveUndo() {
+	e.undo = slices.Clone(e.buf)
+	e.undoPos = e.pos
+}
+
+// key handles one keypress common to both modes, then hands it to the
+// mode's keymap. done is set when the line is complete.
+func (e *lineEditor) key(k key) (done bool) {
+	if e.ctrlX {
+		e.ctrlX = false
+		e.edit = k.r == 0x05
+		return false
+	}
+	switch {
+	case k.r == 0x18: // Ctrl+X
+		e.ctrlX = true
+	case k.r == '\r':
+		return !e.continues()
+	case k.r == '\n': // Ctrl+J
+		e.insert('\n')
+	case k.name == "shift-tab":
+		if e.row > 0 {
+			fmt.Printf("\033[%dA", e.row)
+		}
+		e.row = 0
+		e.a.toggleMode()
+		e.redraw()
+	case e.normal:
+		e.normalKey(k)
+	default:
+		e.insertKey(k)
+	}
+	return false
+}
+
+func (e *lineEditor) insertKey(k key) {
+	switch {
+	case k.name == "esc":
+		if e.vi {
+			if e.pos > e.lineStart(e.pos) {
+				e.pos--
+			}
+			e.setNormal(true)
+			e.redraw()
+		}
+	case k.name == "left":
+		e.pos = max(e.pos-1, 0)
+	case k.name == "right":
+		e.pos = min(e.pos+1, len(e.buf))
+	case k.name == "up":
+		e.vertical(-1)
+	case k.name == "down":
+		e.vertical(1)
+	case k.name == "home" || k.r == 0x01: // Ctrl+A
+		e.pos = e.lineStart(e.pos)
+	case k.name == "end" || k.r == 0x05: // Ctrl+E
+		e.pos = e.lineEnd(e.pos)
+	case k.name == "delete":
+		if e.pos < len(e.buf) {
+			e.buf = slices.Delete(e.buf, e.pos, e.pos+1)
+		}
+	case k.r == 0x7f || k.r == 0x08: // Backspace
+		if e.pos > 0 {
+			e.buf = slices.Delete(e.buf, e.pos-1, e.pos)
+			e.pos--
+		}
+	case k.r == 0x0b: // Ctrl+K
+		e.remove(e.pos, e.lineEnd(e.pos))
+	case k.r == 0x15: // Ctrl+U
+		e.remove(e.lineStart(e.pos), e.pos)
+	case k.r == 0x17: // Ctrl+W
+		e.remove(e.wordBack(e.pos, true), e.pos)
+	case k.r == '\t':
+		e.complete()
+		return
+	case k.name == "" && k.r >= 0x20 && k.r != utf8.RuneError:
+		e.insert(k.r)
+		return
+	default:
+		return
+	}
+	e.redraw()
+}
+
+// complete handles Tab with the cursor at the end of the input: it fills in
+// what completeAt found or lists the candidates under the input.
+func (e *lineEditor) complete() {
+	var added string
+	var cands []string
+	if e.pos == len(e.buf) {
+		added, cands = completeAt(string(e.buf))
+	}
+	switch {
+	case added != "":
+		e.insert([]rune(added)...)
+	case len(cands) > 1:
+		const maxListed = 100
+		list := strings.Join(cands[:min(len(cands), maxListed)], "  ")
+		if len(cands) > maxListed {
+			list += fmt.Sprintf("  ... and %d more", len(cands)-maxListed)
+		}
+		fmt.Print("\r\n" + list + "\r\n")
+		e.row = 0
+		e.redraw()
+	default:
+		fmt.Print("\a")
+	}
+}
+
+func (e *lineEditor) normalKey(k key) {
+	r := k.r
+	switch k.name {
+	case "esc":
+		e.count, e.op, e.pending = 0, 0, 0
+		return
+	case "left":
+		r = 'h'
+	case "right":
+		r = 'l'
+	case "up":
+		r = 'k'
+	case "down":
+		r = 'j'
+	case "home":
+		r = '0'
+	case "end":
+		r = '$'
+	case "delete":
+		r = 'x'
+	case "":
+	default:
+		return
+	}
+	if r == 0x7f || r == 0x08 {
+		r = 'h'
+	}
+
+	if e.pending == 'r' {
+		e.pending = 0
+		if r >= 0x20 && e.pos < len(e.buf) {
+			e.saveUndo()
+			e.buf[e.pos] = r
+			e.redraw()
+		}
+		return
+	}
+	if e.pending == 0 && (r >= '1' && r <= '9' || r == '0' && e.count > 0) {
+		e.count = e.count*10 + int(r-'0')
+		return
+	}
+	count := max(e.count, 1)
+	if e.pending == 0 {
+		if slices.Contains([]rune("fFtT"), r) {
+			e.pending = r
+			return // the count waits with the find
+		}
+		e.count = 0
+	}
+
+	if e.op != 0 {
+		op := e.op
+		e.op = 0
+		count *= e.opCount
+		if r == op { // dd, cc, yy: the current line
+			from, to := e.lineStart(e.pos), e.lineEnd(e.pos)
+			if op == 'd' && to < len(e.buf) {
+				to++ // and its newline
+			} else if op == 'd' && from > 0 {
+				from--
+			}
+			e.apply(op, from, to)
+			return
+		}
+		target, inclusive, ok := e.motion(r, count, op)
+		if !ok {
+			return
+		}
+		from, to := min(e.pos, target), max(e.pos, target)
+		if inclusive {
+			to = min(to+1, len(e.buf))
+		}
+		e.apply(op, from, to)
+		return
+	}
+	if target, _, ok := e.motion(r, count, 0); ok {
+		e.pos = target
+		e.clamp()
+		e.redraw()
+		return
+	}
+
+	switch r {
+	case 'i', 'a', 'I', 'A':
+		e.saveUndo()
+		switch r {
+		case 'a':
+			e.pos = min(e.pos+1, len(e.buf))
+		case 'I':
+			e.pos = e.firstNonBlank()
+		case 'A':
+			e.pos = e.lineEnd(e.pos)
+		}
+		e.setNormal(false)
+	case 'x':
+		e.apply('d', e.pos, min(e.pos+count, len(e.buf)))
+		return
+	case 'X':
+		e.apply('d', max(e.pos-count, 0), e.pos)
+		return
+	case 'D':
+		e.apply('d', e.pos, e.lineEnd(e.pos))
+		return
+	case 'C':
+		e.apply('c', e.pos, e.lineEnd(e.pos))
+		return
+	case 's':
+		e.apply('c', e.pos, min(e.pos+count, len(e.buf)))
+		return
+	case 'S':
+		e.apply('c', e.lineStart(e.pos), e.lineEnd(e.pos))
+		return
+	case 'd', 'c', 'y':
+		e.op, e.opCount = r, count
+		return
+	case 'r':
+		e.pending = 'r'
+		return
+	case 'p', 'P':
+		if len(e.reg) == 0 {
+			return
+		}
+		e.saveUndo()
+		at := e.pos
+		if r == 'p' && len(e.buf) > 0 {
+			at++
+		}
+		for range count {
+			e.buf = slices.Insert(e.buf, at, e.reg...)
+		}
+		e.pos = at + count*len(e.reg) - 1
+	case 'u':
+		if e.undo == nil {
+			return
+		}
+		e.buf, e.undo = e.undo, e.buf
+		e.pos, e.undoPos = e.undoPos, e.pos
+		e.clamp()
+	default:
+		return
+	}
+	e.redraw()
+}
+
+// apply runs operator op (d, c or y) over buf[from:to].
+func (e *lineEditor) apply(op rune, from, to int) {
+	if op == 'y' {
+		if from < to {
+			e.reg = slices.Clone(e.buf[from:to])
+		}
+		e.pos = from
+		e.clamp()
+		e.redraw()
+		return
+	}
+	e.saveUndo()
+	e.remove(from, to)
+	if op == 'c' {
+		e.setNormal(false)
+	} else {
+		e.clamp()
+	}
+	e.redraw()
+}
+
+// clamp keeps the cursor on a character of its line in normal mode.
+func (e *lineEditor) clamp() {
+	if e.normal && e.pos == e.lineEnd(e.pos) && e.pos > e.lineStart(e.pos) {
+		e.pos--
+	}
+}
+
+// motion returns where motion r, repeated count times, moves the cursor, and
+// whether an operator over it includes the target character. op is the
+// operator waiting for it, if any.
+func (e *lineEditor) motion(r rune, count int, op rune) (target int, inclusive, ok bool) {
+	if e.pending != 0 {
+		find := e.pending
+		e.pending = 0
+		e.count = 0
+		return e.find(find, r, count)
+	}
+	p := e.pos
+	switch r {
+	case 'h':
+		return max(p-count, 0), false, true
+	case 'l', ' ':
+		return min(p+count, len(e.buf)), false, true
+	case 'j', 'k':
+		n := count
+		if r == 'k' {
+			n = -count
+		}
+		if !e.vertical(n) {
+			return 0, false, false
+		}
+		target = e.pos
+		e.pos = p
+		return target, false, true
+	case '0':
+		return e.lineStart(p), false, true
+	case '^':
+		return e.firstNonBlank(), false, true
+	case '$':
+		return max(e.lineEnd(p)-1, e.lineStart(p)), true, true
+	case 'w', 'W':
+		if op == 'c' && p < len(e.buf) && !unicode.IsSpace(e.buf[p]) {
+			return e.motion(r-'w'+'e', count, op) // cw changes to the end of the word, like ce
+		}
+		for range count {
+			p = e.wordForward(p, r == 'W')
+		}
+		return p, false, true
+	case 'e', 'E':
+		for range count {
+			p = e.wordEnd(p, r == 'E')
+		}
+		return p, true, true
+	case 'b', 'B':
+		for range count {
+			p = e.wordBack(p, r == 'B')
+		}
+		return p, false, true
+	}
+	return 0, false, false
+}
+
+// find handles f/F/t/T: the count-th c right or left of the cursor, or the
+// character before it for t/T.
+func (e *lineEditor) find(kind, c rune, count int) (int, bool, bool) {
+	p := e.pos
+	step := 1
+	if kind == 'F' || kind == 'T' {
+		step = -1
+	}
+	for found := 0; found < count; {
+		p += step
+		if p < 0 || p >= len(e.buf) {
+			return 0, false, false
+		}
+		if e.buf[p] == c {
+			found++
+		}
+	}
+	switch kind {
+	case 't':
+		p--
+	case 'T':
+		p++
+	}
+	return p, step == 1, true
+}
+
+// firstNonBlank returns the first non-blank position on the cursor's line.
+func (e *lineEditor) firstNonBlank() int {
+	p, end := e.lineStart(e.pos), e.lineEnd(e.pos)
+	for i := p; i < end; i++ {
+		if !unicode.IsSpace(e.buf[i]) {
+			return i
+		}
+	}
+	return p
+}
+
+// charClass groups runes for word motions: 0 blank, 1 word, 2 punctuation.
+// big (W, B, E) treats everything but blanks as one class.
+func charClass(r rune, big bool) int {
+	switch {
+	case unicode.IsSpace(r):
+		return 0
+	case big || r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r):
+		return 1
+	}
+	return 2
+}
+
+// wordForward returns the start of the next word after p.
+func (e *lineEditor) wordForward(p int, big bool) int {
+	n := len(e.buf)
+	if p >= n {
+		return n
+	}
+	if c := charClass(e.buf[p], big); c != 0 {
+		for p < n && charClass(e.buf[p], big) == c {
+			p++
+		}
+	}
+	for p < n && unicode.IsSpace(e.buf[p]) {
+		p++
+	}
+	return p
+}
+
+// wordEnd returns the last character of the word ending after p.
+func (e *lineEditor) wordEnd(p int, big bool) int {
+	n := len(e.buf)
+	p++
+	for p < n && unicode.IsSpace(e.buf[p]) {
+		p++
+	}
+	if p >= n {
+		return max(n-1, 0)
+	}
+	c := charClass(e.buf[p], big)
+	for p+1 < n && charClass(e.buf[p+1], big) == c {
+		p++
+	}
+	return p
+}
+
+// wordBack returns the start of the word before p.
+func (e *lineEditor) wordBack(p int, big bool) int {
+	p--
+	for p > 0 && unicode.IsSpace(e.buf[p]) {
+		p--
+	}
+	if p <= 0 {
+		return 0
+	}
+	c := charClass(e.buf[p], big)
+	for p > 0 && charClass(e.buf[p-1], big) == c {
+		p--
+	}
+	return p
+}
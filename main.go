@@ -6,33 +6,114 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+
+	"golang.org/x/term"
 )
 
 var version = "dev"
 
 func main() {
+	// Subcommands
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		runServe(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "auth" {
+		runAuth(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		runConfig(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "doctor" {
+		runDoctor(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "stats" {
+		plainOutput = !term.IsTerminal(int(os.Stdout.Fd()))
+		runStats(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "docs" {
+		runDocs(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "eval" {
+		plainOutput = !term.IsTerminal(int(os.Stdout.Fd()))
+		runEval(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "pipeline" {
+		plainOutput = !term.IsTerminal(int(os.Stdout.Fd()))
+		runPipeline(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "review" {
+		plainOutput = !term.IsTerminal(int(os.Stdout.Fd()))
+		runReview(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "__complete" {
+		runComplete(os.Args[2:])
+		return
+	}
+
 	var (
 		providerFlag string
 		modelFlag    string
 		sessionFlag  string
 		showVersion  bool
 		showSessions bool
+		listAgentsF  bool
+		searchFlag   string
 		resumeFlag   bool
 		newFlag      bool
 		editFlag     bool
 		setupFlag    bool
+		authFlag     bool
+		dryRunFlag   bool
+		jsonFlag     bool
+		plainFlag    bool
+		traceFlag    bool
+		maxTurnsFlag int
+		watchFlag    string
+		profileFlag  string
+		transcriptF  bool
+		forceFlag    bool
+		replayFlag   string
+		speedFlag    float64
 	)
 
 	flag.StringVar(&providerFlag, "provider", "", "LLM provider (anthropic, openai, openrouter, gemini, ollama, bedrock)")
 	flag.StringVar(&modelFlag, "m", "", "Model name")
 	flag.StringVar(&modelFlag, "model", "", "Model name")
+	flag.StringVar(&profileFlag, "profile", "", "Config profile to use (profiles in config.json; default $SIMPLEAGENT_PROFILE)")
 	flag.StringVar(&sessionFlag, "session", "", "Resume specific session by ID or name")
 	flag.BoolVar(&showVersion, "version", false, "Print version")
 	flag.BoolVar(&showSessions, "sessions", false, "List all sessions")
+	flag.StringVar(&searchFlag, "search", "", "Search all sessions for messages containing these words")
+	flag.BoolVar(&jsonFlag, "json", false, "Print listings (--sessions, --search, --list-agents) as JSON")
+	flag.BoolVar(&listAgentsF, "list-agents", false, "List agents in ./agents/ and ~/.simpleagent/agents/")
 	flag.BoolVar(&resumeFlag, "resume", false, "Resume last session")
 	flag.BoolVar(&newFlag, "new", false, "Create a new .agent file")
 	flag.BoolVar(&editFlag, "edit", false, "Edit an existing .agent file")
 	flag.BoolVar(&setupFlag, "setup", false, "Run setup wizard")
+	flag.BoolVar(&authFlag, "auth", false, "Sign in with a Claude or ChatGPT plan in the browser (anthropic, openai)")
+	flag.BoolVar(&plainFlag, "plain", false, "Plain output: no spinner, status line, or tool previews")
+	flag.IntVar(&maxTurnsFlag, "max-turns", -1, "LLM calls per message before pausing (0 = unlimited; default from config)")
+	flag.BoolVar(&traceFlag, "trace", false, "Also log raw provider HTTP requests/responses to .simpleagent/<agent>/logs/")
+	flag.BoolVar(&dryRunFlag, "dry-run", false, "Stage file changes as diffs instead of writing (/apply to write)")
+	flag.BoolVar(&forceFlag, "force", false, "Resume a session even if another simpleagent process has it open")
+	flag.BoolVar(&transcriptF, "transcript", false, "Keep a markdown transcript of the session updated in .simpleagent/<agent>/")
+	flag.StringVar(&replayFlag, "replay", "", "Print a stored session (ID or name) turn by turn, as it ran")
+	flag.Float64Var(&speedFlag, "speed", 0, "With --replay: play back at the recorded pace, this many times faster (e.g. 1, 4)")
+	flag.StringVar(&watchFlag, "watch", "", "Re-run the prompt whenever files matching these comma-separated globs change")
+	// Completion scripts are generated from the flags above
+	if len(os.Args) > 1 && os.Args[1] == "completion" {
+		runCompletion(os.Args[2:])
+		return
+	}
 	flag.Parse()
 
 	if showVersion {
@@ -40,19 +121,50 @@ func main() {
 		os.Exit(0)
 	}
 
-	// Load config: defaults → user-wide → project → env
+	plainOutput = plainFlag || !term.IsTerminal(int(os.Stdout.Fd()))
+	traceHTTP = traceFlag
+
+	// Load config: defaults → user-wide → project → env → profile
+	configProfile = profileFlag
 	cfg := LoadConfig()
+	sessionStorage = cfg.Storage
+	liveTranscript = transcriptF || cfg.Transcript
 
 	// Parse positional args
 	var agentFile *AgentFile
 	var inlinePrompt string
 	args := flag.Args()
 
-	// Extract .agent file target from args (if present)
+	if listAgentsF {
+		listAgents(jsonFlag)
+		os.Exit(0)
+	}
+
+	// Extract .agent file target from args (if present): a path, "run <name>",
+	// or the bare name of an agent in ./agents/ or ~/.simpleagent/agents/
 	var target string
-	if len(args) > 0 && strings.HasSuffix(args[0], ".agent") {
+	switch {
+	case len(args) > 0 && args[0] == "run":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "Usage: simpleagent run <name> [prompt]  (see --list-agents)")
+			os.Exit(1)
+		}
+		if target = resolveAgent(args[1]); target == "" && strings.HasSuffix(args[1], ".agent") {
+			target = args[1]
+		}
+		if target == "" {
+			fmt.Fprintf(os.Stderr, "Error: no agent named %q in ./agents/ or ~/.simpleagent/agents/\n", args[1])
+			os.Exit(1)
+		}
+		args = args[2:]
+	case len(args) > 0 && strings.HasSuffix(args[0], ".agent"):
 		target = args[0]
 		args = args[1:]
+	case len(args) > 0 && !newFlag:
+		if path := resolveAgent(args[0]); path != "" {
+			target = path
+			args = args[1:]
+		}
 	}
 
 	// Handle --new and --edit modes
@@ -100,6 +212,7 @@ func main() {
 			os.Exit(1)
 		}
 		agentFile = af
+		agentFile.ApplyEnv()
 		fmt.Printf("Agent: %s\n", agentFile.Path)
 	}
 
@@ -117,6 +230,8 @@ func main() {
 	} else {
 		ResolveAgentDir("")
 	}
+	pruneScratch()
+	adoptProcesses()
 
 	// Agent file overrides (layer 4)
 	cfg.ApplyAgentFile(agentFile)
@@ -135,10 +250,31 @@ func main() {
 	}
 
 	if showSessions {
-		listAllSessions()
+		listAllSessions(jsonFlag)
+		os.Exit(0)
+	}
+	if searchFlag != "" {
+		printSearchHits(searchFlag, searchSessions(searchFlag), jsonFlag)
+		os.Exit(0)
+	}
+	if replayFlag != "" {
+		session, err := loadSessionByIDOrName(replayFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		replaySession(session, speedFlag)
 		os.Exit(0)
 	}
 
+	// Plan sign-in for the selected provider
+	if authFlag {
+		if err := runOAuthLogin(cfg, cfg.Provider); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
 	// Explicit setup
 	if setupFlag {
 		if !runSetupWizard(&cfg) {
@@ -202,14 +338,67 @@ func main() {
 		session = sessionPicker()
 	}
 
+	// Resumed session: report environment drift, offer to restart processes
+	if session != nil && len(session.Messages) > 0 {
+		restoreSessionEnv(session, term.IsTerminal(int(os.Stdin.Fd())))
+	}
+
+	// Watch mode: a fresh headless run of the prompt per change
+	if watchFlag != "" {
+		if inlinePrompt == "" {
+			fmt.Fprintln(os.Stderr, "Error: --watch needs a prompt, e.g. simpleagent --watch '**/*.go' \"fix failing tests\"")
+			os.Exit(1)
+		}
+		defer shutdownProcesses()
+		err := runWatch(watchFlag, func(changed []string) {
+			a := NewAgent(llm, cfg, nil, agentFile)
+			a.mode = ModeAction
+			if dryRunFlag {
+				a.tools.DryRun = NewDryRun()
+			}
+			if maxTurnsFlag >= 0 {
+				a.cfg.MaxTurns = maxTurnsFlag
+			}
+			a.RunOnce(inlinePrompt + "\n\nFiles changed: " + strings.Join(changed, ", "))
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Start agent
 	agent := NewAgent(llm, cfg, session, agentFile)
+	if err := lockSession(agent.session.ID, forceFlag); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer unlockSessions()
+	defer shutdownProcesses()
+	if n := agent.session.recovered; n > 0 {
+		fmt.Printf("\033[33mRecovered %d message(s) that were not saved before the last run stopped; type a message to redirect, or /continue\033[0m\n", n)
+		agent.session.Save()
+		agent.paused = true
+	}
+	if dryRunFlag {
+		agent.tools.DryRun = NewDryRun()
+	}
+	if maxTurnsFlag >= 0 {
+		agent.cfg.MaxTurns = maxTurnsFlag
+	}
+	if liveTranscript && !plainOutput {
+		fmt.Printf("\033[2mTranscript: %s\033[0m\n", transcriptPath(agent.session.ID))
+	}
 
 	// --new and --edit always run in action mode (need write tools)
 	if newFlag || editFlag {
 		agent.mode = ModeAction
+		if newFlag {
+			agent.tools.Override("write_file", agent.previewAgentWrite(toolWriteFile))
+		}
 		if inlinePrompt != "" {
-			agent.session.Messages = append(agent.session.Messages, Message{Role: "user", Content: inlinePrompt})
+			agent.addUserMessage(inlinePrompt)
 		}
 		agent.RunLoop()
 		return
@@ -223,6 +412,9 @@ func main() {
 	// If inline prompt provided, use it as first message in action mode
 	if inlinePrompt != "" {
 		agent.mode = ModeAction
+		if cfg.TrackPrompts {
+			trackPrompt(agent.session.ID, inlinePrompt)
+		}
 		agent.RunOnce(inlinePrompt)
 		return
 	}
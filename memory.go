@@ -1,23 +1,333 @@
 package main
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 )
 
-func loadMemory() string {
-	data, err := os.ReadFile(filepath.Join(agentDir, "AGENT.md"))
+// loadMemory returns the memory section of the system prompt: the agent's
+// AGENT.md with the user-wide ~/.simpleagent/AGENT.md beneath it. When they
+// hold more than cfg.Memory.TopK entries, only the entries most relevant to
+// query (the latest user message) are included.
+func loadMemory(cfg Config, query string) string {
+	local := readMemory(memoryPath())
+	global := readMemory(globalMemoryPath())
+	for i := range global {
+		global[i].Global = true
+	}
+	entries := append(local, global...)
+	if len(entries) == 0 {
+		return ""
+	}
+
+	header := "## Agent Memory\n"
+	if k := cfg.Memory.TopK; k > 0 && len(entries) > k {
+		entries = selectMemory(cfg, entries, query, k)
+		header = fmt.Sprintf("## Agent Memory (%d most relevant of %d entries)\n", len(entries), len(local)+len(global))
+	}
+	// Over memory.long_term_tokens, global entries go first, then the agent's
+	// own, oldest first.
+	if limit := cfg.Memory.LongTermTokens; limit > 0 {
+		kept := len(entries)
+		entries = slices.Clone(entries)
+		for len(entries) > 1 && estimateTokens(formatMemory(entries), "") > limit {
+			drop := 0
+			for i, e := range entries {
+				if e.Global {
+					drop = i
+					break
+				}
+			}
+			entries = slices.Delete(entries, drop, drop+1)
+		}
+		if len(entries) < kept {
+			header = fmt.Sprintf("## Agent Memory (%d of %d entries, within memory.long_term_tokens)\n", len(entries), len(local)+len(global))
+		}
+	}
+
+	var agentPart, globalPart []memoryEntry
+	for _, e := range entries {
+		if e.Global {
+			globalPart = append(globalPart, e)
+		} else {
+			agentPart = append(agentPart, e)
+		}
+	}
+	out := header + formatMemory(agentPart)
+	if len(globalPart) > 0 {
+		out += "\n### Global memory\n" + formatMemory(globalPart)
+	}
+	return out + "\n"
+}
+
+// memoryPath is the agent's own memory file.
+func memoryPath() string {
+	return filepath.Join(agentDir, "AGENT.md")
+}
+
+// globalMemoryPath is the user-wide memory shared by every agent.
+func globalMemoryPath() string {
+	home, err := os.UserHomeDir()
 	if err != nil {
 		return ""
 	}
-	return "## Agent Memory\n" + string(data) + "\n"
+	return filepath.Join(home, ".simpleagent", "AGENT.md")
+}
+
+func readMemory(path string) []memoryEntry {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	return parseMemory(string(data))
+}
+
+// memoryEntry is one bullet from AGENT.md with the date heading it sits under.
+type memoryEntry struct {
+	Date   string
+	Text   string
+	Global bool // from ~/.simpleagent/AGENT.md
+}
+
+// parseMemory splits AGENT.md into entries: each "- " bullet under a
+// "## <date>" heading, with following non-bullet lines folded in.
+func parseMemory(content string) []memoryEntry {
+	var entries []memoryEntry
+	date := ""
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+		case strings.HasPrefix(trimmed, "## "):
+			date = strings.TrimSpace(trimmed[3:])
+		case strings.HasPrefix(trimmed, "- "):
+			entries = append(entries, memoryEntry{Date: date, Text: strings.TrimSpace(trimmed[2:])})
+		case len(entries) > 0 && entries[len(entries)-1].Date == date:
+			entries[len(entries)-1].Text += "\n" + trimmed
+		default:
+			entries = append(entries, memoryEntry{Date: date, Text: trimmed})
+		}
+	}
+	return entries
 }
 
+// formatMemory renders entries back into AGENT.md layout.
+func formatMemory(entries []memoryEntry) string {
+	var sb strings.Builder
+	date := "\x00"
+	for _, e := range entries {
+		if e.Date != date {
+			date = e.Date
+			if date != "" {
+				fmt.Fprintf(&sb, "\n## %s\n", date)
+			}
+		}
+		fmt.Fprintf(&sb, "- %s\n", strings.ReplaceAll(e.Text, "\n", "\n  "))
+	}
+	return sb.String()
+}
+
+// selectMemory picks the k entries closest to query, kept in file order.
+// Without a query (or if embedding fails entirely) the k most recent win.
+func selectMemory(cfg Config, entries []memoryEntry, query string, k int) []memoryEntry {
+	recent := entries[len(entries)-k:]
+	if strings.TrimSpace(query) == "" {
+		return recent
+	}
+
+	scores, err := scoreMemory(cfg, entries, query)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "memory: %v (using local embeddings)\n", err)
+		cfg.Memory.Embeddings = "local"
+		if scores, err = scoreMemory(cfg, entries, query); err != nil {
+			return recent
+		}
+	}
+
+	idx := make([]int, len(entries))
+	for i := range idx {
+		idx[i] = i
+	}
+	// Ties (e.g. no shared words) go to the newer entry.
+	sort.SliceStable(idx, func(a, b int) bool {
+		if scores[idx[a]] != scores[idx[b]] {
+			return scores[idx[a]] > scores[idx[b]]
+		}
+		return idx[a] > idx[b]
+	})
+	idx = idx[:k]
+	sort.Ints(idx)
+
+	picked := make([]memoryEntry, k)
+	for i, j := range idx {
+		picked[i] = entries[j]
+	}
+	return picked
+}
+
+// memoryIndex caches entry vectors in agentDir/memory_index.json, keyed by
+// a hash of the entry text. Switching embedders discards the cache.
+type memoryIndex struct {
+	Embedder string               `json:"embedder"`
+	Vectors  map[string][]float32 `json:"vectors"`
+}
+
+var (
+	cachedEmbedder   Embedder
+	cachedEmbedderID string                   // backend+model the embedder was built for
+	queryVectors     = map[string][]float32{} // systemPrompt runs every tool round; embed each query once
+)
+
+func memoryEmbedder(cfg Config) (Embedder, error) {
+	key := cfg.Memory.Embeddings + "/" + cfg.Memory.Model
+	if cachedEmbedder != nil && cachedEmbedderID == key {
+		return cachedEmbedder, nil
+	}
+	e, err := NewEmbedder(cfg)
+	if err != nil {
+		return nil, err
+	}
+	cachedEmbedder, cachedEmbedderID = e, key
+	queryVectors = map[string][]float32{}
+	return e, nil
+}
+
+// scoreMemory returns the cosine similarity of each entry to query.
+func scoreMemory(cfg Config, entries []memoryEntry, query string) ([]float64, error) {
+	emb, err := memoryEmbedder(cfg)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	indexPath := filepath.Join(agentDir, "memory_index.json")
+	var idx memoryIndex
+	if data, err := os.ReadFile(indexPath); err == nil {
+		json.Unmarshal(data, &idx)
+	}
+	if idx.Embedder != emb.ID() || idx.Vectors == nil {
+		idx = memoryIndex{Embedder: emb.ID(), Vectors: make(map[string][]float32)}
+	}
+
+	keys := make([]string, len(entries))
+	var missing, missingKeys []string
+	live := make(map[string]bool)
+	for i, e := range entries {
+		keys[i] = memoryKey(e.Text)
+		live[keys[i]] = true
+		if _, ok := idx.Vectors[keys[i]]; !ok && !slices.Contains(missingKeys, keys[i]) {
+			missing = append(missing, e.Text)
+			missingKeys = append(missingKeys, keys[i])
+		}
+	}
+
+	if len(missing) > 0 {
+		vecs, err := emb.Embed(ctx, missing)
+		if err != nil {
+			return nil, fmt.Errorf("embedding memory: %w", err)
+		}
+		for i, v := range vecs {
+			if v != nil {
+				idx.Vectors[missingKeys[i]] = v
+			}
+		}
+		for k := range idx.Vectors {
+			if !live[k] {
+				delete(idx.Vectors, k) // entry was edited out of AGENT.md
+			}
+		}
+		if data, err := json.Marshal(idx); err == nil {
+			os.WriteFile(indexPath, data, 0644)
+		}
+	}
+
+	qk := memoryKey(query)
+	qv, ok := queryVectors[qk]
+	if !ok {
+		vecs, err := emb.Embed(ctx, []string{query})
+		if err != nil || len(vecs) == 0 {
+			return nil, fmt.Errorf("embedding query: %v", err)
+		}
+		qv = vecs[0]
+		queryVectors[qk] = qv
+	}
+
+	scores := make([]float64, len(entries))
+	for i, k := range keys {
+		scores[i] = cosine(qv, idx.Vectors[k])
+	}
+	return scores, nil
+}
+
+func memoryKey(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:8])
+}
+
+// projectInstructionFiles are loaded from the working directory and every parent.
+var projectInstructionFiles = []string{"AGENTS.md", "CLAUDE.md"}
+
+// loadProjectInstructions collects AGENTS.md / CLAUDE.md from CWD up to the
+// filesystem root. Outermost files come first so closer ones read as overrides.
+func loadProjectInstructions() string {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+
+	var dirs []string
+	for dir := cwd; ; dir = filepath.Dir(dir) {
+		dirs = append(dirs, dir)
+		if filepath.Dir(dir) == dir {
+			break
+		}
+	}
+
+	var sb strings.Builder
+	for i := len(dirs) - 1; i >= 0; i-- {
+		for _, name := range projectInstructionFiles {
+			path := filepath.Join(dirs[i], name)
+			data, err := os.ReadFile(path)
+			if err != nil || strings.TrimSpace(string(data)) == "" {
+				continue
+			}
+			fmt.Fprintf(&sb, "### %s\n%s\n\n", path, strings.TrimSpace(string(data)))
+		}
+	}
+	if sb.Len() == 0 {
+		return ""
+	}
+	return "## Project instructions\n" + sb.String()
+}
+
+// initPrompt asks the agent to analyze the repo and write an AGENTS.md.
+const initPrompt = `Analyze this repository and create (or update) AGENTS.md in the current directory.
+Explore first: list the tree, read the README, build files, and a few representative source files.
+AGENTS.md should be concise and cover:
+- What the project is, in one or two sentences
+- Build, test, lint, and run commands
+- Code layout (key directories and files)
+- Conventions: language version, style, naming, error handling, test layout
+- Anything a new contributor would trip over
+If AGENTS.md already exists, read it and improve it instead of starting over. Write it with write_file.`
+
 func appendMemory(text string) error {
 	os.MkdirAll(agentDir, 0755)
-	path := filepath.Join(agentDir, "AGENT.md")
+	path := memoryPath()
 
 	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
@@ -29,3 +339,154 @@ func appendMemory(text string) error {
 	_, err = fmt.Fprintf(f, "\n## %s\n- %s\n", date, text)
 	return err
 }
+
+const memoryUsage = `Usage:
+  /memory <text>             Save a note to this agent's memory
+  /memory show               List memory entries (numbered)
+  /memory search <terms>     Find entries containing all terms
+  /memory forget <n|date>    Remove entry n, or every entry from a date (YYYY-MM-DD)
+  /memory edit [--global]    Open AGENT.md (or ~/.simpleagent/AGENT.md) in $EDITOR`
+
+// handleMemoryCommand runs /memory and its subcommands.
+func handleMemoryCommand(arg string) {
+	sub, rest, _ := strings.Cut(arg, " ")
+	rest = strings.TrimSpace(rest)
+
+	switch {
+	case arg == "":
+		fmt.Println(memoryUsage)
+	case arg == "show":
+		showMemory()
+	case arg == "edit" || arg == "edit --global":
+		path := memoryPath()
+		if rest == "--global" {
+			path = globalMemoryPath()
+		}
+		editMemory(path)
+	case sub == "search" && rest != "":
+		searchMemory(rest)
+	case sub == "forget" && rest != "":
+		forgetMemory(rest)
+	default:
+		if err := appendMemory(arg); err != nil {
+			fmt.Fprintf(os.Stderr, "Error saving memory: %v\n", err)
+		} else {
+			fmt.Println("Memory saved.")
+		}
+	}
+}
+
+func showMemory() {
+	local := readMemory(memoryPath())
+	global := readMemory(globalMemoryPath())
+	if len(local) == 0 && len(global) == 0 {
+		fmt.Println("Memory is empty. Save a note with /memory <text>.")
+		return
+	}
+	for i, e := range local {
+		printMemoryEntry(fmt.Sprintf("%d.", i+1), e)
+	}
+	if len(global) > 0 {
+		fmt.Printf("\033[2mGlobal (%s):\033[0m\n", globalMemoryPath())
+		for _, e := range global {
+			printMemoryEntry("-", e)
+		}
+	}
+}
+
+func printMemoryEntry(label string, e memoryEntry) {
+	date := ""
+	if e.Date != "" {
+		date = "\033[2m" + e.Date + "\033[0m "
+	}
+	fmt.Printf("  %3s %s%s\n", label, date, strings.ReplaceAll(e.Text, "\n", "\n      "))
+}
+
+func searchMemory(query string) {
+	terms := strings.Fields(strings.ToLower(query))
+	matches := func(e memoryEntry) bool {
+		text := strings.ToLower(e.Text)
+		for _, t := range terms {
+			if !strings.Contains(text, t) {
+				return false
+			}
+		}
+		return true
+	}
+
+	found := 0
+	for i, e := range readMemory(memoryPath()) {
+		if matches(e) {
+			printMemoryEntry(fmt.Sprintf("%d.", i+1), e)
+			found++
+		}
+	}
+	for _, e := range readMemory(globalMemoryPath()) {
+		if matches(e) {
+			printMemoryEntry("g", e)
+			found++
+		}
+	}
+	if found == 0 {
+		fmt.Println("No matching memory entries.")
+	}
+}
+
+// forgetMemory drops entry n (as numbered by /memory show) or every entry
+// under a date heading, then rewrites AGENT.md.
+func forgetMemory(target string) {
+	entries := readMemory(memoryPath())
+	var keep, dropped []memoryEntry
+
+	if n, err := strconv.Atoi(target); err == nil {
+		if n < 1 || n > len(entries) {
+			fmt.Printf("No entry %d (memory has %d entries).\n", n, len(entries))
+			return
+		}
+		dropped = entries[n-1 : n]
+		keep = append(append(keep, entries[:n-1]...), entries[n:]...)
+	} else {
+		for _, e := range entries {
+			if e.Date == target {
+				dropped = append(dropped, e)
+			} else {
+				keep = append(keep, e)
+			}
+		}
+		if len(dropped) == 0 {
+			fmt.Printf("No entries dated %s.\n", target)
+			return
+		}
+	}
+
+	if err := os.WriteFile(memoryPath(), []byte(formatMemory(keep)), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing memory: %v\n", err)
+		return
+	}
+	for _, e := range dropped {
+		fmt.Printf("Forgot: %s\n", truncate(e.Text, 70))
+	}
+}
+
+func editMemory(path string) {
+	if path == "" {
+		fmt.Fprintln(os.Stderr, "Error: no home directory for global memory")
+		return
+	}
+	data, _ := os.ReadFile(path)
+	edited, err := openInEditor(string(data), ".md")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return
+	}
+	if edited == string(data) {
+		fmt.Println("No changes.")
+		return
+	}
+	os.MkdirAll(filepath.Dir(path), 0755)
+	if err := os.WriteFile(path, []byte(edited), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing memory: %v\n", err)
+		return
+	}
+	fmt.Printf("Saved %s.\n", path)
+}
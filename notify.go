@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Notifications (config "notify") for a user who switched to another window
+// during a long turn: a terminal bell and/or a desktop notification when the
+// turn ends or the agent stops to ask something.
+
+// askUserNotify is set by the agent so ask_user can notify before it waits.
+var askUserNotify = func(question string) {}
+
+// notifyWarned keeps a missing notifier to one warning per run.
+var notifyWarned bool
+
+// notify alerts the user, if notifications are on and the current turn has
+// run at least notify.after_seconds. Terminal sessions only.
+func (a *Agent) notify(title, body string) {
+	n := a.cfg.Notify
+	if a.sink != nil || (!n.Bell && !n.Desktop) || a.turnStart.IsZero() {
+		return
+	}
+	if time.Since(a.turnStart) < time.Duration(n.After)*time.Second {
+		return
+	}
+	if n.Bell {
+		fmt.Print("\a")
+	}
+	if n.Desktop {
+		if err := desktopNotify(title, truncate(body, 200)); err != nil && !notifyWarned {
+			notifyWarned = true
+			fmt.Fprintf(os.Stderr, "Warning: desktop notification failed: %v\n", err)
+		}
+	}
+}
+
+// notifyTurnEnd reports a finished or paused turn. A turn the user stopped
+// with Ctrl+C needs no notice: they're here.
+func (a *Agent) notifyTurnEnd(interrupted bool) {
+	if interrupted {
+		return
+	}
+	if a.paused {
+		a.notify("simpleagent paused", "Paused; /continue to resume")
+		return
+	}
+	msgs := a.session.Messages
+	answer := "Done"
+	if len(msgs) > 0 && msgs[len(msgs)-1].Role == "assistant" && strings.TrimSpace(msgs[len(msgs)-1].Content) != "" {
+		answer = strings.TrimSpace(msgs[len(msgs)-1].Content)
+	}
+	a.notify("simpleagent finished", answer)
+}
+
+// desktopNotify shows an OS notification without waiting for it: osascript
+// on macOS, the BurntToast module on Windows, notify-send elsewhere.
+func desktopNotify(title, body string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("osascript", "-e",
+			fmt.Sprintf("display notification %s with title %s", appleScriptQuote(body), appleScriptQuote(title)))
+	case "windows":
+		cmd = exec.Command("powershell", "-NoProfile", "-Command",
+			fmt.Sprintf("New-BurntToastNotification -Text %s, %s", powerShellQuote(title), powerShellQuote(body)))
+	default:
+		cmd = exec.Command("notify-send", "--app-name=simpleagent", title, body)
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go cmd.Wait()
+	return nil
+}
+
+func appleScriptQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+func powerShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
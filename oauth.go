@@ -0,0 +1,378 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// oauthDefaults are the endpoints used when a provider's oauth config leaves
+// them out. Neither vendor publishes a client for third-party tools, so the
+// client_id always comes from config.
+var oauthDefaults = map[string]OAuthConfig{
+	"anthropic": {
+		AuthURL:  "https://claude.ai/oauth/authorize",
+		TokenURL: "https://console.anthropic.com/v1/oauth/token",
+		Scopes:   []string{"user:inference"},
+	},
+	"openai": {
+		AuthURL:  "https://auth.openai.com/oauth/authorize",
+		TokenURL: "https://auth.openai.com/oauth/token",
+		Scopes:   []string{"openid", "profile", "email", "offline_access"},
+	},
+}
+
+// anthropicOAuthBeta is the beta header Anthropic requires on requests
+// authenticated with an OAuth access token instead of an API key.
+const anthropicOAuthBeta = "oauth-2025-04-20"
+
+// oauthToken is what --auth stores per provider.
+type oauthToken struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	ExpiresAt    time.Time `json:"expires_at,omitempty"`
+}
+
+// oauthSettings fills in defaults for a provider's oauth config.
+func oauthSettings(provider string, pc ProviderConfig) (OAuthConfig, error) {
+	def, ok := oauthDefaults[provider]
+	if !ok {
+		return OAuthConfig{}, fmt.Errorf("%s has no OAuth sign-in (supported: anthropic, openai)", provider)
+	}
+	oc := def
+	if pc.OAuth != nil {
+		oc.ClientID = pc.OAuth.ClientID
+		oc.Port = pc.OAuth.Port
+		if pc.OAuth.AuthURL != "" {
+			oc.AuthURL = pc.OAuth.AuthURL
+		}
+		if pc.OAuth.TokenURL != "" {
+			oc.TokenURL = pc.OAuth.TokenURL
+		}
+		if len(pc.OAuth.Scopes) > 0 {
+			oc.Scopes = pc.OAuth.Scopes
+		}
+	}
+	if oc.ClientID == "" {
+		return oc, fmt.Errorf("providers.%s.oauth.client_id not set in config", provider)
+	}
+	return oc, nil
+}
+
+// --- Token storage: OS credential store, else a 0600 file ---
+
+func oauthTokenPath(provider string) string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".simpleagent", "oauth", provider+".json")
+}
+
+func loadOAuthToken(provider string) (*oauthToken, error) {
+	var data []byte
+	if store := keychain(); store != nil {
+		if s, err := store.Get(provider + ":oauth"); err == nil {
+			data = []byte(s)
+		}
+	}
+	if data == nil {
+		b, err := os.ReadFile(oauthTokenPath(provider))
+		if err != nil {
+			return nil, errNoCredential
+		}
+		data = b
+	}
+	var tok oauthToken
+	if err := json.Unmarshal(data, &tok); err != nil || tok.AccessToken == "" {
+		return nil, errNoCredential
+	}
+	return &tok, nil
+}
+
+// saveOAuthToken stores the token and reports where it went.
+func saveOAuthToken(provider string, tok *oauthToken) (string, error) {
+	data, err := json.Marshal(tok)
+	if err != nil {
+		return "", err
+	}
+	if store := keychain(); store != nil {
+		if err := store.Set(provider+":oauth", string(data)); err == nil {
+			os.Remove(oauthTokenPath(provider))
+			return store.Name(), nil
+		}
+	}
+	path := oauthTokenPath(provider)
+	os.MkdirAll(filepath.Dir(path), 0700)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// deleteOAuthToken removes a stored token; false if there was none.
+func deleteOAuthToken(provider string) bool {
+	removed := false
+	if store := keychain(); store != nil && store.Delete(provider+":oauth") == nil {
+		removed = true
+	}
+	if os.Remove(oauthTokenPath(provider)) == nil {
+		removed = true
+	}
+	return removed
+}
+
+func hasOAuthToken(provider string) bool {
+	if _, ok := oauthDefaults[provider]; !ok {
+		return false
+	}
+	_, err := loadOAuthToken(provider)
+	return err == nil
+}
+
+// --- Login: PKCE authorization code flow with a loopback callback ---
+
+// runOAuthLogin opens the provider's sign-in page and stores the token it
+// returns to a local callback server.
+func runOAuthLogin(cfg Config, provider string) error {
+	pc := cfg.ProviderCfg(provider)
+	oc, err := oauthSettings(provider, pc)
+	if err != nil {
+		return err
+	}
+	// The token endpoint sits behind the same proxy as the API
+	hc, err := providerHTTPClient(provider, pc)
+	if err != nil {
+		return err
+	}
+
+	ln, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", oc.Port))
+	if err != nil {
+		return fmt.Errorf("callback server: %w", err)
+	}
+	defer ln.Close()
+	redirectURI := fmt.Sprintf("http://127.0.0.1:%d/callback", ln.Addr().(*net.TCPAddr).Port)
+
+	verifier := randomURLString(32)
+	sum := sha256.Sum256([]byte(verifier))
+	state := randomURLString(16)
+
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {oc.ClientID},
+		"redirect_uri":          {redirectURI},
+		"scope":                 {strings.Join(oc.Scopes, " ")},
+		"state":                 {state},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(sum[:])},
+		"code_challenge_method": {"S256"},
+	}
+	authURL := oc.AuthURL + "?" + q.Encode()
+
+	type result struct {
+		code string
+		err  error
+	}
+	done := make(chan result, 1)
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/callback" {
+			http.NotFound(w, r)
+			return
+		}
+		q := r.URL.Query()
+		var res result
+		switch {
+		case q.Get("error") != "":
+			res.err = fmt.Errorf("sign-in failed: %s %s", q.Get("error"), q.Get("error_description"))
+		case q.Get("state") != state:
+			res.err = fmt.Errorf("sign-in failed: state mismatch")
+		case q.Get("code") == "":
+			res.err = fmt.Errorf("sign-in failed: no code in callback")
+		default:
+			res.code = q.Get("code")
+		}
+		if res.err != nil {
+			fmt.Fprintf(w, "simpleagent: %v\n", res.err)
+		} else {
+			fmt.Fprintln(w, "simpleagent: signed in. You can close this tab.")
+		}
+		select {
+		case done <- res:
+		default:
+		}
+	})}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	fmt.Printf("Opening your browser to sign in to %s. If it doesn't open, visit:\n\n  %s\n\n", provider, authURL)
+	openBrowser(authURL)
+
+	var res result
+	select {
+	case res = <-done:
+	case <-time.After(5 * time.Minute):
+		return fmt.Errorf("timed out waiting for sign-in")
+	}
+	if res.err != nil {
+		return res.err
+	}
+
+	tok, err := requestToken(hc, oc, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {res.code},
+		"redirect_uri":  {redirectURI},
+		"client_id":     {oc.ClientID},
+		"code_verifier": {verifier},
+		"state":         {state},
+	})
+	if err != nil {
+		return err
+	}
+	where, err := saveOAuthToken(provider, tok)
+	if err != nil {
+		return fmt.Errorf("saving token: %w", err)
+	}
+	fmt.Printf("Signed in to %s; token saved to %s.\n", provider, where)
+	if cfg.ProviderKeyCfg(provider).APIKey != "" {
+		fmt.Printf("Note: an api_key for %s is set and takes precedence; remove it to use your plan.\n", provider)
+	}
+	return nil
+}
+
+// requestToken posts to the token endpoint (authorization_code or refresh_token).
+func requestToken(hc *http.Client, oc OAuthConfig, form url.Values) (*oauthToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", oc.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int    `json:"expires_in"`
+		Error        string `json:"error"`
+		Description  string `json:"error_description"`
+	}
+	json.NewDecoder(resp.Body).Decode(&body)
+	if resp.StatusCode != http.StatusOK || body.AccessToken == "" {
+		if body.Error != "" {
+			return nil, fmt.Errorf("token request: %s %s", body.Error, body.Description)
+		}
+		return nil, fmt.Errorf("token request: HTTP %d", resp.StatusCode)
+	}
+	tok := &oauthToken{AccessToken: body.AccessToken, RefreshToken: body.RefreshToken}
+	if body.ExpiresIn > 0 {
+		tok.ExpiresAt = time.Now().Add(time.Duration(body.ExpiresIn) * time.Second)
+	}
+	return tok, nil
+}
+
+func randomURLString(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// openBrowser tries the platform's URL opener; the URL is printed anyway.
+func openBrowser(u string) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", u)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", u)
+	default:
+		cmd = exec.Command("xdg-open", u)
+	}
+	if cmd.Start() == nil {
+		go cmd.Wait()
+	}
+}
+
+// --- Using the token: refresh as needed, send as a bearer token ---
+
+// oauthSource hands out a current access token, refreshing and re-saving
+// it shortly before it expires.
+type oauthSource struct {
+	provider string
+	oc       OAuthConfig
+	client   *http.Client // for refreshes
+	mu       sync.Mutex
+	tok      *oauthToken
+}
+
+func (s *oauthSource) Token() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tok.ExpiresAt.IsZero() || time.Until(s.tok.ExpiresAt) > time.Minute {
+		return s.tok.AccessToken, nil
+	}
+	if s.tok.RefreshToken == "" || s.oc.ClientID == "" {
+		return "", fmt.Errorf("%s sign-in expired; run simpleagent --auth --provider %s", s.provider, s.provider)
+	}
+	tok, err := requestToken(s.client, s.oc, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {s.tok.RefreshToken},
+		"client_id":     {s.oc.ClientID},
+	})
+	if err != nil {
+		return "", fmt.Errorf("refreshing %s sign-in: %w", s.provider, err)
+	}
+	if tok.RefreshToken == "" {
+		tok.RefreshToken = s.tok.RefreshToken
+	}
+	s.tok = tok
+	saveOAuthToken(s.provider, tok)
+	return tok.AccessToken, nil
+}
+
+// oauthTransport replaces the SDK's API-key auth with the OAuth bearer token.
+type oauthTransport struct {
+	src  *oauthSource
+	base http.RoundTripper
+}
+
+func (t oauthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.src.Token()
+	if err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+	if t.src.provider == "anthropic" {
+		req.Header.Del("X-Api-Key")
+		req.Header.Add("Anthropic-Beta", anthropicOAuthBeta)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// oauthHTTPClient returns a client that authenticates with the provider's
+// stored OAuth token, or nil when there is none. It wraps hc, the provider's
+// client (proxy, timeouts, --trace logging).
+func oauthHTTPClient(provider string, pc ProviderConfig, hc *http.Client) *http.Client {
+	tok, err := loadOAuthToken(provider)
+	if err != nil {
+		return nil
+	}
+	oc, _ := oauthSettings(provider, pc) // without a client_id the token works until it expires
+	src := &oauthSource{provider: provider, oc: oc, client: hc, tok: tok}
+	return &http.Client{Transport: oauthTransport{src: src, base: hc.Transport}}
+}
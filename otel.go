@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OTLP span kinds and status codes.
+const (
+	spanKindInternal = 1
+	spanKindClient   = 3
+	spanStatusOK     = 1
+	spanStatusError  = 2
+)
+
+// otelExporter sends a span per turn, model call, and tool run to an OTLP/HTTP
+// collector, JSON-encoded (no SDK needed). Spans of a turn are buffered and
+// exported together when the turn ends. A nil exporter does nothing.
+type otelExporter struct {
+	url      string
+	headers  map[string]string
+	resource []otlpAttr
+	client   *http.Client
+	warned   bool
+
+	traceID   string // current turn
+	turnID    string
+	turnStart time.Time
+	spans     []otlpSpan
+}
+
+type otlpSpan struct {
+	TraceID      string     `json:"traceId"`
+	SpanID       string     `json:"spanId"`
+	ParentSpanID string     `json:"parentSpanId,omitempty"`
+	Name         string     `json:"name"`
+	Kind         int        `json:"kind"`
+	Start        string     `json:"startTimeUnixNano"`
+	End          string     `json:"endTimeUnixNano"`
+	Attributes   []otlpAttr `json:"attributes,omitempty"`
+	Status       otlpStatus `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpAttr struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+// otlpValue is an AnyValue; OTLP/JSON encodes 64-bit ints as strings.
+type otlpValue struct {
+	String *string `json:"stringValue,omitempty"`
+	Int    *string `json:"intValue,omitempty"`
+	Bool   *bool   `json:"boolValue,omitempty"`
+}
+
+func strAttr(key, v string) otlpAttr { return otlpAttr{key, otlpValue{String: &v}} }
+
+func intAttr(key string, n int) otlpAttr {
+	s := strconv.Itoa(n)
+	return otlpAttr{key, otlpValue{Int: &s}}
+}
+
+func boolAttr(key string, b bool) otlpAttr { return otlpAttr{key, otlpValue{Bool: &b}} }
+
+// newOTelExporter returns nil unless otel.endpoint is set. The endpoint is
+// the collector's base URL (http://localhost:4318); /v1/traces is appended
+// unless already there.
+func newOTelExporter(cfg OTelConfig, agentName string) *otelExporter {
+	if cfg.Endpoint == "" {
+		return nil
+	}
+	url := strings.TrimSuffix(cfg.Endpoint, "/")
+	if !strings.HasSuffix(url, "/v1/traces") {
+		url += "/v1/traces"
+	}
+	return &otelExporter{
+		url:     url,
+		headers: cfg.Headers,
+		resource: []otlpAttr{
+			strAttr("service.name", orDefault(cfg.ServiceName, "simpleagent")),
+			strAttr("service.version", version),
+			strAttr("simpleagent.agent", agentName),
+		},
+		client: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// startTurn opens a new trace for one user turn.
+func (e *otelExporter) startTurn() {
+	if e == nil {
+		return
+	}
+	e.traceID, e.turnID, e.turnStart = randomHex(16), randomHex(8), time.Now()
+	e.spans = nil
+}
+
+func (e *otelExporter) addSpan(name string, kind int, start, end time.Time, attrs []otlpAttr, errMsg string) {
+	status := otlpStatus{Code: spanStatusOK}
+	if errMsg != "" {
+		status = otlpStatus{Code: spanStatusError, Message: errMsg}
+	}
+	e.spans = append(e.spans, otlpSpan{
+		TraceID: e.traceID, SpanID: randomHex(8), ParentSpanID: e.turnID,
+		Name: name, Kind: kind, Start: unixNano(start), End: unixNano(end),
+		Attributes: attrs, Status: status,
+	})
+}
+
+// llmSpan records a model call, with token counts as gen_ai.* attributes.
+func (e *otelExporter) llmSpan(rec llmLogRecord) {
+	if e == nil || e.traceID == "" {
+		return
+	}
+	attrs := []otlpAttr{
+		strAttr("gen_ai.operation.name", "chat"),
+		strAttr("gen_ai.system", rec.Provider),
+		strAttr("gen_ai.request.model", rec.Model),
+		intAttr("gen_ai.usage.input_tokens", rec.InputTokens+rec.CacheRead+rec.CacheWrite),
+		intAttr("gen_ai.usage.output_tokens", rec.OutputTokens),
+		intAttr("simpleagent.usage.cache_read_tokens", rec.CacheRead),
+		intAttr("simpleagent.usage.cache_write_tokens", rec.CacheWrite),
+		boolAttr("simpleagent.usage.estimated", rec.Estimated),
+		intAttr("simpleagent.messages", rec.Messages),
+		intAttr("simpleagent.tool_calls", rec.ToolCalls),
+		strAttr("simpleagent.mode", rec.Mode),
+	}
+	if rec.StopReason != "" {
+		attrs = append(attrs, strAttr("gen_ai.response.finish_reason", rec.StopReason))
+	}
+	end := rec.Time.Add(time.Duration(rec.DurationMS) * time.Millisecond)
+	e.addSpan("chat "+rec.Model, spanKindClient, rec.Time, end, attrs, rec.Error)
+}
+
+// toolSpan records a tool execution.
+func (e *otelExporter) toolSpan(rec toolLogRecord) {
+	if e == nil || e.traceID == "" {
+		return
+	}
+	attrs := []otlpAttr{
+		strAttr("gen_ai.operation.name", "execute_tool"),
+		strAttr("gen_ai.tool.name", rec.Name),
+		strAttr("gen_ai.tool.call.id", rec.ID),
+		strAttr("simpleagent.tool.status", rec.Status),
+		intAttr("simpleagent.tool.result_bytes", rec.ResultBytes),
+	}
+	errMsg := ""
+	switch rec.Status {
+	case "exit":
+		attrs = append(attrs, intAttr("process.exit.code", rec.ExitCode))
+		errMsg = fmt.Sprintf("exit status %d", rec.ExitCode)
+	case "error", "invalid", "timeout":
+		errMsg = rec.Status
+	}
+	end := rec.Time.Add(time.Duration(rec.DurationMS) * time.Millisecond)
+	e.addSpan("execute_tool "+rec.Name, spanKindInternal, rec.Time, end, attrs, errMsg)
+}
+
+// endTurn closes the turn's root span and exports the trace.
+func (e *otelExporter) endTurn(a *Agent, turns int) {
+	if e == nil || e.traceID == "" {
+		return
+	}
+	root := otlpSpan{
+		TraceID: e.traceID, SpanID: e.turnID, Name: "agent.turn", Kind: spanKindInternal,
+		Start: unixNano(e.turnStart), End: unixNano(time.Now()),
+		Attributes: []otlpAttr{
+			strAttr("session.id", a.session.ID),
+			strAttr("simpleagent.mode", a.mode.String()),
+			intAttr("simpleagent.llm_calls", turns),
+			boolAttr("simpleagent.paused", a.paused),
+		},
+		Status: otlpStatus{Code: spanStatusOK},
+	}
+	spans := append([]otlpSpan{root}, e.spans...)
+	e.traceID, e.spans = "", nil
+	e.export(spans)
+}
+
+// export posts spans as an ExportTraceServiceRequest. Failures warn once;
+// tracing never interrupts the agent.
+func (e *otelExporter) export(spans []otlpSpan) {
+	body := map[string]any{
+		"resourceSpans": []any{map[string]any{
+			"resource": map[string]any{"attributes": e.resource},
+			"scopeSpans": []any{map[string]any{
+				"scope": map[string]any{"name": "simpleagent", "version": version},
+				"spans": spans,
+			}},
+		}},
+	}
+	data, _ := json.Marshal(body)
+	req, err := http.NewRequestWithContext(context.Background(), "POST", e.url, bytes.NewReader(data))
+	if err != nil {
+		e.warn(err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		e.warn(err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		e.warn(fmt.Errorf("%s: %s", e.url, resp.Status))
+	}
+}
+
+func (e *otelExporter) warn(err error) {
+	if !e.warned {
+		e.warned = true
+		fmt.Fprintf(os.Stderr, "Warning: OTLP export failed: %v\n", err)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// PathPolicy limits the paths the file and exec tools may touch (tools.paths,
+// paths_allow/paths_deny in .agent files). Patterns are globs as in --watch:
+// "*" stays within a segment, "**" spans directories, a pattern without a
+// slash matches the base name anywhere, and a trailing slash means the
+// directory and everything under it.
+type PathPolicy struct {
+	Allow []string `json:"allow,omitempty"` // if set, every path must match one
+	Deny  []string `json:"deny,omitempty"`  // never touched
+}
+
+func (p PathPolicy) IsEmpty() bool {
+	return len(p.Allow) == 0 && len(p.Deny) == 0
+}
+
+// pathArgs are the arguments naming paths, per tool. An empty value is the
+// working directory, which is what the tools default to.
+var pathArgs = map[string][]string{
+	"read_file":          {"path"},
+	"write_file":         {"path"},
+	"edit_file":          {"path"},
+	"list_dir":           {"path"},
+	"delete":             {"path"},
+	"move":               {"source", "dest"},
+	"copy":               {"source", "dest"},
+	"file_info":          {"path"},
+	"make_dir":           {"path"},
+	"chmod":              {"path"},
+	"hash_file":          {"path"},
+	"grep":               {"path"},
+	"find_files":         {"path"},
+	"diff":               {"file_a", "file_b"},
+	"patch":              {"path"},
+	"read_notebook":      {"path"},
+	"edit_notebook_cell": {"path"},
+	"archive_create":     {"path", "base_dir", "files"},
+	"archive_extract":    {"path", "dest"},
+	"lint":               {"paths"},
+	"run_tests":          {"path", "workdir"},
+	"build":              {"workdir"},
+	"bash":               {"workdir"},
+	"start_process":      {"workdir"},
+}
+
+// Check reports why path is not allowed, or "" when it is.
+func (p PathPolicy) Check(path string) string {
+	if path == "" {
+		path = "."
+	}
+	// Match the path relative to the working directory (and absolute, for
+	// absolute patterns), with symlinks resolved so a link can't lead out.
+	abs := resolvePath(path)
+	names := []string{filepath.ToSlash(abs)}
+	if rel, err := filepath.Rel(resolvePath("."), abs); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		names = append(names, filepath.ToSlash(rel))
+	}
+	matches := func(patterns []string) string {
+		for _, pat := range patterns {
+			glob := pat
+			if strings.HasSuffix(glob, "/") {
+				glob += "**"
+			}
+			res, err := watchGlobs(glob)
+			if err != nil {
+				continue
+			}
+			for _, name := range names {
+				// name+"/" lets "docs/**" cover the docs directory itself
+				if res[0].MatchString(name) || res[0].MatchString(name+"/") {
+					return pat
+				}
+			}
+		}
+		return ""
+	}
+	if pat := matches(p.Deny); pat != "" {
+		return fmt.Sprintf("path %s denied by paths_deny: %s", path, pat)
+	}
+	if len(p.Allow) > 0 && matches(p.Allow) == "" {
+		return fmt.Sprintf("path %s is outside paths_allow (%s)", path, strings.Join(p.Allow, ", "))
+	}
+	return ""
+}
+
+// checkPaths applies the path policy to every path argument of a call.
+// Returns a non-empty blocked message when the call must not run. Commands
+// run by bash are not parsed; only their workdir is checked.
+func (r *ToolRegistry) checkPaths(name string, args json.RawMessage) string {
+	if _, ok := pathArgs[name]; !ok || r.paths.IsEmpty() {
+		return ""
+	}
+	for _, path := range callPaths(name, args) {
+		if why := r.paths.Check(path); why != "" {
+			return "blocked: " + name + " " + why
+		}
+	}
+	return ""
+}
+
+// callPaths lists every path a call names, going by pathArgs ("path" for
+// tools not in it). An argument left out is "", the working directory.
+func callPaths(name string, args json.RawMessage) []string {
+	argNames, ok := pathArgs[name]
+	if !ok {
+		argNames = []string{"path"}
+	}
+	var values map[string]json.RawMessage
+	json.Unmarshal(args, &values)
+	var baseDir string
+	json.Unmarshal(values["base_dir"], &baseDir)
+	var all []string
+	for _, arg := range argNames {
+		var paths []string
+		if json.Unmarshal(values[arg], &paths) != nil {
+			var path string
+			json.Unmarshal(values[arg], &path)
+			paths = []string{path}
+		}
+		if len(paths) == 0 {
+			paths = []string{""}
+		}
+		for _, path := range paths {
+			// archive_create's files are relative to base_dir
+			if arg == "files" && !filepath.IsAbs(path) {
+				path = filepath.Join(baseDir, path)
+			}
+			all = append(all, path)
+		}
+	}
+	return all
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ToolPermission is one tool's entry in tools.permissions: allow, deny, or
+// ask before each call, optionally only for calls whose arguments meet the
+// constraints. A call that doesn't meet them is blocked. Written as just the
+// policy ("bash": "ask") or as an object.
+type ToolPermission struct {
+	Policy string            `json:"policy"`          // allow, deny or ask
+	Paths  []string          `json:"paths,omitempty"` // every path argument (pathArgs) must be inside one of these
+	Args   map[string]string `json:"args,omitempty"`  // argument name → regexp its value must match
+}
+
+var permissionPolicies = []string{"allow", "deny", "ask"}
+
+func (p *ToolPermission) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		return json.Unmarshal(data, &p.Policy)
+	}
+	type plain ToolPermission
+	return json.Unmarshal(data, (*plain)(p))
+}
+
+func (p *ToolPermission) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		p.Policy = n.Value
+		return nil
+	}
+	var v struct {
+		Policy string            `yaml:"policy"`
+		Paths  csvList           `yaml:"paths"`
+		Args   map[string]string `yaml:"args"`
+	}
+	if err := n.Decode(&v); err != nil {
+		return err
+	}
+	*p = ToolPermission{Policy: v.Policy, Paths: v.Paths, Args: v.Args}
+	return nil
+}
+
+// problem describes what's wrong with the entry, "" when it's valid.
+func (p ToolPermission) problem() string {
+	if !slices.Contains(permissionPolicies, p.Policy) {
+		return fmt.Sprintf("policy %q is not one of %s", p.Policy, strings.Join(permissionPolicies, ", "))
+	}
+	for arg, expr := range p.Args {
+		if _, err := regexp.Compile(expr); err != nil {
+			return fmt.Sprintf("args.%s: %v", arg, err)
+		}
+	}
+	return ""
+}
+
+// String is the entry as /tools shows it.
+func (p ToolPermission) String() string {
+	s := p.Policy
+	if len(p.Paths) > 0 {
+		s += " under " + strings.Join(p.Paths, ", ")
+	}
+	if len(p.Args) > 0 {
+		s += " (args constrained)"
+	}
+	return s
+}
+
+// violation says which constraint a call of tool name breaks, "" when it
+// meets them all.
+func (p ToolPermission) violation(name string, args json.RawMessage) string {
+	if len(p.Paths) > 0 {
+		for _, path := range callPaths(name, args) {
+			if path == "" {
+				path = "."
+			}
+			inside := slices.ContainsFunc(p.Paths, func(dir string) bool {
+				return filepath.Clean(path) == filepath.Clean(dir) || pathWithin(path, dir)
+			})
+			if !inside {
+				return fmt.Sprintf("is only allowed under %s, not %s", strings.Join(p.Paths, ", "), path)
+			}
+		}
+	}
+	if len(p.Args) == 0 {
+		return ""
+	}
+	var values map[string]any
+	json.Unmarshal(args, &values)
+	names := make([]string, 0, len(p.Args))
+	for name := range p.Args {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		re, err := regexp.Compile(p.Args[name])
+		if err != nil {
+			return fmt.Sprintf("has an invalid args.%s pattern", name)
+		}
+		value, ok := values[name].(string)
+		if !ok && values[name] != nil {
+			b, _ := json.Marshal(values[name])
+			value = string(b)
+		}
+		if !re.MatchString(value) {
+			return fmt.Sprintf("argument %s must match %s", name, p.Args[name])
+		}
+	}
+	return ""
+}
+
+// permissionLabel is the tool's tools.permissions entry for /tools, "" when
+// it has none.
+func (r *ToolRegistry) permissionLabel(name string) string {
+	if p, ok := r.permissions[name]; ok {
+		return p.String()
+	}
+	return ""
+}
+
+// checkPermission applies tools.permissions to a call. Returns a non-empty
+// blocked message when it must not run, and approved when the user said yes
+// to an ask.
+func (r *ToolRegistry) checkPermission(name string, args json.RawMessage) (blocked string, approved bool) {
+	p, ok := r.permissions[name]
+	if !ok {
+		return "", false
+	}
+	if reason := p.violation(name, args); reason != "" {
+		return fmt.Sprintf("blocked: %s %s (tools.permissions)", name, reason), false
+	}
+	switch p.Policy {
+	case "allow":
+		return "", false
+	case "ask":
+		// The answer skips the safety check, so a command is shown whole.
+		question := "Allow " + name
+		if command := argCommand(name, args); command != "" {
+			question += ":\n    " + command + "\n  Run it"
+		} else if arg := primaryArg(string(args)); arg != "" {
+			question += " " + strconv.Quote(truncate(arg, 80))
+		}
+		if r.Confirm == nil || !r.Confirm(question+"?") {
+			return fmt.Sprintf("blocked: user declined %s (tools.permissions: ask)", name), false
+		}
+		return "", true
+	default: // deny, and anything unrecognized
+		return fmt.Sprintf("blocked: %s denied by tools.permissions", name), false
+	}
+}
@@ -0,0 +1,482 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// pipeline is a `.pipeline` file: agent steps wired into a DAG by `needs`,
+// each given the outputs of the steps it needs and checked against its
+// success criteria before the steps after it run.
+type pipeline struct {
+	Name     string         `yaml:"name"`      // default: the file name
+	MaxTurns int            `yaml:"max_turns"` // LLM calls per step run; 0 = config's max_turns
+	Timeout  int            `yaml:"timeout"`   // seconds per step; 0 = none
+	Steps    []pipelineStep `yaml:"steps"`
+}
+
+type pipelineStep struct {
+	Name    string       `yaml:"name"`
+	Agent   string       `yaml:"agent"` // .agent file, relative to the pipeline; empty = plain config
+	Prompt  string       `yaml:"prompt"`
+	Needs   []string     `yaml:"needs"`
+	Mode    string       `yaml:"mode"`    // "action" (default) or "plan"
+	Success []evalAssert `yaml:"success"` // eval assertions, checked after the step
+	Retries int          `yaml:"retries"` // times to send failed checks back to the agent
+	Timeout int          `yaml:"timeout"` // overrides the pipeline's
+}
+
+// pipelineResult is one step's outcome, also the --json output.
+type pipelineResult struct {
+	Step     string   `json:"step"`
+	Status   string   `json:"status"` // passed, failed, skipped
+	Failures []string `json:"failures,omitempty"`
+	Session  string   `json:"session,omitempty"`
+	Log      string   `json:"log,omitempty"`
+	Attempts int      `json:"attempts,omitempty"`
+	Calls    int      `json:"llm_calls"`
+	Tools    int      `json:"tool_calls"`
+	Tokens   int      `json:"tokens"`
+	CostUSD  float64  `json:"cost_usd"`
+	Unpriced bool     `json:"unpriced,omitempty"`
+	Seconds  float64  `json:"seconds"`
+
+	output string // the step's final reply, for the steps that need it
+}
+
+// pipelineRef is a {{name}} in a step prompt: {{input}} or a needed step's output.
+var pipelineRef = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_-]+)\s*\}\}`)
+
+var pipelineStepName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+type pipelineOptions struct {
+	provider, model, profile string
+	json                     bool
+}
+
+func pipelineFlags(o *pipelineOptions) *flag.FlagSet {
+	fs := flag.NewFlagSet("pipeline", flag.ExitOnError)
+	fs.StringVar(&o.provider, "provider", "", "LLM provider")
+	fs.StringVar(&o.model, "model", "", "Model name")
+	fs.StringVar(&o.profile, "profile", "", "Config profile to use")
+	fs.BoolVar(&o.json, "json", false, "Print the step results as JSON")
+	return fs
+}
+
+const pipelineUsage = "Usage: simpleagent pipeline run <file.pipeline> [input...] [--provider p] [--model m] [--json]"
+
+// runPipeline handles `simpleagent pipeline run <file> [input]`: the steps
+// run one at a time in dependency order, each in a fresh headless session
+// in its own agent. A step whose checks still fail after its retries fails,
+// and the steps that need it are skipped. Exits 1 unless every step passed.
+func runPipeline(args []string) {
+	if len(args) == 0 || args[0] != "run" {
+		fmt.Fprintln(os.Stderr, pipelineUsage)
+		os.Exit(1)
+	}
+	var opt pipelineOptions
+	fs := pipelineFlags(&opt)
+	// The file and input words may come before, between or after the flags
+	var words []string
+	for rest := args[1:]; ; {
+		fs.Parse(rest)
+		if fs.NArg() == 0 {
+			break
+		}
+		words = append(words, fs.Arg(0))
+		rest = fs.Args()[1:]
+	}
+	if len(words) == 0 {
+		fmt.Fprintln(os.Stderr, pipelineUsage)
+		os.Exit(1)
+	}
+	path, input := words[0], strings.Join(words[1:], " ")
+	p, order, err := loadPipeline(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	configProfile = opt.profile
+	ResolveAgentDir("")
+	base := LoadConfig()
+	sessionStorage = base.Storage
+	logDir := filepath.Join(".simpleagent", "pipelines", p.Name, time.Now().Format("20060102-150405"))
+	if err := os.MkdirAll(logDir, 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer shutdownProcesses()
+
+	results := map[string]*pipelineResult{}
+	providers := map[string]Provider{} // shared by steps on the same provider, model and URL
+	var ordered []pipelineResult
+	failed := 0
+	for i, step := range order {
+		var blocked []string
+		for _, need := range step.Needs {
+			if results[need].Status != "passed" {
+				blocked = append(blocked, need)
+			}
+		}
+		var r pipelineResult
+		if len(blocked) > 0 {
+			r = pipelineResult{Step: step.Name, Status: "skipped", Failures: []string{"needs " + strings.Join(blocked, ", ")}}
+		} else {
+			if !opt.json && !plainOutput {
+				fmt.Printf("\033[2m… %s\033[0m", step.Name)
+			}
+			logPath := filepath.Join(logDir, fmt.Sprintf("%02d-%s.log", i+1, step.Name))
+			r = runPipelineStep(p, step, path, base, opt, input, results, providers, logPath)
+		}
+		results[step.Name] = &r
+		ordered = append(ordered, r)
+		if r.Status != "passed" {
+			failed++
+		}
+		if !opt.json {
+			renderPipelineStep(r)
+		}
+	}
+	ResolveAgentDir("")
+	if data, err := json.MarshalIndent(ordered, "", "  "); err == nil {
+		os.WriteFile(filepath.Join(logDir, "run.json"), data, 0644)
+	}
+
+	if opt.json {
+		printJSON(ordered)
+	} else {
+		renderPipelineSummary(ordered, failed, logDir)
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// loadPipeline reads and checks a pipeline file and returns it with its
+// steps in run order: dependencies first, otherwise as written.
+func loadPipeline(path string) (*pipeline, []pipelineStep, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	var p pipeline
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if p.Name == "" {
+		p.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if len(p.Steps) == 0 {
+		return nil, nil, fmt.Errorf("%s: no steps", path)
+	}
+	byName := map[string]pipelineStep{}
+	for i, s := range p.Steps {
+		if !pipelineStepName.MatchString(s.Name) || s.Name == "input" {
+			return nil, nil, fmt.Errorf("%s: step %d: name %q must be letters, digits, - or _ (and not \"input\")", path, i+1, s.Name)
+		}
+		if _, dup := byName[s.Name]; dup {
+			return nil, nil, fmt.Errorf("%s: two steps named %s", path, s.Name)
+		}
+		if strings.TrimSpace(s.Prompt) == "" {
+			return nil, nil, fmt.Errorf("%s: %s has no prompt", path, s.Name)
+		}
+		if s.Mode != "" && s.Mode != "action" && s.Mode != "plan" {
+			return nil, nil, fmt.Errorf("%s: %s: mode must be action or plan", path, s.Name)
+		}
+		for _, a := range s.Success {
+			if a.Output != "" {
+				if _, err := regexp.Compile(a.Output); err != nil {
+					return nil, nil, fmt.Errorf("%s: %s: output: %w", path, s.Name, err)
+				}
+			}
+			if a.FileExists == "" && a.Output == "" && a.Command == "" {
+				return nil, nil, fmt.Errorf("%s: %s: a success check needs file_exists, output or command", path, s.Name)
+			}
+		}
+		byName[s.Name] = s
+	}
+	for _, s := range p.Steps {
+		for _, need := range s.Needs {
+			if _, ok := byName[need]; !ok {
+				return nil, nil, fmt.Errorf("%s: %s needs unknown step %s", path, s.Name, need)
+			}
+		}
+		for _, m := range pipelineRef.FindAllStringSubmatch(s.Prompt, -1) {
+			if m[1] != "input" && !slices.Contains(s.Needs, m[1]) {
+				return nil, nil, fmt.Errorf("%s: %s uses {{%s}} but doesn't need it", path, s.Name, m[1])
+			}
+		}
+	}
+
+	// Depth-first over the steps as written, each after what it needs
+	var order []pipelineStep
+	state := map[string]int{} // 1 = visiting, 2 = done
+	var visit func(name string, chain []string) error
+	visit = func(name string, chain []string) error {
+		switch state[name] {
+		case 1:
+			return fmt.Errorf("%s: steps depend on each other in a cycle: %s", path, strings.Join(append(chain, name), " → "))
+		case 2:
+			return nil
+		}
+		state[name] = 1
+		for _, need := range byName[name].Needs {
+			if err := visit(need, append(chain, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = 2
+		order = append(order, byName[name])
+		return nil
+	}
+	for _, s := range p.Steps {
+		if err := visit(s.Name, nil); err != nil {
+			return nil, nil, err
+		}
+	}
+	return &p, order, nil
+}
+
+// pipelinePrompt fills in {{input}} and {{step}} references; the output of a
+// needed step the prompt doesn't reference, and the input if nothing uses
+// it, are appended.
+func pipelinePrompt(step pipelineStep, input string, results map[string]*pipelineResult) string {
+	used := map[string]bool{}
+	prompt := pipelineRef.ReplaceAllStringFunc(step.Prompt, func(ref string) string {
+		name := pipelineRef.FindStringSubmatch(ref)[1]
+		used[name] = true
+		if name == "input" {
+			return input
+		}
+		return results[name].output
+	})
+	if input != "" && !used["input"] && len(step.Needs) == 0 {
+		prompt += "\n\n" + input
+	}
+	for _, need := range step.Needs {
+		if !used[need] {
+			prompt += fmt.Sprintf("\n\n## Output of the %s step\n%s", need, results[need].output)
+		}
+	}
+	return prompt
+}
+
+// runPipelineStep runs a step headless, checks its success criteria and
+// sends failures back up to step.Retries times. Everything it does goes to
+// logPath.
+func runPipelineStep(p *pipeline, step pipelineStep, path string, base Config, opt pipelineOptions, input string, results map[string]*pipelineResult, providers map[string]Provider, logPath string) (r pipelineResult) {
+	start := time.Now()
+	r = pipelineResult{Step: step.Name, Status: "failed", Log: logPath}
+	defer func() { r.Seconds = time.Since(start).Seconds() }()
+	logf, err := os.Create(logPath)
+	if err != nil {
+		r.Failures = append(r.Failures, err.Error())
+		return r
+	}
+	defer logf.Close()
+
+	cfg := base
+	cfg.Providers = maps.Clone(base.Providers)
+	var af *AgentFile
+	agentName := "(config)"
+	if step.Agent != "" {
+		target := step.Agent
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(path), target)
+		}
+		if af, err = ParseAgentFile(target); err != nil {
+			r.Failures = append(r.Failures, fmt.Sprintf("loading %s: %v", target, err))
+			return r
+		}
+		af.ApplyEnv()
+		ResolveAgentDir(filepath.Base(target))
+		agentName = target
+	} else {
+		ResolveAgentDir("")
+	}
+	cfg.ApplyAgentFile(af)
+	if opt.provider != "" {
+		cfg.Provider = opt.provider
+	}
+	if opt.model != "" {
+		pc := cfg.Providers[cfg.Provider]
+		pc.Model = opt.model
+		cfg.Providers[cfg.Provider] = pc
+	}
+	if p.MaxTurns > 0 {
+		cfg.MaxTurns = p.MaxTurns
+	}
+	if !providerReady(cfg) {
+		r.Failures = append(r.Failures, "no provider configured (run simpleagent --setup first)")
+		return r
+	}
+	pc := cfg.ProviderCfg(cfg.Provider)
+	key := cfg.Provider + "|" + pc.Model + "|" + pc.URL
+	llm, ok := providers[key]
+	if !ok {
+		if llm, err = NewProvider(cfg.Provider, cfg); err != nil {
+			r.Failures = append(r.Failures, err.Error())
+			return r
+		}
+		providers[key] = llm
+	}
+
+	a := NewAgent(llm, cfg, nil, af)
+	a.mode = ModeAction
+	if step.Mode == "plan" {
+		a.mode = ModePlan
+	}
+	r.Session = a.session.ID
+	fmt.Fprintf(logf, "# %s\nagent: %s\nmodel: %s/%s\nsession: %s\nstarted: %s\n", step.Name, agentName, cfg.Provider, pc.Model, a.session.ID, start.Format(time.RFC3339))
+	var output strings.Builder
+	a.sink = func(ev AgentEvent) {
+		switch ev.Type {
+		case "text":
+			output.WriteString(ev.Text)
+			logf.WriteString(ev.Text)
+		case "tool_call":
+			r.Tools++
+			fmt.Fprintf(logf, "\n▶ %s %s\n", ev.Name, truncate(string(ev.Args), 500))
+			if !opt.json && !plainOutput {
+				fmt.Printf("\r\033[K\033[2m… %s ▷ %s\033[0m", step.Name, ev.Name)
+			}
+		case "tool_result":
+			result := ev.Result
+			if len(result) > 2000 {
+				result = strings.ToValidUTF8(result[:2000], "") + "\n[...]"
+			}
+			fmt.Fprintf(logf, "↳ %s\n", result)
+		case "usage":
+			r.Calls++
+			r.Tokens += ev.Usage.PromptTokens() + ev.Usage.OutputTokens
+			price, ok := priceFor(a.llm.Name(), a.llmModel, cfg.Budget.Prices)
+			r.CostUSD += usageCost(ev.Usage, price)
+			r.Unpriced = r.Unpriced || !ok
+		case "warning", "error", "paused":
+			fmt.Fprintf(logf, "\n[%s] %s\n", ev.Type, ev.Text)
+		}
+	}
+	defer cleanScratch(a.session.ID)
+
+	timeout := step.Timeout
+	if timeout == 0 {
+		timeout = p.Timeout
+	}
+	prompt := pipelinePrompt(step, input, results)
+	for r.Attempts = 1; ; r.Attempts++ {
+		fmt.Fprintf(logf, "\n## Attempt %d\n\n> %s\n\n", r.Attempts, strings.ReplaceAll(prompt, "\n", "\n> "))
+		output.Reset()
+		ctx, cancel := context.Background(), context.CancelFunc(func() {})
+		if timeout > 0 {
+			ctx, cancel = context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+		}
+		a.addUserMessage(prompt)
+		a.runAgentLoopCtx(ctx)
+		timedOut := ctx.Err() != nil
+		cancel()
+
+		r.Failures = nil
+		if timedOut {
+			r.Failures = append(r.Failures, fmt.Sprintf("timed out after %ds", timeout))
+		} else if a.paused {
+			r.Failures = append(r.Failures, "paused before finishing (max_turns, budget or an error)")
+		}
+		for _, as := range step.Success {
+			if msg := as.check(output.String()); msg != "" {
+				r.Failures = append(r.Failures, msg)
+			}
+		}
+		fmt.Fprintf(logf, "\n\n## Checks\n")
+		if len(r.Failures) == 0 {
+			fmt.Fprintf(logf, "passed\n")
+			r.Status = "passed"
+			break
+		}
+		for _, f := range r.Failures {
+			fmt.Fprintf(logf, "- %s\n", f)
+		}
+		if timedOut || r.Attempts > step.Retries {
+			break
+		}
+		prompt = "The step isn't done yet; these checks failed:\n- " + strings.Join(r.Failures, "\n- ") + "\nFix the problems, then finish the step."
+		a.paused = false
+	}
+
+	for i := len(a.session.Messages) - 1; i >= 0; i-- {
+		if m := a.session.Messages[i]; m.Role == "assistant" && strings.TrimSpace(m.Content) != "" {
+			r.output = strings.TrimSpace(m.Content)
+			break
+		}
+	}
+	return r
+}
+
+func renderPipelineStep(r pipelineResult) {
+	cost := fmt.Sprintf("$%.2f", r.CostUSD)
+	if r.Unpriced {
+		cost += "+?"
+	}
+	stats := fmt.Sprintf("llm %d, tools %d, %.1fk tokens, %s, %.1fs", r.Calls, r.Tools, float64(r.Tokens)/1000, cost, r.Seconds)
+	if r.Attempts > 1 {
+		stats = fmt.Sprintf("%d attempts, %s", r.Attempts, stats)
+	}
+	switch {
+	case r.Status == "skipped" && plainOutput:
+		fmt.Printf("skip %s\n", r.Step)
+	case r.Status == "skipped":
+		fmt.Printf("\033[2m- %s\033[0m\n", r.Step)
+	case plainOutput && r.Status == "passed":
+		fmt.Printf("ok   %s  (%s)\n", r.Step, stats)
+	case plainOutput:
+		fmt.Printf("FAIL %s  (%s)\n", r.Step, stats)
+	case r.Status == "passed":
+		fmt.Printf("\r\033[K\033[32m✓\033[0m %s  \033[2m(%s)\033[0m\n", r.Step, stats)
+	default:
+		fmt.Printf("\r\033[K\033[31m✗\033[0m %s  \033[2m(%s)\033[0m\n", r.Step, stats)
+	}
+	if r.Status == "passed" {
+		return
+	}
+	for _, f := range r.Failures {
+		fmt.Printf("    %s\n", f)
+	}
+	if r.Log != "" {
+		fmt.Printf("    log: %s\n", r.Log)
+	}
+}
+
+func renderPipelineSummary(results []pipelineResult, failed int, logDir string) {
+	var tokens int
+	var cost float64
+	unpriced := false
+	for _, r := range results {
+		tokens += r.Tokens
+		cost += r.CostUSD
+		unpriced = unpriced || r.Unpriced
+	}
+	costStr := fmt.Sprintf("$%.2f", cost)
+	if unpriced {
+		costStr += "+?"
+	}
+	summary := fmt.Sprintf("%d/%d steps passed", len(results)-failed, len(results))
+	if !plainOutput {
+		color := "\033[32m"
+		if failed > 0 {
+			color = "\033[31m"
+		}
+		summary = color + summary + "\033[0m"
+	}
+	fmt.Printf("\n%s · %.1fk tokens · %s · logs in %s\n", summary, float64(tokens)/1000, costStr, logDir)
+}
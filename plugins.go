@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// pluginManifest describes a user-defined tool: <dir>/<name>.json next to
+// the executable or WASM module that implements it. The plugin gets the
+// call's args as JSON on stdin and its stdout becomes the result.
+type pluginManifest struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Parameters  map[string]any `json:"parameters"`
+	Command     string         `json:"command,omitempty"`   // relative to the manifest; default: manifest name without .json
+	ReadOnly    bool           `json:"read_only,omitempty"` // allowed in plan mode
+	Timeout     int            `json:"timeout,omitempty"`   // seconds, default 60
+
+	// WASM plugins (wasmplugin.go): a module relative to the manifest,
+	// run sandboxed instead of an executable, and what it is granted.
+	Wasm     string   `json:"wasm,omitempty"`
+	Dirs     []string `json:"dirs,omitempty"`      // directories it may use, "path" or "path:ro"
+	Net      []string `json:"net,omitempty"`       // hosts it may reach through the http host function
+	MemoryMB int      `json:"memory_mb,omitempty"` // default 64
+
+	path string // resolved executable or module
+}
+
+// pluginName is what every provider accepts as a tool name.
+var pluginName = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+const defaultPluginTimeout = 60
+
+// pluginDirs are searched in order; a project plugin replaces a user-wide
+// one of the same name.
+func pluginDirs() []string {
+	var dirs []string
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(home, ".simpleagent", "tools"))
+	}
+	return append(dirs, filepath.Join(".simpleagent", "tools"))
+}
+
+// loadPlugins reads every manifest in dirs. Broken manifests are reported
+// and skipped so one bad plugin doesn't take the others down.
+func loadPlugins(dirs []string) []pluginManifest {
+	byName := make(map[string]pluginManifest)
+	for _, dir := range dirs {
+		paths, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+		sort.Strings(paths)
+		for _, path := range paths {
+			p, err := readPluginManifest(path)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: plugin %s: %v\n", path, err)
+				continue
+			}
+			byName[p.Name] = p
+		}
+	}
+	plugins := make([]pluginManifest, 0, len(byName))
+	for _, p := range byName {
+		plugins = append(plugins, p)
+	}
+	sort.Slice(plugins, func(i, j int) bool { return plugins[i].Name < plugins[j].Name })
+	return plugins
+}
+
+func readPluginManifest(path string) (pluginManifest, error) {
+	var p pluginManifest
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return p, err
+	}
+	if err := json.Unmarshal(data, &p); err != nil {
+		return p, err
+	}
+	if !pluginName.MatchString(p.Name) {
+		return p, fmt.Errorf("name %q must be 1-64 letters, digits, _ or -", p.Name)
+	}
+	if p.Description == "" {
+		return p, fmt.Errorf("missing description")
+	}
+	if p.Parameters == nil {
+		p.Parameters = map[string]any{"type": "object", "properties": map[string]any{}}
+	}
+	if t, _ := p.Parameters["type"].(string); t != "object" {
+		return p, fmt.Errorf("parameters must be an object schema")
+	}
+	if err := p.checkWasmGrants(); err != nil {
+		return p, err
+	}
+	if p.Wasm != "" {
+		return p, p.resolveWasm(path)
+	}
+
+	command := p.Command
+	if command == "" {
+		command = strings.TrimSuffix(filepath.Base(path), ".json")
+	}
+	if !filepath.IsAbs(command) {
+		command = filepath.Join(filepath.Dir(path), command)
+	}
+	info, err := os.Stat(command)
+	if err != nil {
+		return p, fmt.Errorf("executable: %v", err)
+	}
+	if info.IsDir() || info.Mode()&0111 == 0 {
+		return p, fmt.Errorf("%s is not executable", command)
+	}
+	p.path, _ = filepath.Abs(command)
+	return p, nil
+}
+
+// registerPluginTools adds the plugins from pluginDirs. They can't replace
+// built-in tools. Deny/allow lists apply to them like any other tool.
+func registerPluginTools(r *ToolRegistry) {
+	for _, p := range loadPlugins(pluginDirs()) {
+		if _, ok := r.handlers[p.Name]; ok {
+			fmt.Fprintf(os.Stderr, "Warning: plugin %s: a built-in tool has that name; skipped\n", p.Name)
+			continue
+		}
+		handler := p.run
+		if p.Wasm != "" {
+			handler = newWasmPlugin(p, r.http).run
+		}
+		r.Register(ToolDef{Name: p.Name, Description: p.Description, Parameters: p.Parameters}, handler, !p.ReadOnly)
+		r.plugins = append(r.plugins, p.Name)
+	}
+}
+
+// run executes the plugin with args on stdin. Like bash, a failure keeps
+// stdout and adds stderr and the exit status.
+func (p pluginManifest) run(args json.RawMessage) (string, error) {
+	if len(bytes.TrimSpace(args)) == 0 {
+		args = json.RawMessage("{}")
+	}
+	timeout := p.Timeout
+	if timeout <= 0 {
+		timeout = defaultPluginTimeout
+	}
+	ctx, cancel := context.WithTimeout(toolCtx, time.Duration(timeout)*time.Second)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, p.path)
+	cmd.Stdin = bytes.NewReader(args)
+	cmd.Env = append(os.Environ(), "SIMPLEAGENT_TOOL="+p.Name)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+
+	result := stdout.String()
+	if err != nil {
+		if stderr.Len() > 0 {
+			if result != "" {
+				result += "\n"
+			}
+			result += "STDERR:\n" + stderr.String()
+		}
+		if ctx.Err() == context.DeadlineExceeded {
+			result += fmt.Sprintf("\n[timed out after %ds]", timeout)
+		} else {
+			result += fmt.Sprintf("\n[exit: %v]", err)
+		}
+	}
+	if result == "" {
+		result = "(no output)"
+	}
+
+	const maxOutput = 50000
+	if len(result) > maxOutput {
+		result = result[:maxOutput] + "\n... [truncated]"
+	}
+	return result, nil
+}
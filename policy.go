@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// CommandPolicy restricts what bash and start_process may run.
+// Patterns are command prefixes ("git push --force") matched against each
+// segment of a compound command, or regular expressions ("re:curl.*\|\s*sh")
+// matched against the whole command line.
+type CommandPolicy struct {
+	Allow   []string `json:"allow,omitempty"`   // if set, every segment must match one
+	Deny    []string `json:"deny,omitempty"`    // blocked outright
+	Confirm []string `json:"confirm,omitempty"` // run only after the user says yes
+}
+
+// IsEmpty reports whether the policy has no rules.
+func (p CommandPolicy) IsEmpty() bool {
+	return len(p.Allow) == 0 && len(p.Deny) == 0 && len(p.Confirm) == 0
+}
+
+// commandTools are the tools whose "command" argument the policy inspects.
+var commandTools = map[string]bool{"bash": true, "start_process": true}
+
+type policyVerdict int
+
+const (
+	policyAllow policyVerdict = iota
+	policyDeny
+	policyConfirm
+)
+
+// Check evaluates a command line. The returned string names the rule that matched.
+func (p CommandPolicy) Check(command string) (policyVerdict, string) {
+	segments := splitCommandSegments(command)
+
+	// A re: pattern that doesn't compile counts as a match for deny and
+	// confirm, so a typo fails closed; for allow it matches nothing.
+	for _, pat := range p.Deny {
+		if matchCommandPattern(pat, command, segments, true) {
+			return policyDeny, pat
+		}
+	}
+
+	if len(p.Allow) > 0 {
+		for _, seg := range segments {
+			if hidesCommand(seg) {
+				return policyDeny, "command substitution or eval with an allow list: " + seg
+			}
+			allowed := false
+			for _, pat := range p.Allow {
+				if matchCommandPattern(pat, seg, []string{seg}, false) {
+					allowed = true
+					break
+				}
+			}
+			if !allowed {
+				return policyDeny, "not in allow list: " + seg
+			}
+		}
+	}
+
+	for _, pat := range p.Confirm {
+		if matchCommandPattern(pat, command, segments, true) {
+			return policyConfirm, pat
+		}
+	}
+	return policyAllow, ""
+}
+
+// matchCommandPattern reports whether pat matches; invalid is the answer
+// for a re: pattern that doesn't compile.
+func matchCommandPattern(pat, command string, segments []string, invalid bool) bool {
+	if expr, ok := strings.CutPrefix(pat, "re:"); ok {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return invalid
+		}
+		return re.MatchString(command)
+	}
+	pat = strings.Join(strings.Fields(pat), " ")
+	for _, seg := range segments {
+		if seg == pat || strings.HasPrefix(seg, pat+" ") {
+			return true
+		}
+	}
+	return false
+}
+
+// problems describes each re: pattern that doesn't compile.
+func (p CommandPolicy) problems() []string {
+	var out []string
+	for _, list := range []struct {
+		name, effect string
+		pats         []string
+	}{
+		{"deny", "every command is blocked", p.Deny},
+		{"allow", "it allows nothing", p.Allow},
+		{"confirm", "every command asks first", p.Confirm},
+	} {
+		for _, pat := range list.pats {
+			if expr, ok := strings.CutPrefix(pat, "re:"); ok {
+				if _, err := regexp.Compile(expr); err != nil {
+					out = append(out, fmt.Sprintf("%s pattern %q: %v; %s until it is fixed", list.name, pat, err, list.effect))
+				}
+			}
+		}
+	}
+	return out
+}
+
+var (
+	policyWarnMu sync.Mutex
+	policyWarned = map[string]bool{} // source + problem, reported once per run
+)
+
+// warnCommandPolicy reports the policy's invalid patterns on stderr, once
+// per run for each source (a config layer or an .agent file).
+func warnCommandPolicy(source string, p CommandPolicy) {
+	policyWarnMu.Lock()
+	defer policyWarnMu.Unlock()
+	for _, problem := range p.problems() {
+		if !policyWarned[source+problem] {
+			policyWarned[source+problem] = true
+			fmt.Fprintf(os.Stderr, "Warning: %s: commands: %s\n", source, problem)
+		}
+	}
+}
+
+// commandSubstitution matches $(...), backticks and process substitution,
+// which run a command inside a segment that starts with an allowed prefix.
+var commandSubstitution = regexp.MustCompile("\\$\\(|`|[<>]\\(")
+
+// hidesCommand reports whether a segment can run commands its prefix
+// doesn't show ("git status $(rm -rf ~)", "eval ...").
+func hidesCommand(seg string) bool {
+	return commandSubstitution.MatchString(seg) || slices.Contains(strings.Fields(seg), "eval")
+}
+
+// splitCommandSegments breaks a shell line on ; & && || | and newlines
+// (but not redirections like 2>&1), collapsing whitespace and a leading sudo.
+// Good enough for policy checks, not a shell parser.
+func splitCommandSegments(command string) []string {
+	var segs []string
+	var cur strings.Builder
+	flush := func() {
+		f := strings.Join(strings.Fields(cur.String()), " ")
+		f = strings.TrimPrefix(f, "sudo ")
+		if f != "" {
+			segs = append(segs, f)
+		}
+		cur.Reset()
+	}
+
+	for i := 0; i < len(command); i++ {
+		c := command[i]
+		switch {
+		case c == ';' || c == '\n' || c == '|':
+			flush()
+		case c == '&':
+			redirect := (i > 0 && command[i-1] == '>') || (i+1 < len(command) && command[i+1] == '>')
+			if redirect {
+				cur.WriteByte(c)
+			} else {
+				flush()
+			}
+		default:
+			cur.WriteByte(c)
+		}
+	}
+	flush()
+	return segs
+}
+
+// checkCommandPolicy applies the registry's command policy to a tool call.
+// Returns a non-empty blocked message when the call must not run, and
+// approved when the user already said yes to a confirm rule. asked skips the
+// confirm question when the user just approved the call (tools.permissions).
+func (r *ToolRegistry) checkCommandPolicy(name string, args json.RawMessage, asked bool) (blocked string, approved bool) {
+	if !commandTools[name] || r.commands.IsEmpty() {
+		return "", false
+	}
+	var params struct {
+		Command string `json:"command"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", false
+	}
+
+	verdict, rule := r.commands.Check(params.Command)
+	switch verdict {
+	case policyDeny:
+		return fmt.Sprintf("blocked: command denied by policy (%s)", rule), false
+	case policyConfirm:
+		if asked {
+			return "", true
+		}
+		if r.Confirm == nil || !r.Confirm(fmt.Sprintf("Run %q? (matches %s)", params.Command, rule)) {
+			return fmt.Sprintf("blocked: user declined command (%s)", rule), false
+		}
+		return "", true
+	}
+	return "", false
+}
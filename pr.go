@@ -0,0 +1,425 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// ForgeConfig lets /pr and create_pr open pull requests (merge requests on
+// GitLab). The repository comes from the remote's URL.
+type ForgeConfig struct {
+	GitHubToken string `json:"github_token,omitempty"` // or GITHUB_TOKEN / GH_TOKEN
+	GitLabToken string `json:"gitlab_token,omitempty"` // or GITLAB_TOKEN
+	Kind        string `json:"kind,omitempty"`         // "github" or "gitlab"; detected from the remote host
+	API         string `json:"api,omitempty"`          // API base for self-hosted instances; derived from the host
+	Remote      string `json:"remote,omitempty"`       // push remote (default "origin")
+	Base        string `json:"base,omitempty"`         // target branch (default: the remote's default branch)
+	Draft       bool   `json:"draft,omitempty"`        // open as drafts
+	Transcript  bool   `json:"transcript,omitempty"`   // upload the session transcript (secret gist / private snippet) and link it
+}
+
+func (c ForgeConfig) hasToken() bool {
+	return c.GitHubToken != "" || c.GitLabToken != ""
+}
+
+func (c ForgeConfig) remote() string {
+	if c.Remote != "" {
+		return c.Remote
+	}
+	return "origin"
+}
+
+// forgeRepo is the repository pull requests are opened on.
+type forgeRepo struct {
+	Kind  string // "github" or "gitlab"
+	Path  string // owner/repo; GitLab groups can nest
+	API   string
+	Token string
+}
+
+// parseRemoteURL returns the host and repository path of a remote URL:
+// https://host/owner/repo.git, ssh://git@host:22/owner/repo.git, or the
+// scp-like git@host:owner/repo.git.
+func parseRemoteURL(raw string) (host, path string, err error) {
+	raw = strings.TrimSpace(raw)
+	if strings.Contains(raw, "://") {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return "", "", err
+		}
+		host, path = u.Hostname(), u.Path
+	} else if at, rest, ok := strings.Cut(raw, ":"); ok && !strings.Contains(at, "/") {
+		host, path = at, rest
+		if i := strings.LastIndex(host, "@"); i >= 0 {
+			host = host[i+1:]
+		}
+	}
+	path = strings.TrimSuffix(strings.Trim(path, "/"), ".git")
+	if host == "" || !strings.Contains(path, "/") {
+		return "", "", fmt.Errorf("can't tell the repository from remote URL %q", raw)
+	}
+	return host, path, nil
+}
+
+// resolveForge works out the forge, API and token for the remote.
+func resolveForge(cfg ForgeConfig) (forgeRepo, error) {
+	remoteURL, err := gitOutput("remote", "get-url", cfg.remote())
+	if err != nil {
+		return forgeRepo{}, err
+	}
+	host, path, err := parseRemoteURL(remoteURL)
+	if err != nil {
+		return forgeRepo{}, err
+	}
+	kind := cfg.Kind
+	if kind == "" {
+		switch {
+		case strings.Contains(host, "github"):
+			kind = "github"
+		case strings.Contains(host, "gitlab"):
+			kind = "gitlab"
+		case cfg.GitLabToken != "" && cfg.GitHubToken == "":
+			kind = "gitlab"
+		default:
+			kind = "github"
+		}
+	}
+	repo := forgeRepo{Kind: kind, Path: path, API: strings.TrimSuffix(cfg.API, "/")}
+	switch kind {
+	case "github":
+		repo.Token = cfg.GitHubToken
+		if repo.API == "" {
+			repo.API = "https://" + host + "/api/v3" // GitHub Enterprise
+			if host == "github.com" {
+				repo.API = "https://api.github.com"
+			}
+		}
+	case "gitlab":
+		repo.Token = cfg.GitLabToken
+		if repo.API == "" {
+			repo.API = "https://" + host + "/api/v4"
+		}
+	default:
+		return forgeRepo{}, fmt.Errorf("forge.kind %q is not github or gitlab", kind)
+	}
+	if repo.Token == "" {
+		return forgeRepo{}, fmt.Errorf("no %s token: set forge.%s_token in config or %s", kind, kind, map[string]string{"github": "GITHUB_TOKEN", "gitlab": "GITLAB_TOKEN"}[kind])
+	}
+	return repo, nil
+}
+
+// call sends a request to the forge API, with body as JSON unless it is
+// nil, and decodes the reply into out.
+func (f forgeRepo) call(ctx context.Context, method, path string, body, out any) error {
+	var data io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		data = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, f.API+path, data)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if f.Kind == "gitlab" {
+		req.Header.Set("PRIVATE-TOKEN", f.Token)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+f.Token)
+		req.Header.Set("Accept", "application/vnd.github+json")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	reply, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode >= 300 {
+		var e struct {
+			Message any `json:"message"`
+			Errors  any `json:"errors"`
+		}
+		json.Unmarshal(reply, &e)
+		msg := strings.TrimSpace(string(reply))
+		if e.Message != nil {
+			msg = fmt.Sprint(e.Message)
+			if e.Errors != nil {
+				detail, _ := json.Marshal(e.Errors)
+				msg += " " + string(detail)
+			}
+		}
+		return fmt.Errorf("%s API: %s (status %d)", f.Kind, truncate(msg, 300), resp.StatusCode)
+	}
+	return json.Unmarshal(reply, out)
+}
+
+// uploadTranscript posts a session transcript as a secret gist (GitHub) or
+// a private project snippet (GitLab) and returns its URL.
+func (f forgeRepo) uploadTranscript(ctx context.Context, s *Session) (string, error) {
+	name := "simpleagent-" + s.ID + ".md"
+	content := renderTranscript(s)
+	var out struct {
+		HTMLURL string `json:"html_url"`
+		WebURL  string `json:"web_url"`
+	}
+	if f.Kind == "gitlab" {
+		err := f.call(ctx, "POST", "/projects/"+url.PathEscape(f.Path)+"/snippets", map[string]any{
+			"title":      "simpleagent session " + s.ID,
+			"visibility": "private",
+			"files":      []map[string]string{{"file_path": name, "content": content}},
+		}, &out)
+		return out.WebURL, err
+	}
+	err := f.call(ctx, "POST", "/gists", map[string]any{
+		"description": "simpleagent session " + s.ID,
+		"public":      false,
+		"files":       map[string]any{name: map[string]string{"content": content}},
+	}, &out)
+	return out.HTMLURL, err
+}
+
+// prRequest is a pull request to open from the current branch.
+type prRequest struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+	Base  string `json:"base"`
+	Draft bool   `json:"draft"`
+}
+
+// prBranches returns the current branch and the base to merge it into, and
+// checks there is something to propose.
+func prBranches(cfg ForgeConfig, base string) (branch, target string, err error) {
+	out, err := gitOutput("rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return "", "", err
+	}
+	branch = strings.TrimSpace(out)
+	if branch == "HEAD" {
+		return "", "", fmt.Errorf("HEAD is detached; check out a branch first")
+	}
+	target = base
+	if target == "" {
+		target = cfg.Base
+	}
+	if target == "" {
+		target = "main"
+		if out, err := gitOutput("symbolic-ref", "--short", "refs/remotes/"+cfg.remote()+"/HEAD"); err == nil {
+			target = strings.TrimPrefix(strings.TrimSpace(out), cfg.remote()+"/")
+		}
+	}
+	if branch == target {
+		return "", "", fmt.Errorf("on the base branch %s; create a branch for the change first", target)
+	}
+	if out, err := gitOutput("rev-list", "--count", prBaseRef(cfg, target)+"..HEAD"); err == nil && strings.TrimSpace(out) == "0" {
+		return "", "", fmt.Errorf("%s has no commits that aren't on %s", branch, target)
+	}
+	return branch, target, nil
+}
+
+// prBaseRef is the base as git knows it: the remote-tracking branch when
+// there is one.
+func prBaseRef(cfg ForgeConfig, base string) string {
+	ref := cfg.remote() + "/" + base
+	if exec.Command("git", "rev-parse", "--verify", "-q", ref).Run() == nil {
+		return ref
+	}
+	return base
+}
+
+// openPR pushes the current branch and opens a pull request for it, with a
+// link to the uploaded transcript when forge.transcript is on. Returns the
+// pull request's URL.
+func openPR(ctx context.Context, cfg ForgeConfig, session *Session, req prRequest) (string, error) {
+	repo, err := resolveForge(cfg)
+	if err != nil {
+		return "", err
+	}
+	branch, base, err := prBranches(cfg, req.Base)
+	if err != nil {
+		return "", err
+	}
+	push := exec.CommandContext(ctx, "git", "push", "-u", cfg.remote(), branch)
+	if out, err := push.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("git push: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	body := req.Body
+	if cfg.Transcript && session != nil {
+		link, err := repo.uploadTranscript(ctx, session)
+		if err != nil {
+			return "", fmt.Errorf("uploading the transcript: %w", err)
+		}
+		body = strings.TrimRight(body, "\n") + "\n\n---\nSession transcript: " + link + "\n"
+	}
+
+	var out struct {
+		HTMLURL string `json:"html_url"`
+		WebURL  string `json:"web_url"`
+	}
+	draft := req.Draft || cfg.Draft
+	if repo.Kind == "gitlab" {
+		title := req.Title
+		if draft {
+			title = "Draft: " + title
+		}
+		err = repo.call(ctx, "POST", "/projects/"+url.PathEscape(repo.Path)+"/merge_requests", map[string]any{
+			"source_branch": branch,
+			"target_branch": base,
+			"title":         title,
+			"description":   body,
+		}, &out)
+		return out.WebURL, err
+	}
+	err = repo.call(ctx, "POST", "/repos/"+repo.Path+"/pulls", map[string]any{
+		"title": req.Title,
+		"head":  branch,
+		"base":  base,
+		"body":  body,
+		"draft": draft,
+	}, &out)
+	return out.HTMLURL, err
+}
+
+// registerPRTool adds create_pr when a forge token is configured. It pushes
+// and publishes, so it is a write tool and asks first (safety.confirm_dangerous).
+func registerPRTool(r *ToolRegistry, cfg ForgeConfig, session func() *Session) {
+	if !cfg.hasToken() {
+		return
+	}
+	r.Register(ToolDef{
+		Name: "create_pr",
+		Description: "Push the current git branch and open a pull request (GitLab: merge request) for it. " +
+			"Commit the work on a feature branch first. Write the title and the description yourself: what changed, why, and how it was tested.",
+		Parameters: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"title": map[string]any{"type": "string", "description": "Pull request title"},
+				"body":  map[string]any{"type": "string", "description": "Description in markdown"},
+				"base":  map[string]any{"type": "string", "description": "Branch to merge into (default: the repository's default branch)"},
+				"draft": map[string]any{"type": "boolean", "description": "Open as a draft"},
+			},
+			"required": []string{"title", "body"},
+		},
+	}, func(args json.RawMessage) (string, error) {
+		var req prRequest
+		if err := json.Unmarshal(args, &req); err != nil {
+			return "", err
+		}
+		ctx, cancel := context.WithTimeout(toolCtx, 2*time.Minute)
+		defer cancel()
+		link, err := openPR(ctx, cfg, session(), req)
+		if err != nil {
+			return "error: " + err.Error(), nil
+		}
+		return "opened " + link, nil
+	}, true)
+}
+
+// prCommand handles /pr [hint]: the commit model drafts a title and
+// description from the branch's commits and diff, the user accepts or edits
+// them, and the pull request is opened.
+func (a *Agent) prCommand(hint string) {
+	cfg := a.cfg.Forge
+	if _, err := resolveForge(cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return
+	}
+	branch, base, err := prBranches(cfg, "")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return
+	}
+	ref := prBaseRef(cfg, base)
+	log, _ := gitOutput("log", "--reverse", "--format=- %s%n%b", ref+"..HEAD")
+	stat, _ := gitOutput("diff", "--stat", ref+"...HEAD")
+	diff, _ := gitOutput("diff", ref+"...HEAD")
+	if len(diff) > commitDiffMax {
+		diff = strings.ToValidUTF8(diff[:commitDiffMax], "") + "\n[diff truncated]"
+	}
+
+	prompt := "Write the title and description of a pull request merging " + branch + " into " + base + ".\n" +
+		"The title is at most 72 characters and says what the change does. The description is markdown: " +
+		"what changed and why, then how it was tested if the commits say; no file-by-file list.\n"
+	for _, name := range []string{".github/pull_request_template.md", ".github/PULL_REQUEST_TEMPLATE.md", ".gitlab/merge_request_templates/Default.md"} {
+		if tmpl, err := os.ReadFile(filepath.FromSlash(name)); err == nil {
+			prompt += "Fill in the repository's template:\n" + string(tmpl) + "\n"
+			break
+		}
+	}
+	if hint != "" {
+		prompt += "The user adds: " + hint + "\n"
+	}
+	prompt += "\nCommits:\n" + log + "\nFiles:\n" + stat + "\nDiff:\n" + a.redactor.Redact(diff)
+
+	var draft prRequest
+	schema := jsonObject(map[string]any{
+		"title": map[string]any{"type": "string"},
+		"body":  map[string]any{"type": "string"},
+	})
+	a.useRole("commit")
+	defer a.useRole(a.modeRole())
+	fmt.Printf("\033[2mDrafting the pull request with %s...\033[0m\n", a.llmModel)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Minute)
+	defer cancel()
+	usage, err := completeJSON(ctx, a.llm, prompt, schema, &draft)
+	if usage != nil {
+		a.addUsage(usage)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return
+	}
+	draft.Title, draft.Body = strings.TrimSpace(draft.Title), strings.TrimSpace(draft.Body)
+
+	fmt.Printf("\n%s → %s\n\n\033[1m%s\033[0m\n\n%s\n\n", branch, base, draft.Title, draft.Body)
+	if a.sink != nil || !term.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Println("Not opened: no terminal to approve it.")
+		return
+	}
+	fmt.Print("\033[33m? Push and open this pull request? [y/e(dit)/N]: \033[0m")
+	line, err := a.readLineSimple()
+	if err != nil {
+		return
+	}
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "y", "yes":
+	case "e", "edit":
+		edited, err := openInEditor(draft.Title+"\n\n"+draft.Body+"\n", ".md")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return
+		}
+		title, body, _ := strings.Cut(strings.TrimSpace(edited), "\n")
+		if draft.Title = strings.TrimSpace(title); draft.Title == "" {
+			fmt.Println("Empty title, not opened.")
+			return
+		}
+		draft.Body = strings.TrimSpace(body)
+	default:
+		fmt.Println("Not opened.")
+		return
+	}
+
+	link, err := openPR(ctx, cfg, a.session, draft)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return
+	}
+	fmt.Printf("Opened %s\n", link)
+}
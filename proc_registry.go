@@ -0,0 +1,388 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// processRecord is one managed process in agentDir/processes.json. The file
+// lists every running process of every simpleagent sharing the agent dir, so
+// a later run can find survivors: keep_alive processes, or any process when
+// its simpleagent died without cleaning up.
+type processRecord struct {
+	ID        string            `json:"id"`
+	PID       int               `json:"pid"`
+	Command   string            `json:"command"`
+	Workdir   string            `json:"workdir,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+	Started   time.Time         `json:"started"`
+	StartID   string            `json:"start_id,omitempty"` // processStartID, checked before adopting
+	KeepAlive bool              `json:"keep_alive,omitempty"`
+	// The simpleagent managing the process, identified like the process itself.
+	OwnerPID     int    `json:"owner_pid,omitempty"`
+	OwnerStartID string `json:"owner_start_id,omitempty"`
+}
+
+// ownedBySelf reports whether this simpleagent wrote the record.
+func (rec processRecord) ownedBySelf() bool {
+	return rec.OwnerPID == os.Getpid() && rec.OwnerStartID == selfStartID()
+}
+
+// ownerAlive reports whether the simpleagent managing the process still
+// runs. Records from before owners were recorded have none and count as orphans.
+func (rec processRecord) ownerAlive() bool {
+	return sameProcess(rec.OwnerPID, rec.OwnerStartID)
+}
+
+// selfStartID is this simpleagent's processStartID, written as the owner of its records.
+var selfStartID = sync.OnceValue(func() string { return processStartID(os.Getpid()) })
+
+// errAdoptedExit is the exit status of an adopted process, which can't be waited on.
+var errAdoptedExit = errors.New("exit status unknown (started by a previous run)")
+
+func processRegistryPath() string {
+	return filepath.Join(agentDir, "processes.json")
+}
+
+func processLogDir() string {
+	return filepath.Join(agentDir, "processes")
+}
+
+// saveProcessRegistry merges this run's processes into processes.json under
+// its lock, so other simpleagents' records survive the write.
+func saveProcessRegistry() {
+	if agentDir == "" {
+		return
+	}
+	withFileLock(processRegistryPath()+".lock", func() error {
+		writeProcessRegistry(readProcessRegistry())
+		return nil
+	})
+}
+
+func readProcessRegistry() []processRecord {
+	data, err := os.ReadFile(processRegistryPath())
+	if err != nil {
+		return nil
+	}
+	var recs []processRecord
+	json.Unmarshal(data, &recs)
+	return recs
+}
+
+// writeProcessRegistry replaces this run's records in onDisk with its running
+// processes and writes the result, removing the file when it's empty.
+// Records of processes another live simpleagent owns are kept as they are.
+// The caller holds the registry lock.
+func writeProcessRegistry(onDisk []processRecord) {
+	self, selfStart := os.Getpid(), selfStartID()
+	processes.Lock()
+	var recs []processRecord
+	ours := map[string]bool{}
+	for id, mp := range processes.m {
+		if mp.OwnerPID != 0 {
+			continue // its owner keeps the record
+		}
+		ours[id] = true
+		mp.mu.Lock()
+		done := mp.Done
+		mp.mu.Unlock()
+		if done {
+			continue
+		}
+		recs = append(recs, processRecord{
+			ID: id, PID: mp.Pid, Command: mp.Command, Workdir: mp.Workdir, Env: mp.Env,
+			Started: mp.Started, StartID: mp.StartID, KeepAlive: mp.KeepAlive,
+			OwnerPID: self, OwnerStartID: selfStart,
+		})
+	}
+	processes.Unlock()
+	for _, rec := range onDisk {
+		if !ours[rec.ID] && !rec.ownedBySelf() {
+			recs = append(recs, rec)
+		}
+	}
+
+	path := processRegistryPath()
+	if len(recs) == 0 {
+		os.Remove(path)
+		return
+	}
+	sort.Slice(recs, func(i, j int) bool { return recs[i].Started.Before(recs[j].Started) })
+	os.MkdirAll(agentDir, 0755)
+	data, _ := json.MarshalIndent(recs, "", "  ")
+	os.WriteFile(path, data, 0644)
+}
+
+// adoptProcesses loads processes.json at startup. Still-running processes
+// whose simpleagent has exited become managed again, so read_output (for
+// keep_alive output logs), kill_process, and list_processes work on them,
+// and this run takes over as their owner. A live simpleagent's processes
+// stay its own: its keep_alive ones are shared for reading but never
+// signalled from here, and the rest are left alone. A PID whose start time
+// differs from the recorded one was reused (after a reboot, say) and is
+// forgotten, so it is never signalled.
+func adoptProcesses() {
+	if agentDir == "" {
+		return
+	}
+	var adopted, shared []processRecord
+	gone := 0
+	withFileLock(processRegistryPath()+".lock", func() error {
+		var keep []processRecord
+		for _, rec := range readProcessRegistry() {
+			switch {
+			case rec.ownerAlive():
+				// Its owner forgets it once it exits.
+				keep = append(keep, rec)
+				if rec.KeepAlive && !rec.ownedBySelf() && sameProcess(rec.PID, rec.StartID) {
+					adoptProcess(rec, true)
+					shared = append(shared, rec)
+				}
+			case rec.PID <= 0 || !sameProcess(rec.PID, rec.StartID):
+				removeProcessLogs(rec.ID)
+				gone++
+			default:
+				adoptProcess(rec, false)
+				adopted = append(adopted, rec)
+			}
+		}
+		writeProcessRegistry(keep)
+		return nil
+	})
+
+	if len(adopted) > 0 {
+		fmt.Printf("Adopted %d background process(es) from a previous run:\n", len(adopted))
+		for _, rec := range adopted {
+			fmt.Printf("  %s  pid %d  %s\n", rec.ID, rec.PID, rec.Command)
+		}
+	}
+	if len(shared) > 0 {
+		fmt.Printf("Sharing %d keep_alive process(es) of other running simpleagents:\n", len(shared))
+		for _, rec := range shared {
+			fmt.Printf("  %s  pid %d  %s  (owner PID %d)\n", rec.ID, rec.PID, rec.Command, rec.OwnerPID)
+		}
+	}
+	if gone > 0 {
+		fmt.Printf("\033[2m%d background process(es) from a previous run have exited.\033[0m\n", gone)
+	}
+}
+
+// adoptProcess manages a recorded process. A shared one stays its owner's:
+// it is tracked for reading only, and its logs are left for the owner.
+func adoptProcess(rec processRecord, shared bool) {
+	const bufSize = 64 * 1024
+	name := rec.Command
+	if len(name) > 60 {
+		name = name[:60] + "..."
+	}
+	mp := &ManagedProcess{
+		ID:        rec.ID,
+		Name:      name,
+		Command:   rec.Command,
+		Workdir:   rec.Workdir,
+		Env:       rec.Env,
+		Pid:       rec.PID,
+		Stdout:    newRingBuffer(bufSize),
+		Stderr:    newRingBuffer(bufSize),
+		Started:   rec.Started,
+		StartID:   rec.StartID,
+		KeepAlive: rec.KeepAlive,
+		Adopted:   true,
+	}
+	if shared {
+		mp.OwnerPID = rec.OwnerPID
+	}
+
+	// Output is only recoverable from keep_alive logs; other survivors
+	// were writing to pipes that closed with the previous run.
+	stop := make(chan struct{})
+	tailed := make(chan struct{})
+	if logs := openProcessLogs(rec.ID); logs != nil {
+		go func() {
+			logs.tail(mp.Stdout, mp.Stderr, stop)
+			close(tailed)
+		}()
+	} else {
+		close(tailed)
+	}
+
+	// Not our child, so poll for exit instead of waiting.
+	go func() {
+		for sameProcess(rec.PID, rec.StartID) {
+			time.Sleep(500 * time.Millisecond)
+		}
+		close(stop)
+		<-tailed
+		mp.mu.Lock()
+		mp.Done = true
+		mp.ExitErr = errAdoptedExit
+		mp.mu.Unlock()
+		if !shared {
+			removeProcessLogs(rec.ID)
+			saveProcessRegistry()
+		}
+	}()
+
+	processes.Lock()
+	processes.m[rec.ID] = mp
+	processes.Unlock()
+}
+
+// shutdownProcesses runs when simpleagent exits: managed processes are
+// stopped (SIGTERM, then SIGKILL after 3 seconds) unless started with
+// keep_alive, which stay running and in the registry for the next run.
+// Processes shared from another simpleagent are never touched.
+func shutdownProcesses() {
+	processes.Lock()
+	var stop []*ManagedProcess
+	kept := 0
+	for _, mp := range processes.m {
+		mp.mu.Lock()
+		done := mp.Done
+		mp.mu.Unlock()
+		switch {
+		case done, mp.OwnerPID != 0:
+		case mp.KeepAlive:
+			kept++
+		default:
+			stop = append(stop, mp)
+		}
+	}
+	processes.Unlock()
+
+	for _, mp := range stop {
+		if !mp.exited() {
+			terminateProcess(mp.Pid)
+		}
+		if mp.View != nil {
+			mp.View.Close()
+		}
+	}
+	for _, mp := range stop {
+		for i := 0; i < 30 && !mp.exited(); i++ {
+			time.Sleep(100 * time.Millisecond)
+		}
+		if !mp.exited() {
+			forceKillProcess(mp.Pid)
+		}
+	}
+
+	// Killed processes may not have been reaped yet; drop them explicitly.
+	processes.Lock()
+	for id, mp := range processes.m {
+		if !mp.KeepAlive {
+			delete(processes.m, id)
+		}
+	}
+	processes.Unlock()
+	saveProcessRegistry()
+
+	if len(stop) > 0 || kept > 0 {
+		fmt.Printf("\033[2mStopped %d background process(es)", len(stop))
+		if kept > 0 {
+			fmt.Printf(", left %d running (keep_alive)", kept)
+		}
+		fmt.Print(".\033[0m\n")
+	}
+}
+
+// exited reports whether the process is done (for adopted ones, no longer
+// alive as the process that was recorded).
+func (mp *ManagedProcess) exited() bool {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	return mp.Done || (mp.Adopted && !sameProcess(mp.Pid, mp.StartID))
+}
+
+// sameProcess reports whether pid is alive and still the process startID
+// was recorded for. Records without one can't be checked and never match.
+func sameProcess(pid int, startID string) bool {
+	return startID != "" && processAlive(pid) && processStartID(pid) == startID
+}
+
+// processLogs are a keep_alive process's stdout and stderr files.
+type processLogs struct {
+	outPath, errPath string
+	out, err         *os.File // write ends handed to the child
+}
+
+func createProcessLogs(id string) (*processLogs, error) {
+	if err := os.MkdirAll(processLogDir(), 0755); err != nil {
+		return nil, err
+	}
+	l := &processLogs{
+		outPath: filepath.Join(processLogDir(), id+".out"),
+		errPath: filepath.Join(processLogDir(), id+".err"),
+	}
+	var err error
+	if l.out, err = os.Create(l.outPath); err != nil {
+		return nil, err
+	}
+	if l.err, err = os.Create(l.errPath); err != nil {
+		l.out.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// openProcessLogs returns the logs of a previous run's process, or nil.
+func openProcessLogs(id string) *processLogs {
+	l := &processLogs{
+		outPath: filepath.Join(processLogDir(), id+".out"),
+		errPath: filepath.Join(processLogDir(), id+".err"),
+	}
+	if _, err := os.Stat(l.outPath); err != nil {
+		return nil
+	}
+	return l
+}
+
+// closeFiles closes this process's copies of the write ends after the child starts.
+func (l *processLogs) closeFiles() {
+	l.out.Close()
+	l.err.Close()
+}
+
+// tail copies new log output into stdout and stderr every 200ms until stop
+// is closed, then copies what's left and returns.
+func (l *processLogs) tail(stdout, stderr io.Writer, stop <-chan struct{}) {
+	var wg sync.WaitGroup
+	for _, f := range []struct {
+		path string
+		w    io.Writer
+	}{{l.outPath, stdout}, {l.errPath, stderr}} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			file, err := os.Open(f.path)
+			if err != nil {
+				return
+			}
+			defer file.Close()
+			for {
+				io.Copy(f.w, file)
+				select {
+				case <-stop:
+					io.Copy(f.w, file)
+					return
+				case <-time.After(200 * time.Millisecond):
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func removeProcessLogs(id string) {
+	os.Remove(filepath.Join(processLogDir(), id+".out"))
+	os.Remove(filepath.Join(processLogDir(), id+".err"))
+	os.Remove(processLogDir()) // only succeeds when empty
+}
@@ -3,7 +3,11 @@
 package main
 
 import (
+	"fmt"
+	"os"
 	"os/exec"
+	"strconv"
+	"strings"
 	"syscall"
 )
 
@@ -11,20 +15,47 @@ func setProcGroup(cmd *exec.Cmd) {
 	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
 }
 
-func terminateProcess(cmd *exec.Cmd) {
-	pgid, err := syscall.Getpgid(cmd.Process.Pid)
+func terminateProcess(pid int) {
+	pgid, err := syscall.Getpgid(pid)
 	if err == nil {
 		syscall.Kill(-pgid, syscall.SIGTERM)
 	} else {
-		cmd.Process.Signal(syscall.SIGTERM)
+		syscall.Kill(pid, syscall.SIGTERM)
 	}
 }
 
-func forceKillProcess(cmd *exec.Cmd) {
-	pgid, err := syscall.Getpgid(cmd.Process.Pid)
+func forceKillProcess(pid int) {
+	pgid, err := syscall.Getpgid(pid)
 	if err == nil {
 		syscall.Kill(-pgid, syscall.SIGKILL)
 	} else {
-		cmd.Process.Kill()
+		syscall.Kill(pid, syscall.SIGKILL)
 	}
 }
+
+// processAlive reports whether pid exists (signal 0 probes without sending).
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
+
+// processStartID identifies the process running as pid by when it started,
+// so a reused PID doesn't pass for it. Linux reads the start tick from
+// /proc (with the boot ID, since ticks restart at boot); elsewhere ps's
+// start time. Empty when neither is available.
+func processStartID(pid int) string {
+	if data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid)); err == nil {
+		// Field 22; the command name (field 2) may hold spaces, so count from its ')'
+		s := string(data)
+		if f := strings.Fields(s[strings.LastIndexByte(s, ')')+1:]); len(f) > 19 {
+			boot, _ := os.ReadFile("/proc/sys/kernel/random/boot_id")
+			return strings.TrimSpace(string(boot)) + ":" + f[19]
+		}
+		return ""
+	}
+	out, err := exec.Command("ps", "-o", "lstart=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
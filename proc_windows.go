@@ -2,16 +2,49 @@
 
 package main
 
-import "os/exec"
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+)
 
 func setProcGroup(cmd *exec.Cmd) {
 	// Windows doesn't support Unix process groups
 }
 
-func terminateProcess(cmd *exec.Cmd) {
-	cmd.Process.Kill()
+func terminateProcess(pid int) {
+	if p, err := os.FindProcess(pid); err == nil {
+		p.Kill()
+	}
 }
 
-func forceKillProcess(cmd *exec.Cmd) {
-	cmd.Process.Kill()
+func forceKillProcess(pid int) {
+	terminateProcess(pid)
+}
+
+// processAlive reports whether pid exists; FindProcess fails for unknown PIDs on Windows.
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
+
+// processStartID identifies the process running as pid by its creation
+// time, so a reused PID doesn't pass for it. Empty when it can't be opened.
+func processStartID(pid int) string {
+	const processQueryLimitedInformation = 0x1000
+	h, err := syscall.OpenProcess(processQueryLimitedInformation, false, uint32(pid))
+	if err != nil {
+		return ""
+	}
+	defer syscall.CloseHandle(h)
+	var created, exited, kernel, user syscall.Filetime
+	if err := syscall.GetProcessTimes(h, &created, &exited, &kernel, &user); err != nil {
+		return ""
+	}
+	return strconv.FormatInt(created.Nanoseconds(), 10)
 }
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// projectContextCache holds the "Project context" block for one working
+// directory. Git state is only re-read when the branch changes, so the
+// dirty-file list is what it was at session start or the last checkout.
+var projectContextCache struct {
+	dir    string
+	branch string
+	text   string
+}
+
+// loadProjectContext returns the "Project context" system prompt block:
+// languages, manifests, test command, and git state.
+func loadProjectContext() string {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	root := projectRoot(cwd)
+	branch := gitBranch()
+	if projectContextCache.dir == cwd && projectContextCache.branch == branch {
+		return projectContextCache.text
+	}
+	text := formatProjectContext(root, branch)
+	projectContextCache.dir, projectContextCache.branch, projectContextCache.text = cwd, branch, text
+	return text
+}
+
+func formatProjectContext(root, branch string) string {
+	var notes []string
+	add := func(label string, items []string) {
+		if len(items) > 0 {
+			notes = append(notes, label+": "+strings.Join(items, ", "))
+		}
+	}
+	add("Languages", detectLanguages(root))
+	add("Manifests", detectManifests(root))
+	if cmd := testCommand(root); cmd != "" {
+		notes = append(notes, "Test command: `"+cmd+"`")
+	}
+	if branch != "" {
+		notes = append(notes, "Git: "+gitSummary(root, branch))
+	}
+	if len(notes) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("## Project context (detected)\n")
+	sb.WriteString("Root: " + root + "\n")
+	for _, n := range notes {
+		sb.WriteString("- " + n + "\n")
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+// languageExts maps source extensions to language names. Docs and data
+// formats are left out so they don't crowd the list.
+var languageExts = map[string]string{
+	".go": "Go", ".rs": "Rust", ".py": "Python", ".rb": "Ruby", ".java": "Java", ".kt": "Kotlin",
+	".js": "JavaScript", ".jsx": "JavaScript", ".mjs": "JavaScript", ".cjs": "JavaScript",
+	".ts": "TypeScript", ".tsx": "TypeScript", ".c": "C", ".h": "C", ".cc": "C++", ".cpp": "C++",
+	".hpp": "C++", ".cs": "C#", ".swift": "Swift", ".php": "PHP", ".scala": "Scala", ".ex": "Elixir",
+	".exs": "Elixir", ".dart": "Dart", ".lua": "Lua", ".sh": "Shell", ".zig": "Zig", ".vue": "Vue",
+	".svelte": "Svelte",
+}
+
+// detectLanguages counts source files (up to 20000) and returns the top
+// languages with their share.
+func detectLanguages(root string) []string {
+	counts := map[string]int{}
+	seen, total := 0, 0
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		name := d.Name()
+		if d.IsDir() {
+			if path != root && (strings.HasPrefix(name, ".") || slices.Contains(skipDirs, name)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if seen++; seen > 20000 {
+			return filepath.SkipAll
+		}
+		if lang, ok := languageExts[strings.ToLower(filepath.Ext(name))]; ok {
+			counts[lang]++
+			total++
+		}
+		return nil
+	})
+
+	langs := make([]string, 0, len(counts))
+	for l := range counts {
+		langs = append(langs, l)
+	}
+	sort.Slice(langs, func(i, j int) bool {
+		if counts[langs[i]] != counts[langs[j]] {
+			return counts[langs[i]] > counts[langs[j]]
+		}
+		return langs[i] < langs[j]
+	})
+	var out []string
+	for _, l := range langs {
+		pct := counts[l] * 100 / total
+		if len(out) == 4 || (len(out) > 0 && pct < 5) {
+			break
+		}
+		out = append(out, fmt.Sprintf("%s (%d%%)", l, pct))
+	}
+	return out
+}
+
+// manifestFiles are build and package files worth naming, with what they mean.
+var manifestFiles = []struct{ file, what string }{
+	{"go.mod", "Go modules"},
+	{"Cargo.toml", "Cargo"},
+	{"package.json", "npm"},
+	{"pyproject.toml", "Python project"},
+	{"requirements.txt", "pip"},
+	{"setup.py", "setuptools"},
+	{"Gemfile", "Bundler"},
+	{"pom.xml", "Maven"},
+	{"build.gradle", "Gradle"},
+	{"build.gradle.kts", "Gradle"},
+	{"composer.json", "Composer"},
+	{"mix.exs", "Mix"},
+	{"pubspec.yaml", "Dart/Flutter"},
+	{"Package.swift", "SwiftPM"},
+	{"CMakeLists.txt", "CMake"},
+	{"Makefile", "make"},
+	{"justfile", "just"},
+	{"Dockerfile", "Docker"},
+}
+
+// detectManifests lists the manifests at the project root. For npm the
+// lockfile names the package manager actually in use.
+func detectManifests(root string) []string {
+	var found []string
+	for _, m := range manifestFiles {
+		if !fileExists(filepath.Join(root, m.file)) {
+			continue
+		}
+		what := m.what
+		if m.file == "package.json" {
+			what = nodePackageManager(root)
+		}
+		found = append(found, m.file+" ("+what+")")
+	}
+	if matches, _ := filepath.Glob(filepath.Join(root, "*.csproj")); len(matches) > 0 {
+		found = append(found, filepath.Base(matches[0])+" (.NET)")
+	}
+	return found
+}
+
+func nodePackageManager(root string) string {
+	switch {
+	case fileExists(filepath.Join(root, "pnpm-lock.yaml")):
+		return "pnpm"
+	case fileExists(filepath.Join(root, "yarn.lock")):
+		return "yarn"
+	case fileExists(filepath.Join(root, "bun.lockb")), fileExists(filepath.Join(root, "bun.lock")):
+		return "bun"
+	}
+	return "npm"
+}
+
+// testCommand guesses how the project runs its tests: a declared script or
+// make target first, then the build tool's default.
+func testCommand(root string) string {
+	var pkg struct {
+		Scripts map[string]string `json:"scripts"`
+	}
+	if data, err := os.ReadFile(filepath.Join(root, "package.json")); err == nil {
+		if json.Unmarshal(data, &pkg) == nil && pkg.Scripts["test"] != "" {
+			return nodePackageManager(root) + " test"
+		}
+	}
+	if data, err := os.ReadFile(filepath.Join(root, "Makefile")); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			if strings.HasPrefix(line, "test:") {
+				return "make test"
+			}
+		}
+	}
+	switch {
+	case fileExists(filepath.Join(root, "go.mod")):
+		return "go test ./..."
+	case fileExists(filepath.Join(root, "Cargo.toml")):
+		return "cargo test"
+	case fileExists(filepath.Join(root, "pom.xml")):
+		return "mvn test"
+	case fileExists(filepath.Join(root, "build.gradle")), fileExists(filepath.Join(root, "build.gradle.kts")):
+		if fileExists(filepath.Join(root, "gradlew")) {
+			return "./gradlew test"
+		}
+		return "gradle test"
+	case fileExists(filepath.Join(root, "mix.exs")):
+		return "mix test"
+	}
+	if testRunner(root, readPyproject(root)) == "pytest" {
+		return "pytest"
+	}
+	return ""
+}
+
+// gitSummary describes the branch and uncommitted changes, listing at most
+// ten paths.
+func gitSummary(root, branch string) string {
+	s := "branch " + branch
+	if branch == "HEAD" {
+		s = "detached HEAD"
+	}
+	out, err := exec.Command("git", "-C", root, "status", "--porcelain").Output()
+	if err != nil {
+		return s
+	}
+	var changes []string
+	for _, line := range strings.Split(strings.TrimRight(string(out), "\n"), "\n") {
+		if line != "" {
+			changes = append(changes, strings.TrimSpace(line))
+		}
+	}
+	switch {
+	case len(changes) == 0:
+		return s + ", clean"
+	case len(changes) > 10:
+		return fmt.Sprintf("%s, %d uncommitted changes: %s, ...", s, len(changes), strings.Join(changes[:10], "; "))
+	}
+	return fmt.Sprintf("%s, %d uncommitted changes: %s", s, len(changes), strings.Join(changes, "; "))
+}
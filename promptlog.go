@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// promptSection is one named part of the system prompt. Sections map to
+// what can change them mid-session: "persona" (.agent), "mode" (/plan,
+// /action), "project" (AGENTS.md/CLAUDE.md), "context" (branch), "conventions", "memory"
+// (AGENT.md and retrieval), and so on.
+type promptSection struct {
+	Name string
+	Text string
+}
+
+// promptBuilder collects the system prompt section by section.
+type promptBuilder struct {
+	sections []promptSection
+	name     string
+	cur      strings.Builder
+}
+
+// Section starts a new section; text written before it belongs to the previous one.
+func (b *promptBuilder) Section(name string) {
+	b.flush()
+	b.name = name
+}
+
+func (b *promptBuilder) WriteString(s string) {
+	b.cur.WriteString(s)
+}
+
+func (b *promptBuilder) flush() {
+	if b.cur.Len() > 0 {
+		b.sections = append(b.sections, promptSection{Name: b.name, Text: b.cur.String()})
+	}
+	b.cur.Reset()
+}
+
+// Sections returns the non-empty sections in prompt order.
+func (b *promptBuilder) Sections() []promptSection {
+	b.flush()
+	return b.sections
+}
+
+func joinSections(secs []promptSection) string {
+	var sb strings.Builder
+	for _, s := range secs {
+		sb.WriteString(s.Text)
+	}
+	return sb.String()
+}
+
+// promptVersion is one distinct system prompt sent in a session. Only the
+// sections that changed since the previous version are stored.
+type promptVersion struct {
+	Version  int               `json:"version"`
+	Time     time.Time         `json:"time"`
+	Message  int               `json:"message"`           // transcript length when first sent
+	Changed  []string          `json:"changed,omitempty"` // sections added, changed or removed; empty for version 1
+	Order    []string          `json:"order"`             // all section names, in prompt order
+	Sections map[string]string `json:"sections"`          // text of the changed sections
+}
+
+// promptChangelog is the system prompt versions of one session, appended to
+// .simpleagent/<agent>/prompts/<session-id>.jsonl.
+type promptChangelog struct {
+	session  string
+	versions []promptVersion
+	current  map[string]string // section texts as of the last version
+}
+
+func promptLogPath(sessionID string) string {
+	return filepath.Join(agentDir, "prompts", sessionID+".jsonl")
+}
+
+// loadPromptChangelog reads a session's changelog, so a resumed session
+// keeps numbering from where it left off.
+func loadPromptChangelog(sessionID string) *promptChangelog {
+	h := &promptChangelog{session: sessionID, current: map[string]string{}}
+	f, err := os.Open(promptLogPath(sessionID))
+	if err != nil {
+		return h
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var v promptVersion
+		if json.Unmarshal(scanner.Bytes(), &v) == nil {
+			h.apply(v)
+		}
+	}
+	return h
+}
+
+func (h *promptChangelog) apply(v promptVersion) {
+	for name, text := range v.Sections {
+		h.current[name] = text
+	}
+	for name := range h.current {
+		if !slices.Contains(v.Order, name) {
+			delete(h.current, name)
+		}
+	}
+	h.versions = append(h.versions, v)
+}
+
+// trackPrompt records secs as a new version when they differ from the
+// session's last one.
+func (a *Agent) trackPrompt(secs []promptSection) {
+	if a.prompts == nil || a.prompts.session != a.session.ID {
+		a.prompts = loadPromptChangelog(a.session.ID)
+	}
+	h := a.prompts
+
+	v := promptVersion{Sections: map[string]string{}}
+	for _, s := range secs {
+		v.Order = append(v.Order, s.Name)
+		if old, ok := h.current[s.Name]; !ok || old != s.Text {
+			v.Sections[s.Name] = s.Text
+			v.Changed = append(v.Changed, s.Name)
+		}
+	}
+	for name := range h.current {
+		if !slices.Contains(v.Order, name) {
+			v.Changed = append(v.Changed, name)
+		}
+	}
+	if len(v.Changed) == 0 {
+		return
+	}
+	if len(h.versions) == 0 {
+		v.Changed = nil
+	}
+	v.Version = len(h.versions) + 1
+	v.Time = time.Now()
+	v.Message = len(a.session.Messages)
+	h.apply(v)
+
+	if agentDir == "" {
+		return
+	}
+	path := promptLogPath(a.session.ID)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	data, _ := json.Marshal(v)
+	f.Write(append(data, '\n'))
+}
+
+// text rebuilds the full prompt of version n (1-based).
+func (h *promptChangelog) text(n int) string {
+	sections := map[string]string{}
+	for _, v := range h.versions[:n] {
+		for name, text := range v.Sections {
+			sections[name] = text
+		}
+	}
+	var sb strings.Builder
+	for _, name := range h.versions[n-1].Order {
+		sb.WriteString(sections[name])
+	}
+	return sb.String()
+}
+
+// promptDiff handles /prompt-diff [N [M]]: the changelog, then the diff of
+// the latest change, of version N against N-1, or of N against M.
+func (a *Agent) promptDiff(arg string) {
+	if a.prompts == nil || a.prompts.session != a.session.ID {
+		a.prompts = loadPromptChangelog(a.session.ID)
+	}
+	h := a.prompts
+	if len(h.versions) == 0 {
+		fmt.Println("No system prompt sent in this session yet.")
+		return
+	}
+
+	from, to := len(h.versions)-1, len(h.versions)
+	if fields := strings.Fields(arg); len(fields) > 0 {
+		var nums []int
+		for _, f := range fields[:min(len(fields), 2)] {
+			n, err := strconv.Atoi(strings.TrimPrefix(f, "v"))
+			if err != nil || n < 1 || n > len(h.versions) {
+				fmt.Printf("No prompt version %s (have 1-%d).\n", f, len(h.versions))
+				return
+			}
+			nums = append(nums, n)
+		}
+		if len(nums) == 1 {
+			from, to = nums[0]-1, nums[0]
+		} else {
+			from, to = nums[0], nums[1]
+		}
+	}
+
+	fmt.Println("System prompt versions:")
+	for _, v := range h.versions {
+		changed := "initial"
+		if len(v.Changed) > 0 {
+			changed = "changed: " + strings.Join(v.Changed, ", ")
+		}
+		fmt.Printf("  v%-3d %s  after message %-4d %s\n", v.Version, v.Time.Local().Format("15:04:05"), v.Message, changed)
+	}
+	if from < 1 {
+		fmt.Println("\nv1 is the first version; nothing to diff.")
+		return
+	}
+
+	fmt.Println()
+	nameA, nameB := fmt.Sprintf("v%d", from), fmt.Sprintf("v%d", to)
+	diff := unifiedDiff(nameA, nameB, splitLines(h.text(from)), splitLines(h.text(to)), 3)
+	switch {
+	case diff == "":
+		fmt.Printf("%s and %s are identical.\n", nameA, nameB)
+	case plainOutput:
+		fmt.Print(diff)
+	default:
+		fmt.Print(colorizeDiff(diff, "prompt.md"))
+	}
+}
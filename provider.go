@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 )
 
@@ -9,6 +10,10 @@ type Provider interface {
 	Name() string
 	SendStream(ctx context.Context, msgs []Message, tools []ToolDef, systemPrompt string) (<-chan StreamChunk, error)
 	MaxContext() int
+	// CompleteJSON answers a single prompt with JSON matching schema (a JSON
+	// Schema object), using the provider's JSON mode or a forced tool call.
+	// Callers decode it with completeJSON.
+	CompleteJSON(ctx context.Context, prompt string, schema map[string]any) (json.RawMessage, *Usage, error)
 }
 
 func NewProvider(name string, cfg Config) (Provider, error) {
@@ -20,11 +25,13 @@ func NewProvider(name string, cfg Config) (Provider, error) {
 	case "openrouter":
 		return NewOpenAIProvider("openrouter", cfg)
 	case "ollama":
-		return NewOpenAIProvider("ollama", cfg)
+		return NewOllamaProvider(cfg)
 	case "gemini":
 		return NewGeminiProvider(cfg)
 	case "bedrock":
 		return NewBedrockProvider(cfg)
+	case "mock":
+		return NewMockProvider(cfg)
 	default:
 		return nil, fmt.Errorf("unknown provider: %s", name)
 	}
@@ -17,15 +17,25 @@ type AnthropicProvider struct {
 }
 
 func NewAnthropicProvider(cfg Config) (*AnthropicProvider, error) {
-	pc := cfg.ProviderCfg("anthropic")
-	if pc.APIKey == "" {
-		return nil, fmt.Errorf("anthropic api_key not set (set ANTHROPIC_API_KEY or providers.anthropic.api_key in config)")
+	pc := cfg.ProviderKeyCfg("anthropic")
+	hc, err := providerHTTPClient("anthropic", pc)
+	if err != nil {
+		return nil, err
+	}
+	apiKey := pc.APIKey
+	if apiKey == "" {
+		// Signed in with a Claude plan (--auth): the transport swaps in the token
+		if hc = oauthHTTPClient("anthropic", pc, hc); hc == nil {
+			return nil, fmt.Errorf("anthropic api_key not set (set ANTHROPIC_API_KEY or providers.anthropic.api_key in config, or sign in with --auth)")
+		}
+		apiKey = "oauth"
 	}
 	var opts []anthropic.ClientOption
 	if pc.URL != "" {
 		opts = append(opts, anthropic.WithBaseURL(pc.URL))
 	}
-	client := anthropic.NewClient(pc.APIKey, opts...)
+	opts = append(opts, anthropic.WithHTTPClient(hc))
+	client := anthropic.NewClient(apiKey, opts...)
 	return &AnthropicProvider{client: client, model: pc.Model, cfg: cfg}, nil
 }
 
@@ -57,7 +67,7 @@ func (p *AnthropicProvider) SendStream(ctx context.Context, msgs []Message, tool
 			args strings.Builder
 		}
 		toolCalls := make(map[int]*toolCallState)
-		var inputTokens, outputTokens int
+		var usage Usage
 
 		req := anthropic.MessagesStreamRequest{
 			MessagesRequest: anthropic.MessagesRequest{
@@ -67,7 +77,9 @@ func (p *AnthropicProvider) SendStream(ctx context.Context, msgs []Message, tool
 				System:    systemPrompt,
 			},
 			OnMessageStart: func(data anthropic.MessagesEventMessageStartData) {
-				inputTokens = data.Message.Usage.InputTokens
+				usage.InputTokens = data.Message.Usage.InputTokens
+				usage.CacheCreationTokens = data.Message.Usage.CacheCreationInputTokens
+				usage.CacheReadTokens = data.Message.Usage.CacheReadInputTokens
 			},
 			OnContentBlockStart: func(data anthropic.MessagesEventContentBlockStartData) {
 				if data.ContentBlock.Type == anthropic.MessagesContentTypeToolUse {
@@ -107,7 +119,8 @@ func (p *AnthropicProvider) SendStream(ctx context.Context, msgs []Message, tool
 				}
 			},
 			OnMessageDelta: func(data anthropic.MessagesEventMessageDeltaData) {
-				outputTokens = data.Usage.OutputTokens
+				usage.OutputTokens = data.Usage.OutputTokens
+				usage.StopReason = string(data.Delta.StopReason)
 			},
 		}
 
@@ -121,18 +134,40 @@ func (p *AnthropicProvider) SendStream(ctx context.Context, msgs []Message, tool
 			return
 		}
 
-		ch <- StreamChunk{
-			Done: true,
-			Usage: &Usage{
-				InputTokens:  inputTokens,
-				OutputTokens: outputTokens,
-			},
-		}
+		ch <- StreamChunk{Done: true, Usage: &usage}
 	}()
 
 	return ch, nil
 }
 
+// CompleteJSON forces a call of the respond tool, whose input schema is
+// schema.
+func (p *AnthropicProvider) CompleteJSON(ctx context.Context, prompt string, schema map[string]any) (json.RawMessage, *Usage, error) {
+	resp, err := p.client.CreateMessages(ctx, anthropic.MessagesRequest{
+		Model:      anthropic.Model(p.model),
+		Messages:   []anthropic.Message{anthropic.NewUserTextMessage(prompt)},
+		MaxTokens:  p.cfg.MaxTokens,
+		Tools:      []anthropic.ToolDefinition{{Name: respondTool, Description: respondToolDescription, InputSchema: schema}},
+		ToolChoice: &anthropic.ToolChoice{Type: "tool", Name: respondTool},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	usage := &Usage{
+		InputTokens:         resp.Usage.InputTokens,
+		OutputTokens:        resp.Usage.OutputTokens,
+		CacheCreationTokens: resp.Usage.CacheCreationInputTokens,
+		CacheReadTokens:     resp.Usage.CacheReadInputTokens,
+		StopReason:          string(resp.StopReason),
+	}
+	for _, c := range resp.Content {
+		if c.Type == anthropic.MessagesContentTypeToolUse && c.MessageContentToolUse != nil {
+			return c.MessageContentToolUse.Input, usage, nil
+		}
+	}
+	return nil, usage, fmt.Errorf("anthropic: the reply has no %s call", respondTool)
+}
+
 func convertToAnthropicMessages(msgs []Message) []anthropic.Message {
 	var result []anthropic.Message
 
@@ -174,7 +209,7 @@ func convertToAnthropicMessages(msgs []Message) []anthropic.Message {
 			if toolContent == "" {
 				toolContent = "(no output)"
 			}
-			result = append(result, anthropic.NewToolResultsMessage(m.ToolCallID, toolContent, false))
+			result = append(result, anthropic.NewToolResultsMessage(m.ToolCallID, toolContent, m.IsError))
 		}
 	}
 
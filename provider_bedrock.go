@@ -21,7 +21,11 @@ type BedrockProvider struct {
 
 func NewBedrockProvider(cfg Config) (*BedrockProvider, error) {
 	pc := cfg.ProviderCfg("bedrock")
-	awsCfg, err := awsconfig.LoadDefaultConfig(context.Background())
+	hc, err := providerHTTPClient("bedrock", pc)
+	if err != nil {
+		return nil, err
+	}
+	awsCfg, err := awsconfig.LoadDefaultConfig(context.Background(), awsconfig.WithHTTPClient(hc))
 	if err != nil {
 		return nil, fmt.Errorf("loading AWS config: %w", err)
 	}
@@ -76,6 +80,7 @@ func (p *BedrockProvider) SendStream(ctx context.Context, msgs []Message, tools
 		}
 		var currentTool *toolState
 		currentBlockIndex := 0
+		var stopReason string
 
 		for event := range output.GetStream().Events() {
 			if ctx.Err() != nil {
@@ -122,12 +127,18 @@ func (p *BedrockProvider) SendStream(ctx context.Context, msgs []Message, tools
 				}
 				currentBlockIndex++
 
+			case *types.ConverseStreamOutputMemberMessageStop:
+				stopReason = string(v.Value.StopReason)
+
 			case *types.ConverseStreamOutputMemberMetadata:
 				var usage *Usage
 				if v.Value.Usage != nil {
 					usage = &Usage{
-						InputTokens:  int(aws.ToInt32(v.Value.Usage.InputTokens)),
-						OutputTokens: int(aws.ToInt32(v.Value.Usage.OutputTokens)),
+						InputTokens:         int(aws.ToInt32(v.Value.Usage.InputTokens)),
+						OutputTokens:        int(aws.ToInt32(v.Value.Usage.OutputTokens)),
+						CacheCreationTokens: int(aws.ToInt32(v.Value.Usage.CacheWriteInputTokens)),
+						CacheReadTokens:     int(aws.ToInt32(v.Value.Usage.CacheReadInputTokens)),
+						StopReason:          stopReason,
 					}
 				}
 				ch <- StreamChunk{Done: true, Usage: usage}
@@ -142,6 +153,45 @@ func (p *BedrockProvider) SendStream(ctx context.Context, msgs []Message, tools
 	return ch, nil
 }
 
+// CompleteJSON forces a call of the respond tool, whose input schema is
+// schema.
+func (p *BedrockProvider) CompleteJSON(ctx context.Context, prompt string, schema map[string]any) (json.RawMessage, *Usage, error) {
+	input := &bedrockruntime.ConverseInput{
+		ModelId:  aws.String(p.model),
+		Messages: convertToBedrockMessages([]Message{{Role: "user", Content: prompt}}),
+		ToolConfig: &types.ToolConfiguration{
+			Tools:      convertToBedrockTools([]ToolDef{{Name: respondTool, Description: respondToolDescription, Parameters: schema}}),
+			ToolChoice: &types.ToolChoiceMemberTool{Value: types.SpecificToolChoice{Name: aws.String(respondTool)}},
+		},
+	}
+	if p.cfg.MaxTokens > 0 {
+		input.InferenceConfig = &types.InferenceConfiguration{
+			MaxTokens: aws.Int32(int32(p.cfg.MaxTokens)),
+		}
+	}
+	out, err := p.client.Converse(ctx, input)
+	if err != nil {
+		return nil, nil, err
+	}
+	var usage *Usage
+	if out.Usage != nil {
+		usage = &Usage{
+			InputTokens:  int(aws.ToInt32(out.Usage.InputTokens)),
+			OutputTokens: int(aws.ToInt32(out.Usage.OutputTokens)),
+			StopReason:   string(out.StopReason),
+		}
+	}
+	if msg, ok := out.Output.(*types.ConverseOutputMemberMessage); ok {
+		for _, block := range msg.Value.Content {
+			if tu, ok := block.(*types.ContentBlockMemberToolUse); ok && tu.Value.Input != nil {
+				data, err := tu.Value.Input.MarshalSmithyDocument()
+				return data, usage, err
+			}
+		}
+	}
+	return nil, usage, fmt.Errorf("bedrock: the reply has no %s call", respondTool)
+}
+
 func convertToBedrockMessages(msgs []Message) []types.Message {
 	var result []types.Message
 
@@ -178,6 +228,10 @@ func convertToBedrockMessages(msgs []Message) []types.Message {
 				Content: content,
 			})
 		case "tool":
+			status := types.ToolResultStatusSuccess
+			if m.IsError {
+				status = types.ToolResultStatusError
+			}
 			result = append(result, types.Message{
 				Role: types.ConversationRoleUser,
 				Content: []types.ContentBlock{
@@ -187,7 +241,7 @@ func convertToBedrockMessages(msgs []Message) []types.Message {
 							Content: []types.ToolResultContentBlock{
 								&types.ToolResultContentBlockMemberText{Value: m.Content},
 							},
-							Status: types.ToolResultStatusSuccess,
+							Status: status,
 						},
 					},
 				},
@@ -16,7 +16,7 @@ type GeminiProvider struct {
 }
 
 func NewGeminiProvider(cfg Config) (*GeminiProvider, error) {
-	pc := cfg.ProviderCfg("gemini")
+	pc := cfg.ProviderKeyCfg("gemini")
 	if pc.APIKey == "" {
 		return nil, fmt.Errorf("gemini api_key not set (set GEMINI_API_KEY or providers.gemini.api_key in config)")
 	}
@@ -27,6 +27,11 @@ func NewGeminiProvider(cfg Config) (*GeminiProvider, error) {
 	if pc.URL != "" {
 		clientCfg.HTTPOptions = genai.HTTPOptions{BaseURL: pc.URL}
 	}
+	hc, err := providerHTTPClient("gemini", pc)
+	if err != nil {
+		return nil, err
+	}
+	clientCfg.HTTPClient = hc
 	client, err := genai.NewClient(context.Background(), clientCfg)
 	if err != nil {
 		return nil, fmt.Errorf("creating gemini client: %w", err)
@@ -69,6 +74,7 @@ func (p *GeminiProvider) SendStream(ctx context.Context, msgs []Message, tools [
 		defer close(ch)
 
 		var usage *Usage
+		var stopReason string
 		toolCallIndex := 0
 
 		for result, err := range p.client.Models.GenerateContentStream(ctx, p.model, contents, config) {
@@ -110,14 +116,43 @@ func (p *GeminiProvider) SendStream(ctx context.Context, msgs []Message, tools [
 					OutputTokens: int(result.UsageMetadata.CandidatesTokenCount),
 				}
 			}
+			if len(result.Candidates) > 0 && result.Candidates[0].FinishReason == genai.FinishReasonMaxTokens {
+				stopReason = "max_tokens"
+			}
 		}
 
+		if usage != nil {
+			usage.StopReason = stopReason
+		}
 		ch <- StreamChunk{Done: true, Usage: usage}
 	}()
 
 	return ch, nil
 }
 
+// CompleteJSON uses JSON mode with a response schema.
+func (p *GeminiProvider) CompleteJSON(ctx context.Context, prompt string, schema map[string]any) (json.RawMessage, *Usage, error) {
+	config := &genai.GenerateContentConfig{
+		ResponseMIMEType:   "application/json",
+		ResponseJsonSchema: schema,
+	}
+	if p.cfg.MaxTokens > 0 {
+		config.MaxOutputTokens = int32(p.cfg.MaxTokens)
+	}
+	resp, err := p.client.Models.GenerateContent(ctx, p.model, genai.Text(prompt), config)
+	if err != nil {
+		return nil, nil, err
+	}
+	var usage *Usage
+	if resp.UsageMetadata != nil {
+		usage = &Usage{
+			InputTokens:  int(resp.UsageMetadata.PromptTokenCount),
+			OutputTokens: int(resp.UsageMetadata.CandidatesTokenCount),
+		}
+	}
+	return json.RawMessage(resp.Text()), usage, nil
+}
+
 func convertToGeminiContents(msgs []Message) []*genai.Content {
 	var result []*genai.Content
 
@@ -148,7 +183,10 @@ func convertToGeminiContents(msgs []Message) []*genai.Content {
 		case "tool":
 			var response map[string]any
 			// Try to parse as JSON, fall back to wrapping in object
-			if err := json.Unmarshal([]byte(m.Content), &response); err != nil {
+			if m.IsError {
+				// Gemini reads failures from an "error" key
+				response = map[string]any{"error": m.Content}
+			} else if err := json.Unmarshal([]byte(m.Content), &response); err != nil {
 				response = map[string]any{"result": m.Content}
 			}
 			result = append(result, &genai.Content{
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// mockMaxContext is the context window the mock provider reports.
+const mockMaxContext = 128000
+
+// MockProvider plays back scripted replies from a fixture file, one per
+// call, so the agent loop, tools and rendering run end to end without a
+// model or API key (tests, CI, demos). Without a fixture it echoes the last
+// user message.
+type MockProvider struct {
+	fixture string
+	replies []mockReply
+
+	mu   sync.Mutex
+	next int
+}
+
+// mockFixture is the fixture file: {"responses": [...]}, played in order.
+type mockFixture struct {
+	Responses []mockReply `json:"responses"`
+}
+
+// mockReply is one scripted LLM call. Error fails the call instead; Usage
+// is estimated when absent, and stop_reason "max_tokens" in it exercises
+// truncation handling.
+type mockReply struct {
+	Text      string         `json:"text,omitempty"`
+	ToolCalls []mockToolCall `json:"tool_calls,omitempty"`
+	Usage     *Usage         `json:"usage,omitempty"`
+	Error     string         `json:"error,omitempty"`
+	DelayMs   int            `json:"delay_ms,omitempty"` // before the first chunk
+}
+
+type mockToolCall struct {
+	Name string          `json:"name"`
+	Args json.RawMessage `json:"args"`
+}
+
+func NewMockProvider(cfg Config) (*MockProvider, error) {
+	pc := cfg.ProviderCfg("mock")
+	p := &MockProvider{fixture: pc.Fixture}
+	if pc.Fixture == "" {
+		return p, nil
+	}
+	data, err := os.ReadFile(pc.Fixture)
+	if err != nil {
+		return nil, fmt.Errorf("mock fixture: %w", err)
+	}
+	var f mockFixture
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("mock fixture %s: %w", pc.Fixture, err)
+	}
+	for i, r := range f.Responses {
+		for _, tc := range r.ToolCalls {
+			if tc.Name == "" {
+				return nil, fmt.Errorf("mock fixture %s: response %d has a tool call without a name", pc.Fixture, i+1)
+			}
+		}
+	}
+	p.replies = f.Responses
+	return p, nil
+}
+
+func (p *MockProvider) Name() string { return "mock" }
+
+func (p *MockProvider) MaxContext() int { return mockMaxContext }
+
+func (p *MockProvider) SendStream(ctx context.Context, msgs []Message, tools []ToolDef, systemPrompt string) (<-chan StreamChunk, error) {
+	reply, call, err := p.take(msgs)
+	if err != nil {
+		return nil, err
+	}
+	if reply.Error != "" {
+		return nil, fmt.Errorf("mock: %s", reply.Error)
+	}
+
+	ch := make(chan StreamChunk)
+	go func() {
+		defer close(ch)
+		send := func(c StreamChunk) bool {
+			select {
+			case ch <- c:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		if reply.DelayMs > 0 {
+			select {
+			case <-time.After(time.Duration(reply.DelayMs) * time.Millisecond):
+			case <-ctx.Done():
+				return
+			}
+		}
+		// Word by word, so rendering sees a real stream
+		for _, w := range strings.SplitAfter(reply.Text, " ") {
+			if w != "" && !send(StreamChunk{Text: w}) {
+				return
+			}
+		}
+		for i, tc := range reply.ToolCalls {
+			args := string(tc.Args)
+			if args == "" || args == "null" {
+				args = "{}"
+			}
+			if !send(StreamChunk{ToolCallDelta: &ToolCallDelta{Index: i, ID: fmt.Sprintf("mock_%d_%d", call, i), Name: tc.Name, Args: args}}) {
+				return
+			}
+		}
+		var usage *Usage
+		if reply.Usage != nil {
+			u := *reply.Usage
+			if u.StopReason == "" {
+				u.StopReason = "end_turn"
+				if len(reply.ToolCalls) > 0 {
+					u.StopReason = "tool_use"
+				}
+			}
+			usage = &u
+		}
+		send(StreamChunk{Done: true, Usage: usage})
+	}()
+	return ch, nil
+}
+
+// CompleteJSON plays the next response like SendStream: its text, or its
+// first tool call's args, is the JSON. Without a fixture it answers with a
+// value of the schema's shape.
+func (p *MockProvider) CompleteJSON(ctx context.Context, prompt string, schema map[string]any) (json.RawMessage, *Usage, error) {
+	if p.fixture == "" {
+		p.take(nil)
+		data, err := json.Marshal(mockValue(schema))
+		return data, nil, err
+	}
+	reply, _, err := p.take(nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if reply.Error != "" {
+		return nil, nil, fmt.Errorf("mock: %s", reply.Error)
+	}
+	if len(reply.ToolCalls) > 0 {
+		return reply.ToolCalls[0].Args, reply.Usage, nil
+	}
+	return json.RawMessage(reply.Text), reply.Usage, nil
+}
+
+// mockValue is a placeholder value of a JSON Schema's type.
+func mockValue(schema map[string]any) any {
+	switch schema["type"] {
+	case "object":
+		obj := map[string]any{}
+		props, _ := schema["properties"].(map[string]any)
+		for name, prop := range props {
+			sub, _ := prop.(map[string]any)
+			obj[name] = mockValue(sub)
+		}
+		return obj
+	case "array":
+		return []any{}
+	case "integer", "number":
+		return 0
+	case "boolean":
+		return false
+	}
+	return "mock"
+}
+
+// take returns the next scripted reply and its number, or an echo without
+// a fixture.
+func (p *MockProvider) take(msgs []Message) (mockReply, int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	call := p.next
+	p.next++
+	if p.fixture == "" {
+		for i := len(msgs) - 1; i >= 0; i-- {
+			if msgs[i].Role == "user" {
+				return mockReply{Text: "echo: " + msgs[i].Content}, call, nil
+			}
+		}
+		return mockReply{Text: "echo"}, call, nil
+	}
+	if call >= len(p.replies) {
+		return mockReply{}, call, fmt.Errorf("mock: fixture %s has no response left (%d played)", p.fixture, len(p.replies))
+	}
+	return p.replies[call], call, nil
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ollamaDefaultCtx caps the context window when num_ctx isn't configured:
+// loading a model at its full advertised length (often 128k+) can exhaust
+// memory, and Ollama's own default (2-4k) silently truncates the prompt.
+const ollamaDefaultCtx = 32768
+
+// OllamaProvider talks to Ollama's native /api/chat, which reports the
+// model's real context length and takes num_ctx/keep_alive.
+type OllamaProvider struct {
+	client    *http.Client
+	url       string
+	model     string
+	numCtx    int
+	keepAlive any
+	cfg       Config
+
+	ctxOnce sync.Once
+	maxCtx  int
+}
+
+func NewOllamaProvider(cfg Config) (*OllamaProvider, error) {
+	pc := cfg.ProviderCfg("ollama")
+	url := strings.TrimRight(pc.URL, "/")
+	if url == "" {
+		url = "http://localhost:11434"
+	}
+	hc, err := providerHTTPClient("ollama", pc)
+	if err != nil {
+		return nil, err
+	}
+	p := &OllamaProvider{client: hc, url: url, model: pc.Model, numCtx: pc.NumCtx, cfg: cfg}
+	// keep_alive is a duration ("30m") or seconds; a bare number must go as one
+	if pc.KeepAlive != "" {
+		if n, err := strconv.Atoi(pc.KeepAlive); err == nil {
+			p.keepAlive = n
+		} else {
+			p.keepAlive = pc.KeepAlive
+		}
+	}
+	return p, nil
+}
+
+func (p *OllamaProvider) Name() string { return "ollama" }
+
+// MaxContext is the num_ctx requests are sent with: the configured value, or
+// the model's context length from /api/show capped at ollamaDefaultCtx.
+func (p *OllamaProvider) MaxContext() int {
+	p.ctxOnce.Do(func() {
+		if p.numCtx > 0 {
+			p.maxCtx = p.numCtx
+			return
+		}
+		p.maxCtx = ollamaDefaultCtx
+		if n := p.modelContextLength(); n > 0 && n < ollamaDefaultCtx {
+			p.maxCtx = n
+		}
+	})
+	return p.maxCtx
+}
+
+// modelContextLength asks /api/show for the model's trained context length
+// (model_info "<arch>.context_length"). 0 when unknown.
+func (p *OllamaProvider) modelContextLength() int {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	body, _ := json.Marshal(map[string]string{"model": p.model})
+	req, err := http.NewRequestWithContext(ctx, "POST", p.url+"/api/show", bytes.NewReader(body))
+	if err != nil {
+		return 0
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0
+	}
+	defer resp.Body.Close()
+	var show struct {
+		ModelInfo map[string]any `json:"model_info"`
+	}
+	if resp.StatusCode != http.StatusOK || json.NewDecoder(resp.Body).Decode(&show) != nil {
+		return 0
+	}
+	arch, _ := show.ModelInfo["general.architecture"].(string)
+	if n, ok := show.ModelInfo[arch+".context_length"].(float64); ok {
+		return int(n)
+	}
+	for k, v := range show.ModelInfo {
+		if n, ok := v.(float64); ok && strings.HasSuffix(k, ".context_length") {
+			return int(n)
+		}
+	}
+	return 0
+}
+
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"`
+}
+
+type ollamaToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"` // an object, not a JSON string
+	} `json:"function"`
+}
+
+type ollamaChunk struct {
+	Message    ollamaMessage `json:"message"`
+	Done       bool          `json:"done"`
+	DoneReason string        `json:"done_reason"`
+	PromptEval int           `json:"prompt_eval_count"`
+	Eval       int           `json:"eval_count"`
+	Error      string        `json:"error"`
+}
+
+// chat posts a /api/chat request with the provider's options added. A
+// non-200 response is closed and returned as an error.
+func (p *OllamaProvider) chat(ctx context.Context, reqBody map[string]any) (*http.Response, error) {
+	options := map[string]any{"num_ctx": p.MaxContext()}
+	if p.cfg.MaxTokens > 0 {
+		options["num_predict"] = p.cfg.MaxTokens
+	}
+	reqBody["model"] = p.model
+	reqBody["options"] = options
+	if p.keepAlive != nil {
+		reqBody["keep_alive"] = p.keepAlive
+	}
+	body, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", p.url+"/api/chat", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		var e struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(data, &e) == nil && e.Error != "" {
+			return nil, fmt.Errorf("ollama: %s (status %d)", e.Error, resp.StatusCode)
+		}
+		return nil, fmt.Errorf("ollama: status %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	return resp, nil
+}
+
+// CompleteJSON uses structured outputs: the schema goes in "format".
+func (p *OllamaProvider) CompleteJSON(ctx context.Context, prompt string, schema map[string]any) (json.RawMessage, *Usage, error) {
+	resp, err := p.chat(ctx, map[string]any{
+		"messages": []ollamaMessage{{Role: "user", Content: prompt}},
+		"stream":   false,
+		"format":   schema,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	var reply ollamaChunk
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return nil, nil, fmt.Errorf("ollama: bad response: %w", err)
+	}
+	if reply.Error != "" {
+		return nil, nil, fmt.Errorf("ollama: %s", reply.Error)
+	}
+	usage := &Usage{InputTokens: reply.PromptEval, OutputTokens: reply.Eval, StopReason: normalizeStopReason(reply.DoneReason)}
+	return json.RawMessage(reply.Message.Content), usage, nil
+}
+
+func (p *OllamaProvider) SendStream(ctx context.Context, msgs []Message, tools []ToolDef, systemPrompt string) (<-chan StreamChunk, error) {
+	reqBody := map[string]any{
+		"messages": convertToOllamaMessages(msgs, systemPrompt),
+		"stream":   true,
+	}
+	if len(tools) > 0 {
+		reqBody["tools"] = convertToOllamaTools(tools)
+	}
+	resp, err := p.chat(ctx, reqBody)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan StreamChunk, 64)
+	go func() {
+		defer close(ch)
+		defer resp.Body.Close()
+
+		calls := 0 // Ollama sends whole tool calls without IDs or indexes
+		sawTools := false
+		sc := bufio.NewScanner(resp.Body)
+		sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		for sc.Scan() {
+			if ctx.Err() != nil {
+				return
+			}
+			line := bytes.TrimSpace(sc.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			var chunk ollamaChunk
+			if err := json.Unmarshal(line, &chunk); err != nil {
+				ch <- StreamChunk{Err: fmt.Errorf("ollama: bad stream line: %w", err)}
+				return
+			}
+			if chunk.Error != "" {
+				ch <- StreamChunk{Err: fmt.Errorf("ollama: %s", chunk.Error)}
+				return
+			}
+			if chunk.Message.Content != "" {
+				ch <- StreamChunk{Text: chunk.Message.Content}
+			}
+			for _, tc := range chunk.Message.ToolCalls {
+				args := tc.Function.Arguments
+				if len(args) == 0 || string(args) == "null" {
+					args = json.RawMessage("{}")
+				}
+				ch <- StreamChunk{ToolCallDelta: &ToolCallDelta{
+					Index: calls,
+					ID:    fmt.Sprintf("call_%d", calls),
+					Name:  tc.Function.Name,
+					Args:  string(args),
+				}}
+				calls++
+				sawTools = true
+			}
+			if chunk.Done {
+				stop := normalizeStopReason(chunk.DoneReason)
+				if sawTools && stop == "end_turn" {
+					stop = "tool_use" // Ollama reports "stop" for tool calls too
+				}
+				ch <- StreamChunk{Done: true, Usage: &Usage{
+					InputTokens:  chunk.PromptEval,
+					OutputTokens: chunk.Eval,
+					StopReason:   stop,
+				}}
+				return
+			}
+		}
+		if err := sc.Err(); err != nil && ctx.Err() == nil {
+			ch <- StreamChunk{Err: err}
+		}
+	}()
+	return ch, nil
+}
+
+func convertToOllamaMessages(msgs []Message, systemPrompt string) []ollamaMessage {
+	result := []ollamaMessage{{Role: "system", Content: systemPrompt}}
+	// Tool results are matched by name in Ollama's format, not by call ID
+	names := make(map[string]string)
+	for _, m := range msgs {
+		switch m.Role {
+		case "user":
+			result = append(result, ollamaMessage{Role: "user", Content: m.Content})
+		case "assistant":
+			om := ollamaMessage{Role: "assistant", Content: m.Content}
+			for _, tc := range m.ToolCalls {
+				names[tc.ID] = tc.Name
+				var call ollamaToolCall
+				call.Function.Name = tc.Name
+				call.Function.Arguments = tc.Args
+				if !json.Valid(tc.Args) {
+					call.Function.Arguments = json.RawMessage("{}")
+				}
+				om.ToolCalls = append(om.ToolCalls, call)
+			}
+			result = append(result, om)
+		case "tool":
+			result = append(result, ollamaMessage{Role: "tool", Content: openAIToolContent(m), ToolName: names[m.ToolCallID]})
+		}
+	}
+	return result
+}
+
+func convertToOllamaTools(tools []ToolDef) []map[string]any {
+	var result []map[string]any
+	for _, t := range tools {
+		result = append(result, map[string]any{
+			"type": "function",
+			"function": map[string]any{
+				"name":        t.Name,
+				"description": t.Description,
+				"parameters":  t.Parameters,
+			},
+		})
+	}
+	return result
+}
+
+func init() {
+	var _ Provider = (*OllamaProvider)(nil)
+}
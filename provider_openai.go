@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 
 	"github.com/openai/openai-go"
@@ -18,15 +19,24 @@ type OpenAIProvider struct {
 }
 
 func NewOpenAIProvider(backend string, cfg Config) (*OpenAIProvider, error) {
-	pc := cfg.ProviderCfg(backend)
+	pc := cfg.ProviderKeyCfg(backend)
+	hc, err := providerHTTPClient(backend, pc)
+	if err != nil {
+		return nil, err
+	}
 	var opts []option.RequestOption
 
 	switch backend {
 	case "openai":
-		if pc.APIKey == "" {
-			return nil, fmt.Errorf("openai api_key not set (set OPENAI_API_KEY or providers.openai.api_key in config)")
+		apiKey := pc.APIKey
+		if apiKey == "" {
+			// Signed in with a ChatGPT plan (--auth): the transport swaps in the token
+			if hc = oauthHTTPClient("openai", pc, hc); hc == nil {
+				return nil, fmt.Errorf("openai api_key not set (set OPENAI_API_KEY or providers.openai.api_key in config, or sign in with --auth)")
+			}
+			apiKey = "oauth"
 		}
-		opts = append(opts, option.WithAPIKey(pc.APIKey))
+		opts = append(opts, option.WithAPIKey(apiKey))
 		if pc.URL != "" {
 			opts = append(opts, option.WithBaseURL(pc.URL))
 		}
@@ -40,17 +50,11 @@ func NewOpenAIProvider(backend string, cfg Config) (*OpenAIProvider, error) {
 			url = "https://openrouter.ai/api/v1"
 		}
 		opts = append(opts, option.WithBaseURL(url))
-	case "ollama":
-		url := pc.URL
-		if url == "" {
-			url = "http://localhost:11434"
-		}
-		opts = append(opts, option.WithBaseURL(url+"/v1/"))
-		opts = append(opts, option.WithAPIKey("ollama"))
 	default:
 		return nil, fmt.Errorf("unsupported openai-compatible backend: %s", backend)
 	}
 
+	opts = append(opts, option.WithHTTPClient(hc))
 	client := openai.NewClient(opts...)
 	return &OpenAIProvider{client: &client, backend: backend, model: pc.Model, cfg: cfg}, nil
 }
@@ -61,8 +65,6 @@ func (p *OpenAIProvider) MaxContext() int {
 	switch p.backend {
 	case "openrouter":
 		return 200000
-	case "ollama":
-		return 32000
 	default:
 		return 128000
 	}
@@ -143,6 +145,9 @@ func (p *OpenAIProvider) SendStream(ctx context.Context, msgs []Message, tools [
 				InputTokens:  int(acc.Usage.PromptTokens),
 				OutputTokens: int(acc.Usage.CompletionTokens),
 			}
+			if len(acc.Choices) > 0 {
+				usage.StopReason = normalizeStopReason(acc.Choices[0].FinishReason)
+			}
 		}
 
 		ch <- StreamChunk{Done: true, Usage: usage}
@@ -151,6 +156,36 @@ func (p *OpenAIProvider) SendStream(ctx context.Context, msgs []Message, tools [
 	return ch, nil
 }
 
+// CompleteJSON uses structured outputs (response_format json_schema), which
+// OpenRouter passes on to models that support it.
+func (p *OpenAIProvider) CompleteJSON(ctx context.Context, prompt string, schema map[string]any) (json.RawMessage, *Usage, error) {
+	params := openai.ChatCompletionNewParams{
+		Model:    p.model,
+		Messages: []openai.ChatCompletionMessageParamUnion{openai.UserMessage(prompt)},
+		ResponseFormat: openai.ChatCompletionNewParamsResponseFormatUnion{
+			OfJSONSchema: &shared.ResponseFormatJSONSchemaParam{
+				JSONSchema: shared.ResponseFormatJSONSchemaJSONSchemaParam{Name: "response", Schema: schema},
+			},
+		},
+	}
+	if p.cfg.MaxTokens > 0 {
+		params.MaxTokens = param.NewOpt(int64(p.cfg.MaxTokens))
+	}
+	resp, err := p.client.Chat.Completions.New(ctx, params)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(resp.Choices) == 0 {
+		return nil, nil, fmt.Errorf("%s: empty reply", p.backend)
+	}
+	usage := &Usage{
+		InputTokens:  int(resp.Usage.PromptTokens),
+		OutputTokens: int(resp.Usage.CompletionTokens),
+		StopReason:   normalizeStopReason(resp.Choices[0].FinishReason),
+	}
+	return json.RawMessage(resp.Choices[0].Message.Content), usage, nil
+}
+
 func convertToOpenAIMessages(msgs []Message, systemPrompt string) []openai.ChatCompletionMessageParamUnion {
 	var result []openai.ChatCompletionMessageParamUnion
 
@@ -199,7 +234,7 @@ func convertToOpenAIMessages(msgs []Message, systemPrompt string) []openai.ChatC
 				OfTool: &openai.ChatCompletionToolMessageParam{
 					ToolCallID: m.ToolCallID,
 					Content: openai.ChatCompletionToolMessageParamContentUnion{
-						OfString: param.NewOpt(m.Content),
+						OfString: param.NewOpt(openAIToolContent(m)),
 					},
 				},
 			})
@@ -227,3 +262,26 @@ func init() {
 	// Ensure interfaces are satisfied
 	var _ Provider = (*OpenAIProvider)(nil)
 }
+
+// normalizeStopReason maps OpenAI finish reasons onto Anthropic's names.
+func normalizeStopReason(reason string) string {
+	switch reason {
+	case "length":
+		return "max_tokens"
+	case "stop":
+		return "end_turn"
+	case "tool_calls", "function_call":
+		return "tool_use"
+	}
+	return reason
+}
+
+// openAIToolContent is a tool result's text. Chat Completions has no error
+// flag, so failures are labelled in the content instead.
+func openAIToolContent(m Message) string {
+	if !m.IsError || toolResult(m.Content, nil).IsError {
+		// Already reads as a failure ("error: ...", "blocked: ...", exit status)
+		return m.Content
+	}
+	return "error: " + m.Content
+}
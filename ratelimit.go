@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// rateMaxWait is the longest the loop waits for a limit to reset before it
+// pauses instead (/continue resumes).
+const rateMaxWait = 2 * time.Minute
+
+// rateRetries is how many times one LLM call is retried after a 429.
+const rateRetries = 3
+
+// rateState is the last rate-limit picture a provider sent back. -1 means the
+// provider didn't say.
+type rateState struct {
+	requests      int
+	requestsReset time.Time
+	tokens        int
+	tokensReset   time.Time
+	retryAt       time.Time // from a 429's retry-after
+	limitedAt     time.Time // when the last 429 arrived
+}
+
+var (
+	rateMu     sync.Mutex
+	rateLimits = map[string]*rateState{}
+)
+
+// tracksRateLimits reports whether a provider sends headers we understand.
+func tracksRateLimits(provider string) bool {
+	return provider == "anthropic" || provider == "openai"
+}
+
+// rateTransport records rate-limit headers from every provider response.
+type rateTransport struct {
+	provider string
+	base     http.RoundTripper
+}
+
+func (t rateTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err == nil {
+		recordRateHeaders(t.provider, resp.StatusCode, resp.Header, time.Now())
+	}
+	return resp, err
+}
+
+func recordRateHeaders(provider string, status int, h http.Header, now time.Time) {
+	st := rateState{requests: -1, tokens: -1}
+	switch provider {
+	case "anthropic":
+		st.requests = headerInt(h, "anthropic-ratelimit-requests-remaining")
+		st.requestsReset = headerTime(h, "anthropic-ratelimit-requests-reset")
+		// Input tokens are what a long transcript runs out of first
+		st.tokens = headerInt(h, "anthropic-ratelimit-input-tokens-remaining")
+		st.tokensReset = headerTime(h, "anthropic-ratelimit-input-tokens-reset")
+		if st.tokens < 0 {
+			st.tokens = headerInt(h, "anthropic-ratelimit-tokens-remaining")
+			st.tokensReset = headerTime(h, "anthropic-ratelimit-tokens-reset")
+		}
+	case "openai":
+		// Resets are durations: "1s", "6m0s", "20ms"
+		st.requests = headerInt(h, "x-ratelimit-remaining-requests")
+		if d, err := time.ParseDuration(h.Get("x-ratelimit-reset-requests")); err == nil {
+			st.requestsReset = now.Add(d)
+		}
+		st.tokens = headerInt(h, "x-ratelimit-remaining-tokens")
+		if d, err := time.ParseDuration(h.Get("x-ratelimit-reset-tokens")); err == nil {
+			st.tokensReset = now.Add(d)
+		}
+	}
+	if status == http.StatusTooManyRequests {
+		st.limitedAt = now
+		st.retryAt = now.Add(10 * time.Second) // no retry-after: a short backoff
+		if secs, err := strconv.Atoi(h.Get("retry-after")); err == nil {
+			st.retryAt = now.Add(time.Duration(secs) * time.Second)
+		}
+	}
+	if st.requests < 0 && st.tokens < 0 && st.limitedAt.IsZero() {
+		return // nothing rate-related in this response
+	}
+	rateMu.Lock()
+	rateLimits[provider] = &st
+	rateMu.Unlock()
+}
+
+func headerInt(h http.Header, key string) int {
+	n, err := strconv.Atoi(h.Get(key))
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+func headerTime(h http.Header, key string) time.Time {
+	t, _ := time.Parse(time.RFC3339, h.Get(key))
+	return t
+}
+
+// rateDelay says how long to hold off before a call needing about `need`
+// input tokens, and why. Zero means go ahead.
+func rateDelay(provider string, need int, now time.Time) (time.Duration, string) {
+	rateMu.Lock()
+	st := rateLimits[provider]
+	rateMu.Unlock()
+	if st == nil {
+		return 0, ""
+	}
+	switch {
+	case st.retryAt.After(now):
+		return st.retryAt.Sub(now), "rate limited"
+	case st.requests == 0 && st.requestsReset.After(now):
+		return st.requestsReset.Sub(now), "request limit reached"
+	case st.tokens >= 0 && st.tokens < need && st.tokensReset.After(now):
+		return st.tokensReset.Sub(now), fmt.Sprintf("token limit nearly used (%d left, next call ~%d)", st.tokens, need)
+	}
+	return 0, ""
+}
+
+// rateLimitedSince reports whether the provider answered 429 after t.
+func rateLimitedSince(provider string, t time.Time) bool {
+	rateMu.Lock()
+	defer rateMu.Unlock()
+	st := rateLimits[provider]
+	return st != nil && !st.limitedAt.Before(t)
+}
+
+// paceRateLimit waits out a known rate limit before the next LLM call, with
+// a countdown. Past rateMaxWait the loop pauses instead. Returns false when
+// the turn should stop (paused or interrupted).
+func (a *Agent) paceRateLimit(ctx context.Context, need int) bool {
+	provider := a.llm.Name()
+	wait, reason := rateDelay(provider, need, time.Now())
+	if wait <= 0 {
+		return true
+	}
+	if wait > rateMaxWait {
+		a.paused = true
+		a.session.Save()
+		msg := fmt.Sprintf("%s %s; resets at %s", provider, reason, time.Now().Add(wait).Format("15:04:05"))
+		if a.sink != nil {
+			a.sink(AgentEvent{Type: "paused", Text: msg})
+		} else {
+			fmt.Printf("\033[33m⏸ %s — /continue to resume\033[0m\n", msg)
+		}
+		return false
+	}
+
+	if a.sink != nil {
+		a.sink(AgentEvent{Type: "warning", Text: fmt.Sprintf("%s %s; waiting %s", provider, reason, wait.Round(time.Second))})
+	}
+	deadline := time.Now().Add(wait)
+	tick := time.NewTicker(time.Second)
+	defer tick.Stop()
+	for {
+		left := time.Until(deadline)
+		if left <= 0 {
+			break
+		}
+		if a.sink == nil {
+			fmt.Printf("\r\033[33m⏳ %s %s — waiting %ds \033[0m\033[K", provider, reason, int(left.Seconds()+0.5))
+		}
+		select {
+		case <-ctx.Done():
+			if a.sink == nil {
+				fmt.Print("\r\033[K")
+			}
+			return false
+		case <-tick.C:
+		}
+	}
+	if a.sink == nil {
+		fmt.Print("\r\033[K")
+	}
+	return true
+}
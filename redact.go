@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// redactRule masks matches of re, or only its first capture group when it
+// has one (so "API_KEY=" stays readable and just the value is hidden).
+type redactRule struct {
+	name string
+	re   *regexp.Regexp
+}
+
+// secretRules are the built-in patterns. The generic assignment rule only
+// matches UPPER_CASE names, as in .env files and shell exports, so ordinary
+// code like `password = getPassword()` reads back unchanged.
+var secretRules = []redactRule{
+	{"private_key", regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`)},
+	{"anthropic_key", regexp.MustCompile(`\bsk-ant-[A-Za-z0-9_-]{20,}`)},
+	{"openai_key", regexp.MustCompile(`\bsk-(?:proj-|svcacct-)?[A-Za-z0-9_-]{20,}`)},
+	{"aws_access_key", regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"aws_secret_key", regexp.MustCompile(`(?i)aws_secret_access_key["']?\s*[=:]\s*["']?([A-Za-z0-9/+=]{40})`)},
+	{"github_token", regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})`)},
+	{"google_api_key", regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`)},
+	{"slack_token", regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`)},
+	{"bearer_token", regexp.MustCompile(`(?i)\bbearer\s+([A-Za-z0-9._~+/-]{16,}=*)`)},
+	{"secret", regexp.MustCompile(`\b[A-Z][A-Z0-9_]*(?:API_KEY|APIKEY|SECRET|TOKEN|PASSWORD|PASSWD)[A-Z0-9_]*["']?\s*[=:]\s*["']?([^\s"'$\[]{8,})`)},
+}
+
+// Redactor masks secrets in text before it reaches the model or the session
+// file. A nil Redactor leaves text unchanged.
+type Redactor struct {
+	rules []redactRule
+}
+
+// NewRedactor builds the redactor for cfg, or nil when redaction is off.
+// Invalid custom patterns are reported and skipped.
+func NewRedactor(cfg RedactConfig) *Redactor {
+	if !cfg.Enabled {
+		return nil
+	}
+	r := &Redactor{rules: secretRules}
+	for _, pat := range cfg.Patterns {
+		re, err := regexp.Compile(pat)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: redact pattern %q: %v\n", pat, err)
+			continue
+		}
+		r.rules = append(r.rules, redactRule{"custom", re})
+	}
+	return r
+}
+
+// Redact replaces each secret with [REDACTED:<rule>].
+func (r *Redactor) Redact(s string) string {
+	if r == nil || s == "" {
+		return s
+	}
+	for _, rule := range r.rules {
+		matches := rule.re.FindAllStringSubmatchIndex(s, -1)
+		if matches == nil {
+			continue
+		}
+		var sb strings.Builder
+		last := 0
+		for _, m := range matches {
+			start, end := m[0], m[1]
+			if len(m) >= 4 && m[2] >= 0 {
+				start, end = m[2], m[3]
+			}
+			sb.WriteString(s[last:start])
+			sb.WriteString("[REDACTED:" + rule.name + "]")
+			last = end
+		}
+		sb.WriteString(s[last:])
+		s = sb.String()
+	}
+	return s
+}
+
+// wantsUnredacted reports whether a tool call asked for its raw output with
+// "unredacted": true, the per-call escape hatch. The user still has to agree.
+func wantsUnredacted(args json.RawMessage) bool {
+	var params struct {
+		Unredacted bool `json:"unredacted"`
+	}
+	json.Unmarshal(args, &params)
+	return params.Unredacted
+}
+
+// redactResult masks a tool result unless the call used the escape hatch
+// and the user approved it.
+func (a *Agent) redactResult(tc ToolCall, result string) string {
+	if a.redactor == nil {
+		return result
+	}
+	masked := a.redactor.Redact(result)
+	if masked == result || !wantsUnredacted(tc.Args) {
+		return masked
+	}
+	if a.confirm(fmt.Sprintf("%s output contains secrets. Send it to the model unredacted?", tc.Name)) {
+		return result
+	}
+	return masked + "\n[unredacted output declined; secrets stay masked]"
+}
+
+// addUserMessage appends user input to the transcript, secrets masked, with
+// any !command output kept for it.
+func (a *Agent) addUserMessage(input string) {
+	a.session.Append(Message{Role: "user", Content: a.redactor.Redact(a.withShellOutput(input))})
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// resultVectors caches tool result embeddings by embedder and content hash:
+// every call of a turn scores the same history again.
+var resultVectors = map[string][]float32{}
+
+// relevantResults returns msgs with past tool results cut to a stub, except
+// the memory.relevant_results ones closest to the latest user message. The
+// current turn's results and short ones are always kept whole, tool calls
+// keep their results (as stubs), and msgs itself isn't modified. If
+// embedding fails entirely, everything is kept.
+func relevantResults(cfg Config, msgs []Message) []Message {
+	n := cfg.Memory.RelevantResults
+	if n <= 0 {
+		return msgs
+	}
+	turn := -1 // the latest user message; results after it are this turn's
+	for i := len(msgs) - 1; i >= 0; i-- {
+		if msgs[i].Role == "user" {
+			turn = i
+			break
+		}
+	}
+	if turn < 0 {
+		return msgs
+	}
+
+	calls := map[string]ToolCall{}
+	var idx []int
+	var texts []string
+	for i, m := range msgs[:turn] {
+		for _, tc := range m.ToolCalls {
+			calls[tc.ID] = tc
+		}
+		if m.Role == "tool" && len(m.Content) > prunedHead+200 {
+			tc := calls[m.ToolCallID]
+			text := tc.Name + " " + string(tc.Args) + "\n" + m.Content
+			if len(text) > 2000 {
+				text = strings.ToValidUTF8(text[:2000], "")
+			}
+			idx = append(idx, i)
+			texts = append(texts, text)
+		}
+	}
+	if len(idx) <= n {
+		return msgs
+	}
+
+	query := msgs[turn].Content
+	scores, err := scoreResults(cfg, texts, query)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "relevant_results: %v (using local embeddings)\n", err)
+		cfg.Memory.Embeddings = "local"
+		if scores, err = scoreResults(cfg, texts, query); err != nil {
+			return msgs
+		}
+	}
+	order := make([]int, len(idx))
+	for i := range order {
+		order[i] = i
+	}
+	// Ties go to the newer result.
+	sort.SliceStable(order, func(a, b int) bool {
+		if scores[order[a]] != scores[order[b]] {
+			return scores[order[a]] > scores[order[b]]
+		}
+		return order[a] > order[b]
+	})
+
+	out := append([]Message(nil), msgs...)
+	for _, j := range order[n:] {
+		out[idx[j]].Content = omitResult(out[idx[j]].Content, n)
+	}
+	return out
+}
+
+// omitResult is what's left of a result that didn't make the cut: its first
+// line, so the model knows what it was.
+func omitResult(s string, n int) string {
+	first, _, _ := strings.Cut(s, "\n")
+	return fmt.Sprintf("%s\n[... %d characters omitted: not among the %d earlier tool results most relevant to the current request; run the tool again if you need it]", truncate(first, 120), len(s), n)
+}
+
+// scoreResults returns the cosine similarity of each text to query.
+func scoreResults(cfg Config, texts []string, query string) ([]float64, error) {
+	emb, err := memoryEmbedder(cfg)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	keys := make([]string, len(texts))
+	var missing, missingKeys []string
+	for i, text := range texts {
+		keys[i] = emb.ID() + "/" + memoryKey(text)
+		if _, ok := resultVectors[keys[i]]; !ok {
+			missing = append(missing, text)
+			missingKeys = append(missingKeys, keys[i])
+		}
+	}
+	if len(missing) > 0 {
+		vecs, err := emb.Embed(ctx, missing)
+		if err != nil {
+			return nil, fmt.Errorf("embedding tool results: %w", err)
+		}
+		for i, v := range vecs {
+			resultVectors[missingKeys[i]] = v
+		}
+	}
+
+	qk := memoryKey(query)
+	qv, ok := queryVectors[qk]
+	if !ok {
+		vecs, err := emb.Embed(ctx, []string{query})
+		if err != nil || len(vecs) == 0 {
+			return nil, fmt.Errorf("embedding query: %v", err)
+		}
+		qv = vecs[0]
+		queryVectors[qk] = qv
+	}
+
+	scores := make([]float64, len(texts))
+	for i, k := range keys {
+		scores[i] = cosine(qv, resultVectors[k])
+	}
+	return scores, nil
+}
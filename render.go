@@ -1,14 +1,30 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/formatters"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
 	"github.com/charmbracelet/glamour"
+	"golang.org/x/term"
 )
 
 var mdRenderer *glamour.TermRenderer
 
+// plainOutput keeps output to the bare sequential stream: no spinner, status
+// line, or tool previews. Set by --plain, or when stdout isn't a terminal.
+var plainOutput bool
+
 func initRenderer() {
 	r, err := glamour.NewTermRenderer(
 		glamour.WithAutoStyle(),
@@ -35,16 +51,326 @@ func renderMarkdown(text string) {
 	fmt.Print(out)
 }
 
+// mdStream renders streamed assistant text as markdown, one block at a time.
+// Text is echoed raw as it arrives; once a block is complete (blank line or
+// closing code fence) the raw echo is erased and replaced with glamour output.
+// Blocks taller than the screen stay raw — the cursor can't reach them.
+type mdStream struct {
+	block   strings.Builder // complete lines of the current block
+	partial string          // current line, no newline yet
+	inFence bool
+	rows    int // terminal rows used by the raw echo since the last render
+	col     int
+	width   int
+	height  int
+}
+
+func newMDStream() *mdStream {
+	w, h, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil || w <= 0 {
+		w, h = 80, 24
+	}
+	return &mdStream{width: w, height: h}
+}
+
+// Write echoes text and renders any blocks it completes.
+func (m *mdStream) Write(text string) {
+	m.echo(text)
+	m.partial += text
+	for {
+		i := strings.IndexByte(m.partial, '\n')
+		if i < 0 {
+			return
+		}
+		line := m.partial[:i]
+		m.partial = m.partial[i+1:]
+		m.addLine(line)
+	}
+}
+
+func (m *mdStream) addLine(line string) {
+	trimmed := strings.TrimSpace(line)
+	switch {
+	case strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~"):
+		m.block.WriteString(line + "\n")
+		m.inFence = !m.inFence
+		if !m.inFence {
+			m.flush()
+		}
+	case !m.inFence && trimmed == "":
+		if m.block.Len() > 0 {
+			m.flush()
+		}
+	default:
+		m.block.WriteString(line + "\n")
+	}
+}
+
+// Finish renders whatever is left once the stream ends.
+func (m *mdStream) Finish() {
+	if m.partial != "" {
+		m.block.WriteString(m.partial)
+		m.partial = ""
+	}
+	if strings.TrimSpace(m.block.String()) != "" {
+		m.flush()
+	}
+}
+
+func (m *mdStream) flush() {
+	text := m.block.String()
+	m.block.Reset()
+
+	if m.rows >= m.height-1 {
+		// Scrolled off screen; leave the raw text in place.
+		m.resetEcho()
+		return
+	}
+	out, err := mdRenderer.Render(text)
+	if err != nil {
+		m.resetEcho()
+		return
+	}
+
+	if m.rows > 0 {
+		fmt.Printf("\033[%dA", m.rows)
+	}
+	fmt.Print("\r\033[J")
+	// Glamour pads lines to the wrap width; trim so narrow terminals don't wrap
+	lines := strings.Split(strings.TrimLeft(out, "\n"), "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimRight(l, " ")
+	}
+	fmt.Print(strings.Join(lines, "\n"))
+	m.resetEcho()
+	// The start of the next line was echoed before this block ended; redraw it.
+	m.echo(m.partial)
+}
+
+func (m *mdStream) resetEcho() {
+	m.rows, m.col = 0, 0
+}
+
+// echo prints raw text and tracks how many rows it occupies.
+func (m *mdStream) echo(text string) {
+	fmt.Print(text)
+	for _, r := range text {
+		if r == '\n' {
+			m.rows++
+			m.col = 0
+			continue
+		}
+		m.col++
+		if m.col >= m.width {
+			m.rows++
+			m.col = 0
+		}
+	}
+}
+
 func renderContextLine(usage *Usage, maxContext int) {
 	if usage == nil {
 		return
 	}
-	total := usage.InputTokens + usage.OutputTokens
+	total := usage.PromptTokens() + usage.OutputTokens
 	totalK := float64(total) / 1000
 	maxK := float64(maxContext) / 1000
 
+	approx := ""
+	if usage.Estimated {
+		approx = "~"
+	}
+
 	// Dim color
-	fmt.Printf("\033[2m── ctx: %.1fk/%.0fk tokens ──\033[0m\n", totalK, maxK)
+	fmt.Printf("\033[2m── ctx: %s%.1fk/%.0fk tokens%s ──\033[0m\n", approx, totalK, maxK, cacheNote(usage))
+}
+
+// cacheNote summarizes prompt caching for the context line ("" when unused).
+func cacheNote(usage *Usage) string {
+	if usage.CacheReadTokens == 0 && usage.CacheCreationTokens == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" · cache %.1fk read, %.1fk written",
+		float64(usage.CacheReadTokens)/1000, float64(usage.CacheCreationTokens)/1000)
+}
+
+// renderTruncated warns that a reply hit the max_tokens output limit.
+func renderTruncated(maxTokens int) {
+	fmt.Printf("\n\033[33m⚠ reply cut off at max_tokens (%d) — raise \"max_tokens\" in config.json\033[0m\n", maxTokens)
+}
+
+// renderStatusLine is the decorated context line: mode, model, context fill,
+// and tokens spent this session.
+func renderStatusLine(mode Mode, model string, usage *Usage, maxContext int, session Usage) {
+	if usage == nil {
+		return
+	}
+	approx := ""
+	if usage.Estimated {
+		approx = "~"
+	}
+	ctx := usage.PromptTokens() + usage.OutputTokens
+	pct := 0
+	if maxContext > 0 {
+		pct = ctx * 100 / maxContext
+	}
+	spent := session.PromptTokens() + session.OutputTokens
+	fmt.Printf("\033[2m── %s · %s · ctx %s%.1fk/%.0fk (%d%%)%s · session %.1fk tokens ──\033[0m\n",
+		mode, model, approx, float64(ctx)/1000, float64(maxContext)/1000, pct, cacheNote(usage), float64(spent)/1000)
+}
+
+// Diff line backgrounds (256-color): dark green for added, dark red for removed.
+const (
+	diffAddBG = "\033[48;5;22m"
+	diffDelBG = "\033[48;5;52m"
+)
+
+// maxDiffLines caps how much of a diff is printed inline.
+const maxDiffLines = 200
+
+// renderDiff prints a colorized unified diff of a file change.
+func renderDiff(path, before, after string) {
+	diff := unifiedDiff(path, path, splitLines(before), splitLines(after), 3)
+	if diff == "" {
+		return
+	}
+	fmt.Print(colorizeDiff(diff, path))
+}
+
+// colorizeDiff colors a unified diff: headers bold, hunks cyan, added and
+// removed lines on green/red backgrounds, with code syntax-highlighted by
+// chroma (lexer picked from path).
+func colorizeDiff(diff, path string) string {
+	lexer := lexers.Match(filepath.Base(path))
+	if lexer == nil {
+		lexer = lexers.Fallback
+	}
+	lexer = chroma.Coalesce(lexer)
+	style := styles.Get("monokai")
+	formatter := formatters.Get("terminal256")
+
+	highlight := func(marker, code, bg string) string {
+		prefix := bg + marker
+		it, err := lexer.Tokenise(nil, code)
+		if err != nil {
+			return prefix + code
+		}
+		var buf strings.Builder
+		if err := formatter.Format(&buf, style, it); err != nil {
+			return prefix + code
+		}
+		out := strings.ReplaceAll(buf.String(), "\n", "")
+		// Chroma resets after every token; put the line background back.
+		return prefix + strings.ReplaceAll(out, "\033[0m", "\033[0m"+bg)
+	}
+
+	lines := strings.Split(strings.TrimRight(diff, "\n"), "\n")
+	var sb strings.Builder
+	for i, line := range lines {
+		if i == maxDiffLines {
+			fmt.Fprintf(&sb, "\033[2m  ... %d more diff lines\033[0m\n", len(lines)-i)
+			break
+		}
+		switch {
+		case strings.HasPrefix(line, "+++") || strings.HasPrefix(line, "---"):
+			fmt.Fprintf(&sb, "\033[1m%s\033[0m\n", line)
+		case strings.HasPrefix(line, "@@"):
+			fmt.Fprintf(&sb, "\033[36m%s\033[0m\n", line)
+		case strings.HasPrefix(line, "+"):
+			sb.WriteString(highlight("\033[32m+\033[39m", line[1:], diffAddBG) + "\033[K\033[0m\n")
+		case strings.HasPrefix(line, "-"):
+			sb.WriteString(highlight("\033[31m-\033[39m", line[1:], diffDelBG) + "\033[K\033[0m\n")
+		case strings.HasPrefix(line, " "):
+			sb.WriteString(highlight(" ", line[1:], "") + "\033[0m\n")
+		default:
+			sb.WriteString(line + "\n")
+		}
+	}
+	return sb.String()
+}
+
+// renderToolResult prints a collapsed one-line preview of a tool result and
+// how long the call took.
+func renderToolResult(result string, took time.Duration) {
+	result = strings.TrimRight(result, "\n")
+	if result == "" {
+		fmt.Printf("\033[2m  ↳ (%s)\033[0m\n", elapsed(took))
+		return
+	}
+	lines := strings.Count(result, "\n") + 1
+	preview := truncate(result, 80)
+	if lines > 1 {
+		fmt.Printf("\033[2m  ↳ %s  (+%d lines) (%s)\033[0m\n", preview, lines-1, elapsed(took))
+	} else {
+		fmt.Printf("\033[2m  ↳ %s  (%s)\033[0m\n", preview, elapsed(took))
+	}
+}
+
+// turnTimes adds up where a turn's wall time went.
+type turnTimes struct {
+	total, llm, tools time.Duration
+	calls, toolCalls  int
+}
+
+// renderTurnTimes prints the turn's duration split into model and tool time.
+func renderTurnTimes(t turnTimes) {
+	calls := func(n int) string {
+		if n == 1 {
+			return "1 call"
+		}
+		return fmt.Sprintf("%d calls", n)
+	}
+	line := fmt.Sprintf("⏱ %s · model %s (%s)", elapsed(t.total), elapsed(t.llm), calls(t.calls))
+	if t.toolCalls > 0 {
+		line += fmt.Sprintf(" · tools %s (%s)", elapsed(t.tools), calls(t.toolCalls))
+	}
+	fmt.Printf("\033[2m%s\033[0m\n", line)
+}
+
+// elapsed formats a duration for display: 0.4s, 12.3s, 2m5s.
+func elapsed(d time.Duration) string {
+	if d < time.Minute {
+		return fmt.Sprintf("%.1fs", d.Seconds())
+	}
+	return d.Round(time.Second).String()
+}
+
+// spinner animates a label on the current line until stopped.
+type spinner struct {
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+func startSpinner(label string) *spinner {
+	s := &spinner{stop: make(chan struct{}), done: make(chan struct{})}
+	go func() {
+		defer close(s.done)
+		frames := []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		for i := 0; ; i++ {
+			fmt.Printf("\r\033[2m%s %s\033[0m", frames[i%len(frames)], label)
+			select {
+			case <-s.stop:
+				fmt.Print("\r\033[K")
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return s
+}
+
+// Stop clears the spinner line. Safe to call more than once, and on nil.
+func (s *spinner) Stop() {
+	if s == nil {
+		return
+	}
+	s.once.Do(func() {
+		close(s.stop)
+		<-s.done
+	})
 }
 
 func renderToolCall(name string, args string, blocked bool) {
@@ -53,4 +379,191 @@ func renderToolCall(name string, args string, blocked bool) {
 	} else {
 		fmt.Printf("\033[36m▶ %s\033[0m\n", name)
 	}
+	if plainOutput {
+		return
+	}
+	if pretty := formatToolArgs(args); pretty != "" {
+		fmt.Printf("\033[2m%s\033[0m\n", pretty)
+	}
+}
+
+// formatToolArgs pretty-prints tool call arguments, indented under the call.
+// Long or multi-line strings (file contents, patches) are cut to their first
+// line with a line count.
+func formatToolArgs(args string) string {
+	var m map[string]any
+	if err := json.Unmarshal([]byte(args), &m); err != nil || len(m) == 0 {
+		return ""
+	}
+	for k, v := range m {
+		if str, ok := v.(string); ok && (len(str) > 200 || strings.Count(str, "\n") > 2) {
+			m[k] = fmt.Sprintf("%s  (%d lines, %d bytes)", truncate(str, 80), strings.Count(str, "\n")+1, len(str))
+		}
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("  ", "  ")
+	if err := enc.Encode(m); err != nil {
+		return ""
+	}
+	return "  " + strings.TrimRight(buf.String(), "\n")
+}
+
+// primaryArgKeys are the arguments that say what a call is about, in the
+// order they are looked for.
+var primaryArgKeys = []string{"command", "path", "url", "pattern", "query", "question", "name", "id"}
+
+// partialStringArg matches a string-valued key in JSON that may still be
+// streaming: the closing quote is optional.
+var partialStringArg = regexp.MustCompile(`"(\w+)"\s*:\s*"((?:[^"\\]|\\.)*)`)
+
+// primaryArg returns the most telling string argument of a tool call, as far
+// as its JSON has arrived.
+func primaryArg(args string) string {
+	found := map[string]string{}
+	for _, m := range partialStringArg.FindAllStringSubmatch(args, -1) {
+		if _, ok := found[m[1]]; !ok {
+			found[m[1]] = m[2]
+		}
+	}
+	for _, k := range primaryArgKeys {
+		v, ok := found[k]
+		if !ok {
+			continue
+		}
+		// A cut-off escape (\ or \u00) doesn't decode; drop it until it does
+		for i := 0; i < 6 && v != ""; i++ {
+			var out string
+			if json.Unmarshal([]byte(`"`+v+`"`), &out) == nil {
+				return out
+			}
+			v = v[:len(v)-1]
+		}
+		return v
+	}
+	return ""
+}
+
+// toolPreview shows a tool call on one dimmed line while its arguments
+// stream in; renderToolCall prints the full call once it is complete.
+type toolPreview struct {
+	shown string
+}
+
+func (p *toolPreview) update(name, args string) {
+	if name == "" {
+		return
+	}
+	line := name
+	if arg := primaryArg(args); arg != "" {
+		line += "  " + arg
+	}
+	width := 80
+	if w, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil && w > 10 {
+		width = w
+	}
+	line = truncate(line, width-3) // one row, or \r can't redraw it
+	if line == p.shown {
+		return
+	}
+	p.shown = line
+	fmt.Printf("\r\033[2m▷ %s\033[0m\033[K", line)
+}
+
+// clear erases the preview line. Safe on nil.
+func (p *toolPreview) clear() {
+	if p == nil || p.shown == "" {
+		return
+	}
+	fmt.Print("\r\033[K")
+	p.shown = ""
+}
+
+// liveOutput echoes a running bash command's output to the terminal, dimmed
+// and indented under the tool call, one line at a time. stdout and stderr
+// share the lock so their lines don't interleave mid-line.
+type liveOutput struct {
+	mu sync.Mutex
+}
+
+// liveStream is one of the command's output streams; it buffers the
+// current partial line.
+type liveStream struct {
+	out    *liveOutput
+	stderr bool
+	buf    []byte
+}
+
+func (o *liveOutput) stream(stderr bool) *liveStream {
+	return &liveStream{out: o, stderr: stderr}
+}
+
+func (s *liveStream) Write(p []byte) (int, error) {
+	s.out.mu.Lock()
+	defer s.out.mu.Unlock()
+	s.buf = append(s.buf, p...)
+	for {
+		i := bytes.IndexByte(s.buf, '\n')
+		if i < 0 {
+			break
+		}
+		s.printLine(string(s.buf[:i]))
+		s.buf = s.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush prints a trailing line without a newline.
+func (s *liveStream) Flush() {
+	s.out.mu.Lock()
+	defer s.out.mu.Unlock()
+	if len(s.buf) > 0 {
+		s.printLine(string(s.buf))
+		s.buf = nil
+	}
+}
+
+func (s *liveStream) printLine(line string) {
+	// Progress bars redraw with \r; only the last frame is worth showing.
+	line = strings.TrimRight(line, "\r")
+	if i := strings.LastIndexByte(line, '\r'); i >= 0 {
+		line = line[i+1:]
+	}
+	line = ansiEscape.ReplaceAllString(line, "")
+	switch {
+	case plainOutput:
+		fmt.Printf("  | %s\n", line)
+	case s.stderr:
+		fmt.Printf("\033[2;31m  │ %s\033[0m\n", line)
+	default:
+		fmt.Printf("\033[2m  │ %s\033[0m\n", line)
+	}
+}
+
+// printJSON writes v as indented JSON, the --json form of every listing.
+func printJSON(v any) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return
+	}
+	fmt.Println(string(data))
+}
+
+// renderToolList prints tools grouped with their plan-mode and policy status.
+func renderToolList(tools []ToolInfo, mode Mode) {
+	for _, t := range tools {
+		status := ""
+		switch {
+		case t.Denied:
+			status = "\033[31mdenied\033[0m"
+		case t.Write && mode == ModePlan:
+			status = "\033[33mblocked in plan\033[0m"
+		case t.Permission != "":
+			status = "\033[33m" + t.Permission + "\033[0m"
+		}
+		desc := truncate(t.Description, 70)
+		fmt.Printf("  %-16s %-70s %s\n", t.Name, desc, status)
+	}
 }
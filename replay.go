@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// replayMaxPause caps how long one step of a --speed playback takes at speed
+// 1, so a two-minute build doesn't stall a demo.
+const replayMaxPause = 5 * time.Second
+
+// replayCharsPerSec paces replies saved before durations were recorded.
+const replayCharsPerSec = 200
+
+// replaySession prints a stored session (--replay) turn by turn with the
+// live renderers: markdown replies, ▶ tool calls, ↳ results, ⏱ turn lines.
+// speed 0 prints it at once; otherwise it plays back at the recorded pace,
+// speed times faster.
+func replaySession(s *Session, speed float64) {
+	initRenderer()
+	pause := func(d time.Duration) {
+		if speed > 0 {
+			time.Sleep(time.Duration(float64(min(d, replayMaxPause)) / speed))
+		}
+	}
+
+	title := s.Summary
+	if title == "" {
+		title = s.ID
+	}
+	fmt.Printf("\033[1mReplay: %s\033[0m\n\033[2m%s · %s/%s · %d messages\033[0m\n", title, s.CreatedAt, s.Provider, s.Model, len(s.Messages))
+
+	var times turnTimes
+	for _, m := range s.Messages {
+		switch m.Role {
+		case "user":
+			pause(time.Second)
+			fmt.Printf("\n\033[1m> %s\033[0m\n", m.Content)
+			times = turnTimes{}
+		case "assistant":
+			d := time.Duration(m.DurationMs) * time.Millisecond
+			if d == 0 {
+				d = time.Duration(len(m.Content)) * time.Second / replayCharsPerSec
+			}
+			replayText(m.Content, func(frac float64) { pause(time.Duration(float64(d) * frac)) })
+			for _, tc := range m.ToolCalls {
+				renderToolCall(tc.Name, string(tc.Args), false)
+			}
+			times.llm += d
+			times.calls++
+			if len(m.ToolCalls) == 0 && !plainOutput {
+				times.total = times.llm + times.tools
+				renderTurnTimes(times)
+			}
+		case "tool":
+			d := time.Duration(m.DurationMs) * time.Millisecond
+			pause(d)
+			if !plainOutput {
+				renderToolResult(m.Content, d)
+			}
+			times.tools += d
+			times.toolCalls++
+		}
+	}
+}
+
+// replayText prints a reply the way it streamed: word by word through the
+// markdown renderer, waiting wait(fraction of the reply) before each word.
+func replayText(text string, wait func(frac float64)) {
+	if text == "" {
+		return
+	}
+	var md *mdStream
+	if !plainOutput && mdRenderer != nil {
+		md = newMDStream()
+	}
+	words := strings.SplitAfter(text, " ")
+	for _, w := range words {
+		wait(1 / float64(len(words)))
+		if md != nil {
+			md.Write(w)
+		} else {
+			fmt.Print(w)
+		}
+	}
+	if md != nil {
+		md.Finish()
+	} else if !strings.HasSuffix(text, "\n") {
+		fmt.Println()
+	}
+}
@@ -0,0 +1,481 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// reviewBatchMax caps the annotated diff sent in one review request; larger
+// changes are reviewed a few files at a time.
+const reviewBatchMax = 60000
+
+// reviewSeverities are the finding levels, most serious first.
+var reviewSeverities = []string{"critical", "major", "minor", "nit"}
+
+const reviewPrompt = `You are reviewing a code change as a careful senior engineer on this project.
+Report real problems: bugs and wrong logic, unhandled errors, security issues, races, resource leaks, broken edge cases, missing tests for new behavior, and clear departures from the project's conventions. Don't praise, don't restate the change, and don't flag what a formatter would fix.
+For each finding give:
+- file: the path as shown in the diff
+- line: the new-file line number shown at the left of the diff; 0 when the finding is about the file as a whole or about removed code
+- severity: critical (breaks things or is a security hole), major (a bug or likely wrong behavior), minor (an edge case or maintainability problem), nit (small, optional)
+- comment: what is wrong and why, in one to three sentences
+- suggestion: the concrete fix, or "" if the comment says it
+The summary is one to three sentences on the change as a whole. If the change looks right, return no findings.
+`
+
+type reviewFinding struct {
+	File       string `json:"file"`
+	Line       int    `json:"line"`
+	Severity   string `json:"severity"`
+	Comment    string `json:"comment"`
+	Suggestion string `json:"suggestion,omitempty"`
+}
+
+type reviewReport struct {
+	Target   string          `json:"target"` // what was reviewed, e.g. "staged changes"
+	Model    string          `json:"model"`
+	Summary  string          `json:"summary"`
+	Findings []reviewFinding `json:"findings"`
+}
+
+// reviewFile is one file of a diff, with new-file line numbers added.
+type reviewFile struct {
+	Path      string
+	Annotated string
+	Lines     map[int]bool // new-file lines the diff shows; only these take PR line comments
+}
+
+type reviewOptions struct {
+	staged   bool
+	output   string
+	post     bool
+	json     bool
+	provider string
+	model    string
+	profile  string
+}
+
+func reviewFlags(o *reviewOptions) *flag.FlagSet {
+	fs := flag.NewFlagSet("review", flag.ExitOnError)
+	fs.BoolVar(&o.staged, "staged", false, "Review the staged changes")
+	fs.StringVar(&o.output, "o", "", "Also write the findings as a markdown report to this file")
+	fs.StringVar(&o.output, "output", "", "Also write the findings as a markdown report to this file")
+	fs.BoolVar(&o.post, "post", false, "Post the findings as a review on the branch's open GitHub pull request")
+	fs.BoolVar(&o.json, "json", false, "Print the findings as JSON")
+	fs.StringVar(&o.provider, "provider", "", "LLM provider")
+	fs.StringVar(&o.model, "model", "", "Model name")
+	fs.StringVar(&o.profile, "profile", "", "Config profile to use")
+	return fs
+}
+
+// runReview handles `simpleagent review [ref|--staged]`: the diff goes to
+// the review model (models.review, else the main model) with the review
+// prompt and the project's instructions and conventions, and the structured
+// findings are printed, and optionally written as markdown or posted on the
+// pull request.
+func runReview(args []string) {
+	var opt reviewOptions
+	fs := reviewFlags(&opt)
+	// The ref may come before, between or after the flags
+	var ref string
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		ref = fs.Arg(0)
+		fs.Parse(fs.Args()[1:])
+	}
+	fail := func(err error) {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := exec.Command("git", "rev-parse", "--git-dir").Run(); err != nil {
+		fail(fmt.Errorf("not a git repository"))
+	}
+	if ref != "" && opt.staged {
+		fail(fmt.Errorf("give a ref or --staged, not both"))
+	}
+
+	configProfile = opt.profile
+	ResolveAgentDir("")
+	cfg := LoadConfig()
+	if opt.provider != "" {
+		cfg.Provider = opt.provider
+	}
+	if opt.model != "" {
+		pc := cfg.Providers[cfg.Provider]
+		pc.Model = opt.model
+		cfg.Providers[cfg.Provider] = pc
+	}
+	if !providerReady(cfg) {
+		fail(fmt.Errorf("no provider configured (run simpleagent --setup first)"))
+	}
+
+	var pr *githubPull
+	var diffArgs []string
+	target := "uncommitted changes"
+	switch {
+	case opt.post:
+		if ref != "" || opt.staged {
+			fail(fmt.Errorf("--post reviews the pull request's changes; drop the ref and --staged"))
+		}
+		p, err := findPull(cfg.Forge)
+		if err != nil {
+			fail(err)
+		}
+		pr = p
+		exec.Command("git", "fetch", "-q", cfg.Forge.remote(), pr.Base.Ref).Run()
+		diffArgs = []string{"diff", prBaseRef(cfg.Forge, pr.Base.Ref) + "...HEAD"}
+		target = fmt.Sprintf("pull request #%d", pr.Number)
+	case opt.staged:
+		diffArgs = []string{"diff", "--cached"}
+		target = "staged changes"
+	case strings.Contains(ref, ".."):
+		diffArgs = []string{"diff", ref}
+		target = ref
+	case ref != "":
+		diffArgs = []string{"diff", ref + "...HEAD"}
+		target = "changes since " + ref
+	default:
+		diffArgs = []string{"diff", "HEAD"}
+	}
+	diff, err := gitOutput(diffArgs...)
+	if err != nil {
+		fail(err)
+	}
+	files := annotateDiff(NewRedactor(cfg.Redact).Redact(diff))
+	if len(files) == 0 {
+		fmt.Printf("No %s to review.\n", target)
+		return
+	}
+
+	llm, err := NewProvider(cfg.Provider, cfg)
+	model := cfg.ProviderCfg(cfg.Provider).Model
+	if err == nil && cfg.Models.Review != "" {
+		llm, model, err = routedProvider(cfg, cfg.Models.Review)
+	}
+	if err != nil {
+		fail(err)
+	}
+	if !opt.json && !plainOutput {
+		fmt.Printf("\033[2mReviewing %s (%d file(s)) with %s...\033[0m\n", target, len(files), model)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	report, err := reviewDiff(ctx, cfg, llm, model, files)
+	if err != nil {
+		fail(err)
+	}
+	report.Target = target
+
+	if opt.json {
+		printJSON(report)
+	} else {
+		renderReview(report)
+	}
+	if opt.output != "" {
+		if err := os.WriteFile(opt.output, []byte(reviewMarkdown(report)), 0644); err != nil {
+			fail(err)
+		}
+		fmt.Fprintf(os.Stderr, "Wrote %s\n", opt.output)
+	}
+	if pr != nil {
+		link, err := postReview(ctx, cfg.Forge, pr, report, files)
+		if err != nil {
+			fail(err)
+		}
+		fmt.Fprintf(os.Stderr, "Posted %s\n", link)
+	}
+}
+
+// annotateDiff splits a unified diff by file and numbers the lines of the
+// new file, so the model can cite them: "   42 +added", "   43  context",
+// "      -removed". Deleted files are skipped.
+func annotateDiff(diff string) []reviewFile {
+	var files []reviewFile
+	var cur *reviewFile
+	var sb strings.Builder
+	line := 0
+	flush := func() {
+		if cur != nil && cur.Path != "" {
+			cur.Annotated = sb.String()
+			files = append(files, *cur)
+		}
+		sb.Reset()
+	}
+	for _, l := range strings.Split(diff, "\n") {
+		switch {
+		case strings.HasPrefix(l, "diff --git "):
+			flush()
+			cur = &reviewFile{Lines: map[int]bool{}}
+			line = 0
+			sb.WriteString(l + "\n")
+			continue
+		case cur == nil:
+			continue
+		case line == 0 && strings.HasPrefix(l, "+++ "):
+			if p := strings.TrimPrefix(l, "+++ "); p != "/dev/null" {
+				cur.Path = strings.TrimPrefix(p, "b/")
+			}
+		case strings.HasPrefix(l, "@@ "):
+			// @@ -a,b +c,d @@
+			if _, after, ok := strings.Cut(l, " +"); ok {
+				start, _, _ := strings.Cut(after, " ")
+				start, _, _ = strings.Cut(start, ",")
+				line, _ = strconv.Atoi(start)
+			}
+		case line > 0 && (strings.HasPrefix(l, "+") || strings.HasPrefix(l, " ")):
+			cur.Lines[line] = true
+			fmt.Fprintf(&sb, "%5d %s\n", line, l)
+			line++
+			continue
+		case line > 0 && strings.HasPrefix(l, "-"):
+			sb.WriteString("      " + l + "\n")
+			continue
+		}
+		sb.WriteString(l + "\n")
+	}
+	flush()
+	return files
+}
+
+// reviewDiff reviews the files in batches of up to reviewBatchMax and merges
+// the findings, most serious first.
+func reviewDiff(ctx context.Context, cfg Config, llm Provider, model string, files []reviewFile) (reviewReport, error) {
+	instructions := reviewPrompt
+	if instr := loadProjectInstructions(); instr != "" {
+		instructions += "\n" + instr
+	}
+	if conv := loadConventions(); conv != "" {
+		instructions += "\n" + conv
+	}
+
+	finding := jsonObject(map[string]any{
+		"file":       map[string]any{"type": "string"},
+		"line":       map[string]any{"type": "integer"},
+		"severity":   map[string]any{"type": "string", "enum": reviewSeverities},
+		"comment":    map[string]any{"type": "string"},
+		"suggestion": map[string]any{"type": "string"},
+	})
+	schema := jsonObject(map[string]any{
+		"summary":  map[string]any{"type": "string"},
+		"findings": map[string]any{"type": "array", "items": finding},
+	})
+
+	report := reviewReport{Model: model}
+	var summaries []string
+	for start := 0; start < len(files); {
+		var sb strings.Builder
+		end := start
+		for end < len(files) && (end == start || sb.Len()+len(files[end].Annotated) <= reviewBatchMax) {
+			text := files[end].Annotated
+			if len(text) > reviewBatchMax {
+				text = strings.ToValidUTF8(text[:reviewBatchMax], "") + "\n[diff of this file truncated]\n"
+			}
+			sb.WriteString(text)
+			end++
+		}
+		prompt := instructions + "\nThe change:\n" + sb.String()
+		if start > 0 || end < len(files) {
+			prompt += fmt.Sprintf("\n(This is part of a larger change: files %d-%d of %d.)\n", start+1, end, len(files))
+		}
+
+		var reply struct {
+			Summary  string          `json:"summary"`
+			Findings []reviewFinding `json:"findings"`
+		}
+		usage, err := completeJSON(ctx, llm, prompt, schema, &reply)
+		if usage != nil {
+			price, ok := priceFor(llm.Name(), model, cfg.Budget.Prices)
+			cwd, _ := os.Getwd()
+			recordUsage(usageRecord{
+				Time: time.Now(), Session: "review", Project: cwd, Provider: llm.Name(), Model: model,
+				Input: usage.InputTokens, Output: usage.OutputTokens, CacheRead: usage.CacheReadTokens, CacheWrite: usage.CacheCreationTokens,
+				CostUSD: usageCost(usage, price), Unpriced: !ok,
+			})
+		}
+		if err != nil {
+			return report, err
+		}
+		if s := strings.TrimSpace(reply.Summary); s != "" {
+			summaries = append(summaries, s)
+		}
+		report.Findings = append(report.Findings, reply.Findings...)
+		start = end
+	}
+	report.Summary = strings.Join(summaries, "\n\n")
+
+	rank := func(s string) int {
+		for i, name := range reviewSeverities {
+			if s == name {
+				return i
+			}
+		}
+		return len(reviewSeverities)
+	}
+	sort.SliceStable(report.Findings, func(i, j int) bool {
+		a, b := report.Findings[i], report.Findings[j]
+		if rank(a.Severity) != rank(b.Severity) {
+			return rank(a.Severity) < rank(b.Severity)
+		}
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.Line < b.Line
+	})
+	if report.Findings == nil {
+		report.Findings = []reviewFinding{}
+	}
+	return report, nil
+}
+
+// location is file:line, or the file alone for line 0.
+func (f reviewFinding) location() string {
+	if f.Line > 0 {
+		return fmt.Sprintf("%s:%d", f.File, f.Line)
+	}
+	return f.File
+}
+
+// reviewCounts is "1 critical, 2 minor" or "no findings".
+func reviewCounts(findings []reviewFinding) string {
+	var parts []string
+	for _, sev := range reviewSeverities {
+		n := 0
+		for _, f := range findings {
+			if f.Severity == sev {
+				n++
+			}
+		}
+		if n > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", n, sev))
+		}
+	}
+	if len(parts) == 0 {
+		return "no findings"
+	}
+	return strings.Join(parts, ", ")
+}
+
+func renderReview(r reviewReport) {
+	colors := map[string]string{"critical": "\033[1;31m", "major": "\033[33m", "minor": "\033[36m", "nit": "\033[2m"}
+	if plainOutput {
+		fmt.Printf("Review of %s: %s\n\n%s\n", r.Target, reviewCounts(r.Findings), r.Summary)
+	} else {
+		fmt.Printf("\033[1mReview of %s\033[0m: %s\n\n%s\n", r.Target, reviewCounts(r.Findings), r.Summary)
+	}
+	for _, f := range r.Findings {
+		if plainOutput {
+			fmt.Printf("\n%-8s  %s\n", f.Severity, f.location())
+		} else {
+			fmt.Printf("\n%s%-8s\033[0m  \033[1m%s\033[0m\n", colors[f.Severity], f.Severity, f.location())
+		}
+		fmt.Printf("  %s\n", strings.ReplaceAll(strings.TrimSpace(f.Comment), "\n", "\n  "))
+		if s := strings.TrimSpace(f.Suggestion); s != "" {
+			fmt.Printf("  → %s\n", strings.ReplaceAll(s, "\n", "\n    "))
+		}
+	}
+}
+
+// reviewMarkdown is the report for --output.
+func reviewMarkdown(r reviewReport) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# Review of %s\n\n_%s · %s · %s_\n\n%s\n", r.Target, r.Model, time.Now().Format("2006-01-02 15:04"), reviewCounts(r.Findings), r.Summary)
+	for _, f := range r.Findings {
+		fmt.Fprintf(&sb, "\n## %s `%s`\n\n%s\n", f.Severity, f.location(), findingText(f))
+	}
+	return sb.String()
+}
+
+// findingText is a finding's comment and suggestion in markdown.
+func findingText(f reviewFinding) string {
+	text := strings.TrimSpace(f.Comment)
+	if s := strings.TrimSpace(f.Suggestion); s != "" {
+		text += "\n\n**Suggestion:** " + s
+	}
+	return text
+}
+
+// githubPull is the part of a GitHub pull request review posting needs.
+type githubPull struct {
+	Number  int    `json:"number"`
+	HTMLURL string `json:"html_url"`
+	Head    struct {
+		SHA string `json:"sha"`
+	} `json:"head"`
+	Base struct {
+		Ref string `json:"ref"`
+	} `json:"base"`
+}
+
+// findPull returns the open GitHub pull request for the current branch,
+// checking that it is at the local HEAD.
+func findPull(cfg ForgeConfig) (*githubPull, error) {
+	repo, err := resolveForge(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if repo.Kind != "github" {
+		return nil, fmt.Errorf("--post supports GitHub pull requests only")
+	}
+	out, err := gitOutput("rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	branch := strings.TrimSpace(out)
+	owner, _, _ := strings.Cut(repo.Path, "/")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	var pulls []githubPull
+	q := "?state=open&head=" + owner + ":" + branch
+	if err := repo.call(ctx, "GET", "/repos/"+repo.Path+"/pulls"+q, nil, &pulls); err != nil {
+		return nil, err
+	}
+	if len(pulls) == 0 {
+		return nil, fmt.Errorf("no open pull request for %s (open one with /pr)", branch)
+	}
+	head, _ := gitOutput("rev-parse", "HEAD")
+	if pr := &pulls[0]; pr.Head.SHA != strings.TrimSpace(head) {
+		return nil, fmt.Errorf("pull request #%d is at %.7s but HEAD is %.7s; push or pull first", pr.Number, pr.Head.SHA, head)
+	}
+	return &pulls[0], nil
+}
+
+// postReview posts the report as a COMMENT review: findings on lines the
+// diff shows become line comments, the rest go in the review body with the
+// summary. Returns the review's URL.
+func postReview(ctx context.Context, cfg ForgeConfig, pr *githubPull, r reviewReport, files []reviewFile) (string, error) {
+	repo, err := resolveForge(cfg)
+	if err != nil {
+		return "", err
+	}
+	shown := map[string]map[int]bool{}
+	for _, f := range files {
+		shown[f.Path] = f.Lines
+	}
+	body := "**Automated review** (" + reviewCounts(r.Findings) + ")\n\n" + r.Summary + "\n"
+	comments := []map[string]any{}
+	for _, f := range r.Findings {
+		text := "**" + f.Severity + "**: " + findingText(f)
+		if shown[f.File][f.Line] {
+			comments = append(comments, map[string]any{"path": f.File, "line": f.Line, "side": "RIGHT", "body": text})
+			continue
+		}
+		body += "\n---\n`" + f.location() + "` " + text + "\n"
+	}
+	var out struct {
+		HTMLURL string `json:"html_url"`
+	}
+	err = repo.call(ctx, "POST", fmt.Sprintf("/repos/%s/pulls/%d/reviews", repo.Path, pr.Number), map[string]any{
+		"commit_id": pr.Head.SHA,
+		"event":     "COMMENT",
+		"body":      body,
+		"comments":  comments,
+	}, &out)
+	return out.HTMLURL, err
+}
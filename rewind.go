@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Checkpoint is a slice of the conversation removed by /rewind, kept so
+// /rewind restore can put it back.
+type Checkpoint struct {
+	CreatedAt string    `json:"created_at"`
+	From      int       `json:"from"` // index the messages were cut at
+	Messages  []Message `json:"messages"`
+}
+
+// checkpointPath is .simpleagent/<agent>/checkpoints/<session-id>.json, kept
+// beside the session store so it works with either backend.
+func checkpointPath(sessionID string) string {
+	return filepath.Join(agentDir, "checkpoints", sessionID+".json")
+}
+
+func loadCheckpoints(sessionID string) []Checkpoint {
+	data, err := os.ReadFile(checkpointPath(sessionID))
+	if err != nil {
+		return nil
+	}
+	var cps []Checkpoint
+	json.Unmarshal(data, &cps)
+	return cps
+}
+
+func saveCheckpoints(sessionID string, cps []Checkpoint) error {
+	path := checkpointPath(sessionID)
+	if len(cps) == 0 {
+		os.Remove(path)
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(cps, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// rewindPoint returns the index of the n-th last user message, where the
+// last n exchanges start, and how many exchanges there are in total.
+func rewindPoint(msgs []Message, n int) (int, int) {
+	idx, seen := -1, 0
+	for i := len(msgs) - 1; i >= 0; i-- {
+		if msgs[i].Role == "user" {
+			seen++
+			if seen == n {
+				idx = i
+			}
+		}
+	}
+	return idx, seen
+}
+
+// describeMessages prints one line per user prompt and counts the rest.
+func describeMessages(msgs []Message) {
+	replies, tools := 0, 0
+	for _, m := range msgs {
+		switch m.Role {
+		case "user":
+			fmt.Printf("  > %s\n", truncate(m.Content, 70))
+		case "assistant":
+			replies++
+			tools += len(m.ToolCalls)
+		}
+	}
+	fmt.Printf("  (%d message(s): %d from the assistant, %d tool call(s))\n", len(msgs), replies, tools)
+}
+
+// rewind handles /rewind [n] and /rewind restore.
+func (a *Agent) rewind(arg string) {
+	if arg == "restore" {
+		a.rewindRestore()
+		return
+	}
+	n := 1
+	if arg != "" {
+		v, err := strconv.Atoi(arg)
+		if err != nil || v < 1 {
+			fmt.Println("Usage: /rewind [n] | /rewind restore")
+			return
+		}
+		n = v
+	}
+
+	idx, total := rewindPoint(a.session.Messages, n)
+	if total == 0 {
+		fmt.Println("Nothing to rewind.")
+		return
+	}
+	if idx < 0 {
+		fmt.Printf("Only %d exchange(s) in this session.\n", total)
+		return
+	}
+	removed := a.session.Messages[idx:]
+	fmt.Printf("Rewinding %d exchange(s) removes:\n", n)
+	describeMessages(removed)
+	if !a.confirm("Remove them from the conversation? (files are not touched)") {
+		fmt.Println("Cancelled.")
+		return
+	}
+
+	cps := append(loadCheckpoints(a.session.ID), Checkpoint{
+		CreatedAt: time.Now().Format(time.RFC3339),
+		From:      idx,
+		Messages:  append([]Message(nil), removed...),
+	})
+	if err := saveCheckpoints(a.session.ID, cps); err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving checkpoint: %v\n", err)
+		return
+	}
+	a.dropSummaryFrom(idx)
+	a.session.Messages = a.session.Messages[:idx]
+	a.paused = false
+	a.session.Save()
+	fmt.Printf("Rewound %d exchange(s). /rewind restore brings them back.\n", n)
+}
+
+// rewindRestore puts back the most recent checkpoint. Anything said since
+// the rewind is swapped out into a checkpoint of its own, so restoring twice
+// returns to where you were.
+func (a *Agent) rewindRestore() {
+	cps := loadCheckpoints(a.session.ID)
+	if len(cps) == 0 {
+		fmt.Println("No checkpoint to restore.")
+		return
+	}
+	cp := cps[len(cps)-1]
+	cps = cps[:len(cps)-1]
+	if cp.From > len(a.session.Messages) {
+		fmt.Println("The conversation is shorter than it was at that rewind; it can't be restored.")
+		return
+	}
+
+	tail := a.session.Messages[cp.From:]
+	fmt.Printf("Restoring checkpoint from %s:\n", cp.CreatedAt)
+	describeMessages(cp.Messages)
+	if len(tail) > 0 {
+		fmt.Println("Replacing what came after the rewind (kept as a checkpoint):")
+		describeMessages(tail)
+	}
+	if !a.confirm("Restore?") {
+		fmt.Println("Cancelled.")
+		return
+	}
+
+	if len(tail) > 0 {
+		cps = append(cps, Checkpoint{
+			CreatedAt: time.Now().Format(time.RFC3339),
+			From:      cp.From,
+			Messages:  append([]Message(nil), tail...),
+		})
+	}
+	if err := saveCheckpoints(a.session.ID, cps); err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving checkpoint: %v\n", err)
+		return
+	}
+	a.dropSummaryFrom(cp.From)
+	a.session.Messages = append(a.session.Messages[:cp.From:cp.From], cp.Messages...)
+	a.session.Save()
+	fmt.Printf("Restored %d message(s).\n", len(cp.Messages))
+	// Don't let the REPL pick a half-finished turn straight back up
+	if last := cp.Messages[len(cp.Messages)-1]; last.Role != "assistant" {
+		a.paused = true
+		fmt.Println("The restored conversation ends mid-turn; /continue to resume it.")
+	}
+}
+
+// redo opens the last user message in $EDITOR, drops that exchange (kept as a
+// checkpoint, like /rewind) and sends the edited text in its place.
+func (a *Agent) redo() {
+	idx, _ := rewindPoint(a.session.Messages, 1)
+	if idx < 0 {
+		fmt.Println("No previous message to redo.")
+		return
+	}
+	edited, err := openInEditor(a.session.Messages[idx].Content, ".md")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return
+	}
+	edited = strings.TrimSpace(edited)
+	if edited == "" {
+		fmt.Println("Empty message, nothing sent.")
+		return
+	}
+
+	cps := append(loadCheckpoints(a.session.ID), Checkpoint{
+		CreatedAt: time.Now().Format(time.RFC3339),
+		From:      idx,
+		Messages:  append([]Message(nil), a.session.Messages[idx:]...),
+	})
+	if err := saveCheckpoints(a.session.ID, cps); err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving checkpoint: %v\n", err)
+		return
+	}
+	a.dropSummaryFrom(idx)
+	a.session.Messages = a.session.Messages[:idx]
+	a.session.Save()
+	fmt.Printf("\033[2m> %s\033[0m\n", truncate(edited, 70))
+
+	if a.cfg.TrackPrompts {
+		trackPrompt(a.session.ID, a.redactor.Redact(edited))
+	}
+	a.paused = false
+	a.addUserMessage(edited)
+	a.runAgentLoop()
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"strings"
+)
+
+// ModelRoutes picks models per task. Each is "model" (on the current
+// provider) or "provider:model"; empty uses the main model.
+type ModelRoutes struct {
+	Compact string `json:"compact,omitempty"` // /compact summaries
+	Title   string `json:"title,omitempty"`   // session titles; when unset, the first message is the title
+	Plan    string `json:"plan,omitempty"`    // turns in plan mode
+	Action  string `json:"action,omitempty"`  // turns in action mode
+	Commit  string `json:"commit,omitempty"`  // /commit messages; when unset, the title model
+	Review  string `json:"review,omitempty"`  // simpleagent review
+}
+
+func (r ModelRoutes) spec(role string) string {
+	switch role {
+	case "compact":
+		return r.Compact
+	case "title":
+		return r.Title
+	case "plan":
+		return r.Plan
+	case "action":
+		return r.Action
+	case "commit":
+		if r.Commit != "" {
+			return r.Commit
+		}
+		return r.Title
+	case "review":
+		return r.Review
+	}
+	return ""
+}
+
+// providerNames are the valid prefixes of a "provider:model" route. Ollama
+// model names contain colons too (qwen2.5-coder:14b), so only these split.
+var providerNames = []string{"anthropic", "openai", "openrouter", "gemini", "ollama", "bedrock", "mock"}
+
+// parseModelSpec splits a route into provider and model; provider is "" for
+// the current one.
+func parseModelSpec(spec string) (provider, model string) {
+	if p, m, ok := strings.Cut(spec, ":"); ok {
+		for _, name := range providerNames {
+			if p == name {
+				return p, m
+			}
+		}
+	}
+	return "", spec
+}
+
+// modeRole is the models.* route for the current mode.
+func (a *Agent) modeRole() string {
+	if a.mode == ModePlan {
+		return "plan"
+	}
+	return "action"
+}
+
+// mainModel is the model of the main provider (config, .agent, -m, /model).
+func (a *Agent) mainModel() string {
+	return a.cfg.ProviderCfg(a.cfg.Provider).Model
+}
+
+// useRole points a.llm at the provider and model for role. Routed providers
+// are created once and cached; one that can't be created warns and falls
+// back to the main model.
+func (a *Agent) useRole(role string) {
+	a.llm, a.llmModel = a.provider, a.mainModel()
+	spec := a.cfg.Models.spec(role)
+	if spec == "" {
+		return
+	}
+	name, model := parseModelSpec(spec)
+	if name == "" {
+		name = a.cfg.Provider
+	}
+	key := name + ":" + model
+	if p, ok := a.routes[key]; ok {
+		if p != nil {
+			a.llm, a.llmModel = p, model
+		}
+		return
+	}
+
+	p, _, err := routedProvider(a.cfg, spec)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: models.%s (%s): %v; using %s\n", role, spec, err, a.mainModel())
+		p = nil
+	}
+	if a.routes == nil {
+		a.routes = make(map[string]Provider)
+	}
+	a.routes[key] = p
+	if p != nil {
+		a.llm, a.llmModel = p, model
+	}
+}
+
+// routedProvider creates the provider for a models.* route, returning it
+// with the model it runs.
+func routedProvider(cfg Config, spec string) (Provider, string, error) {
+	name, model := parseModelSpec(spec)
+	if name == "" {
+		name = cfg.Provider
+	}
+	cfg.Providers = maps.Clone(cfg.Providers)
+	pc := cfg.Providers[name]
+	pc.Model = model
+	cfg.Providers[name] = pc
+	p, err := NewProvider(name, cfg)
+	return p, model, err
+}
+
+// resetRoutes drops cached routed providers after /model or /provider, since
+// routes without a provider prefix follow the main provider.
+func (a *Agent) resetRoutes() {
+	a.routes = nil
+	a.useRole(a.modeRole())
+}
+
+// titleSession asks the models.title model for a short session title after
+// the first exchange. Without models.title the first message stays the title.
+func (a *Agent) titleSession(ctx context.Context) {
+	if a.cfg.Models.Title == "" {
+		return
+	}
+	var first string
+	for _, m := range a.session.Messages {
+		if m.Role == "user" && m.Content != "" {
+			first = m.Content
+			break
+		}
+	}
+	if first == "" || (a.session.Summary != "" && a.session.Summary != truncate(first, 60)) {
+		return // already titled
+	}
+
+	a.useRole("title")
+	defer a.useRole(a.modeRole())
+	if len(first) > 2000 {
+		first = first[:2000]
+	}
+	var reply struct {
+		Title string `json:"title"`
+	}
+	schema := jsonObject(map[string]any{
+		"title": map[string]any{"type": "string", "description": "at most 6 words"},
+	})
+	usage, err := completeJSON(ctx, a.llm, "You write short, specific titles for coding sessions. Give a title of at most 6 words for a conversation that starts with this request.\n\n"+first, schema, &reply)
+	if usage != nil {
+		a.addUsage(usage)
+	}
+	if err != nil {
+		return
+	}
+	title := strings.Trim(strings.TrimSpace(reply.Title), "\"'`*#. ")
+	if title != "" {
+		a.session.Summary = truncate(title, 60)
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// SafetyCheck scores shell commands for destructiveness before bash and
+// start_process run them. Commands at or above Threshold need the user's
+// approval even when the command policy allows them.
+type SafetyCheck struct {
+	Threshold int
+	// Dangerous makes commands matching dangerRules always ask, whatever
+	// the threshold or allow rules say.
+	Dangerous bool
+	// Model is an optional second opinion for commands the rules score
+	// below the threshold; nil means heuristics only.
+	Model func(command string) (int, error)
+}
+
+// safetyRule adds score when its pattern appears anywhere in the command.
+type safetyRule struct {
+	re     *regexp.Regexp
+	score  int
+	reason string
+}
+
+func safetyPattern(expr string, score int, reason string) safetyRule {
+	return safetyRule{regexp.MustCompile(expr), score, reason}
+}
+
+// safetyRules are deliberately broad: a false positive costs one keypress.
+var safetyRules = []safetyRule{
+	safetyPattern(`\brm\s+(-\S+\s+)*-\S*[rR]`, 40, "recursive rm"),
+	safetyPattern(`\brm\s+(-\S+\s+)*(/|/\*|~/?|\$HOME/?|\*|\.\.?/?)(\s|;|$)`, 60, "rm on /, ~, . or *"),
+	safetyPattern(`--no-preserve-root`, 100, "--no-preserve-root"),
+	safetyPattern(`\bmkfs(\.\w+)?\b`, 100, "mkfs"),
+	safetyPattern(`\bdd\b.*\bof=/dev/`, 100, "dd to a device"),
+	safetyPattern(`>\s*/dev/(sd|hd|vd|xvd|nvme|mmcblk|disk)`, 100, "write to a block device"),
+	safetyPattern(`:\(\)\s*\{\s*:\s*\|\s*:\s*&\s*\}\s*;\s*:`, 100, "fork bomb"),
+	safetyPattern(`(?i)\bdrop\s+(table|database|schema)\b`, 80, "DROP TABLE/DATABASE"),
+	safetyPattern(`(?i)\btruncate\s+table\b`, 70, "TRUNCATE TABLE"),
+	safetyPattern(`(?i)\bdelete\s+from\s+\w+\s*(;|"|'|$)`, 60, "DELETE without WHERE"),
+	safetyPattern(`\bgit\s+push\b.*(\s--force(\s|$)|\s-f(\s|$)|\s\+\S)`, 70, "git force push"),
+	safetyPattern(`\bgit\s+push\b.*\s--force-with-lease`, 40, "git force push (with lease)"),
+	safetyPattern(`\bgit\s+reset\s+.*--hard`, 50, "git reset --hard"),
+	safetyPattern(`\bgit\s+clean\s+(-\S+\s+)*-\S*f`, 50, "git clean -f"),
+	safetyPattern(`\bgit\s+branch\s+.*-D\b`, 30, "git branch -D"),
+	safetyPattern(`\b(chmod|chown)\s+(-\S+\s+)*-\S*R\S*\s+(\S+\s+)?/(\s|$)`, 70, "recursive chmod/chown on /"),
+	safetyPattern(`\bchmod\s+(-\S+\s+)*0?777\b`, 30, "chmod 777"),
+	safetyPattern(`\b(curl|wget)\b[^|]*\|\s*(sudo\s+)?(ba|z)?sh\b`, 60, "pipe download to shell"),
+	safetyPattern(`\b(shutdown|reboot|halt|poweroff)\b`, 70, "shutdown/reboot"),
+	safetyPattern(`\bkill\s+-9\s+-1\b`, 90, "kill every process"),
+	safetyPattern(`>\s*/etc/`, 60, "overwrite under /etc"),
+	safetyPattern(`\bfind\b.*\s-delete\b`, 40, "find -delete"),
+	safetyPattern(`\bdocker\s+(system|volume|image)\s+prune\b`, 40, "docker prune"),
+	safetyPattern(`\bkubectl\s+delete\b`, 50, "kubectl delete"),
+	safetyPattern(`\bterraform\s+destroy\b`, 80, "terraform destroy"),
+	safetyPattern(`(^|[;&|]\s*)sudo\s`, 20, "sudo"),
+}
+
+// dangerRules are commands that are never routine for an agent: they wipe
+// disks, the root filesystem, work trees or databases. A match always asks,
+// with the command shown as is. Scores are unused.
+var dangerRules = []safetyRule{
+	safetyPattern(`\brm\s+(-\S+\s+)*-\S*[rR]\S*\s+(-\S+\s+)*(/|/\*|/(bin|boot|dev|etc|home|lib\w*|opt|root|sbin|srv|usr|var)/?\*?|~/?\*?|\$HOME/?\*?)(\s|;|&|\||$)`, 0, "rm -rf on / or a system/home directory"),
+	safetyPattern(`--no-preserve-root`, 0, "--no-preserve-root"),
+	safetyPattern(`\bmkfs(\.\w+)?\b`, 0, "mkfs"),
+	safetyPattern(`\bdd\b.*\bof=/dev/`, 0, "dd to a device"),
+	safetyPattern(`>\s*/dev/(sd|hd|vd|xvd|nvme|mmcblk|disk)`, 0, "write to a block device"),
+	safetyPattern(`:\(\)\s*\{\s*:\s*\|\s*:\s*&\s*\}\s*;\s*:`, 0, "fork bomb"),
+	safetyPattern(`\bgit\s+reset\s+.*--hard`, 0, "git reset --hard"),
+	safetyPattern(`(?i)\bdrop\s+(table|database|schema)\b`, 0, "DROP TABLE/DATABASE"),
+}
+
+// dangerousCommand returns why command matches dangerRules, or "".
+func dangerousCommand(command string) string {
+	var reasons []string
+	for _, r := range dangerRules {
+		if r.re.MatchString(command) {
+			reasons = append(reasons, r.reason)
+		}
+	}
+	return strings.Join(reasons, ", ")
+}
+
+// classifyCommand scores a command from 0 (harmless) to 100 (destructive)
+// and lists the rules that matched.
+func classifyCommand(command string) (int, []string) {
+	score := 0
+	var reasons []string
+	for _, r := range safetyRules {
+		if r.re.MatchString(command) {
+			score += r.score
+			reasons = append(reasons, r.reason)
+		}
+	}
+	return min(score, 100), reasons
+}
+
+// checkSafety escalates risky bash/start_process commands to the user.
+// Returns a non-empty blocked message when the call must not run. A call the
+// user approved with a tools.permissions ask still gets the dangerous command
+// rules, but not the publish question or the risk score.
+func (r *ToolRegistry) checkSafety(name string, args json.RawMessage, approved bool) string {
+	if q := publishQuestion(name, args); q != "" && !approved && r.Safety != nil && r.Safety.Dangerous {
+		// Pushes and posts are seen by others: not something to take back.
+		if r.Confirm == nil || !r.Confirm(q) {
+			return fmt.Sprintf("blocked: %s needs the user's confirmation; it was declined or no one could confirm it", name)
+		}
+		return ""
+	}
+	if r.Safety == nil || !commandTools[name] {
+		return ""
+	}
+	var params struct {
+		Command string `json:"command"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return ""
+	}
+
+	if why := dangerousCommand(params.Command); why != "" && r.Safety.Dangerous {
+		if r.Confirm == nil || !r.Confirm(fmt.Sprintf("Destructive command (%s):\n    %s\n  Run it?", why, params.Command)) {
+			return fmt.Sprintf("blocked: destructive command (%s) needs the user's confirmation; it was declined or no one could confirm it", why)
+		}
+		return ""
+	}
+	if approved || r.Safety.Threshold <= 0 {
+		return ""
+	}
+
+	score, reasons := classifyCommand(params.Command)
+	if score < r.Safety.Threshold && r.Safety.Model != nil {
+		if s, err := r.Safety.Model(params.Command); err == nil && s > score {
+			score = s
+			reasons = append(reasons, "model review")
+		}
+	}
+	if score < r.Safety.Threshold {
+		return ""
+	}
+
+	why := strings.Join(reasons, ", ")
+	if r.Confirm == nil || !r.Confirm(fmt.Sprintf("Run %q? risk %d/100 (%s)", params.Command, score, why)) {
+		return fmt.Sprintf("blocked: command needs user approval, risk %d/100 (%s)", score, why)
+	}
+	return ""
+}
+
+// publishQuestion is the confirmation asked before a tool that publishes
+// something (create_pr, github_issue_comment), or "" for other tools.
+func publishQuestion(name string, args json.RawMessage) string {
+	var params struct {
+		Title  string `json:"title"`
+		Number int    `json:"number"`
+		Body   string `json:"body"`
+	}
+	json.Unmarshal(args, &params)
+	switch name {
+	case "create_pr":
+		return fmt.Sprintf("Push this branch and open a pull request %q?", params.Title)
+	case "github_issue_comment":
+		body := strings.TrimSpace(params.Body)
+		if len(body) > 500 {
+			body = strings.ToValidUTF8(body[:500], "") + " ..."
+		}
+		return fmt.Sprintf("Post this comment on issue #%d?\n    %s\n ", params.Number, strings.ReplaceAll(body, "\n", "\n    "))
+	}
+	return ""
+}
+
+const safetyReviewPrompt = `You review shell commands before an automated agent runs them.
+Rate how destructive or irreversible the command is, from 0 (read-only, harmless) to 100 (destroys data or systems).
+
+Command:
+`
+
+// modelSafetyScore asks the provider to rate a command. Used when
+// safety.model_check is on.
+func modelSafetyScore(provider Provider, command string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	var reply struct {
+		Score int `json:"score"`
+	}
+	schema := jsonObject(map[string]any{
+		"score": map[string]any{"type": "integer", "minimum": 0, "maximum": 100},
+	})
+	if _, err := completeJSON(ctx, provider, safetyReviewPrompt+command, schema, &reply); err != nil {
+		return 0, err
+	}
+	return min(max(reply.Score, 0), 100), nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// scratchMaxAge is how long a scratch directory left behind by a crashed run
+// or by serve mode (which has no session end) survives before pruning.
+const scratchMaxAge = 24 * time.Hour
+
+// scratchDir returns the session's scratch directory for temporary files:
+// .simpleagent/<agent>/scratch/<session-id>/.
+func scratchDir(sessionID string) string {
+	return filepath.Join(agentDir, "scratch", sessionID)
+}
+
+// cleanScratch deletes a session's scratch directory when the session ends.
+func cleanScratch(sessionID string) {
+	os.RemoveAll(scratchDir(sessionID))
+}
+
+// pruneScratch removes scratch directories untouched for scratchMaxAge.
+func pruneScratch() {
+	root := filepath.Join(agentDir, "scratch")
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		info, err := e.Info()
+		if err == nil && time.Since(info.ModTime()) > scratchMaxAge {
+			os.RemoveAll(filepath.Join(root, e.Name()))
+		}
+	}
+	os.Remove(root) // only succeeds when empty
+}
+
+// scratchTools only touch their "path" argument, so they can run freely
+// inside the scratch directory.
+var scratchTools = map[string]bool{"write_file": true, "edit_file": true, "patch": true, "delete": true, "make_dir": true, "edit_notebook_cell": true}
+
+// inScratch reports whether tool name targets a path inside r.Scratch.
+// Those calls skip plan-mode blocking, dry-run staging and diffs.
+func (r *ToolRegistry) inScratch(name string, args json.RawMessage) bool {
+	if r.Scratch == "" || !scratchTools[name] {
+		return false
+	}
+	var params struct {
+		Path string `json:"path"`
+	}
+	json.Unmarshal(args, &params)
+	return params.Path != "" && pathWithin(params.Path, r.Scratch)
+}
+
+// pathWithin reports whether path is strictly inside dir. Symlinks in the
+// existing part of path are resolved so a link can't point back out.
+func pathWithin(path, dir string) bool {
+	rel, err := filepath.Rel(resolvePath(dir), resolvePath(path))
+	return err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// resolvePath makes p absolute with symlinks resolved in its longest
+// existing prefix; the rest may not exist yet.
+func resolvePath(p string) string {
+	p, _ = filepath.Abs(p)
+	var rest []string
+	for q := p; ; q = filepath.Dir(q) {
+		if real, err := filepath.EvalSymlinks(q); err == nil {
+			return filepath.Join(append([]string{real}, rest...)...)
+		}
+		if filepath.Dir(q) == q {
+			return p
+		}
+		rest = append([]string{filepath.Base(q)}, rest...)
+	}
+}
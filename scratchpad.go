@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// scratchpadMaxBytes caps the scratchpad so appends can't grow it forever.
+const scratchpadMaxBytes = 256 * 1024
+
+// scratchpadOutline is how many headings (or first lines) of the scratchpad
+// the system prompt shows.
+const scratchpadOutline = 12
+
+// scratchpadPath is the session's scratchpad, the agent's own notes:
+// .simpleagent/<agent>/scratchpad/<session-id>.md. Unlike the scratch
+// directory it is kept when the session ends, so a resumed session has it.
+func scratchpadPath(sessionID string) string {
+	return filepath.Join(agentDir, "scratchpad", sessionID+".md")
+}
+
+// registerScratchpadTools adds scratchpad_write and scratchpad_read for the
+// session sessionID returns. They only touch the scratchpad, so they work in
+// plan mode and a tools allow list doesn't remove them; deny still does.
+func registerScratchpadTools(r *ToolRegistry, sessionID func() string) {
+	r.Register(ToolDef{
+		Name: "scratchpad_write",
+		Description: "Save notes to this conversation's scratchpad: plans, findings, intermediate data to keep across turns. " +
+			"Only an outline of it is in your instructions; read it back with scratchpad_read. Use markdown headings so the outline is useful.",
+		Parameters: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"content": map[string]any{"type": "string", "description": "Text to save"},
+				"mode": map[string]any{
+					"type":        "string",
+					"enum":        []string{"append", "replace"},
+					"description": "append adds to the end (default); replace overwrites the whole scratchpad, empty content clears it",
+				},
+			},
+			"required": []string{"content"},
+		},
+	}, func(args json.RawMessage) (string, error) {
+		var params struct {
+			Content string `json:"content"`
+			Mode    string `json:"mode"`
+		}
+		if err := json.Unmarshal(args, &params); err != nil {
+			return "", err
+		}
+		path := scratchpadPath(sessionID())
+		text := params.Content
+		if params.Mode != "replace" {
+			old, _ := os.ReadFile(path)
+			if len(old) > 0 && !strings.HasSuffix(string(old), "\n") {
+				old = append(old, '\n')
+			}
+			text = string(old) + text
+		}
+		if len(text) > scratchpadMaxBytes {
+			return fmt.Sprintf("error: the scratchpad would be %d bytes, over the %d limit; replace it with a condensed version", len(text), scratchpadMaxBytes), nil
+		}
+		if text == "" {
+			os.Remove(path)
+			return "scratchpad cleared", nil
+		}
+		if !strings.HasSuffix(text, "\n") {
+			text += "\n"
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return "", err
+		}
+		if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("scratchpad: %d lines, %d bytes", lineCount(text), len(text)), nil
+	}, false)
+
+	r.Register(ToolDef{
+		Name:        "scratchpad_read",
+		Description: "Read this conversation's scratchpad (notes saved with scratchpad_write).",
+		Parameters: map[string]any{
+			"type":       "object",
+			"properties": map[string]any{},
+		},
+	}, func(args json.RawMessage) (string, error) {
+		data, err := os.ReadFile(scratchpadPath(sessionID()))
+		if os.IsNotExist(err) || len(data) == 0 {
+			return "(scratchpad is empty)", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}, false)
+}
+
+// writeScratchpad summarizes the session's scratchpad for the system prompt:
+// its size and headings (or first lines), not the text itself.
+func writeScratchpad(sb *promptBuilder, sessionID string) {
+	data, err := os.ReadFile(scratchpadPath(sessionID))
+	if err != nil || len(data) == 0 {
+		return
+	}
+	text := string(data)
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	var outline []string
+	for _, line := range lines {
+		if strings.HasPrefix(line, "#") {
+			outline = append(outline, line)
+		}
+	}
+	if len(outline) == 0 {
+		for _, line := range lines {
+			if strings.TrimSpace(line) != "" {
+				outline = append(outline, line)
+			}
+		}
+	}
+	more := len(outline) - scratchpadOutline
+	if more > 0 {
+		outline = outline[:scratchpadOutline]
+	}
+	sb.WriteString(fmt.Sprintf("Scratchpad (%d lines, %d bytes; call scratchpad_read for the full text before relying on it):\n", len(lines), len(text)))
+	for _, line := range outline {
+		sb.WriteString("  " + truncate(line, 120) + "\n")
+	}
+	if more > 0 {
+		sb.WriteString(fmt.Sprintf("  ... %d more\n", more))
+	}
+	sb.WriteString("\n")
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// Server exposes the agent over a small REST + SSE API.
+//
+//	POST /sessions                 create a session ({"name": "..."} optional)
+//	GET  /sessions                 list sessions
+//	GET  /sessions/{id}            full session transcript
+//	POST /sessions/{id}/messages   send {"content": "..."}, stream SSE events back
+//
+// Turns run in action mode. One turn runs at a time; concurrent requests queue.
+// Every request needs "Authorization: Bearer <token>" (serve_token, or one
+// generated at startup), a Host naming this server and no foreign Origin;
+// POST bodies must be application/json.
+type Server struct {
+	provider  Provider
+	cfg       Config
+	agentFile *AgentFile
+	token     string
+	addr      string // --addr, accepted as a Host besides localhost and IPs
+	mu        sync.Mutex
+}
+
+// serveOptions are the flags of `simpleagent serve`.
+type serveOptions struct {
+	port            int
+	addr            string
+	provider, model string
+	profile         string
+	trace           bool
+}
+
+// serveFlags defines serve's flags into o. Shell completion reads them too.
+func serveFlags(o *serveOptions) *flag.FlagSet {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	fs.IntVar(&o.port, "port", 8080, "Port to listen on")
+	fs.StringVar(&o.addr, "addr", "127.0.0.1", "Address to bind")
+	fs.StringVar(&o.provider, "provider", "", "LLM provider")
+	fs.StringVar(&o.model, "model", "", "Model name")
+	fs.StringVar(&o.profile, "profile", "", "Config profile to use")
+	fs.BoolVar(&o.trace, "trace", false, "Also log raw provider HTTP requests/responses")
+	return fs
+}
+
+// runServe handles `simpleagent serve [file.agent] [--port N] [--addr host]`.
+func runServe(args []string) {
+	var opt serveOptions
+	fs := serveFlags(&opt)
+
+	// Allow the .agent file before or after flags
+	var target string
+	if len(args) > 0 && strings.HasSuffix(args[0], ".agent") {
+		target = args[0]
+		args = args[1:]
+	}
+	fs.Parse(args)
+	if target == "" && fs.NArg() > 0 && strings.HasSuffix(fs.Arg(0), ".agent") {
+		target = fs.Arg(0)
+	}
+
+	traceHTTP = opt.trace
+
+	configProfile = opt.profile
+	cfg := LoadConfig()
+	sessionStorage = cfg.Storage
+	liveTranscript = cfg.Transcript
+
+	var agentFile *AgentFile
+	if target != "" {
+		af, err := ParseAgentFile(target)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading %s: %v\n", target, err)
+			os.Exit(1)
+		}
+		agentFile = af
+		agentFile.ApplyEnv()
+		ResolveAgentDir(filepath.Base(target))
+	} else {
+		ResolveAgentDir("")
+	}
+	pruneScratch()
+	adoptProcesses()
+
+	cfg.ApplyAgentFile(agentFile)
+	if opt.provider != "" {
+		cfg.Provider = opt.provider
+	}
+	if opt.model != "" {
+		pc := cfg.Providers[cfg.Provider]
+		pc.Model = opt.model
+		cfg.Providers[cfg.Provider] = pc
+	}
+
+	if !providerReady(cfg) {
+		fmt.Fprintln(os.Stderr, "Error: no provider configured (run simpleagent --setup first)")
+		os.Exit(1)
+	}
+
+	llm, err := NewProvider(cfg.Provider, cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	token := cfg.ServeToken
+	if token == "" {
+		token = randomHex(32)
+	}
+	s := &Server{provider: llm, cfg: cfg, agentFile: agentFile, token: token, addr: opt.addr}
+
+	// Stop managed processes on Ctrl+C / SIGTERM; keep_alive ones stay up.
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigCh
+		shutdownProcesses()
+		os.Exit(0)
+	}()
+
+	listen := fmt.Sprintf("%s:%d", opt.addr, opt.port)
+	fmt.Printf("simpleagent v%s serving on http://%s\n", version, listen)
+	if cfg.ServeToken == "" {
+		fmt.Printf("Token: %s (set serve_token or SIMPLEAGENT_SERVE_TOKEN to keep one)\n", token)
+	}
+	if err := http.ListenAndServe(listen, s.Handler()); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// Handler returns the HTTP routes for the API.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /sessions", s.handleCreateSession)
+	mux.HandleFunc("GET /sessions", s.handleListSessions)
+	mux.HandleFunc("GET /sessions/{id}", s.handleGetSession)
+	mux.HandleFunc("POST /sessions/{id}/messages", s.handleSendMessage)
+	return s.guard(mux)
+}
+
+// guard refuses requests that don't come from a client of this server. A
+// message runs tools, and any web page can send a simple cross-origin POST
+// to localhost or reach it through DNS rebinding, so the Host must name this
+// server, a browser's Origin must match it, the bearer token must be present,
+// and a body must be declared JSON (which a page can't send without a CORS
+// preflight this server never answers).
+func (s *Server) guard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.allowedHost(r.Host) {
+			writeJSONError(w, http.StatusForbidden, "host not allowed")
+			return
+		}
+		if origin := r.Header.Get("Origin"); origin != "" {
+			if u, err := url.Parse(origin); err != nil || u.Host != r.Host {
+				writeJSONError(w, http.StatusForbidden, "cross-origin requests are not allowed")
+				return
+			}
+		}
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeJSONError(w, http.StatusUnauthorized, "missing or wrong bearer token")
+			return
+		}
+		if r.Method == http.MethodPost && r.ContentLength != 0 {
+			if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt != "application/json" {
+				writeJSONError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allowedHost accepts localhost, IP literals and the --addr name. Any other
+// name may be an attacker's domain rebound to this address.
+func (s *Server) allowedHost(hostport string) bool {
+	host, _, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host = hostport
+	}
+	host = strings.Trim(host, "[]")
+	return strings.EqualFold(host, "localhost") || net.ParseIP(host) != nil || strings.EqualFold(host, s.addr)
+}
+
+func (s *Server) handleCreateSession(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid JSON body")
+			return
+		}
+	}
+
+	session := NewSession(s.provider.Name(), s.cfg.ProviderCfg(s.cfg.Provider).Model)
+	if err := session.Save(); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if req.Name != "" {
+		renameSession(session.ID, req.Name)
+	}
+	writeJSON(w, http.StatusCreated, map[string]string{"id": session.ID})
+}
+
+func (s *Server) handleListSessions(w http.ResponseWriter, r *http.Request) {
+	sessions := sortedSessions()
+	if sessions == nil {
+		sessions = []SessionEntry{}
+	}
+	writeJSON(w, http.StatusOK, SessionIndex{Sessions: sessions})
+}
+
+func (s *Server) handleGetSession(w http.ResponseWriter, r *http.Request) {
+	session, err := loadSessionByIDOrName(r.PathValue("id"))
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, session)
+}
+
+func (s *Server) handleSendMessage(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Content string `json:"content"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Content) == "" {
+		writeJSONError(w, http.StatusBadRequest, `body must be {"content": "..."}`)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSONError(w, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, err := loadSessionByIDOrName(r.PathValue("id"))
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err := lockSession(session.ID, false); err != nil {
+		writeJSONError(w, http.StatusConflict, err.Error())
+		return
+	}
+	defer unlockSession(session.ID)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	agent := NewAgent(s.provider, s.cfg, session, s.agentFile)
+	agent.mode = ModeAction
+	agent.sink = func(ev AgentEvent) {
+		writeSSE(w, ev.Type, ev)
+		flusher.Flush()
+	}
+
+	agent.addUserMessage(req.Content)
+	agent.runAgentLoopCtx(r.Context())
+
+	writeSSE(w, "done", map[string]string{"session_id": session.ID})
+	flusher.Flush()
+}
+
+func writeSSE(w http.ResponseWriter, event string, v any) {
+	data, _ := json.Marshal(v)
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
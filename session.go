@@ -5,7 +5,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -15,14 +17,41 @@ import (
 )
 
 type Session struct {
-	ID         string    `json:"id"`
-	CreatedAt  string    `json:"created_at"`
-	UpdatedAt  string    `json:"updated_at"`
-	Provider   string    `json:"provider"`
-	Model      string    `json:"model"`
-	Messages   []Message `json:"messages"`
-	Summary    string    `json:"summary"`
-	TokensUsed int       `json:"tokens_used"`
+	ID         string      `json:"id"`
+	CreatedAt  string      `json:"created_at"`
+	UpdatedAt  string      `json:"updated_at"`
+	Provider   string      `json:"provider"`
+	Model      string      `json:"model"`
+	Messages   []Message   `json:"messages"`
+	Summary    string      `json:"summary"`
+	TokensUsed int         `json:"tokens_used"`
+	Env        *SessionEnv `json:"env,omitempty"`
+
+	stored    bool // in the store, so Append can log instead of saving
+	recovered int  // messages LoadSession replayed from the log
+}
+
+// SessionEnv is the working state captured at save time, checked on resume.
+type SessionEnv struct {
+	Cwd       string            `json:"cwd"`
+	GitBranch string            `json:"git_branch,omitempty"`
+	Vars      map[string]string `json:"vars,omitempty"`
+	Processes []SavedProcess    `json:"processes,omitempty"`
+}
+
+// SavedProcess is enough of a managed process to start it again.
+type SavedProcess struct {
+	Command string            `json:"command"`
+	Workdir string            `json:"workdir,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+	PTY     bool              `json:"pty,omitempty"`
+}
+
+// sessionEnvVars are environment variables that shape the working state
+// (active virtualenv, cloud profile, ...). Differences are reported on resume.
+var sessionEnvVars = []string{
+	"VIRTUAL_ENV", "CONDA_DEFAULT_ENV", "NODE_ENV", "GOFLAGS",
+	"KUBECONFIG", "KUBE_CONTEXT", "AWS_PROFILE", "AWS_REGION", "DOCKER_HOST",
 }
 
 type SessionIndex struct {
@@ -33,15 +62,20 @@ type SessionEntry struct {
 	ID        string `json:"id"`
 	Name      string `json:"name"`
 	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at,omitempty"`
 	Summary   string `json:"summary"`
 }
 
-func sessionsDir() string {
-	return filepath.Join(agentDir, "sessions")
+// LastActive is when the session was last saved (created time for old index entries).
+func (e SessionEntry) LastActive() string {
+	if e.UpdatedAt != "" {
+		return e.UpdatedAt
+	}
+	return e.CreatedAt
 }
 
-func ensureSessionsDir() {
-	os.MkdirAll(sessionsDir(), 0755)
+func sessionsDir() string {
+	return filepath.Join(agentDir, "sessions")
 }
 
 func NewSession(provider, model string) *Session {
@@ -56,9 +90,11 @@ func NewSession(provider, model string) *Session {
 }
 
 func (s *Session) Save() error {
-	ensureSessionsDir()
-	dir := sessionsDir()
+	if err := checkSessionOwner(s.ID); err != nil {
+		return err
+	}
 	s.UpdatedAt = time.Now().Format(time.RFC3339)
+	s.Env = captureSessionEnv()
 
 	// Generate summary from first user message if empty
 	if s.Summary == "" {
@@ -70,32 +106,39 @@ func (s *Session) Save() error {
 		}
 	}
 
-	data, err := json.MarshalIndent(s, "", "  ")
-	if err != nil {
-		return err
+	if liveTranscript {
+		if err := writeTranscript(s); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: writing transcript: %v\n", err)
+		}
 	}
-
-	path := filepath.Join(dir, s.ID+".json")
-	if err := os.WriteFile(path, data, 0644); err != nil {
+	if err := store().Save(s); err != nil {
 		return err
 	}
-
-	updateSessionIndex(s)
-	os.WriteFile(filepath.Join(dir, "last_session"), []byte(s.ID), 0644)
+	s.stored = true
+	clearWAL(s.ID)
 	return nil
 }
 
+// LoadSession loads a session along with any messages its log holds beyond
+// the last save. The ID must look like one NewSession makes, so a name or a
+// request path can't reach files outside the sessions directory.
 func LoadSession(id string) (*Session, error) {
-	path := filepath.Join(sessionsDir(), id+".json")
-	data, err := os.ReadFile(path)
-	if err != nil {
+	if !validSessionID(id) {
 		return nil, fmt.Errorf("session not found: %s", id)
 	}
-	var s Session
-	if err := json.Unmarshal(data, &s); err != nil {
+	s, err := store().Load(id)
+	if err != nil {
 		return nil, err
 	}
-	return &s, nil
+	s.stored = true
+	s.recovered = replayWAL(s)
+	return s, nil
+}
+
+// validSessionID reports whether id is a UUID in the canonical form.
+func validSessionID(id string) bool {
+	_, err := uuid.Parse(id)
+	return err == nil && len(id) == 36
 }
 
 func loadSessionByIDOrName(idOrName string) (*Session, error) {
@@ -103,8 +146,8 @@ func loadSessionByIDOrName(idOrName string) (*Session, error) {
 		return s, nil
 	}
 
-	idx := loadSessionIndex()
-	for _, e := range idx.Sessions {
+	entries, _ := store().List()
+	for _, e := range entries {
 		if e.Name == idOrName {
 			return LoadSession(e.ID)
 		}
@@ -114,11 +157,10 @@ func loadSessionByIDOrName(idOrName string) (*Session, error) {
 }
 
 func loadLastSession() *Session {
-	data, err := os.ReadFile(filepath.Join(sessionsDir(), "last_session"))
-	if err != nil {
+	id, err := store().LastID()
+	if err != nil || id == "" {
 		return nil
 	}
-	id := strings.TrimSpace(string(data))
 	s, err := LoadSession(id)
 	if err != nil {
 		return nil
@@ -126,95 +168,60 @@ func loadLastSession() *Session {
 	return s
 }
 
-func loadSessionIndex() SessionIndex {
-	var idx SessionIndex
-	data, err := os.ReadFile(filepath.Join(sessionsDir(), "sessions.json"))
-	if err != nil {
-		return idx
-	}
-	json.Unmarshal(data, &idx)
-	return idx
+func renameSession(id, name string) {
+	store().Rename(id, name)
 }
 
-func updateSessionIndex(s *Session) {
-	idx := loadSessionIndex()
-	dir := sessionsDir()
-
-	found := false
-	for i, e := range idx.Sessions {
-		if e.ID == s.ID {
-			idx.Sessions[i].Summary = s.Summary
-			idx.Sessions[i].CreatedAt = s.CreatedAt
-			found = true
-			break
-		}
-	}
-	if !found {
-		idx.Sessions = append(idx.Sessions, SessionEntry{
-			ID:        s.ID,
-			CreatedAt: s.CreatedAt,
-			Summary:   s.Summary,
-		})
-	}
-
-	data, _ := json.MarshalIndent(idx, "", "  ")
-	os.WriteFile(filepath.Join(dir, "sessions.json"), data, 0644)
+// sortedSessions returns the index entries, most recently active first.
+func sortedSessions() []SessionEntry {
+	sessions, _ := store().List()
+	sort.SliceStable(sessions, func(i, j int) bool {
+		return sessionTime(sessions[i].LastActive()).After(sessionTime(sessions[j].LastActive()))
+	})
+	return sessions
 }
 
-func renameSession(id, name string) {
-	idx := loadSessionIndex()
-	dir := sessionsDir()
-	for i, e := range idx.Sessions {
-		if e.ID == id {
-			idx.Sessions[i].Name = name
-			break
+func listAllSessions(asJSON bool) {
+	sessions := sortedSessions()
+
+	if asJSON {
+		if sessions == nil {
+			sessions = []SessionEntry{}
 		}
+		printJSON(sessions)
+		return
 	}
-	data, _ := json.MarshalIndent(idx, "", "  ")
-	os.WriteFile(filepath.Join(dir, "sessions.json"), data, 0644)
-}
 
-func listAllSessions() {
-	idx := loadSessionIndex()
-	if len(idx.Sessions) == 0 {
+	if len(sessions) == 0 {
 		fmt.Println("No sessions found.")
 		return
 	}
 
-	sort.Slice(idx.Sessions, func(i, j int) bool {
-		return idx.Sessions[i].CreatedAt > idx.Sessions[j].CreatedAt
-	})
-
-	for _, e := range idx.Sessions {
+	for _, e := range sessions {
 		name := e.Name
 		if name == "" {
 			name = e.ID[:8]
 		}
-		age := formatAge(e.CreatedAt)
-		fmt.Printf("  %-20s (%s)  %q\n", name, age, e.Summary)
+		fmt.Printf("  %-20s %s (%s)  %q\n", name, formatLocalTime(e.LastActive()), formatAge(e.LastActive()), e.Summary)
 	}
 }
 
 func sessionPicker() *Session {
-	idx := loadSessionIndex()
+	sessions := sortedSessions()
 
 	fmt.Printf("simpleagent v%s\n\n", version)
 
-	if len(idx.Sessions) == 0 {
+	if len(sessions) == 0 {
 		fmt.Println("Starting new session.")
 		fmt.Println()
 		return nil
 	}
 
-	sort.Slice(idx.Sessions, func(i, j int) bool {
-		return idx.Sessions[i].CreatedAt > idx.Sessions[j].CreatedAt
-	})
-
 	limit := 5
-	if len(idx.Sessions) < limit {
-		limit = len(idx.Sessions)
+	if len(sessions) < limit {
+		limit = len(sessions)
 	}
-	recent := idx.Sessions[:limit]
+	recent := sessions[:limit]
 
 	fmt.Println("Recent sessions:")
 	for i, e := range recent {
@@ -222,12 +229,11 @@ func sessionPicker() *Session {
 		if name == "" {
 			name = e.ID[:8]
 		}
-		age := formatAge(e.CreatedAt)
 		summary := e.Summary
 		if summary == "" {
 			summary = "(empty)"
 		}
-		fmt.Printf("  %d. %-20s (%s)  %q\n", i+1, name, age, summary)
+		fmt.Printf("  %d. %-20s %s (%s)  %q\n", i+1, name, formatLocalTime(e.LastActive()), formatAge(e.LastActive()), summary)
 	}
 	fmt.Printf("  0. New Session\n\n")
 
@@ -256,6 +262,113 @@ func sessionPicker() *Session {
 	return s
 }
 
+func captureSessionEnv() *SessionEnv {
+	cwd, _ := os.Getwd()
+	env := &SessionEnv{
+		Cwd:       cwd,
+		GitBranch: gitBranch(),
+		Processes: runningProcesses(),
+	}
+	for _, k := range sessionEnvVars {
+		if v := os.Getenv(k); v != "" {
+			if env.Vars == nil {
+				env.Vars = make(map[string]string)
+			}
+			env.Vars[k] = v
+		}
+	}
+	return env
+}
+
+// gitBranch returns the current git branch, or "" outside a repo.
+func gitBranch() string {
+	out, err := exec.Command("git", "rev-parse", "--abbrev-ref", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// restoreSessionEnv compares a resumed session's saved environment with the
+// current one, warns about drift, and offers to restart its background processes.
+func restoreSessionEnv(s *Session, interactive bool) {
+	if s.Env == nil {
+		return
+	}
+	saved := s.Env
+	now := captureSessionEnv()
+
+	warn := func(format string, args ...any) {
+		fmt.Printf("\033[33m⚠ "+format+"\033[0m\n", args...)
+	}
+	if saved.Cwd != "" && saved.Cwd != now.Cwd {
+		warn("session was saved in %s (now in %s)", saved.Cwd, now.Cwd)
+	}
+	if saved.GitBranch != "" && saved.GitBranch != now.GitBranch {
+		warn("git branch changed: %s → %s", saved.GitBranch, orNone(now.GitBranch))
+	}
+	for _, k := range sessionEnvVars {
+		if saved.Vars[k] != now.Vars[k] {
+			warn("%s changed: %s → %s", k, orNone(saved.Vars[k]), orNone(now.Vars[k]))
+		}
+	}
+
+	// Processes adopted at startup are still running; don't offer them.
+	var stopped []SavedProcess
+	for _, p := range saved.Processes {
+		if !slices.ContainsFunc(now.Processes, func(r SavedProcess) bool { return r.Command == p.Command && r.Workdir == p.Workdir }) {
+			stopped = append(stopped, p)
+		}
+	}
+	if len(stopped) == 0 {
+		return
+	}
+	fmt.Printf("Previous run had %d background process(es):\n", len(stopped))
+	for _, p := range stopped {
+		fmt.Printf("  %s\n", p.Command)
+	}
+	if !interactive {
+		return
+	}
+	fmt.Print("Restart them? [y/N]: ")
+	scanner := bufio.NewScanner(os.Stdin)
+	if !scanner.Scan() || !strings.EqualFold(strings.TrimSpace(scanner.Text()), "y") {
+		return
+	}
+	for _, p := range stopped {
+		args, _ := json.Marshal(map[string]any{"command": p.Command, "workdir": p.Workdir, "env": p.Env, "pty": p.PTY})
+		result, _ := toolStartProcess(args)
+		fmt.Println("  " + result)
+	}
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "(none)"
+	}
+	return s
+}
+
+// sessionTime parses an RFC3339 timestamp; zero time if malformed.
+func sessionTime(rfc3339 string) time.Time {
+	t, _ := time.Parse(time.RFC3339, rfc3339)
+	return t
+}
+
+// formatLocalTime renders an RFC3339 timestamp in the local timezone.
+// Dates within the current year drop the year to keep listings narrow.
+func formatLocalTime(rfc3339 string) string {
+	t, err := time.Parse(time.RFC3339, rfc3339)
+	if err != nil {
+		return "?"
+	}
+	t = t.Local()
+	if t.Year() == time.Now().Year() {
+		return t.Format("Jan _2 15:04")
+	}
+	return t.Format("2006-01-02 15:04")
+}
+
 func formatAge(rfc3339 string) string {
 	t, err := time.Parse(time.RFC3339, rfc3339)
 	if err != nil {
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Session locks are advisory file locks (flock, LockFileEx) on
+// sessions/<id>.lock, which also holds the owner's PID: a second simpleagent
+// resuming the session fails instead of both rewriting the same file. The OS
+// drops the lock when its process dies, so there is no stale lock to break;
+// --force replaces the file to take over a live one (not on Windows, where a
+// file open in another process can't be removed).
+
+// errSessionLocked is returned when another live process holds a session.
+type errSessionLocked struct {
+	id  string
+	pid int
+}
+
+func (e errSessionLocked) Error() string {
+	if !canReplaceLockedFile {
+		return fmt.Sprintf("session %s is in use by PID %d", e.id, e.pid)
+	}
+	return fmt.Sprintf("session %s is in use by PID %d (--force to take it over)", e.id, e.pid)
+}
+
+// errLockHeld is tryLockFile's answer when another process has the lock.
+var errLockHeld = errors.New("lock held by another process")
+
+var (
+	lockMu    sync.Mutex
+	heldLocks = map[string]*os.File{} // session IDs this process locked, with the locked file
+	takenOver = map[string]bool{}     // sessions another process took with --force; warned once
+)
+
+func sessionLockPath(id string) string {
+	return filepath.Join(sessionsDir(), id+".lock")
+}
+
+// lockPID reads the PID in a lock file, 0 when missing or unreadable.
+func lockPID(path string) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+	return pid
+}
+
+// acquireLock opens path, locks it without waiting and writes our PID into
+// it. The file may be removed or replaced between the open and the lock (a
+// release, --force), so the lock only counts once path still names the
+// locked file; otherwise it tries again on the new one.
+func acquireLock(path string) (*os.File, error) {
+	for {
+		f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, err
+		}
+		if err := tryLockFile(f); err != nil {
+			f.Close()
+			return nil, err
+		}
+		if isLockFile(f, path) {
+			f.Truncate(0)
+			f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+			return f, nil
+		}
+		f.Close()
+	}
+}
+
+// isLockFile reports whether path still names the open file f.
+func isLockFile(f *os.File, path string) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	pi, err := os.Stat(path)
+	return err == nil && os.SameFile(fi, pi)
+}
+
+// releaseLock removes path if it is still f, then drops the lock. Removing
+// first means a process that opened the old file fails isLockFile.
+func releaseLock(f *os.File, path string) {
+	if isLockFile(f, path) {
+		os.Remove(path)
+	}
+	f.Close()
+}
+
+// lockSession marks the session as open in this process. A lock held by a
+// live process is an errSessionLocked unless force is set.
+func lockSession(id string, force bool) error {
+	lockMu.Lock()
+	defer lockMu.Unlock()
+	if heldLocks[id] != nil {
+		return nil
+	}
+	path := sessionLockPath(id)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := acquireLock(path)
+	if errors.Is(err, errLockHeld) && force {
+		if !canReplaceLockedFile {
+			return fmt.Errorf("session %s is in use by PID %d, and --force can't take over a live session on this system; exit that simpleagent first", id, lockPID(path))
+		}
+		// The holder keeps its lock on the removed file, sees our PID in
+		// the new one (checkSessionOwner) and stops saving.
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("could not take over session %s: %w", id, err)
+		}
+		f, err = acquireLock(path)
+	}
+	if errors.Is(err, errLockHeld) {
+		return errSessionLocked{id, lockPID(path)}
+	}
+	if err != nil {
+		return fmt.Errorf("could not lock session %s: %w", id, err)
+	}
+	heldLocks[id] = f
+	delete(takenOver, id)
+	return nil
+}
+
+// unlockSession releases the session if this process still holds it.
+func unlockSession(id string) {
+	lockMu.Lock()
+	defer lockMu.Unlock()
+	f := heldLocks[id]
+	if f == nil {
+		return
+	}
+	delete(heldLocks, id)
+	releaseLock(f, sessionLockPath(id))
+}
+
+// unlockSessions releases every session lock this process holds, at exit.
+func unlockSessions() {
+	lockMu.Lock()
+	ids := make([]string, 0, len(heldLocks))
+	for id := range heldLocks {
+		ids = append(ids, id)
+	}
+	lockMu.Unlock()
+	for _, id := range ids {
+		unlockSession(id)
+	}
+}
+
+// checkSessionOwner stops a save once another process has taken the session
+// over with --force, so the two don't overwrite each other's turns.
+func checkSessionOwner(id string) error {
+	lockMu.Lock()
+	defer lockMu.Unlock()
+	if heldLocks[id] == nil {
+		return nil
+	}
+	pid := lockPID(sessionLockPath(id))
+	if pid == 0 || pid == os.Getpid() {
+		return nil
+	}
+	if !takenOver[id] {
+		takenOver[id] = true
+		fmt.Fprintf(os.Stderr, "Warning: session %s was taken over by PID %d; this process no longer saves it (/new to start another)\n", id, pid)
+	}
+	return errSessionLocked{id, pid}
+}
+
+const indexLockWait = 5 * time.Second
+
+// withFileLock runs fn while holding the lock on path (a lock file next to
+// the file being updated), waiting for other processes' read-modify-write
+// to finish. A dead holder's lock is already gone, so nothing is broken.
+func withFileLock(path string, fn func() error) error {
+	deadline := time.Now().Add(indexLockWait)
+	for {
+		f, err := acquireLock(path)
+		if err == nil {
+			defer releaseLock(f, path)
+			break
+		}
+		if !errors.Is(err, errLockHeld) {
+			return err
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%s is locked by PID %d", filepath.Base(strings.TrimSuffix(path, ".lock")), lockPID(path))
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return fn()
+}
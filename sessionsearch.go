@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const historyUsage = `Usage:
+  /history search <terms> [--json]   Find past sessions with a message containing all terms`
+
+// handleHistoryCommand runs /history and its subcommands.
+func handleHistoryCommand(arg string) {
+	sub, rest, _ := strings.Cut(arg, " ")
+	rest = strings.TrimSpace(rest)
+	asJSON := false
+	if q, ok := strings.CutSuffix(rest, "--json"); ok {
+		rest, asJSON = strings.TrimSpace(q), true
+	}
+	if sub != "search" || rest == "" {
+		fmt.Println(historyUsage)
+		return
+	}
+	printSearchHits(rest, searchSessions(rest), asJSON)
+}
+
+// SearchHit is one matching message (or session title) in the history.
+type SearchHit struct {
+	Session SessionEntry `json:"session"`
+	Message int          `json:"message"` // index in the transcript; -1 for a title match
+	Role    string       `json:"role"`
+	Snippet string       `json:"snippet"`
+}
+
+const (
+	maxSearchHits       = 50
+	maxHitsPerSession   = 3
+	searchSnippetRadius = 70
+)
+
+// sessionSearcher is implemented by stores that can narrow a search to
+// candidate session IDs without loading every transcript (sqlite).
+type sessionSearcher interface {
+	searchCandidates(terms []string) (map[string]bool, error)
+}
+
+// searchSessions finds messages containing every term of query (case-
+// insensitive), newest sessions first.
+func searchSessions(query string) []SearchHit {
+	terms := strings.Fields(strings.ToLower(query))
+	if len(terms) == 0 {
+		return nil
+	}
+	var candidates map[string]bool
+	if s, ok := store().(sessionSearcher); ok {
+		candidates, _ = s.searchCandidates(terms)
+	}
+
+	var hits []SearchHit
+	for _, e := range sortedSessions() {
+		if len(hits) >= maxSearchHits {
+			break
+		}
+		title := e.Name + " " + e.Summary
+		if candidates != nil && !candidates[e.ID] && !containsAll(strings.ToLower(title), terms) {
+			continue
+		}
+		n := 0
+		if containsAll(strings.ToLower(title), terms) {
+			hits = append(hits, SearchHit{Session: e, Message: -1, Role: "title", Snippet: e.Summary})
+			n++
+		}
+		s, err := LoadSession(e.ID)
+		if err != nil {
+			continue
+		}
+		for i, m := range s.Messages {
+			if n >= maxHitsPerSession || len(hits) >= maxSearchHits {
+				break
+			}
+			lower := strings.ToLower(m.Content)
+			if m.Content == "" || !containsAll(lower, terms) {
+				continue
+			}
+			hits = append(hits, SearchHit{Session: e, Message: i, Role: m.Role, Snippet: snippet(m.Content, lower, terms[0])})
+			n++
+		}
+	}
+	return hits
+}
+
+func containsAll(s string, terms []string) bool {
+	for _, t := range terms {
+		if !strings.Contains(s, t) {
+			return false
+		}
+	}
+	return true
+}
+
+// snippet cuts text around the first occurrence of term, on one line.
+func snippet(text, lower, term string) string {
+	i := strings.Index(lower, term)
+	if i < 0 || len(lower) != len(text) { // ToLower changed byte offsets
+		i = 0
+	}
+	start, end := max(0, i-searchSnippetRadius), min(len(text), i+len(term)+searchSnippetRadius)
+	// Don't split a UTF-8 sequence
+	for start > 0 && text[start]&0xC0 == 0x80 {
+		start--
+	}
+	for end < len(text) && text[end]&0xC0 == 0x80 {
+		end++
+	}
+	s := strings.Join(strings.Fields(text[start:end]), " ")
+	if start > 0 {
+		s = "…" + s
+	}
+	if end < len(text) {
+		s += "…"
+	}
+	return s
+}
+
+// printSearchHits prints hits grouped by session, terms highlighted.
+func printSearchHits(query string, hits []SearchHit, asJSON bool) {
+	if asJSON {
+		if hits == nil {
+			hits = []SearchHit{}
+		}
+		printJSON(hits)
+		return
+	}
+	if len(hits) == 0 {
+		fmt.Printf("No sessions match %q.\n", query)
+		return
+	}
+	terms := strings.Fields(strings.ToLower(query))
+	last := ""
+	for _, h := range hits {
+		if h.Session.ID != last {
+			last = h.Session.ID
+			name := h.Session.Name
+			if name == "" {
+				name = h.Session.ID[:8]
+			}
+			fmt.Printf("\n%s  %s (%s)  %q\n", name, formatLocalTime(h.Session.LastActive()), formatAge(h.Session.LastActive()), h.Session.Summary)
+		}
+		if h.Message < 0 {
+			continue
+		}
+		fmt.Printf("  #%-4d %-9s %s\n", h.Message, h.Role, highlightTerms(h.Snippet, terms))
+	}
+	if len(hits) >= maxSearchHits {
+		fmt.Printf("\n(first %d matches; narrow the query for more)\n", maxSearchHits)
+	}
+	fmt.Println("\nResume with: simpleagent --session <name or id>")
+}
+
+// highlightTerms bolds each occurrence of terms (case-insensitive).
+func highlightTerms(s string, terms []string) string {
+	if plainOutput {
+		return s
+	}
+	lower := strings.ToLower(s)
+	if len(lower) != len(s) {
+		return s
+	}
+	marks := make([]bool, len(s))
+	for _, t := range terms {
+		for i := 0; ; {
+			j := strings.Index(lower[i:], t)
+			if j < 0 {
+				break
+			}
+			for k := i + j; k < i+j+len(t); k++ {
+				marks[k] = true
+			}
+			i += j + len(t)
+		}
+	}
+	var sb strings.Builder
+	on := false
+	for i := 0; i < len(s); i++ {
+		if marks[i] != on {
+			on = marks[i]
+			if on {
+				sb.WriteString("\033[1;33m")
+			} else {
+				sb.WriteString("\033[0m")
+			}
+		}
+		sb.WriteByte(s[i])
+	}
+	if on {
+		sb.WriteString("\033[0m")
+	}
+	return sb.String()
+}
@@ -117,9 +117,20 @@ func runSetupWizard(cfg *Config) bool {
 
 	// Save — only write provider + active provider entry (minimal config)
 	cfg.Providers[selected.name] = pc
+	savePC := pc
+	if selected.needKey {
+		if store := keychain(); store != nil {
+			if err := store.Set(selected.name, pc.APIKey); err == nil {
+				fmt.Printf("\n  Key stored in %s\n", store.Name())
+				savePC.APIKey = ""
+			} else {
+				fmt.Fprintf(os.Stderr, "\n  Couldn't use %s (%v); saving key to config\n", store.Name(), err)
+			}
+		}
+	}
 	saveCfg := Config{
 		Provider:  selected.name,
-		Providers: map[string]ProviderConfig{selected.name: pc},
+		Providers: map[string]ProviderConfig{selected.name: savePC},
 	}
 	path := UserConfigPath()
 	if err := SaveConfig(path, saveCfg); err != nil {
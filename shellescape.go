@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// shellEscape runs a !command typed at the prompt in the user's terminal,
+// without the model, then offers to hand its output to the model with the
+// next message.
+func (a *Agent) shellEscape(command string) {
+	if command == "" {
+		fmt.Println("Usage: !<command> runs it here without the model, e.g. !git status")
+		return
+	}
+	cmd := exec.Command("sh", "-c", command)
+	var out bytes.Buffer
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = io.MultiWriter(os.Stdout, &out)
+	cmd.Stderr = io.MultiWriter(os.Stderr, &out)
+	err := cmd.Run()
+	status := ""
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		status = fmt.Sprintf(" (exit %d)", exitErr.ExitCode())
+		fmt.Printf("\033[2m[exit: %d]\033[0m\n", exitErr.ExitCode())
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return
+	}
+	if out.Len() == 0 && status == "" {
+		return
+	}
+	if !a.confirm("Add the output to the conversation?") {
+		return
+	}
+	const maxOutput = 50000
+	text := strings.TrimRight(out.String(), "\n")
+	if len(text) > maxOutput {
+		text = text[:maxOutput] + "\n... [truncated]"
+	}
+	a.shellOut = append(a.shellOut, fmt.Sprintf("I ran `%s`%s:\n```\n%s\n```", command, status, ansiEscape.ReplaceAllString(text, "")))
+	fmt.Println("\033[2m(added; it goes to the model with your next message)\033[0m")
+}
+
+// withShellOutput puts output kept from !commands ahead of the next message.
+func (a *Agent) withShellOutput(input string) string {
+	if len(a.shellOut) == 0 {
+		return input
+	}
+	input = strings.Join(a.shellOut, "\n\n") + "\n\n" + input
+	a.shellOut = nil
+	return input
+}
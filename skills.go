@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Skill is a "# skill: Name" section of an .agent file. Only its name and
+// description go into the system prompt; load_skill returns the full text.
+type Skill struct {
+	Name        string
+	Description string // first line of the section
+	Text        string
+}
+
+var skillHeading = regexp.MustCompile(`(?i)^#\s*skill:\s*(.+?)\s*$`)
+
+// splitSkills separates skill sections from an .agent body. A skill runs
+// until the next level-1 heading; headings inside code fences don't count.
+func splitSkills(body string) (prompt string, skills []Skill) {
+	var base []string
+	var cur *Skill
+	var text []string
+	fenced := false
+	flush := func() {
+		if cur != nil {
+			cur.Text = strings.TrimSpace(strings.Join(text, "\n"))
+			for _, line := range strings.Split(cur.Text, "\n") {
+				if line = strings.TrimSpace(line); line != "" {
+					cur.Description = truncate(strings.TrimLeft(line, "#-* "), 120)
+					break
+				}
+			}
+			skills = append(skills, *cur)
+		}
+		cur, text = nil, nil
+	}
+
+	for _, line := range strings.Split(body, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			fenced = !fenced
+		}
+		if !fenced {
+			if m := skillHeading.FindStringSubmatch(line); m != nil {
+				flush()
+				cur = &Skill{Name: m[1]}
+				continue
+			}
+			if cur != nil && strings.HasPrefix(line, "# ") {
+				flush()
+			}
+		}
+		if cur != nil {
+			text = append(text, line)
+		} else {
+			base = append(base, line)
+		}
+	}
+	flush()
+	return strings.TrimSpace(strings.Join(base, "\n")), skills
+}
+
+// findSkill looks a skill up by name, ignoring case.
+func findSkill(skills []Skill, name string) *Skill {
+	for i := range skills {
+		if strings.EqualFold(skills[i].Name, strings.TrimSpace(name)) {
+			return &skills[i]
+		}
+	}
+	return nil
+}
+
+// registerSkillTool adds load_skill when the agent file has skills. It only
+// reads the agent's own file, so a tools allow list doesn't remove it; deny
+// still does.
+func registerSkillTool(r *ToolRegistry, skills []Skill) {
+	if len(skills) == 0 {
+		return
+	}
+	var names []string
+	for _, s := range skills {
+		names = append(names, s.Name)
+	}
+	r.Register(ToolDef{
+		Name:        "load_skill",
+		Description: "Load the full instructions of one of this agent's skills. Call it before starting a task a skill covers.",
+		Parameters: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"name": map[string]any{"type": "string", "description": "Skill name: " + strings.Join(names, ", ")},
+			},
+			"required": []string{"name"},
+		},
+	}, func(args json.RawMessage) (string, error) {
+		var params struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(args, &params); err != nil {
+			return "", err
+		}
+		s := findSkill(skills, params.Name)
+		if s == nil {
+			return fmt.Sprintf("error: no skill named %q (have: %s)", params.Name, strings.Join(names, ", ")), nil
+		}
+		return "# Skill: " + s.Name + "\n\n" + s.Text, nil
+	}, false)
+}
+
+// writeSkills lists the agent's skills for the system prompt.
+func writeSkills(sb *promptBuilder, skills []Skill) {
+	if len(skills) == 0 {
+		return
+	}
+	sb.WriteString("Skills (call load_skill with the name to get the full instructions before doing a task one covers):\n")
+	for _, s := range skills {
+		sb.WriteString("  - " + s.Name)
+		if s.Description != "" {
+			sb.WriteString(": " + s.Description)
+		}
+		sb.WriteString("\n")
+	}
+	sb.WriteString("\n")
+}
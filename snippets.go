@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Snippets are reusable instructions kept one per file in
+// ~/.simpleagent/snippets/<name>.md, shared by every agent and project.
+// /snippet use sends one as a message; @name in any message is replaced by
+// the snippet's text.
+
+var snippetName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+func snippetsDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".simpleagent", "snippets")
+}
+
+func snippetPath(name string) string {
+	return filepath.Join(snippetsDir(), name+".md")
+}
+
+// readSnippet returns the named snippet's text, false if there is none.
+func readSnippet(name string) (string, bool) {
+	if !snippetName.MatchString(name) || snippetsDir() == "" {
+		return "", false
+	}
+	data, err := os.ReadFile(snippetPath(name))
+	if err != nil {
+		return "", false
+	}
+	return strings.TrimSpace(string(data)), true
+}
+
+// listSnippets returns the saved snippet names, sorted.
+func listSnippets() []string {
+	files, _ := filepath.Glob(filepath.Join(snippetsDir(), "*.md"))
+	var names []string
+	for _, f := range files {
+		if name := strings.TrimSuffix(filepath.Base(f), ".md"); snippetName.MatchString(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// expandSnippets replaces each @name that names a saved snippet with its
+// text. Other @words (emails, decorators, handles) are left alone.
+func expandSnippets(input string) string {
+	if !strings.Contains(input, "@") {
+		return input
+	}
+	var used []string
+	out := replaceMentions(input, func(ref string) (string, bool) {
+		text, ok := readSnippet(ref)
+		if ok {
+			used = append(used, "@"+ref)
+		}
+		return text, ok
+	})
+	if len(used) > 0 && !plainOutput {
+		fmt.Printf("\033[2m(expanded %s)\033[0m\n", strings.Join(used, ", "))
+	}
+	return out
+}
+
+const snippetUsage = `Usage:
+  /snippet list                 List saved snippets
+  /snippet save <name> [text]   Save text (or your last message, edited in $EDITOR) as a snippet
+  /snippet use <name> [text]    Send the snippet, followed by text
+  /snippet show <name>          Print a snippet
+  /snippet edit <name>          Open a snippet in $EDITOR
+  /snippet delete <name>        Remove a snippet
+Write @name in any message to insert a snippet's text.`
+
+// snippetCommand runs /snippet and its subcommands. It returns the message
+// to send for /snippet use, or "".
+func (a *Agent) snippetCommand(arg string) string {
+	sub, rest, _ := strings.Cut(arg, " ")
+	name, text, _ := strings.Cut(strings.TrimSpace(rest), " ")
+	text = strings.TrimSpace(text)
+	if sub != "" && sub != "list" && !snippetName.MatchString(name) {
+		if name == "" {
+			fmt.Println(snippetUsage)
+		} else {
+			fmt.Printf("Invalid snippet name %q: use letters, digits, - and _.\n", name)
+		}
+		return ""
+	}
+
+	switch sub {
+	case "", "list":
+		names := listSnippets()
+		if len(names) == 0 {
+			fmt.Println("No snippets. Save one with /snippet save <name> <text>.")
+			return ""
+		}
+		for _, n := range names {
+			text, _ := readSnippet(n)
+			fmt.Printf("  @%-16s \033[2m%s\033[0m\n", n, truncate(text, 60))
+		}
+	case "save":
+		if text == "" {
+			edited, err := openInEditor(a.lastUserMessage(), ".md")
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				return ""
+			}
+			text = strings.TrimSpace(edited)
+		}
+		if text == "" {
+			fmt.Println("Nothing to save.")
+			return ""
+		}
+		if err := saveSnippet(name, text); err != nil {
+			fmt.Fprintf(os.Stderr, "Error saving snippet: %v\n", err)
+			return ""
+		}
+		fmt.Printf("Saved @%s.\n", name)
+	case "use":
+		body, ok := readSnippet(name)
+		if !ok {
+			fmt.Printf("No snippet named %q (/snippet list).\n", name)
+			return ""
+		}
+		if text != "" {
+			body += "\n\n" + expandSnippets(text)
+		}
+		return body
+	case "show":
+		body, ok := readSnippet(name)
+		if !ok {
+			fmt.Printf("No snippet named %q (/snippet list).\n", name)
+			return ""
+		}
+		fmt.Println(body)
+	case "edit":
+		old, _ := readSnippet(name)
+		edited, err := openInEditor(old, ".md")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return ""
+		}
+		if edited = strings.TrimSpace(edited); edited == old {
+			fmt.Println("No changes.")
+			return ""
+		}
+		if edited == "" {
+			fmt.Println("Empty snippet not saved (/snippet delete removes it).")
+			return ""
+		}
+		if err := saveSnippet(name, edited); err != nil {
+			fmt.Fprintf(os.Stderr, "Error saving snippet: %v\n", err)
+			return ""
+		}
+		fmt.Printf("Saved @%s.\n", name)
+	case "delete", "rm":
+		if err := os.Remove(snippetPath(name)); err != nil {
+			fmt.Printf("No snippet named %q (/snippet list).\n", name)
+			return ""
+		}
+		fmt.Printf("Deleted @%s.\n", name)
+	default:
+		fmt.Println(snippetUsage)
+	}
+	return ""
+}
+
+func saveSnippet(name, text string) error {
+	if snippetsDir() == "" {
+		return fmt.Errorf("no home directory")
+	}
+	if err := os.MkdirAll(snippetsDir(), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(snippetPath(name), []byte(text+"\n"), 0644)
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// usageStats aggregates the usage ledger (every project, every agent) and
+// this project's turn logs over the last Days days.
+type usageStats struct {
+	Since    string     `json:"since"`
+	Days     int        `json:"days"`
+	Total    statRow    `json:"total"`
+	ByDay    []statRow  `json:"by_day"`
+	ByModel  []statRow  `json:"by_model"`
+	Projects []statRow  `json:"projects"`
+	Tools    []toolStat `json:"tools"`
+	Turns    turnStat   `json:"turns"`
+}
+
+// statRow is LLM usage for one day, provider/model or project.
+type statRow struct {
+	Key      string  `json:"key,omitempty"`
+	Calls    int     `json:"calls"`
+	Input    int     `json:"input_tokens"`
+	Output   int     `json:"output_tokens"`
+	Cached   int     `json:"cache_tokens,omitempty"`
+	CostUSD  float64 `json:"cost_usd"`
+	Unpriced int     `json:"unpriced_calls,omitempty"` // calls to models with no known price
+}
+
+func (r *statRow) add(rec usageRecord) {
+	r.Calls++
+	r.Input += rec.Input
+	r.Output += rec.Output
+	r.Cached += rec.CacheRead + rec.CacheWrite
+	r.CostUSD += rec.CostUSD
+	if rec.Unpriced {
+		r.Unpriced++
+	}
+}
+
+func (r statRow) tokens() int { return r.Input + r.Output + r.Cached }
+
+// toolStat is one tool's calls in this project's logs.
+type toolStat struct {
+	Name   string `json:"name"`
+	Calls  int    `json:"calls"`
+	Errors int    `json:"errors"` // any status but ok
+	AvgMS  int64  `json:"avg_ms"`
+}
+
+// turnStat covers user turns (a message until the final answer) and the
+// model calls within them.
+type turnStat struct {
+	Turns    int     `json:"turns"`
+	AvgMS    int64   `json:"avg_ms"`
+	AvgCalls float64 `json:"avg_llm_calls"`
+	LLMCalls int     `json:"llm_calls"`
+	LLMAvgMS int64   `json:"llm_avg_ms"`
+	Errors   int     `json:"llm_errors"`
+}
+
+// runStats handles `simpleagent stats` and /stats.
+func runStats(args []string) {
+	fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+	days := fs.Int("days", 30, "Days to cover, counting today")
+	asJSON := fs.Bool("json", false, "Print the statistics as JSON")
+	if err := fs.Parse(args); err != nil {
+		return
+	}
+	if *days < 1 {
+		*days = 1
+	}
+	now := time.Now()
+	since := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local).AddDate(0, 0, 1-*days)
+	st := collectStats(since, *days)
+	if *asJSON {
+		printJSON(st)
+		return
+	}
+	renderStats(st)
+}
+
+func collectStats(since time.Time, days int) usageStats {
+	st := usageStats{Since: since.Format("2006-01-02"), Days: days}
+	byDay := map[string]*statRow{}
+	byModel := map[string]*statRow{}
+	byProject := map[string]*statRow{}
+	row := func(m map[string]*statRow, key string) *statRow {
+		if m[key] == nil {
+			m[key] = &statRow{Key: key}
+		}
+		return m[key]
+	}
+	for _, rec := range readUsage(since) {
+		st.Total.add(rec)
+		row(byDay, rec.Time.Local().Format("2006-01-02")).add(rec)
+		row(byModel, rec.Provider+"/"+rec.Model).add(rec)
+		project := "(not recorded)"
+		if rec.Project != "" {
+			project = tildePath(rec.Project)
+		}
+		row(byProject, project).add(rec)
+	}
+	st.ByDay = sortedRows(byDay, func(a, b statRow) bool { return a.Key < b.Key })
+	st.ByModel = sortedRows(byModel, func(a, b statRow) bool { return a.tokens() > b.tokens() })
+	st.Projects = sortedRows(byProject, func(a, b statRow) bool { return a.tokens() > b.tokens() })
+	st.Tools, st.Turns = readLogStats(since)
+	return st
+}
+
+func sortedRows(m map[string]*statRow, less func(a, b statRow) bool) []statRow {
+	rows := make([]statRow, 0, len(m))
+	for _, r := range m {
+		rows = append(rows, *r)
+	}
+	sort.Slice(rows, func(i, j int) bool { return less(rows[i], rows[j]) })
+	return rows
+}
+
+// readLogStats reads tool, llm and turn records from every agent's logs in
+// this project (.simpleagent/*/logs/), from since onwards.
+func readLogStats(since time.Time) ([]toolStat, turnStat) {
+	files, _ := filepath.Glob(filepath.Join(".simpleagent", "*", "logs", "*.jsonl"))
+	tools := map[string]*toolStat{}
+	var toolMS = map[string]int64{}
+	var ts turnStat
+	var turnMS, llmMS int64
+	var turnCalls int
+	for _, path := range files {
+		day, err := time.ParseInLocation("2006-01-02", strings.TrimSuffix(filepath.Base(path), ".jsonl"), time.Local)
+		if err != nil || day.Before(since.AddDate(0, 0, -1)) {
+			continue
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+		for scanner.Scan() {
+			var rec struct {
+				Time       time.Time `json:"time"`
+				Type       string    `json:"type"`
+				Name       string    `json:"name"`
+				Status     string    `json:"status"`
+				Error      string    `json:"error"`
+				DurationMS int64     `json:"duration_ms"`
+				LLMCalls   int       `json:"llm_calls"`
+			}
+			if json.Unmarshal(scanner.Bytes(), &rec) != nil || rec.Time.Before(since) {
+				continue
+			}
+			switch rec.Type {
+			case "tool":
+				t := tools[rec.Name]
+				if t == nil {
+					t = &toolStat{Name: rec.Name}
+					tools[rec.Name] = t
+				}
+				t.Calls++
+				if rec.Status != "ok" {
+					t.Errors++
+				}
+				toolMS[rec.Name] += rec.DurationMS
+			case "llm":
+				ts.LLMCalls++
+				llmMS += rec.DurationMS
+				if rec.Error != "" {
+					ts.Errors++
+				}
+			case "turn":
+				ts.Turns++
+				turnMS += rec.DurationMS
+				turnCalls += rec.LLMCalls
+			}
+		}
+		f.Close()
+	}
+	list := make([]toolStat, 0, len(tools))
+	for name, t := range tools {
+		t.AvgMS = toolMS[name] / int64(t.Calls)
+		list = append(list, *t)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Calls != list[j].Calls {
+			return list[i].Calls > list[j].Calls
+		}
+		return list[i].Name < list[j].Name
+	})
+	if ts.Turns > 0 {
+		ts.AvgMS = turnMS / int64(ts.Turns)
+		ts.AvgCalls = float64(turnCalls) / float64(ts.Turns)
+	}
+	if ts.LLMCalls > 0 {
+		ts.LLMAvgMS = llmMS / int64(ts.LLMCalls)
+	}
+	return list, ts
+}
+
+func renderStats(st usageStats) {
+	fmt.Printf("Usage since %s (%d day(s), all projects): %s tokens, %s, %d model call(s)\n",
+		st.Since, st.Days, statTokens(st.Total.tokens()), statCost(st.Total), st.Total.Calls)
+	if st.Total.Calls == 0 {
+		fmt.Println("  No model calls recorded in ~/.simpleagent/usage/.")
+	}
+	printRows := func(title string, rows []statRow, limit int) {
+		if len(rows) == 0 {
+			return
+		}
+		fmt.Printf("\n%s:\n", title)
+		width := 0
+		for _, r := range rows {
+			width = max(width, len(r.Key))
+		}
+		for i, r := range rows {
+			if limit > 0 && i == limit {
+				fmt.Printf("  ... and %d more\n", len(rows)-i)
+				break
+			}
+			fmt.Printf("  %-*s  %8s tokens  %9s  %5d call(s)  %s\n",
+				width, r.Key, statTokens(r.tokens()), statCost(r), r.Calls, statDim(statTokens(r.Input)+" in / "+statTokens(r.Output)+" out"))
+		}
+	}
+	printRows("By day", st.ByDay, 0)
+	printRows("By provider/model", st.ByModel, 0)
+	printRows("Busiest projects", st.Projects, 10)
+
+	fmt.Println("\nThis project (.simpleagent/*/logs):")
+	t := st.Turns
+	switch {
+	case t.Turns > 0:
+		fmt.Printf("  Turns: %d, avg %s, %.1f model call(s) each\n", t.Turns, statDuration(t.AvgMS), t.AvgCalls)
+	case t.LLMCalls == 0 && len(st.Tools) == 0:
+		fmt.Println("  No log records (logs are off, or nothing ran here in this period).")
+		return
+	}
+	if t.LLMCalls > 0 {
+		fmt.Printf("  Model calls: %d, avg %s", t.LLMCalls, statDuration(t.LLMAvgMS))
+		if t.Errors > 0 {
+			fmt.Printf(", %d failed", t.Errors)
+		}
+		fmt.Println()
+	}
+	if len(st.Tools) > 0 {
+		calls := 0
+		width := 0
+		for _, tool := range st.Tools {
+			calls += tool.Calls
+			width = max(width, len(tool.Name))
+		}
+		fmt.Printf("  Tool calls: %d\n", calls)
+		for _, tool := range st.Tools {
+			errs := ""
+			if tool.Errors > 0 {
+				errs = fmt.Sprintf(", %d not ok", tool.Errors)
+			}
+			fmt.Printf("    %-*s  %5d  %s\n", width, tool.Name, tool.Calls, statDim("avg "+statDuration(tool.AvgMS)+errs))
+		}
+	}
+}
+
+func statDim(s string) string {
+	if plainOutput {
+		return s
+	}
+	return "\033[2m" + s + "\033[0m"
+}
+
+func statTokens(n int) string {
+	switch {
+	case n >= 1_000_000:
+		return fmt.Sprintf("%.1fM", float64(n)/1e6)
+	case n >= 1000:
+		return fmt.Sprintf("%.1fk", float64(n)/1e3)
+	}
+	return fmt.Sprint(n)
+}
+
+func statCost(r statRow) string {
+	cost := fmt.Sprintf("$%.2f", r.CostUSD)
+	if r.Unpriced > 0 {
+		cost += "+?" // some calls have no price
+	}
+	return cost
+}
+
+func statDuration(ms int64) string {
+	d := time.Duration(ms) * time.Millisecond
+	if d < time.Second {
+		return d.String()
+	}
+	return d.Round(100 * time.Millisecond).String()
+}
+
+// tildePath shortens a path under the home directory to ~/...
+func tildePath(path string) string {
+	home, err := os.UserHomeDir()
+	if err != nil || home == "" {
+		return path
+	}
+	if rel, err := filepath.Rel(home, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return filepath.Join("~", rel)
+	}
+	return path
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// SessionStore persists sessions for one agentDir.
+type SessionStore interface {
+	Save(s *Session) error
+	Load(id string) (*Session, error)
+	List() ([]SessionEntry, error)
+	Rename(id, name string) error
+	LastID() (string, error)
+}
+
+// sessionStorage selects the store driver ("json" or "sqlite"); set from config in main.
+var sessionStorage = "json"
+
+var (
+	openStore    SessionStore
+	openStoreKey string // driver + agentDir the open store belongs to
+)
+
+// NewSessionStore opens the named store driver under agentDir.
+func NewSessionStore(driver string) (SessionStore, error) {
+	switch driver {
+	case "", "json":
+		return &jsonStore{dir: sessionsDir()}, nil
+	case "sqlite":
+		return openSQLiteStore(sessionsDir())
+	default:
+		return nil, fmt.Errorf("unknown session storage: %s", driver)
+	}
+}
+
+// store returns the session store for the current agentDir, opening it on
+// first use. A driver that fails to open falls back to JSON files.
+func store() SessionStore {
+	key := sessionStorage + ":" + agentDir
+	if openStore != nil && openStoreKey == key {
+		return openStore
+	}
+	s, err := NewSessionStore(sessionStorage)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v (using json session storage)\n", err)
+		s = &jsonStore{dir: sessionsDir()}
+	}
+	openStore, openStoreKey = s, key
+	return s
+}
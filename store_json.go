@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// jsonStore keeps one <id>.json file per session plus a sessions.json index
+// and a last_session pointer. The default store. Files are replaced
+// atomically and index updates hold sessions.json.lock, so processes working
+// on different sessions don't lose each other's entries.
+type jsonStore struct {
+	dir string
+}
+
+func (j *jsonStore) Save(s *Session) error {
+	os.MkdirAll(j.dir, 0755)
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(j.dir, s.ID+".json")
+	if err := writeWithBackup(path, data, 0644); err != nil {
+		return err
+	}
+
+	if err := j.updateIndex(s); err != nil {
+		return err
+	}
+	writeFileAtomic(filepath.Join(j.dir, "last_session"), []byte(s.ID), 0644)
+	return nil
+}
+
+func (j *jsonStore) Load(id string) (*Session, error) {
+	path := filepath.Join(j.dir, id+".json")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("session not found: %s", id)
+	}
+	var s Session
+	if err := json.Unmarshal(data, &s); err != nil {
+		bak, ok := loadBackup(path, "session", err)
+		if !ok {
+			return nil, fmt.Errorf("session %s is corrupt: %v", id, err)
+		}
+		s = Session{}
+		if err := json.Unmarshal(bak, &s); err != nil {
+			return nil, err
+		}
+	}
+	return &s, nil
+}
+
+func (j *jsonStore) List() ([]SessionEntry, error) {
+	return j.loadIndex().Sessions, nil
+}
+
+func (j *jsonStore) Rename(id, name string) error {
+	return withFileLock(j.indexPath()+".lock", func() error {
+		idx := j.loadIndex()
+		for i, e := range idx.Sessions {
+			if e.ID == id {
+				idx.Sessions[i].Name = name
+				break
+			}
+		}
+		return j.writeIndex(idx)
+	})
+}
+
+func (j *jsonStore) LastID() (string, error) {
+	data, err := os.ReadFile(filepath.Join(j.dir, "last_session"))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+func (j *jsonStore) indexPath() string {
+	return filepath.Join(j.dir, "sessions.json")
+}
+
+func (j *jsonStore) loadIndex() SessionIndex {
+	var idx SessionIndex
+	data, err := os.ReadFile(j.indexPath())
+	if err != nil {
+		return idx
+	}
+	if err := json.Unmarshal(data, &idx); err != nil {
+		idx = SessionIndex{}
+		if bak, ok := loadBackup(j.indexPath(), "session index", err); ok {
+			json.Unmarshal(bak, &idx)
+		}
+	}
+	return idx
+}
+
+func (j *jsonStore) writeIndex(idx SessionIndex) error {
+	data, _ := json.MarshalIndent(idx, "", "  ")
+	return writeWithBackup(j.indexPath(), data, 0644)
+}
+
+// updateIndex re-reads the index under its lock, so entries another
+// process added since this one last read it are kept.
+func (j *jsonStore) updateIndex(s *Session) error {
+	return withFileLock(j.indexPath()+".lock", func() error {
+		return j.updateIndexLocked(s)
+	})
+}
+
+func (j *jsonStore) updateIndexLocked(s *Session) error {
+	idx := j.loadIndex()
+
+	found := false
+	for i, e := range idx.Sessions {
+		if e.ID == s.ID {
+			idx.Sessions[i].Summary = s.Summary
+			idx.Sessions[i].CreatedAt = s.CreatedAt
+			idx.Sessions[i].UpdatedAt = s.UpdatedAt
+			found = true
+			break
+		}
+	}
+	if !found {
+		idx.Sessions = append(idx.Sessions, SessionEntry{
+			ID:        s.ID,
+			CreatedAt: s.CreatedAt,
+			UpdatedAt: s.UpdatedAt,
+			Summary:   s.Summary,
+		})
+	}
+
+	return j.writeIndex(idx)
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteStore keeps every session of an agentDir in one sessions.db:
+// session rows, their messages, and a meta table for the last session.
+// Writes are transactional, so concurrent saves can't corrupt the index.
+type sqliteStore struct {
+	db *sql.DB
+}
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS sessions (
+	id            TEXT PRIMARY KEY,
+	name          TEXT NOT NULL DEFAULT '',
+	created_at    TEXT NOT NULL,
+	updated_at    TEXT NOT NULL,
+	provider      TEXT NOT NULL DEFAULT '',
+	model         TEXT NOT NULL DEFAULT '',
+	summary       TEXT NOT NULL DEFAULT '',
+	tokens_used   INTEGER NOT NULL DEFAULT 0,
+	env           TEXT
+);
+CREATE TABLE IF NOT EXISTS messages (
+	session_id    TEXT NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+	seq           INTEGER NOT NULL,
+	role          TEXT NOT NULL,
+	content       TEXT NOT NULL DEFAULT '',
+	tool_calls    TEXT,
+	tool_call_id  TEXT NOT NULL DEFAULT '',
+	is_error      INTEGER NOT NULL DEFAULT 0,
+	duration_ms   INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (session_id, seq)
+);
+CREATE INDEX IF NOT EXISTS sessions_updated ON sessions(updated_at);
+CREATE TABLE IF NOT EXISTS meta (
+	key   TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+);`
+
+// openSQLiteStore opens (or creates) dir/sessions.db. An empty database
+// imports any existing JSON sessions from dir first.
+func openSQLiteStore(dir string) (*sqliteStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, "sessions.db")
+	dsn := "file:" + path + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("opening %s: %w", path, err)
+	}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("creating schema in %s: %w", path, err)
+	}
+	if err := migrateSQLite(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrating %s: %w", path, err)
+	}
+
+	s := &sqliteStore{db: db}
+	if err := s.importJSON(dir); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: importing JSON sessions: %v\n", err)
+	}
+	return s, nil
+}
+
+// migrateSQLite adds columns introduced after a database was created.
+func migrateSQLite(db *sql.DB) error {
+	for _, col := range []string{"is_error", "duration_ms"} {
+		var n int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('messages') WHERE name = ?`, col).Scan(&n); err != nil {
+			return err
+		}
+		if n == 0 {
+			if _, err := db.Exec(`ALTER TABLE messages ADD COLUMN ` + col + ` INTEGER NOT NULL DEFAULT 0`); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (q *sqliteStore) Save(s *Session) error {
+	var env []byte
+	if s.Env != nil {
+		env, _ = json.Marshal(s.Env)
+	}
+
+	tx, err := q.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`INSERT INTO sessions (id, created_at, updated_at, provider, model, summary, tokens_used, env)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			created_at = excluded.created_at, updated_at = excluded.updated_at,
+			provider = excluded.provider, model = excluded.model, summary = excluded.summary,
+			tokens_used = excluded.tokens_used, env = excluded.env`,
+		s.ID, s.CreatedAt, s.UpdatedAt, s.Provider, s.Model, s.Summary, s.TokensUsed, nullString(env))
+	if err != nil {
+		return err
+	}
+
+	// Messages are rewritten wholesale: /compact replaces history.
+	if _, err := tx.Exec(`DELETE FROM messages WHERE session_id = ?`, s.ID); err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(`INSERT INTO messages (session_id, seq, role, content, tool_calls, tool_call_id, is_error, duration_ms) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for i, m := range s.Messages {
+		var calls []byte
+		if len(m.ToolCalls) > 0 {
+			calls, _ = json.Marshal(m.ToolCalls)
+		}
+		if _, err := stmt.Exec(s.ID, i, m.Role, m.Content, nullString(calls), m.ToolCallID, m.IsError, m.DurationMs); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(`INSERT INTO meta (key, value) VALUES ('last_session', ?)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value`, s.ID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (q *sqliteStore) Load(id string) (*Session, error) {
+	var s Session
+	var env sql.NullString
+	err := q.db.QueryRow(`SELECT id, created_at, updated_at, provider, model, summary, tokens_used, env
+		FROM sessions WHERE id = ?`, id).
+		Scan(&s.ID, &s.CreatedAt, &s.UpdatedAt, &s.Provider, &s.Model, &s.Summary, &s.TokensUsed, &env)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("session not found: %s", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if env.Valid {
+		json.Unmarshal([]byte(env.String), &s.Env)
+	}
+
+	rows, err := q.db.Query(`SELECT role, content, tool_calls, tool_call_id, is_error, duration_ms FROM messages
+		WHERE session_id = ? ORDER BY seq`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var m Message
+		var calls sql.NullString
+		if err := rows.Scan(&m.Role, &m.Content, &calls, &m.ToolCallID, &m.IsError, &m.DurationMs); err != nil {
+			return nil, err
+		}
+		if calls.Valid {
+			json.Unmarshal([]byte(calls.String), &m.ToolCalls)
+		}
+		s.Messages = append(s.Messages, m)
+	}
+	return &s, rows.Err()
+}
+
+func (q *sqliteStore) List() ([]SessionEntry, error) {
+	rows, err := q.db.Query(`SELECT id, name, created_at, updated_at, summary FROM sessions ORDER BY updated_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []SessionEntry
+	for rows.Next() {
+		var e SessionEntry
+		if err := rows.Scan(&e.ID, &e.Name, &e.CreatedAt, &e.UpdatedAt, &e.Summary); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// searchCandidates returns the sessions with a message containing every term
+// (LIKE is case-insensitive for ASCII), so search loads only those.
+func (q *sqliteStore) searchCandidates(terms []string) (map[string]bool, error) {
+	query := `SELECT DISTINCT session_id FROM messages WHERE 1`
+	var args []any
+	for _, t := range terms {
+		query += ` AND content LIKE ? ESCAPE '\'`
+		esc := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(t)
+		args = append(args, "%"+esc+"%")
+	}
+	rows, err := q.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids[id] = true
+	}
+	return ids, rows.Err()
+}
+
+func (q *sqliteStore) Rename(id, name string) error {
+	_, err := q.db.Exec(`UPDATE sessions SET name = ? WHERE id = ?`, name, id)
+	return err
+}
+
+func (q *sqliteStore) LastID() (string, error) {
+	var id string
+	err := q.db.QueryRow(`SELECT value FROM meta WHERE key = 'last_session'`).Scan(&id)
+	return id, err
+}
+
+// importJSON copies JSON-store sessions into an empty database, keeping
+// names and the last-session pointer. The JSON files are left in place.
+func (q *sqliteStore) importJSON(dir string) error {
+	var n int
+	if err := q.db.QueryRow(`SELECT COUNT(*) FROM sessions`).Scan(&n); err != nil || n > 0 {
+		return err
+	}
+
+	js := &jsonStore{dir: dir}
+	entries, _ := js.List()
+	for _, e := range entries {
+		s, err := js.Load(e.ID)
+		if err != nil {
+			continue
+		}
+		if err := q.Save(s); err != nil {
+			return err
+		}
+		if e.Name != "" {
+			q.Rename(e.ID, e.Name)
+		}
+	}
+	if last, err := js.LastID(); err == nil && last != "" {
+		q.db.Exec(`INSERT INTO meta (key, value) VALUES ('last_session', ?)
+			ON CONFLICT(key) DO UPDATE SET value = excluded.value`, last)
+	}
+	return nil
+}
+
+func nullString(b []byte) sql.NullString {
+	return sql.NullString{String: string(b), Valid: b != nil}
+}
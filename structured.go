@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// respondTool is the tool providers without a JSON mode (Anthropic, Bedrock)
+// are made to call for CompleteJSON: its arguments are the answer.
+const respondTool = "respond"
+
+const respondToolDescription = "Give your answer. The arguments are the whole response."
+
+// completeJSON asks p for JSON matching schema and decodes it into v, so
+// features that need a value (a title, a score) don't parse free text.
+func completeJSON(ctx context.Context, p Provider, prompt string, schema map[string]any, v any) (*Usage, error) {
+	raw, usage, err := p.CompleteJSON(ctx, prompt, schema)
+	if err != nil {
+		return usage, err
+	}
+	if err := json.Unmarshal(unfenceJSON(raw), v); err != nil {
+		return usage, fmt.Errorf("%s: reply is not the requested JSON: %v", p.Name(), err)
+	}
+	return usage, nil
+}
+
+// unfenceJSON strips the ```json fence some models put around JSON even in
+// JSON mode.
+func unfenceJSON(raw []byte) []byte {
+	raw = bytes.TrimSpace(raw)
+	if !bytes.HasPrefix(raw, []byte("```")) {
+		return raw
+	}
+	if i := bytes.IndexByte(raw, '\n'); i >= 0 {
+		raw = raw[i+1:]
+	}
+	return bytes.TrimSpace(bytes.TrimSuffix(bytes.TrimSpace(raw), []byte("```")))
+}
+
+// jsonObject is a JSON Schema for an object whose properties are all
+// required.
+func jsonObject(props map[string]any) map[string]any {
+	return map[string]any{
+		"type":                 "object",
+		"properties":           props,
+		"required":             slices.Sorted(maps.Keys(props)),
+		"additionalProperties": false,
+	}
+}
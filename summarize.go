@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// summaryDefaultTokens bounds the rolling summary when memory.summary_tokens
+// is unset.
+const summaryDefaultTokens = 2000
+
+// rollingSummary is the mid-term tier of a session's memory, between the
+// recent messages sent verbatim and the long-term facts in AGENT.md: the
+// turns that left the recent window, folded by the compact model into a
+// summary the system prompt carries. It is stored beside the session in
+// summaries/<session-id>.json, so the session itself keeps every message.
+type rollingSummary struct {
+	Upto    int    `json:"upto"` // messages before this index are summarized
+	Text    string `json:"text"`
+	Updated string `json:"updated,omitempty"`
+
+	session string // which session this was loaded for
+}
+
+func summaryPath(sessionID string) string {
+	return filepath.Join(agentDir, "summaries", sessionID+".json")
+}
+
+func loadSummary(sessionID string) rollingSummary {
+	var s rollingSummary
+	if data, err := os.ReadFile(summaryPath(sessionID)); err == nil {
+		json.Unmarshal(data, &s)
+	}
+	s.session = sessionID
+	return s
+}
+
+// save writes the summary, or removes its file once it covers nothing.
+func (s rollingSummary) save() error {
+	path := summaryPath(s.session)
+	if s.Upto == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// summary returns the current session's rolling summary, read once per
+// session. One that covers more messages than the session has (the session
+// was edited elsewhere) is ignored.
+func (a *Agent) summary() *rollingSummary {
+	if a.rolling == nil || a.rolling.session != a.session.ID {
+		s := loadSummary(a.session.ID)
+		if s.Upto > len(a.session.Messages) {
+			s = rollingSummary{session: a.session.ID}
+		}
+		a.rolling = &s
+	}
+	return a.rolling
+}
+
+// history is what requests carry verbatim: the session's messages after the
+// ones the rolling summary covers.
+func (a *Agent) history() []Message {
+	return a.session.Messages[a.summary().Upto:]
+}
+
+// dropSummaryFrom clears the rolling summary when messages from idx on are
+// being removed or replaced and it covers some of them (/rewind, /redo). The
+// remaining messages are sent verbatim again and fold anew as they outgrow
+// the window.
+func (a *Agent) dropSummaryFrom(idx int) {
+	s := a.summary()
+	if s.Upto <= idx {
+		return
+	}
+	*s = rollingSummary{session: s.session}
+	if err := s.save(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return
+	}
+	fmt.Println("The session summary covered removed messages and was cleared.")
+}
+
+// recentBudget is how many tokens of recent messages are sent verbatim:
+// memory.recent_tokens, or half the context budget.
+func (a *Agent) recentBudget() int {
+	if n := a.cfg.Memory.RecentTokens; n > 0 {
+		return n
+	}
+	return contextBudget(a.llm.MaxContext(), a.cfg.MaxTokens) / 2
+}
+
+// foldHistory runs before a user turn's first request: when the verbatim
+// messages are over recentBudget, the oldest exchanges are folded into the
+// rolling summary until at most half the budget is left, so it doesn't run
+// again on the next turn. The current turn is never folded. A failed fold
+// warns and leaves the request to fitContext.
+func (a *Agent) foldHistory(ctx context.Context) {
+	if !a.cfg.Memory.Summarize {
+		return
+	}
+	budget := a.recentBudget()
+	s := a.summary()
+	provider := a.llm.Name()
+	if estimateContextTokens("", a.session.Messages[s.Upto:], nil, provider) <= budget {
+		return
+	}
+	cut := foldPoint(a.session.Messages, s.Upto, budget/2, provider)
+	if cut <= s.Upto {
+		return
+	}
+	if err := a.fold(ctx, cut); err != nil {
+		note := fmt.Sprintf("couldn't update the session summary: %v", err)
+		if a.sink != nil {
+			a.sink(AgentEvent{Type: "warning", Text: note})
+		} else {
+			fmt.Printf("\033[2m✂ %s\033[0m\n", note)
+		}
+	}
+}
+
+// foldPoint is where the verbatim part of msgs should start so that it fits
+// keep tokens: the earliest user message after from with at most keep
+// tokens from it on, or else the last user message. Exchanges start at user
+// messages, so a tool call is never separated from its result. Returns from
+// when there is nothing to fold.
+func foldPoint(msgs []Message, from, keep int, provider string) int {
+	cut, last, tokens := from, from, 0
+	for i := len(msgs) - 1; i > from; i-- {
+		tokens += estimateMessageTokens(msgs[i], provider)
+		if msgs[i].Role != "user" {
+			continue
+		}
+		if last == from {
+			last = i
+		}
+		if tokens <= keep {
+			cut = i
+		}
+	}
+	if cut == from {
+		return last
+	}
+	return cut
+}
+
+// fold summarizes the messages up to cut into the rolling summary with the
+// compact model, keeping it within memory.summary_tokens. Messages that
+// wouldn't fit in one request are folded in parts.
+func (a *Agent) fold(ctx context.Context, cut int) error {
+	s := a.summary()
+	limit := a.cfg.Memory.SummaryTokens
+	if limit <= 0 {
+		limit = summaryDefaultTokens
+	}
+
+	a.useRole("compact")
+	defer a.useRole(a.modeRole())
+	provider := a.llm.Name()
+	part := max(contextBudget(a.llm.MaxContext(), a.cfg.MaxTokens)/2-limit, limit)
+
+	text := s.Text
+	for from := s.Upto; from < cut; {
+		var sb strings.Builder
+		tokens := 0
+		end := from
+		for end < cut {
+			line := foldLine(a.session.Messages[end])
+			t := estimateTokens(line, provider)
+			if end > from && tokens+t > part {
+				break
+			}
+			sb.WriteString(line)
+			tokens += t
+			end++
+		}
+
+		prompt := fmt.Sprintf("Update the summary of this coding session with the new messages below. "+
+			"Keep what later turns will need: the user's goals and preferences, decisions and their reasons, files and code changed, "+
+			"commands and their outcomes, open problems and the current state. Drop chit-chat and details that no longer matter. "+
+			"Use at most %d words. Reply with the summary only.\n\n", limit*3/4)
+		if text != "" {
+			prompt += "Summary so far:\n" + text + "\n\n"
+		}
+		prompt += "New messages:\n" + sb.String()
+
+		ch, err := a.llm.SendStream(ctx, []Message{{Role: "user", Content: prompt}}, nil,
+			"You maintain the running summary of a long conversation between a user and a coding agent.")
+		if err != nil {
+			return err
+		}
+		var out strings.Builder
+		var usage *Usage
+		for chunk := range ch {
+			if chunk.Err != nil {
+				return chunk.Err
+			}
+			out.WriteString(chunk.Text)
+			if chunk.Usage != nil {
+				usage = chunk.Usage
+			}
+		}
+		if usage != nil {
+			a.addUsage(usage)
+		}
+		if strings.TrimSpace(out.String()) == "" {
+			return fmt.Errorf("the %s model returned an empty summary", a.llmModel)
+		}
+		text = strings.TrimSpace(out.String())
+		from = end
+	}
+
+	folded := cut - s.Upto
+	s.Upto, s.Text, s.Updated = cut, text, time.Now().Format(time.RFC3339)
+	if err := s.save(); err != nil {
+		return err
+	}
+	if a.sink == nil {
+		fmt.Printf("\033[2m⋯ folded %d earlier message(s) into the session summary (~%d tokens)\033[0m\n", folded, estimateTokens(text, provider))
+	}
+	return nil
+}
+
+// foldLine renders a message for the summarizer, with tool arguments and
+// results cut down: the summary needs what happened, not the full output.
+func foldLine(m Message) string {
+	var sb strings.Builder
+	switch m.Role {
+	case "user":
+		sb.WriteString("User: " + m.Content + "\n")
+	case "assistant":
+		if m.Content != "" {
+			sb.WriteString("Assistant: " + m.Content + "\n")
+		}
+		for _, tc := range m.ToolCalls {
+			sb.WriteString("Tool call: " + tc.Name + " " + truncate(string(tc.Args), 200) + "\n")
+		}
+	case "tool":
+		content := m.Content
+		if len(content) > prunedHead+200 {
+			content = pruneToolResult(content)
+		}
+		sb.WriteString("Tool result: " + content + "\n")
+	}
+	return sb.String()
+}
+
+// writeSummary adds the rolling summary to the system prompt.
+func writeSummary(sb *promptBuilder, s *rollingSummary) {
+	if s.Text == "" {
+		return
+	}
+	sb.WriteString(fmt.Sprintf("## Earlier in this conversation\nThe first %d messages are no longer shown; this is their summary:\n", s.Upto))
+	sb.WriteString(s.Text + "\n\n")
+}
+
+// compactSession handles /compact: everything before the latest exchange is
+// folded into the rolling summary now, instead of waiting for the recent
+// window to fill. The session keeps every message.
+func (a *Agent) compactSession() {
+	s := a.summary()
+	cut := foldPoint(a.session.Messages, s.Upto, 0, a.llm.Name())
+	if cut <= s.Upto {
+		fmt.Println("Nothing to compact: only the latest exchange is sent in full.")
+		return
+	}
+	fmt.Println("Compacting session...")
+	if err := a.fold(context.Background(), cut); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return
+	}
+	fmt.Println("Session compacted.")
+}
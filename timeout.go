@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultConnectTimeout = 30 * time.Second
+	defaultRequestTimeout = 5 * time.Minute
+)
+
+// providerTimeout turns a *_timeout setting (seconds; 0 = def, negative =
+// none) into a duration, 0 meaning no limit.
+func providerTimeout(secs int, def time.Duration) time.Duration {
+	switch {
+	case secs < 0:
+		return 0
+	case secs == 0:
+		return def
+	}
+	return time.Duration(secs) * time.Second
+}
+
+// errRequestTimeout is the cause a request is cancelled with when the
+// provider stops sending.
+type errRequestTimeout struct {
+	provider string
+	after    time.Duration
+}
+
+func (e errRequestTimeout) Error() string {
+	return fmt.Sprintf("%s sent no data for %s (request_timeout)", e.provider, e.after)
+}
+
+var (
+	timeoutMu  sync.Mutex
+	timedOutAt = map[string]time.Time{}
+)
+
+// timedOutSince reports whether a request to the provider hit its
+// request_timeout after t.
+func timedOutSince(provider string, t time.Time) bool {
+	timeoutMu.Lock()
+	defer timeoutMu.Unlock()
+	at, ok := timedOutAt[provider]
+	return ok && !at.Before(t)
+}
+
+// timeoutTransport cancels a request once the provider goes `idle` without
+// sending anything: no response headers, or no body bytes mid-stream. A long
+// stream that keeps sending is never cut off.
+type timeoutTransport struct {
+	provider string
+	idle     time.Duration
+	base     http.RoundTripper
+}
+
+func (t timeoutTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithCancelCause(req.Context())
+	timer := time.AfterFunc(t.idle, func() {
+		timeoutMu.Lock()
+		timedOutAt[t.provider] = time.Now()
+		timeoutMu.Unlock()
+		cancel(errRequestTimeout{t.provider, t.idle})
+	})
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		timer.Stop()
+		if cause := context.Cause(ctx); cause != nil && req.Context().Err() == nil {
+			err = cause
+		}
+		cancel(nil)
+		return nil, err
+	}
+	timer.Reset(t.idle)
+	resp.Body = &idleBody{ReadCloser: resp.Body, ctx: ctx, timer: timer, idle: t.idle, cancel: cancel}
+	return resp, nil
+}
+
+// idleBody restarts the idle timer on every read and reports a timeout as
+// itself rather than as "context canceled".
+type idleBody struct {
+	io.ReadCloser
+	ctx    context.Context
+	timer  *time.Timer
+	idle   time.Duration
+	cancel context.CancelCauseFunc
+}
+
+func (b *idleBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.timer.Reset(b.idle)
+	}
+	if err != nil && err != io.EOF {
+		if cause, ok := context.Cause(b.ctx).(errRequestTimeout); ok {
+			err = cause
+		}
+	}
+	return n, err
+}
+
+func (b *idleBody) Close() error {
+	b.timer.Stop()
+	b.cancel(nil)
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Local token estimation for backends that don't report usage (Ollama and
+// some OpenAI-compatible servers). Estimates, not exact counts — good enough
+// to keep the context line and compaction decisions meaningful.
+
+// bpePreTokenizer approximates tiktoken's cl100k pre-tokenization split
+// (contractions, words with a leading space, 1-3 digit runs, punctuation
+// runs, whitespace). Go's regexp has no lookahead, so trailing-space
+// handling is simplified.
+var bpePreTokenizer = regexp.MustCompile(`(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+`)
+
+// perMessageOverhead covers role markers and separators in chat formats.
+const perMessageOverhead = 4
+
+// estimateTokens estimates the token count of text for the given provider.
+func estimateTokens(text, provider string) int {
+	if text == "" {
+		return 0
+	}
+	switch provider {
+	case "openai", "openrouter", "ollama":
+		return estimateBPETokens(text)
+	default:
+		return estimateHeuristicTokens(text)
+	}
+}
+
+// estimateBPETokens splits text the way a BPE tokenizer would, then estimates
+// merges per piece: common words are one token, long words split every ~6
+// characters, non-Latin scripts cost roughly a token per character.
+func estimateBPETokens(text string) int {
+	total := 0
+	for _, piece := range bpePreTokenizer.FindAllString(text, -1) {
+		n := utf8.RuneCountInString(piece)
+		body := strings.TrimLeft(piece, " ") // a leading space merges into the word
+		r, _ := utf8.DecodeRuneInString(body)
+		switch {
+		case body == "" || unicode.IsSpace(r):
+			total += 1 + n/16 // newlines + indentation merge well
+		case !isLatinish(body):
+			total += utf8.RuneCountInString(body)
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			total += 1 + (utf8.RuneCountInString(body)-1)/3
+		default:
+			total += 1 + (utf8.RuneCountInString(body)-1)/6
+		}
+	}
+	return total
+}
+
+// estimateHeuristicTokens uses ~3.5 characters per token for Latin text
+// and one token per character for other scripts.
+func estimateHeuristicTokens(text string) int {
+	latin, other := 0, 0
+	for _, r := range text {
+		if r < 0x2E80 {
+			latin++
+		} else {
+			other++
+		}
+	}
+	return (latin*2+6)/7 + other
+}
+
+// isLatinish reports whether s is mostly ASCII / Latin-script text.
+func isLatinish(s string) bool {
+	for _, r := range s {
+		if r >= 0x2E80 { // CJK and beyond
+			return false
+		}
+	}
+	return true
+}
+
+// estimateMessageTokens estimates one message including tool calls.
+func estimateMessageTokens(m Message, provider string) int {
+	n := perMessageOverhead + estimateTokens(m.Content, provider)
+	for _, tc := range m.ToolCalls {
+		n += estimateTokens(tc.Name, provider) + estimateTokens(string(tc.Args), provider)
+	}
+	return n
+}
+
+// estimateContextTokens estimates the full request: system prompt, tool
+// definitions, and conversation history.
+func estimateContextTokens(systemPrompt string, msgs []Message, tools []ToolDef, provider string) int {
+	n := estimateTokens(systemPrompt, provider)
+	if len(tools) > 0 {
+		data, _ := json.Marshal(tools)
+		n += estimateTokens(string(data), provider)
+	}
+	for _, m := range msgs {
+		n += estimateMessageTokens(m, provider)
+	}
+	return n
+}
+
+// estimateUsage builds a Usage for one turn when the provider sent none.
+func estimateUsage(systemPrompt string, history []Message, tools []ToolDef, reply Message, provider string) *Usage {
+	return &Usage{
+		InputTokens:  estimateContextTokens(systemPrompt, history, tools, provider),
+		OutputTokens: estimateMessageTokens(reply, provider),
+		Estimated:    true,
+	}
+}
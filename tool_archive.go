@@ -0,0 +1,527 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Limits for both tools; extraction stops rather than fill the disk with a
+// zip bomb.
+const (
+	archiveMaxBytes   = 1 << 30 // uncompressed total, overridable per call
+	archiveMaxEntries = 100000
+)
+
+func registerArchiveTools(r *ToolRegistry) {
+	r.Register(ToolDef{
+		Name: "archive_create",
+		Description: "Create a zip, tar, or tar.gz archive from files and directories (directories are added recursively). " +
+			"Entries are stored relative to base_dir, like tar -C. The format follows the archive's extension unless given.",
+		Parameters: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"path": map[string]any{"type": "string", "description": "Archive to write (.zip, .tar, .tar.gz, .tgz)"},
+				"files": map[string]any{
+					"type":        "array",
+					"items":       map[string]any{"type": "string"},
+					"description": "Files and directories to add, relative to base_dir",
+				},
+				"base_dir": map[string]any{"type": "string", "description": "Directory entry names are relative to (default: current directory)"},
+				"format": map[string]any{
+					"type":        "string",
+					"enum":        []string{"zip", "tar", "tar.gz"},
+					"description": "Archive format (default: from the path's extension)",
+				},
+			},
+			"required": []string{"path", "files"},
+		},
+	}, toolArchiveCreate, true)
+
+	r.Register(ToolDef{
+		Name: "archive_extract",
+		Description: "Extract a zip, tar, or tar.gz archive, or list its entries with list=true. " +
+			"Entries that would land outside dest (absolute paths, .., escaping links) are skipped. Existing files are kept unless overwrite is true.",
+		Parameters: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"path":      map[string]any{"type": "string", "description": "Archive to read"},
+				"dest":      map[string]any{"type": "string", "description": "Directory to extract into (default: current directory)"},
+				"list":      map[string]any{"type": "boolean", "description": "Only list entries with their sizes (default false)"},
+				"overwrite": map[string]any{"type": "boolean", "description": "Replace existing files (default false)"},
+				"max_bytes": map[string]any{"type": "integer", "description": "Stop after this many uncompressed bytes (default 1 GiB)"},
+				"format": map[string]any{
+					"type":        "string",
+					"enum":        []string{"zip", "tar", "tar.gz"},
+					"description": "Archive format (default: from the path's extension)",
+				},
+			},
+			"required": []string{"path"},
+		},
+	}, toolArchiveExtract, true)
+}
+
+// archiveFormat picks the format from an explicit value or the file name.
+func archiveFormat(name, format string) (string, error) {
+	if format != "" {
+		return format, nil
+	}
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return "zip", nil
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return "tar.gz", nil
+	case strings.HasSuffix(lower, ".tar"):
+		return "tar", nil
+	}
+	return "", fmt.Errorf("can't tell the format of %s; set format to zip, tar, or tar.gz", name)
+}
+
+// --- Create ---
+
+// archiveWriter adds entries to a zip or tar stream.
+type archiveWriter interface {
+	add(name string, info fs.FileInfo, link string, body io.Reader) error
+	Close() error
+}
+
+type zipArchive struct{ w *zip.Writer }
+
+func (z zipArchive) add(name string, info fs.FileInfo, link string, body io.Reader) error {
+	h, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	h.Name = name
+	if info.IsDir() {
+		h.Name += "/"
+	} else {
+		h.Method = zip.Deflate
+	}
+	w, err := z.w.CreateHeader(h)
+	if err != nil {
+		return err
+	}
+	switch {
+	case link != "":
+		_, err = io.WriteString(w, link) // zip stores a symlink's target as its content
+	case body != nil:
+		_, err = io.Copy(w, body)
+	}
+	return err
+}
+
+func (z zipArchive) Close() error { return z.w.Close() }
+
+type tarArchive struct {
+	w  *tar.Writer
+	gz *gzip.Writer // nil for plain tar
+}
+
+func (t tarArchive) add(name string, info fs.FileInfo, link string, body io.Reader) error {
+	h, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+	h.Name = name
+	if info.IsDir() {
+		h.Name += "/"
+	}
+	h.Uname, h.Gname = "", "" // don't leak local account names
+	if err := t.w.WriteHeader(h); err != nil {
+		return err
+	}
+	if body != nil && h.Typeflag == tar.TypeReg {
+		_, err = io.Copy(t.w, body)
+	}
+	return err
+}
+
+func (t tarArchive) Close() error {
+	err := t.w.Close()
+	if t.gz != nil {
+		if gerr := t.gz.Close(); err == nil {
+			err = gerr
+		}
+	}
+	return err
+}
+
+func toolArchiveCreate(args json.RawMessage) (string, error) {
+	var params struct {
+		Path    string   `json:"path"`
+		Files   []string `json:"files"`
+		BaseDir string   `json:"base_dir"`
+		Format  string   `json:"format"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", err
+	}
+	format, err := archiveFormat(params.Path, params.Format)
+	if err != nil {
+		return "error: " + err.Error(), nil
+	}
+	if len(params.Files) == 0 {
+		return "error: files is empty", nil
+	}
+	base := params.BaseDir
+	if base == "" {
+		base = "."
+	}
+	outAbs, _ := filepath.Abs(params.Path)
+
+	// Write next to the target and rename, so a failure leaves no half archive
+	if err := os.MkdirAll(filepath.Dir(params.Path), 0755); err != nil {
+		return fmt.Sprintf("error: %v", err), nil
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(params.Path), ".archive-*")
+	if err != nil {
+		return fmt.Sprintf("error: %v", err), nil
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	var aw archiveWriter
+	switch format {
+	case "zip":
+		aw = zipArchive{zip.NewWriter(tmp)}
+	case "tar":
+		aw = tarArchive{w: tar.NewWriter(tmp)}
+	case "tar.gz":
+		gz := gzip.NewWriter(tmp)
+		aw = tarArchive{w: tar.NewWriter(gz), gz: gz}
+	}
+
+	var entries int
+	var total int64
+	for _, f := range params.Files {
+		root := f
+		if !filepath.IsAbs(root) {
+			root = filepath.Join(base, f)
+		}
+		if !pathWithinOrEqual(root, base) {
+			return fmt.Sprintf("error: %s is outside base_dir %s", f, base), nil
+		}
+		err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if abs, _ := filepath.Abs(p); abs == outAbs {
+				return nil // don't archive the archive
+			}
+			info, err := os.Lstat(p)
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(base, p)
+			if err != nil {
+				return err
+			}
+			name := filepath.ToSlash(rel)
+			if name == "." {
+				return nil // base_dir itself
+			}
+			if entries++; entries > archiveMaxEntries {
+				return fmt.Errorf("more than %d entries", archiveMaxEntries)
+			}
+			switch {
+			case info.Mode()&fs.ModeSymlink != 0:
+				link, err := os.Readlink(p)
+				if err != nil {
+					return err
+				}
+				return aw.add(name, info, link, nil)
+			case info.IsDir():
+				return aw.add(name, info, "", nil)
+			case !info.Mode().IsRegular():
+				entries--
+				return nil // sockets, devices, fifos
+			}
+			if total += info.Size(); total > archiveMaxBytes {
+				return fmt.Errorf("more than %d bytes of input", archiveMaxBytes)
+			}
+			file, err := os.Open(p)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			return aw.add(name, info, "", file)
+		})
+		if err != nil {
+			return fmt.Sprintf("error: %v", err), nil
+		}
+	}
+	if err := aw.Close(); err != nil {
+		return fmt.Sprintf("error: %v", err), nil
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Sprintf("error: %v", err), nil
+	}
+	if err := os.Rename(tmp.Name(), params.Path); err != nil {
+		return fmt.Sprintf("error: %v", err), nil
+	}
+	info, _ := os.Stat(params.Path)
+	return fmt.Sprintf("created %s (%s, %d entries, %d bytes in, %d bytes archived)", params.Path, format, entries, total, info.Size()), nil
+}
+
+// pathWithinOrEqual is pathWithin that also accepts dir itself.
+func pathWithinOrEqual(p, dir string) bool {
+	a, _ := filepath.Abs(p)
+	b, _ := filepath.Abs(dir)
+	return a == b || pathWithin(p, dir)
+}
+
+// --- Extract ---
+
+// archiveEntry is one member of an archive, whatever the format.
+type archiveEntry struct {
+	name string
+	mode fs.FileMode
+	size int64
+	link string // symlink or hard link target
+	hard bool
+	open func() (io.ReadCloser, error)
+}
+
+// walkArchive calls fn for each entry in order.
+func walkArchive(p, format string, fn func(archiveEntry) error) error {
+	if format == "zip" {
+		zr, err := zip.OpenReader(p)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		for _, f := range zr.File {
+			e := archiveEntry{name: f.Name, mode: f.Mode(), size: int64(f.UncompressedSize64), open: f.Open}
+			if e.mode&fs.ModeSymlink != 0 {
+				rc, err := f.Open()
+				if err != nil {
+					return err
+				}
+				target, _ := io.ReadAll(io.LimitReader(rc, 4096))
+				rc.Close()
+				e.link = string(target)
+			}
+			if err := fn(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	file, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	var r io.Reader = file
+	if format == "tar.gz" {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		e := archiveEntry{name: h.Name, mode: h.FileInfo().Mode(), size: h.Size, link: h.Linkname}
+		e.hard = h.Typeflag == tar.TypeLink
+		e.open = func() (io.ReadCloser, error) { return io.NopCloser(tr), nil }
+		switch h.Typeflag {
+		case tar.TypeReg, tar.TypeDir, tar.TypeSymlink, tar.TypeLink:
+		default:
+			continue // pax headers are consumed by the reader; devices and fifos are skipped
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+}
+
+// errArchiveLimit stops extraction at max_bytes or the entry limit.
+var errArchiveLimit = errors.New("limit reached")
+
+func toolArchiveExtract(args json.RawMessage) (string, error) {
+	var params struct {
+		Path      string `json:"path"`
+		Dest      string `json:"dest"`
+		List      bool   `json:"list"`
+		Overwrite bool   `json:"overwrite"`
+		MaxBytes  int64  `json:"max_bytes"`
+		Format    string `json:"format"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", err
+	}
+	format, err := archiveFormat(params.Path, params.Format)
+	if err != nil {
+		return "error: " + err.Error(), nil
+	}
+	if params.List {
+		return listArchive(params.Path, format)
+	}
+	dest := params.Dest
+	if dest == "" {
+		dest = "."
+	}
+	maxBytes := params.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = archiveMaxBytes
+	}
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return fmt.Sprintf("error: %v", err), nil
+	}
+
+	var files, entries int
+	var total int64
+	var skipped []string
+	skip := func(name, why string) {
+		skipped = append(skipped, name+": "+why)
+	}
+	err = walkArchive(params.Path, format, func(e archiveEntry) error {
+		if entries++; entries > archiveMaxEntries {
+			return fmt.Errorf("%w: more than %d entries", errArchiveLimit, archiveMaxEntries)
+		}
+		name := path.Clean(strings.ReplaceAll(e.name, `\`, "/"))
+		if name == "." {
+			return nil
+		}
+		if path.IsAbs(name) || filepath.VolumeName(name) != "" || name == ".." || strings.HasPrefix(name, "../") {
+			skip(e.name, "path escapes dest")
+			return nil
+		}
+		target := filepath.Join(dest, filepath.FromSlash(name))
+		// Resolves symlinks already on disk, so an earlier link entry can't redirect this one
+		if !pathWithin(target, dest) {
+			skip(e.name, "path escapes dest")
+			return nil
+		}
+
+		if e.mode.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		if _, err := os.Lstat(target); err == nil {
+			if !params.Overwrite {
+				skip(e.name, "exists")
+				return nil
+			}
+			os.Remove(target)
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+
+		if e.link != "" {
+			// Link targets must stay inside dest too
+			linkPath := filepath.Join(filepath.Dir(target), filepath.FromSlash(e.link))
+			if e.hard {
+				linkPath = filepath.Join(dest, filepath.FromSlash(path.Clean(e.link)))
+			}
+			if filepath.IsAbs(e.link) || !pathWithin(linkPath, dest) {
+				skip(e.name, "link target outside dest")
+				return nil
+			}
+			if e.hard {
+				return os.Link(linkPath, target)
+			}
+			return os.Symlink(e.link, target)
+		}
+
+		remaining := maxBytes - total
+		if e.size > remaining {
+			return fmt.Errorf("%w: %s would pass max_bytes (%d)", errArchiveLimit, e.name, maxBytes)
+		}
+		rc, err := e.open()
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, e.mode.Perm()|0600)
+		if err != nil {
+			return err
+		}
+		// Declared sizes can lie; count what is actually written
+		n, err := io.Copy(out, io.LimitReader(rc, remaining+1))
+		out.Close()
+		total += n
+		if err != nil {
+			return err
+		}
+		if total > maxBytes {
+			os.Remove(target)
+			return fmt.Errorf("%w: %s passes max_bytes (%d)", errArchiveLimit, e.name, maxBytes)
+		}
+		files++
+		return nil
+	})
+
+	var sb strings.Builder
+	if err != nil {
+		fmt.Fprintf(&sb, "error: %v\n", err)
+		if files > 0 {
+			fmt.Fprintf(&sb, "extracted %d files (%d bytes) to %s before stopping\n", files, total, dest)
+		}
+	} else {
+		fmt.Fprintf(&sb, "extracted %d files (%d bytes) from %s to %s\n", files, total, params.Path, dest)
+	}
+	if len(skipped) > 0 {
+		fmt.Fprintf(&sb, "skipped %d entries:\n", len(skipped))
+		for i, s := range skipped {
+			if i == 20 {
+				fmt.Fprintf(&sb, "  ... and %d more\n", len(skipped)-20)
+				break
+			}
+			sb.WriteString("  " + s + "\n")
+		}
+	}
+	return strings.TrimRight(sb.String(), "\n"), nil
+}
+
+// listArchive prints up to 500 entries with sizes.
+func listArchive(p, format string) (string, error) {
+	var sb strings.Builder
+	var n int
+	var total int64
+	err := walkArchive(p, format, func(e archiveEntry) error {
+		n++
+		total += e.size
+		if n > 500 {
+			return nil
+		}
+		switch {
+		case e.mode.IsDir():
+			fmt.Fprintf(&sb, "%12s  %s\n", "dir", e.name)
+		case e.link != "":
+			fmt.Fprintf(&sb, "%12s  %s -> %s\n", "link", e.name, e.link)
+		default:
+			fmt.Fprintf(&sb, "%12d  %s\n", e.size, e.name)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Sprintf("error: %v", err), nil
+	}
+	if n > 500 {
+		fmt.Fprintf(&sb, "... and %d more\n", n-500)
+	}
+	fmt.Fprintf(&sb, "%d entries, %d bytes uncompressed", n, total)
+	return sb.String(), nil
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// buildSystems are the build commands the build tool knows how to run.
+var buildSystems = []string{"go", "cargo", "npm", "make"}
+
+const (
+	buildTimeout     = 600 // default seconds for a build
+	buildMaxProblems = 30  // diagnostics listed in the summary
+)
+
+func registerBuildTools(r *ToolRegistry) {
+	r.Register(ToolDef{
+		Name:        "build",
+		Description: "Build the project (go build, cargo build, the package.json build script, or make; detected from the project) and return the compiler errors and warnings as file:line:col references. The full log is saved to the scratch directory. Prefer this over running the build with bash.",
+		Parameters: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"system":  map[string]any{"type": "string", "enum": buildSystems, "description": "Build system to use (default: detected)"},
+				"target":  map[string]any{"type": "string", "description": "What to build: a Go package pattern (default ./...), a cargo package name, a package.json script (default build), or a make target"},
+				"workdir": map[string]any{"type": "string", "description": "Project directory (default: current)"},
+				"timeout": map[string]any{"type": "integer", "description": "Timeout in seconds (default 600)"},
+			},
+		},
+	}, func(args json.RawMessage) (string, error) {
+		return toolBuild(r, args)
+	}, true)
+}
+
+func toolBuild(r *ToolRegistry, args json.RawMessage) (string, error) {
+	var params struct {
+		System  string `json:"system"`
+		Target  string `json:"target"`
+		Workdir string `json:"workdir"`
+		Timeout int    `json:"timeout"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", err
+	}
+	root := params.Workdir
+	if root == "" {
+		root = "."
+	}
+	system := params.System
+	if system == "" {
+		if system = detectBuildSystem(root); system == "" {
+			return "error: no go.mod, Cargo.toml, package.json build script or Makefile found; pass system, or run the build with bash", nil
+		}
+	}
+
+	var argv []string
+	switch system {
+	case "go":
+		argv = []string{"go", "build", orDefault(params.Target, "./...")}
+	case "cargo":
+		argv = []string{"cargo", "build", "--message-format", "short"}
+		if params.Target != "" {
+			argv = append(argv, "-p", params.Target)
+		}
+	case "npm":
+		argv = []string{nodePackageManager(root), "run", orDefault(params.Target, "build")}
+	case "make":
+		argv = []string{"make"}
+		if params.Target != "" {
+			argv = append(argv, params.Target)
+		}
+	default:
+		return fmt.Sprintf("error: unknown build system %q (%s)", system, strings.Join(buildSystems, ", ")), nil
+	}
+
+	timeout := buildTimeout
+	if params.Timeout > 0 {
+		timeout = params.Timeout
+	}
+	ctx, cancel := context.WithTimeout(toolCtx, time.Duration(timeout)*time.Second)
+	defer cancel()
+	start := time.Now()
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Dir = root
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err := cmd.Run()
+	elapsed := time.Since(start).Round(100 * time.Millisecond)
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Sprintf("%s\n[timed out after %ds]", tailLines(out.String(), testExcerpt), timeout), nil
+	}
+	if _, ok := err.(*exec.ExitError); err != nil && !ok {
+		return fmt.Sprintf("error: running %s: %v", argv[0], err), nil
+	}
+
+	errs, warnings := parseBuildOutput(ansiEscape.ReplaceAllString(out.String(), ""), root)
+	var sb strings.Builder
+	status := "OK"
+	if err != nil {
+		status = "FAILED"
+	}
+	fmt.Fprintf(&sb, "%s: %s", strings.Join(argv, " "), status)
+	if len(errs) > 0 || len(warnings) > 0 {
+		fmt.Fprintf(&sb, " — %d error(s), %d warning(s)", len(errs), len(warnings))
+	}
+	fmt.Fprintf(&sb, " (%s)\n", elapsed)
+	problems := append(errs, warnings...)
+	for i, p := range problems {
+		if i == buildMaxProblems {
+			fmt.Fprintf(&sb, "  ... and %d more\n", len(problems)-i)
+			break
+		}
+		sb.WriteString("  " + p + "\n")
+	}
+	if err != nil && len(errs) == 0 {
+		// A failure the parser didn't recognize: show where it stopped
+		sb.WriteString("Output:\n" + indentLines(tailLines(out.String(), testExcerpt)) + "\n")
+	}
+	if r.Scratch != "" && out.Len() > 0 {
+		log := filepath.Join(r.Scratch, fmt.Sprintf("build-%s.log", time.Now().Format("150405")))
+		if os.WriteFile(log, out.Bytes(), 0644) == nil {
+			fmt.Fprintf(&sb, "Full output (%d lines): %s\n", strings.Count(out.String(), "\n"), log)
+		}
+	}
+	return strings.TrimRight(sb.String(), "\n"), nil
+}
+
+// detectBuildSystem picks the build command for the project at root.
+func detectBuildSystem(root string) string {
+	switch {
+	case fileExists(filepath.Join(root, "go.mod")):
+		return "go"
+	case fileExists(filepath.Join(root, "Cargo.toml")):
+		return "cargo"
+	case hasBuildScript(root):
+		return "npm"
+	case fileExists(filepath.Join(root, "Makefile")), fileExists(filepath.Join(root, "makefile")),
+		fileExists(filepath.Join(root, "GNUmakefile")):
+		return "make"
+	}
+	return ""
+}
+
+// hasBuildScript reports whether package.json defines a build script.
+func hasBuildScript(root string) bool {
+	var pkg struct {
+		Scripts map[string]string `json:"scripts"`
+	}
+	data, err := os.ReadFile(filepath.Join(root, "package.json"))
+	if err != nil || json.Unmarshal(data, &pkg) != nil {
+		return false
+	}
+	return pkg.Scripts["build"] != ""
+}
+
+// Compiler diagnostics, as file, line, column (optional) and message:
+// gcc/clang/go/cargo --message-format short ("f.go:3:2: msg"), tsc
+// ("f.ts(3,2): msg" and "f.ts:3:2 - msg").
+var buildDiagnostic = []*regexp.Regexp{
+	regexp.MustCompile(`^([^\s:()]+\.\w+):(\d+):(?:(\d+):)? (.+)$`),
+	regexp.MustCompile(`^([^\s:()]+\.\w+)\((\d+),(\d+)\): (.+)$`),
+	regexp.MustCompile(`^([^\s:()]+\.\w+):(\d+):(\d+) - (.+)$`),
+}
+
+var (
+	buildWarning = regexp.MustCompile(`(?i)^warning\b`)
+	buildNote    = regexp.MustCompile(`^(note|help):`) // context for the line before
+)
+
+// parseBuildOutput pulls file:line diagnostics out of a build log, split into
+// errors and warnings, deduplicated, with paths made relative to the agent's
+// directory rather than root.
+func parseBuildOutput(out, root string) (errs, warnings []string) {
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimRight(line, "\r")
+		for _, re := range buildDiagnostic {
+			m := re.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+			if buildNote.MatchString(m[4]) {
+				break
+			}
+			path := strings.TrimPrefix(m[1], "./")
+			if root != "." && !filepath.IsAbs(path) {
+				path = filepath.Join(root, path)
+			}
+			ref := path + ":" + m[2]
+			if m[3] != "" {
+				ref += ":" + m[3]
+			}
+			d := ref + ": " + strings.TrimSpace(m[4])
+			if seen[d] {
+				break
+			}
+			seen[d] = true
+			if buildWarning.MatchString(m[4]) {
+				warnings = append(warnings, d)
+			} else {
+				errs = append(errs, d)
+			}
+			break
+		}
+	}
+	return errs, warnings
+}
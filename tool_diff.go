@@ -98,22 +98,29 @@ func toolPatch(args json.RawMessage) (string, error) {
 		return fmt.Sprintf("error reading file: %v", err), nil
 	}
 
-	lines := splitLines(string(data))
-	hunks, err := parseUnifiedDiff(params.Patch)
+	output, n, err := applyPatch(string(data), params.Patch)
 	if err != nil {
-		return fmt.Sprintf("error parsing patch: %v", err), nil
+		return fmt.Sprintf("error %v", err), nil
 	}
 
-	result, err := applyHunks(lines, hunks)
+	if err := os.WriteFile(params.Path, []byte(output), 0644); err != nil {
+		return fmt.Sprintf("error writing file: %v", err), nil
+	}
+	return fmt.Sprintf("patched %s (%d hunks applied)", params.Path, n), nil
+}
+
+// applyPatch applies a unified diff to content, returning the result and hunk count.
+func applyPatch(content, patch string) (string, int, error) {
+	hunks, err := parseUnifiedDiff(patch)
 	if err != nil {
-		return fmt.Sprintf("error applying patch: %v", err), nil
+		return "", 0, fmt.Errorf("parsing patch: %w", err)
 	}
 
-	output := strings.Join(result, "\n")
-	if err := os.WriteFile(params.Path, []byte(output), 0644); err != nil {
-		return fmt.Sprintf("error writing file: %v", err), nil
+	result, err := applyHunks(splitLines(content), hunks)
+	if err != nil {
+		return "", 0, fmt.Errorf("applying patch: %w", err)
 	}
-	return fmt.Sprintf("patched %s (%d hunks applied)", params.Path, len(hunks)), nil
+	return strings.Join(result, "\n"), len(hunks), nil
 }
 
 // splitLines splits content into lines, preserving empty trailing line semantics.
@@ -8,10 +8,12 @@ import (
 	"io"
 	"os"
 	"os/exec"
+	"regexp"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/creack/pty"
 	"github.com/google/uuid"
 )
 
@@ -116,14 +118,26 @@ func (rb *ringBuffer) ReadAll() string {
 type ManagedProcess struct {
 	ID      string
 	Name    string
-	Cmd     *exec.Cmd
-	Stdin   io.WriteCloser
+	Command string // full command line, for restart on resume
+	Workdir string
+	Env     map[string]string // extra env passed to start_process
+	Cmd     *exec.Cmd         // nil for processes adopted from a previous run
+	Pid     int
+	Stdin   io.WriteCloser // nil for adopted processes
 	Stdout  *ringBuffer
 	Stderr  *ringBuffer
 	Started time.Time
 	Done    bool
 	ExitErr error
-	mu      sync.Mutex
+	View    *logView // live terminal view (tmux/screen), nil if not requested
+	PTY     *os.File // pseudo-terminal master when started with pty; output is all in Stdout
+	// KeepAlive processes outlive simpleagent: output goes to log files in
+	// the agent dir and the next run adopts them.
+	KeepAlive bool
+	Adopted   bool   // started by a previous run; exit status is unknown
+	StartID   string // processStartID when started; an adopted PID is only signalled while it matches
+	OwnerPID  int    // the other running simpleagent a shared keep_alive process belongs to; never signalled from here
+	mu        sync.Mutex
 }
 
 var processes = struct {
@@ -154,9 +168,14 @@ func registerExecTools(r *ToolRegistry) {
 		Parameters: map[string]any{
 			"type": "object",
 			"properties": map[string]any{
-				"command": map[string]any{"type": "string", "description": "Shell command to execute"},
-				"workdir": map[string]any{"type": "string", "description": "Working directory"},
-				"env":     map[string]any{"type": "object", "description": "Extra environment variables"},
+				"command":    map[string]any{"type": "string", "description": "Shell command to execute"},
+				"workdir":    map[string]any{"type": "string", "description": "Working directory"},
+				"env":        map[string]any{"type": "object", "description": "Extra environment variables"},
+				"view":       map[string]any{"type": "boolean", "description": "Also show live output in a new tmux/screen window so the user can watch (only when running inside tmux or screen)"},
+				"pty":        map[string]any{"type": "boolean", "description": "Run in a pseudo-terminal, for REPLs and programs that need a TTY (stdout and stderr are merged)"},
+				"cols":       map[string]any{"type": "integer", "description": "Terminal width with pty (default 120)"},
+				"rows":       map[string]any{"type": "integer", "description": "Terminal height with pty (default 40)"},
+				"keep_alive": map[string]any{"type": "boolean", "description": "Leave the process running when simpleagent exits; the next run adopts it (default: stopped on exit)"},
 			},
 			"required": []string{"command"},
 		},
@@ -164,24 +183,29 @@ func registerExecTools(r *ToolRegistry) {
 
 	r.Register(ToolDef{
 		Name:        "write_stdin",
-		Description: "Send input to a running process's stdin.",
+		Description: "Send input to a running process's stdin. For pty processes, can also resize the terminal.",
 		Parameters: map[string]any{
 			"type": "object",
 			"properties": map[string]any{
 				"id":   map[string]any{"type": "string", "description": "Process handle ID"},
 				"text": map[string]any{"type": "string", "description": "Text to write (newline appended if missing)"},
+				"raw":  map[string]any{"type": "boolean", "description": "Send text as-is, without appending a newline (keystrokes like \u0003 for Ctrl+C)"},
+				"cols": map[string]any{"type": "integer", "description": "Resize a pty process's terminal to this width"},
+				"rows": map[string]any{"type": "integer", "description": "Resize a pty process's terminal to this height"},
 			},
-			"required": []string{"id", "text"},
+			"required": []string{"id"},
 		},
 	}, toolWriteStdin, true)
 
 	r.Register(ToolDef{
 		Name:        "read_output",
-		Description: "Read buffered stdout/stderr from a managed process (non-blocking).",
+		Description: "Read buffered stdout/stderr from a managed process. Returns immediately, or with wait_for blocks until the output matches (e.g. a server's \"Listening on\" line) instead of polling with sleep.",
 		Parameters: map[string]any{
 			"type": "object",
 			"properties": map[string]any{
-				"id": map[string]any{"type": "string", "description": "Process handle ID"},
+				"id":              map[string]any{"type": "string", "description": "Process handle ID"},
+				"wait_for":        map[string]any{"type": "string", "description": "Regex to wait for in new output; returns once it matches, the process exits, or the timeout passes"},
+				"timeout_seconds": map[string]any{"type": "integer", "description": "How long wait_for may block (default 30, max 600)"},
 			},
 			"required": []string{"id"},
 		},
@@ -211,6 +235,13 @@ func registerExecTools(r *ToolRegistry) {
 
 var bashTimeout = 120 // overridden from config
 
+// bashLive echoes bash output to the terminal while the command runs. Set
+// per tool call: on for the interactive terminal unless stream_bash is off.
+var bashLive bool
+
+// toolCtx is cancelled when the user interrupts the turn, killing a running bash command.
+var toolCtx = context.Background()
+
 func toolBash(args json.RawMessage) (string, error) {
 	var params struct {
 		Command string            `json:"command"`
@@ -228,7 +259,7 @@ func toolBash(args json.RawMessage) (string, error) {
 		timeout = params.Timeout
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+	ctx, cancel := context.WithTimeout(toolCtx, time.Duration(timeout)*time.Second)
 	defer cancel()
 
 	cmd := exec.CommandContext(ctx, "sh", "-c", params.Command)
@@ -251,6 +282,14 @@ func toolBash(args json.RawMessage) (string, error) {
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
+	if bashLive {
+		live := &liveOutput{}
+		liveOut, liveErr := live.stream(false), live.stream(true)
+		cmd.Stdout = io.MultiWriter(&stdout, liveOut)
+		cmd.Stderr = io.MultiWriter(&stderr, liveErr)
+		defer liveOut.Flush()
+		defer liveErr.Flush()
+	}
 
 	err := cmd.Run()
 
@@ -287,22 +326,37 @@ func toolBash(args json.RawMessage) (string, error) {
 
 func toolStartProcess(args json.RawMessage) (string, error) {
 	var params struct {
-		Command string            `json:"command"`
-		Workdir string            `json:"workdir"`
-		Env     map[string]string `json:"env"`
+		Command   string            `json:"command"`
+		Workdir   string            `json:"workdir"`
+		Env       map[string]string `json:"env"`
+		View      bool              `json:"view"`
+		PTY       bool              `json:"pty"`
+		Cols      int               `json:"cols"`
+		Rows      int               `json:"rows"`
+		KeepAlive bool              `json:"keep_alive"`
 	}
 	if err := json.Unmarshal(args, &params); err != nil {
 		return "", err
 	}
+	if params.PTY && params.KeepAlive {
+		return "error: keep_alive can't be combined with pty (the terminal closes when simpleagent exits)", nil
+	}
 
 	cmd := exec.Command("sh", "-c", params.Command)
-	setProcGroup(cmd)
+	if !params.PTY {
+		setProcGroup(cmd) // pty.Start makes the child a session leader instead
+	}
 
 	if params.Workdir != "" {
 		cmd.Dir = params.Workdir
 	}
-	if len(params.Env) > 0 {
+	if len(params.Env) > 0 || params.PTY {
 		cmd.Env = os.Environ()
+		if params.PTY {
+			// The agent's own TERM may be dumb or unset (serve mode); give
+			// the program a capable terminal unless env says otherwise.
+			cmd.Env = append(cmd.Env, "TERM=xterm-256color")
+		}
 		for k, v := range params.Env {
 			cmd.Env = append(cmd.Env, k+"="+v)
 		}
@@ -310,19 +364,17 @@ func toolStartProcess(args json.RawMessage) (string, error) {
 
 	const bufSize = 64 * 1024 // 64KB ring buffers
 
-	stdin, err := cmd.StdinPipe()
-	if err != nil {
-		return fmt.Sprintf("error: %v", err), nil
+	var stdin io.WriteCloser
+	if !params.PTY {
+		var err error
+		if stdin, err = cmd.StdinPipe(); err != nil {
+			return fmt.Sprintf("error: %v", err), nil
+		}
 	}
 
 	stdoutBuf := newRingBuffer(bufSize)
 	stderrBuf := newRingBuffer(bufSize)
-	cmd.Stdout = stdoutBuf
-	cmd.Stderr = stderrBuf
-
-	if err := cmd.Start(); err != nil {
-		return fmt.Sprintf("error starting process: %v", err), nil
-	}
+	var stdoutW, stderrW io.Writer = stdoutBuf, stderrBuf
 
 	id := uuid.New().String()[:8]
 	name := params.Command
@@ -330,36 +382,148 @@ func toolStartProcess(args json.RawMessage) (string, error) {
 		name = name[:60] + "..."
 	}
 
+	// Tee output into a log file the tmux/screen window tails
+	var view *logView
+	var viewNote string
+	if params.View {
+		v, err := newLogView(id)
+		if err != nil {
+			viewNote = fmt.Sprintf(" (no live view: %v)", err)
+		} else {
+			view = v
+			stdoutW = io.MultiWriter(stdoutBuf, v.log)
+			stderrW = io.MultiWriter(stderrBuf, v.log)
+		}
+	}
+
+	var ptmx *os.File
+	var logs *processLogs
+	var err error
+	switch {
+	case params.PTY:
+		ptmx, err = pty.StartWithSize(cmd, &pty.Winsize{Cols: uint16(orDefaultInt(params.Cols, 120)), Rows: uint16(orDefaultInt(params.Rows, 40))})
+		stdin = ptmx
+	case params.KeepAlive:
+		// Write straight to files: a pipe to this process would break when it exits.
+		if logs, err = createProcessLogs(id); err == nil {
+			cmd.Stdout, cmd.Stderr = logs.out, logs.err
+			err = cmd.Start()
+			logs.closeFiles()
+		}
+	default:
+		cmd.Stdout, cmd.Stderr = stdoutW, stderrW
+		err = cmd.Start()
+	}
+	if err != nil {
+		if view != nil {
+			view.Close()
+		}
+		return fmt.Sprintf("error starting process: %v", err), nil
+	}
+
+	// A pty has one output stream; copy it until the child side closes.
+	// Log files are tailed into the ring buffers until the process exits.
+	copied := make(chan struct{})
+	stopTail := make(chan struct{})
+	switch {
+	case ptmx != nil:
+		go func() {
+			io.Copy(stdoutW, ptmx)
+			close(copied)
+		}()
+	case logs != nil:
+		go func() {
+			logs.tail(stdoutW, stderrW, stopTail)
+			close(copied)
+		}()
+	default:
+		close(copied)
+	}
+
+	if view != nil {
+		if err := view.Open(); err != nil {
+			viewNote = fmt.Sprintf(" (no live view: %v)", err)
+		} else {
+			viewNote = " (live output in " + view.mux + " window " + view.window + ")"
+		}
+	}
+
 	mp := &ManagedProcess{
-		ID:      id,
-		Name:    name,
-		Cmd:     cmd,
-		Stdin:   stdin,
-		Stdout:  stdoutBuf,
-		Stderr:  stderrBuf,
-		Started: time.Now(),
+		ID:        id,
+		Name:      name,
+		Command:   params.Command,
+		Workdir:   params.Workdir,
+		Env:       params.Env,
+		Cmd:       cmd,
+		Pid:       cmd.Process.Pid,
+		StartID:   processStartID(cmd.Process.Pid),
+		Stdin:     stdin,
+		Stdout:    stdoutBuf,
+		Stderr:    stderrBuf,
+		Started:   time.Now(),
+		View:      view,
+		PTY:       ptmx,
+		KeepAlive: params.KeepAlive,
 	}
 
 	// Monitor process exit in background
 	go func() {
 		exitErr := cmd.Wait()
+		if ptmx != nil {
+			// Drain the last output; a grandchild holding the pty open
+			// mustn't keep the process from being reported done.
+			select {
+			case <-copied:
+			case <-time.After(time.Second):
+			}
+			ptmx.Close()
+		}
+		if logs != nil {
+			close(stopTail)
+			<-copied
+		}
+		if view != nil {
+			fmt.Fprintf(view.log, "\n[process exited: %v]\n", exitStatus(exitErr))
+			view.log.Close()
+		}
 		mp.mu.Lock()
 		mp.Done = true
 		mp.ExitErr = exitErr
 		mp.mu.Unlock()
+		if logs != nil {
+			removeProcessLogs(id)
+		}
+		saveProcessRegistry()
 	}()
 
 	processes.Lock()
 	processes.m[id] = mp
 	processes.Unlock()
+	saveProcessRegistry()
+
+	if ptmx != nil {
+		viewNote += " [pty]"
+	}
+	if params.KeepAlive {
+		viewNote += " [keep_alive]"
+	}
+	return fmt.Sprintf("started process %s (pid %d): %s%s", id, cmd.Process.Pid, name, viewNote), nil
+}
 
-	return fmt.Sprintf("started process %s (pid %d): %s", id, cmd.Process.Pid, name), nil
+func orDefaultInt(n, def int) int {
+	if n <= 0 {
+		return def
+	}
+	return n
 }
 
 func toolWriteStdin(args json.RawMessage) (string, error) {
 	var params struct {
 		ID   string `json:"id"`
 		Text string `json:"text"`
+		Raw  bool   `json:"raw"`
+		Cols int    `json:"cols"`
+		Rows int    `json:"rows"`
 	}
 	if err := json.Unmarshal(args, &params); err != nil {
 		return "", err
@@ -378,26 +542,58 @@ func toolWriteStdin(args json.RawMessage) (string, error) {
 	if done {
 		return "error: process has already exited", nil
 	}
+	if mp.Stdin == nil {
+		return "error: process was started by a previous run; its stdin is not available", nil
+	}
 
-	text := params.Text
-	if !strings.HasSuffix(text, "\n") {
-		text += "\n"
+	var notes []string
+	if params.Cols > 0 || params.Rows > 0 {
+		if mp.PTY == nil {
+			return "error: only processes started with pty can be resized", nil
+		}
+		size, _ := pty.GetsizeFull(mp.PTY)
+		if size == nil {
+			size = &pty.Winsize{Cols: 120, Rows: 40}
+		}
+		size.Cols = uint16(orDefaultInt(params.Cols, int(size.Cols)))
+		size.Rows = uint16(orDefaultInt(params.Rows, int(size.Rows)))
+		if err := pty.Setsize(mp.PTY, size); err != nil {
+			return fmt.Sprintf("error resizing terminal: %v", err), nil
+		}
+		notes = append(notes, fmt.Sprintf("resized process %s terminal to %dx%d", params.ID, size.Cols, size.Rows))
 	}
 
-	if _, err := io.WriteString(mp.Stdin, text); err != nil {
-		return fmt.Sprintf("error writing to stdin: %v", err), nil
+	if params.Text != "" || len(notes) == 0 {
+		text := params.Text
+		if !params.Raw && !strings.HasSuffix(text, "\n") {
+			text += "\n"
+		}
+		if _, err := io.WriteString(mp.Stdin, text); err != nil {
+			return fmt.Sprintf("error writing to stdin: %v", err), nil
+		}
+		notes = append(notes, fmt.Sprintf("wrote %d bytes to process %s stdin", len(text), params.ID))
 	}
-	return fmt.Sprintf("wrote %d bytes to process %s stdin", len(text), params.ID), nil
+	return strings.Join(notes, "; "), nil
 }
 
 func toolReadOutput(args json.RawMessage) (string, error) {
 	var params struct {
-		ID string `json:"id"`
+		ID             string `json:"id"`
+		WaitFor        string `json:"wait_for"`
+		TimeoutSeconds int    `json:"timeout_seconds"`
 	}
 	if err := json.Unmarshal(args, &params); err != nil {
 		return "", err
 	}
 
+	var re *regexp.Regexp
+	if params.WaitFor != "" {
+		var err error
+		if re, err = regexp.Compile(params.WaitFor); err != nil {
+			return fmt.Sprintf("error: invalid wait_for regex: %v", err), nil
+		}
+	}
+
 	processes.Lock()
 	mp, ok := processes.m[params.ID]
 	processes.Unlock()
@@ -405,13 +601,47 @@ func toolReadOutput(args json.RawMessage) (string, error) {
 		return fmt.Sprintf("error: no process with id %s", params.ID), nil
 	}
 
-	stdout := mp.Stdout.ReadUnread()
-	stderr := mp.Stderr.ReadUnread()
+	timeout := min(orDefaultInt(params.TimeoutSeconds, 30), 600)
+	deadline := time.Now().Add(time.Duration(timeout) * time.Second)
 
-	mp.mu.Lock()
-	done := mp.Done
-	exitErr := mp.ExitErr
-	mp.mu.Unlock()
+	var stdout, stderr string
+	var done bool
+	var exitErr error
+	var waitNote string
+	for {
+		// Exit status first: output read after it is complete if done.
+		mp.mu.Lock()
+		done = mp.Done
+		exitErr = mp.ExitErr
+		mp.mu.Unlock()
+
+		stdout += mp.Stdout.ReadUnread()
+		stderr += mp.Stderr.ReadUnread()
+		if mp.PTY != nil {
+			stdout = cleanTerminalOutput(stdout)
+		}
+
+		if re == nil {
+			break
+		}
+		if re.MatchString(stdout) || re.MatchString(stderr) {
+			waitNote = "[wait_for matched]"
+			break
+		}
+		if done {
+			waitNote = "[wait_for not matched: process exited]"
+			break
+		}
+		if toolCtx.Err() != nil {
+			waitNote = "[wait_for interrupted]"
+			break
+		}
+		if time.Now().After(deadline) {
+			waitNote = fmt.Sprintf("[wait_for not matched after %ds]", timeout)
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
 
 	var sb strings.Builder
 	if stdout != "" {
@@ -436,6 +666,13 @@ func toolReadOutput(args json.RawMessage) (string, error) {
 		}
 	}
 
+	if waitNote != "" {
+		if sb.Len() == 0 {
+			sb.WriteString("(no new output)")
+		}
+		sb.WriteString("\n" + waitNote)
+	}
+
 	if sb.Len() == 0 {
 		return "(no new output)", nil
 	}
@@ -457,36 +694,138 @@ func toolKillProcess(args json.RawMessage) (string, error) {
 		return fmt.Sprintf("error: no process with id %s", params.ID), nil
 	}
 
-	mp.mu.Lock()
-	done := mp.Done
-	mp.mu.Unlock()
-	if done {
+	if mp.OwnerPID != 0 {
+		return fmt.Sprintf("error: process %s belongs to the simpleagent running as PID %d; stop it from there", params.ID, mp.OwnerPID), nil
+	}
+
+	// exited also covers an adopted PID that now belongs to another process
+	if mp.exited() {
 		return fmt.Sprintf("process %s already exited", params.ID), nil
 	}
 
 	// Send SIGTERM (or Kill on Windows) to process group
-	terminateProcess(mp.Cmd)
+	terminateProcess(mp.Pid)
 
 	// Wait up to 3 seconds for graceful exit
-	done = false
+	done := false
 	for i := 0; i < 30; i++ {
 		time.Sleep(100 * time.Millisecond)
-		mp.mu.Lock()
-		done = mp.Done
-		mp.mu.Unlock()
-		if done {
+		if done = mp.exited(); done {
 			break
 		}
 	}
 
+	if mp.View != nil {
+		mp.View.Close()
+	}
+
 	if !done {
-		forceKillProcess(mp.Cmd)
+		forceKillProcess(mp.Pid)
 		return fmt.Sprintf("killed process %s (forced)", params.ID), nil
 	}
 
 	return fmt.Sprintf("terminated process %s", params.ID), nil
 }
 
+// exitStatus formats a Wait error as an exit code string ("0" on success).
+func exitStatus(err error) string {
+	if err == nil {
+		return "0"
+	}
+	return err.Error()
+}
+
+// logView mirrors a managed process's output into a tmux or screen window.
+// Output is teed to a log file and the window runs `tail -f` on it, so the
+// agent keeps reading through the ring buffers while the user watches live.
+type logView struct {
+	mux    string // "tmux" or "screen"
+	path   string
+	log    *os.File
+	window string // tmux window ID or screen window title
+}
+
+// newLogView creates the log file for process id. Fails when not running
+// inside tmux or screen.
+func newLogView(id string) (*logView, error) {
+	mux := ""
+	switch {
+	case os.Getenv("TMUX") != "":
+		mux = "tmux"
+	case os.Getenv("STY") != "":
+		mux = "screen"
+	default:
+		return nil, fmt.Errorf("not running inside tmux or screen")
+	}
+	if _, err := exec.LookPath(mux); err != nil {
+		return nil, fmt.Errorf("%s not found in PATH", mux)
+	}
+
+	// A fresh 0600 file: the output isn't redacted, and a predictable name
+	// in a shared /tmp could be a symlink planted by another user.
+	f, err := os.CreateTemp("", "simpleagent-"+id+"-*.log")
+	if err != nil {
+		return nil, err
+	}
+	return &logView{mux: mux, path: f.Name(), log: f, window: "sa-" + id}, nil
+}
+
+// Open starts the viewer window without stealing focus.
+func (v *logView) Open() error {
+	tail := "tail -n +1 -f " + shellQuote(v.path)
+	switch v.mux {
+	case "tmux":
+		out, err := exec.Command("tmux", "new-window", "-d", "-P", "-F", "#{window_id}", "-n", v.window, tail).Output()
+		if err != nil {
+			return fmt.Errorf("tmux new-window: %v", err)
+		}
+		v.window = strings.TrimSpace(string(out))
+	case "screen":
+		if err := exec.Command("screen", "-X", "screen", "-t", v.window, "sh", "-c", tail).Run(); err != nil {
+			return fmt.Errorf("screen: %v", err)
+		}
+	}
+	return nil
+}
+
+// Close tears down the viewer window and removes the log file.
+func (v *logView) Close() {
+	switch v.mux {
+	case "tmux":
+		if strings.HasPrefix(v.window, "@") {
+			exec.Command("tmux", "kill-window", "-t", v.window).Run()
+		}
+	case "screen":
+		exec.Command("screen", "-X", "-p", v.window, "kill").Run()
+	}
+	v.log.Close()
+	os.Remove(v.path)
+}
+
+// shellQuote single-quotes s for sh -c.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// runningProcesses snapshots managed processes that are still alive,
+// leaving out those shared from another simpleagent.
+func runningProcesses() []SavedProcess {
+	processes.Lock()
+	defer processes.Unlock()
+
+	var result []SavedProcess
+	for _, mp := range processes.m {
+		mp.mu.Lock()
+		done := mp.Done
+		mp.mu.Unlock()
+		if done || mp.OwnerPID != 0 {
+			continue
+		}
+		result = append(result, SavedProcess{Command: mp.Command, Workdir: mp.Workdir, Env: mp.Env, PTY: mp.PTY != nil})
+	}
+	return result
+}
+
 func toolListProcesses(args json.RawMessage) (string, error) {
 	processes.Lock()
 	defer processes.Unlock()
@@ -511,8 +850,55 @@ func toolListProcesses(args json.RawMessage) (string, error) {
 			}
 		}
 
+		if mp.PTY != nil {
+			status += " [pty]"
+		}
+		if mp.KeepAlive {
+			status += " [keep_alive]"
+		}
+		if mp.OwnerPID != 0 {
+			status += fmt.Sprintf(" [shared from PID %d]", mp.OwnerPID)
+		} else if mp.Adopted {
+			status += " [adopted]"
+		}
+
 		uptime := time.Since(mp.Started).Truncate(time.Second)
 		fmt.Fprintf(&sb, "%s  %s  %s  uptime=%s\n", id, status, mp.Name, uptime)
 	}
 	return sb.String(), nil
 }
+
+// ansiEscape matches terminal control sequences: CSI (colors, cursor moves),
+// OSC (window titles, hyperlinks), and two-byte escapes.
+var ansiEscape = regexp.MustCompile(`\x1b(\[[0-?]*[ -/]*[@-~]|\][^\x07\x1b]*(\x07|\x1b\\)|[@-Z\\-_])`)
+
+// cleanTerminalOutput turns raw pty output into plain lines: escape sequences
+// are dropped, CRLF becomes LF, a bare CR keeps only what was drawn after it
+// (progress bars, spinners), and backspaces erase the previous character.
+func cleanTerminalOutput(s string) string {
+	s = ansiEscape.ReplaceAllString(s, "")
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if j := strings.LastIndexByte(strings.TrimRight(line, "\r"), '\r'); j >= 0 {
+			line = line[j+1:]
+		}
+		line = strings.TrimRight(line, "\r")
+		if strings.ContainsRune(line, '\b') {
+			var out []rune
+			for _, r := range line {
+				if r == '\b' {
+					if len(out) > 0 {
+						out = out[:len(out)-1]
+					}
+					continue
+				}
+				out = append(out, r)
+			}
+			line = string(out)
+		}
+		lines[i] = line
+	}
+	return strings.Join(lines, "\n")
+}
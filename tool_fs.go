@@ -28,13 +28,20 @@ func registerFSTools(r *ToolRegistry) {
 	}, toolReadFile, false)
 
 	r.Register(ToolDef{
-		Name:        "write_file",
-		Description: "Write content to a file. Creates parent directories if needed.",
+		Name: "write_file",
+		Description: "Write content to a file. Creates parent directories if needed. " +
+			"For files too large for one call, write in parts: mode \"begin\" with the first part, \"continue\" for each middle part, " +
+			"and \"commit\" with the last part; the file is only written on commit.",
 		Parameters: map[string]any{
 			"type": "object",
 			"properties": map[string]any{
 				"path":    map[string]any{"type": "string", "description": "File path to write"},
-				"content": map[string]any{"type": "string", "description": "File content to write"},
+				"content": map[string]any{"type": "string", "description": "File content to write (or this part of it)"},
+				"mode": map[string]any{
+					"type":        "string",
+					"enum":        []string{"overwrite", "append", "begin", "continue", "commit"},
+					"description": "overwrite (default) replaces the file, append adds to the end of it; begin/continue/commit build the file in parts",
+				},
 			},
 			"required": []string{"path", "content"},
 		},
@@ -161,19 +168,24 @@ func toolReadFile(args json.RawMessage) (string, error) {
 		return fmt.Sprintf("error: %v", err), nil
 	}
 
-	lines := strings.Split(string(data), "\n")
+	return numberLines(string(data), params.Offset, params.Limit), nil
+}
+
+// numberLines formats content read_file-style: 1-based line numbers, optional window.
+func numberLines(content string, offset, limit int) string {
+	lines := strings.Split(content, "\n")
 
 	start := 0
-	if params.Offset > 0 {
-		start = params.Offset - 1
+	if offset > 0 {
+		start = offset - 1
 	}
 	if start > len(lines) {
 		start = len(lines)
 	}
 
 	end := len(lines)
-	if params.Limit > 0 {
-		end = start + params.Limit
+	if limit > 0 {
+		end = start + limit
 	}
 	if end > len(lines) {
 		end = len(lines)
@@ -183,27 +195,83 @@ func toolReadFile(args json.RawMessage) (string, error) {
 	for i := start; i < end; i++ {
 		fmt.Fprintf(&sb, "%4d\t%s\n", i+1, lines[i])
 	}
-	return sb.String(), nil
+	return sb.String()
+}
+
+// writeParts buffers the parts of chunked write_file calls by path until commit.
+var writeParts = make(map[string]*strings.Builder)
+
+// addWritePart handles the begin/continue/commit modes of write_file. It
+// returns the full content once committed; until then msg is the result.
+func addWritePart(path, mode, content string) (full string, done bool, msg string) {
+	key := cleanPath(path)
+	buf, started := writeParts[key]
+	switch mode {
+	case "", "overwrite":
+		delete(writeParts, key)
+		return content, true, ""
+	case "begin":
+		buf = &strings.Builder{}
+		writeParts[key] = buf
+	case "continue", "commit":
+		if !started {
+			return "", false, fmt.Sprintf("error: no chunked write in progress for %s; start with mode \"begin\"", path)
+		}
+	default:
+		return "", false, fmt.Sprintf("error: unknown mode %q", mode)
+	}
+
+	buf.WriteString(content)
+	if mode != "commit" {
+		return "", false, fmt.Sprintf("buffered %d bytes for %s (%d so far); not written until mode \"commit\"", len(content), path, buf.Len())
+	}
+	delete(writeParts, key)
+	return buf.String(), true, ""
 }
 
 func toolWriteFile(args json.RawMessage) (string, error) {
 	var params struct {
 		Path    string `json:"path"`
 		Content string `json:"content"`
+		Mode    string `json:"mode"`
 	}
 	if err := json.Unmarshal(args, &params); err != nil {
 		return "", err
 	}
 
+	content := params.Content
+	if params.Mode != "append" {
+		full, done, msg := addWritePart(params.Path, params.Mode, params.Content)
+		if !done {
+			return msg, nil
+		}
+		content = full
+	}
+
 	dir := filepath.Dir(params.Path)
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return fmt.Sprintf("error creating directory: %v", err), nil
 	}
 
-	if err := os.WriteFile(params.Path, []byte(params.Content), 0644); err != nil {
+	if params.Mode == "append" {
+		f, err := os.OpenFile(params.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Sprintf("error: %v", err), nil
+		}
+		_, err = f.WriteString(content)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return fmt.Sprintf("error: %v", err), nil
+		}
+		return fmt.Sprintf("appended %d bytes to %s", len(content), params.Path), nil
+	}
+
+	if err := os.WriteFile(params.Path, []byte(content), 0644); err != nil {
 		return fmt.Sprintf("error: %v", err), nil
 	}
-	return fmt.Sprintf("wrote %d bytes to %s", len(params.Content), params.Path), nil
+	return fmt.Sprintf("wrote %d bytes to %s", len(content), params.Path), nil
 }
 
 func toolEditFile(args json.RawMessage) (string, error) {
@@ -221,23 +289,29 @@ func toolEditFile(args json.RawMessage) (string, error) {
 		return fmt.Sprintf("error: %v", err), nil
 	}
 
-	content := string(data)
-	count := strings.Count(content, params.OldText)
-
-	if count == 0 {
-		return "error: old_text not found in file", nil
-	}
-	if count > 1 {
-		return fmt.Sprintf("error: old_text found %d times, must be unique", count), nil
+	newContent, errMsg := replaceUnique(string(data), params.OldText, params.NewText)
+	if errMsg != "" {
+		return errMsg, nil
 	}
-
-	newContent := strings.Replace(content, params.OldText, params.NewText, 1)
 	if err := os.WriteFile(params.Path, []byte(newContent), 0644); err != nil {
 		return fmt.Sprintf("error: %v", err), nil
 	}
 	return fmt.Sprintf("edited %s", params.Path), nil
 }
 
+// replaceUnique swaps the single occurrence of oldText. On failure it
+// returns the tool error message instead.
+func replaceUnique(content, oldText, newText string) (string, string) {
+	count := strings.Count(content, oldText)
+	if count == 0 {
+		return "", "error: old_text not found in file"
+	}
+	if count > 1 {
+		return "", fmt.Sprintf("error: old_text found %d times, must be unique", count)
+	}
+	return strings.Replace(content, oldText, newText, 1), ""
+}
+
 func toolListDir(args json.RawMessage) (string, error) {
 	var params struct {
 		Path      string `json:"path"`
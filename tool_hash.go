@@ -0,0 +1,185 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+func registerHashTools(r *ToolRegistry) {
+	r.Register(ToolDef{
+		Name: "hash_file",
+		Description: "Checksum a file, or a whole directory tree, with size and modification time. Pass expected to verify a download. " +
+			"A directory's hash is the hash of its manifest (one \"<hash>  <relative path>\" line per file, sorted), i.e. sha256sum's output for the sorted relative paths, hashed again; symlinks are listed by target, not followed.",
+		Parameters: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"path": map[string]any{"type": "string", "description": "File or directory"},
+				"algorithm": map[string]any{
+					"type":        "string",
+					"enum":        []string{"md5", "sha1", "sha256", "sha512"},
+					"description": "Hash algorithm (default sha256)",
+				},
+				"expected": map[string]any{"type": "string", "description": "Checksum to compare against (hex, case-insensitive)"},
+				"per_file": map[string]any{"type": "boolean", "description": "For a directory, also list each file's hash (default false)"},
+			},
+			"required": []string{"path"},
+		},
+	}, toolHashFile, false)
+}
+
+func newHash(algorithm string) hash.Hash {
+	switch algorithm {
+	case "md5":
+		return md5.New()
+	case "sha1":
+		return sha1.New()
+	case "sha512":
+		return sha512.New()
+	}
+	return sha256.New()
+}
+
+func hashFile(path, algorithm string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := newHash(algorithm)
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func toolHashFile(args json.RawMessage) (string, error) {
+	var params struct {
+		Path      string `json:"path"`
+		Algorithm string `json:"algorithm"`
+		Expected  string `json:"expected"`
+		PerFile   bool   `json:"per_file"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", err
+	}
+	algo := params.Algorithm
+	if algo == "" {
+		algo = "sha256"
+	}
+
+	info, err := os.Stat(params.Path)
+	if err != nil {
+		return fmt.Sprintf("error: %v", err), nil
+	}
+
+	var sb strings.Builder
+	var sum string
+	if info.IsDir() {
+		sum, err = hashTree(&sb, params.Path, algo, params.PerFile)
+		if err != nil {
+			return fmt.Sprintf("error: %v", err), nil
+		}
+	} else {
+		if sum, err = hashFile(params.Path, algo); err != nil {
+			return fmt.Sprintf("error: %v", err), nil
+		}
+		fmt.Fprintf(&sb, "%s: %s\n", algo, sum)
+		fmt.Fprintf(&sb, "size: %d\n", info.Size())
+		fmt.Fprintf(&sb, "modified: %s\n", info.ModTime().Format(time.RFC3339))
+	}
+
+	if params.Expected != "" {
+		want := strings.ToLower(strings.TrimSpace(params.Expected))
+		want = strings.TrimPrefix(want, algo+":")
+		if want == sum {
+			sb.WriteString("match: yes\n")
+		} else {
+			fmt.Fprintf(&sb, "match: NO (expected %s)\n", want)
+		}
+	}
+	return sb.String(), nil
+}
+
+// hashTree hashes every regular file under root and then the sorted
+// manifest. Symlinks are recorded by target, not followed.
+func hashTree(sb *strings.Builder, root, algo string, perFile bool) (string, error) {
+	type entry struct{ rel, sum string }
+	var entries []entry
+	var total int64
+	var latest time.Time
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, _ := filepath.Rel(root, p)
+		rel = filepath.ToSlash(rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+		switch {
+		case info.Mode()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			h := newHash(algo)
+			io.WriteString(h, target)
+			entries = append(entries, entry{rel + " -> " + target, hex.EncodeToString(h.Sum(nil))})
+		case info.Mode().IsRegular():
+			sum, err := hashFile(p, algo)
+			if err != nil {
+				return err
+			}
+			total += info.Size()
+			entries = append(entries, entry{rel, sum})
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].rel < entries[j].rel })
+
+	h := newHash(algo)
+	for _, e := range entries {
+		fmt.Fprintf(h, "%s  %s\n", e.sum, e.rel)
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+
+	fmt.Fprintf(sb, "%s (tree): %s\n", algo, sum)
+	fmt.Fprintf(sb, "files: %d\n", len(entries))
+	fmt.Fprintf(sb, "size: %d\n", total)
+	if !latest.IsZero() {
+		fmt.Fprintf(sb, "modified: %s (newest file)\n", latest.Format(time.RFC3339))
+	}
+	if perFile {
+		for i, e := range entries {
+			if i == 1000 {
+				fmt.Fprintf(sb, "... and %d more\n", len(entries)-1000)
+				break
+			}
+			fmt.Fprintf(sb, "%s  %s\n", e.sum, e.rel)
+		}
+	}
+	return sum, nil
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// HTTPPolicy restricts which hosts http_request may reach. Patterns are host
+// names: "example.com" matches it and its subdomains, "*.example.com" only
+// subdomains. Redirects are checked too.
+type HTTPPolicy struct {
+	Allow []string `json:"allow,omitempty"` // if set, the host must match one
+	Deny  []string `json:"deny,omitempty"`  // blocked outright
+}
+
+// Check reports why host is not allowed, or "" when it is.
+func (p HTTPPolicy) Check(host string) string {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, pat := range p.Deny {
+		if matchHostPattern(pat, host) {
+			return "host " + host + " denied by tools.http.deny: " + pat
+		}
+	}
+	if len(p.Allow) > 0 && !slices.ContainsFunc(p.Allow, func(pat string) bool { return matchHostPattern(pat, host) }) {
+		return "host " + host + " not in tools.http.allow"
+	}
+	return ""
+}
+
+func matchHostPattern(pat, host string) bool {
+	pat = strings.ToLower(strings.TrimSuffix(pat, "."))
+	if rest, ok := strings.CutPrefix(pat, "*."); ok {
+		return strings.HasSuffix(host, "."+rest)
+	}
+	return host == pat || strings.HasSuffix(host, "."+pat)
+}
+
+// sensitiveHeaders have their values replaced in the transcript.
+var sensitiveHeaders = map[string]bool{
+	"authorization":       true,
+	"proxy-authorization": true,
+	"cookie":              true,
+	"set-cookie":          true,
+	"x-api-key":           true,
+	"api-key":             true,
+	"x-auth-token":        true,
+}
+
+const redactedValue = "[REDACTED]"
+
+// safeMethods don't change anything on the server, so they're allowed in plan mode.
+var safeMethods = map[string]bool{"GET": true, "HEAD": true, "OPTIONS": true}
+
+// writesRemote reports whether a tool call changes remote state: an
+// http_request with a method other than GET, HEAD or OPTIONS.
+func writesRemote(name string, args json.RawMessage) bool {
+	if name != "http_request" {
+		return false
+	}
+	var params struct {
+		Method string `json:"method"`
+	}
+	json.Unmarshal(args, &params)
+	return params.Method != "" && !safeMethods[strings.ToUpper(params.Method)]
+}
+
+func registerHTTPTools(r *ToolRegistry) {
+	r.Register(ToolDef{
+		Name:        "http_request",
+		Description: "Make an HTTP request. Returns the status, response headers, and the start of the body. Prefer this over curl in bash.",
+		Parameters: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"method": map[string]any{"type": "string", "description": "HTTP method (default GET). Only GET, HEAD and OPTIONS are allowed in plan mode"},
+				"url":    map[string]any{"type": "string", "description": "Absolute http:// or https:// URL"},
+				"headers": map[string]any{
+					"type":                 "object",
+					"additionalProperties": map[string]any{"type": "string"},
+					"description":          "Request headers. Authorization and similar values are redacted from the transcript",
+				},
+				"body":      map[string]any{"type": "string", "description": "Request body"},
+				"timeout":   map[string]any{"type": "integer", "description": "Timeout in seconds (default 30, max 300)"},
+				"max_bytes": map[string]any{"type": "integer", "description": "Body bytes to return (default 20000)"},
+			},
+			"required": []string{"url"},
+		},
+	}, func(args json.RawMessage) (string, error) {
+		return toolHTTPRequest(r.http, args)
+	}, false)
+}
+
+func toolHTTPRequest(policy HTTPPolicy, args json.RawMessage) (string, error) {
+	var params struct {
+		Method   string            `json:"method"`
+		URL      string            `json:"url"`
+		Headers  map[string]string `json:"headers"`
+		Body     string            `json:"body"`
+		Timeout  int               `json:"timeout"`
+		MaxBytes int               `json:"max_bytes"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(params.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "error: url must be an absolute http:// or https:// URL", nil
+	}
+	if msg := policy.Check(u.Hostname()); msg != "" {
+		return "blocked: " + msg, nil
+	}
+
+	method := strings.ToUpper(orDefault(params.Method, "GET"))
+	timeout := min(orDefaultInt(params.Timeout, 30), 300)
+	maxBytes := orDefaultInt(params.MaxBytes, 20000)
+
+	ctx, cancel := context.WithTimeout(toolCtx, time.Duration(timeout)*time.Second)
+	defer cancel()
+
+	var body io.Reader
+	if params.Body != "" {
+		body = strings.NewReader(params.Body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return fmt.Sprintf("error: %v", err), nil
+	}
+	req.Header.Set("User-Agent", "simpleagent")
+	for k, v := range params.Headers {
+		req.Header.Set(k, v)
+	}
+
+	client := &http.Client{
+		CheckRedirect: func(next *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			if msg := policy.Check(next.URL.Hostname()); msg != "" {
+				return errors.New("redirect blocked: " + msg)
+			}
+			return nil
+		},
+	}
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return fmt.Sprintf("error: timed out after %ds", timeout), nil
+		}
+		return fmt.Sprintf("error: %v", err), nil
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, int64(maxBytes)+1))
+	elapsed := time.Since(start).Round(time.Millisecond)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s %s (%s)\n", resp.Proto, resp.Status, elapsed)
+	if resp.Request.URL.String() != u.String() {
+		fmt.Fprintf(&sb, "Final URL: %s\n", resp.Request.URL)
+	}
+	names := make([]string, 0, len(resp.Header))
+	for k := range resp.Header {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		for _, v := range resp.Header[k] {
+			if sensitiveHeaders[strings.ToLower(k)] {
+				v = redactedValue
+			}
+			fmt.Fprintf(&sb, "%s: %s\n", k, v)
+		}
+	}
+	sb.WriteString("\n")
+
+	truncated := len(data) > maxBytes
+	if truncated {
+		data = data[:maxBytes]
+	}
+	switch {
+	case err != nil:
+		fmt.Fprintf(&sb, "[error reading body: %v]", err)
+	case len(data) == 0:
+		sb.WriteString("(empty body)")
+	case !textual(resp.Header.Get("Content-Type"), data):
+		fmt.Fprintf(&sb, "[binary body, %s]", orDefault(resp.Header.Get("Content-Type"), "unknown type"))
+	default:
+		sb.Write(data)
+		if truncated {
+			fmt.Fprintf(&sb, "\n... [truncated at %d bytes]", maxBytes)
+		}
+	}
+	return sb.String(), nil
+}
+
+// textual reports whether a body can be shown as text.
+func textual(contentType string, data []byte) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		strings.HasSuffix(mediaType, "json"), strings.HasSuffix(mediaType, "xml"),
+		mediaType == "application/javascript", mediaType == "application/x-www-form-urlencoded":
+		return true
+	case mediaType == "" || mediaType == "application/octet-stream":
+		// The cut at max_bytes may split a rune; ignore the tail.
+		return utf8.Valid(data[:max(0, len(data)-utf8.UTFMax)])
+	}
+	return false
+}
+
+// redactToolCalls returns msg with sensitive http_request header values
+// replaced, for the transcript. The calls themselves run with the originals.
+func redactToolCalls(msg Message) Message {
+	if !slices.ContainsFunc(msg.ToolCalls, func(tc ToolCall) bool { return tc.Name == "http_request" }) {
+		return msg
+	}
+	calls := make([]ToolCall, len(msg.ToolCalls))
+	for i, tc := range msg.ToolCalls {
+		calls[i] = tc
+		if tc.Name == "http_request" {
+			calls[i].Args = redactHTTPArgs(tc.Args)
+		}
+	}
+	msg.ToolCalls = calls
+	return msg
+}
+
+func redactHTTPArgs(args json.RawMessage) json.RawMessage {
+	var params map[string]any
+	if json.Unmarshal(args, &params) != nil {
+		return args
+	}
+	headers, _ := params["headers"].(map[string]any)
+	changed := false
+	for k := range headers {
+		if sensitiveHeaders[strings.ToLower(k)] {
+			headers[k] = redactedValue
+			changed = true
+		}
+	}
+	if !changed {
+		return args
+	}
+	data, err := json.Marshal(params)
+	if err != nil {
+		return args
+	}
+	return data
+}
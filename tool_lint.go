@@ -0,0 +1,403 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// lintStep is one formatter or linter. Each file is fed on stdin, so staged
+// dry-run content is checked as the agent sees it. The first of bins that is
+// installed runs (goimports over gofmt, ruff over black).
+type lintStep struct {
+	bins   []string
+	exts   []string
+	format bool                                        // prints the formatted file; else reports problems
+	args   func(bin, path string) []string             // arguments after the binary
+	issues func(bin, path string, out []byte) []string // problems from a linter's output
+}
+
+var webExts = []string{".js", ".jsx", ".mjs", ".cjs", ".ts", ".tsx", ".vue", ".css", ".scss", ".json", ".md", ".yaml", ".yml", ".html"}
+
+var lintSteps = []lintStep{
+	{
+		bins: []string{"goimports", "gofmt"}, exts: []string{".go"}, format: true,
+		args: func(bin, path string) []string {
+			if bin == "goimports" {
+				return []string{"-srcdir", filepath.Dir(path)}
+			}
+			return nil
+		},
+	},
+	{
+		bins: []string{"ruff", "black"}, exts: []string{".py", ".pyi"}, format: true,
+		args: func(bin, path string) []string {
+			if bin == "ruff" {
+				return []string{"format", "--stdin-filename", path, "-"}
+			}
+			return []string{"-q", "--stdin-filename", path, "-"}
+		},
+	},
+	{
+		bins: []string{"prettier"}, exts: webExts, format: true,
+		args: func(bin, path string) []string { return []string{"--stdin-filepath", path} },
+	},
+	{
+		bins: []string{"ruff"}, exts: []string{".py", ".pyi"},
+		args: func(bin, path string) []string {
+			return []string{"check", "--output-format", "concise", "--stdin-filename", path, "-"}
+		},
+		issues: func(bin, path string, out []byte) []string {
+			var issues []string
+			for _, line := range strings.Split(string(out), "\n") {
+				if strings.HasPrefix(line, path+":") {
+					issues = append(issues, line)
+				}
+			}
+			return issues
+		},
+	},
+	{
+		bins: []string{"eslint"}, exts: []string{".js", ".jsx", ".mjs", ".cjs", ".ts", ".tsx", ".vue"},
+		args: func(bin, path string) []string {
+			return []string{"--stdin", "--stdin-filename", path, "--format", "json"}
+		},
+		issues: func(bin, path string, out []byte) []string {
+			var results []struct {
+				Messages []struct {
+					Line     int    `json:"line"`
+					Column   int    `json:"column"`
+					Message  string `json:"message"`
+					RuleID   string `json:"ruleId"`
+					Severity int    `json:"severity"`
+				} `json:"messages"`
+			}
+			json.Unmarshal(out, &results)
+			var issues []string
+			for _, res := range results {
+				for _, m := range res.Messages {
+					level := "warning"
+					if m.Severity == 2 {
+						level = "error"
+					}
+					issues = append(issues, fmt.Sprintf("%s:%d:%d: %s %s (%s)", path, m.Line, m.Column, level, m.Message, m.RuleID))
+				}
+			}
+			return issues
+		},
+	},
+}
+
+const (
+	lintMaxFiles  = 100
+	lintMaxReport = 20000
+)
+
+func registerLintTools(r *ToolRegistry) {
+	r.Register(ToolDef{
+		Name:        "lint",
+		Description: "Check files with the project's formatter and linter (gofmt/goimports, ruff/black, prettier, eslint; whichever are installed). Returns a unified diff of formatting changes and a list of lint problems. Defaults to the files changed in git. With fix, applies the formatting.",
+		Parameters: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"paths": map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "description": "Files or directories to check (default: files changed according to git status)"},
+				"fix":   map[string]any{"type": "boolean", "description": "Write the formatted files (lint problems are only reported)"},
+			},
+		},
+	}, func(args json.RawMessage) (string, error) {
+		return toolLint(r, args)
+	}, false)
+}
+
+// lintFixes reports whether a lint call writes files, for plan mode.
+func lintFixes(name string, args json.RawMessage) bool {
+	if name != "lint" {
+		return false
+	}
+	var params struct {
+		Fix bool `json:"fix"`
+	}
+	json.Unmarshal(args, &params)
+	return params.Fix
+}
+
+func toolLint(r *ToolRegistry, args json.RawMessage) (string, error) {
+	var params struct {
+		Paths []string `json:"paths"`
+		Fix   bool     `json:"fix"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", err
+	}
+	files, err := lintFiles(r, params.Paths)
+	if err != nil {
+		return fmt.Sprintf("error: %v", err), nil
+	}
+	if len(files) == 0 {
+		return "No files to check (nothing changed in git, or no supported file types).", nil
+	}
+	truncated := len(files) > lintMaxFiles
+	if truncated {
+		files = files[:lintMaxFiles]
+	}
+
+	var diffs, problems, fixed, failures []string
+	used := map[string]bool{}
+	missing := map[string]bool{}
+	for _, path := range files {
+		src, err := r.fileContent(path)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", path, err))
+			continue
+		}
+		formatted := src
+		for _, step := range lintSteps {
+			if !slices.Contains(step.exts, strings.ToLower(filepath.Ext(path))) {
+				continue
+			}
+			bin := lintBinary(step.bins)
+			if bin == "" {
+				for _, b := range step.bins {
+					missing[b] = true
+				}
+				continue
+			}
+			name := filepath.Base(bin)
+			used[name] = true
+			out, errOut, err := runLintStep(bin, step.args(name, path), formatted)
+			if step.format {
+				if err != nil {
+					failures = append(failures, fmt.Sprintf("%s: %s: %s", name, path, firstLines(strings.ReplaceAll(errOut, "<standard input>", path), 5)))
+					continue
+				}
+				formatted = out
+				continue
+			}
+			problems = append(problems, step.issues(name, path, []byte(out))...)
+		}
+		if formatted == src {
+			continue
+		}
+		if params.Fix {
+			if err := r.writeFormatted(path, formatted); err != nil {
+				failures = append(failures, fmt.Sprintf("%s: %v", path, err))
+				continue
+			}
+			fixed = append(fixed, path)
+		} else {
+			diffs = append(diffs, unifiedDiff(path, path, splitLines(src), splitLines(formatted), 3))
+		}
+	}
+
+	var sb strings.Builder
+	switch {
+	case len(fixed) > 0:
+		fmt.Fprintf(&sb, "Formatted %d file(s): %s\n", len(fixed), strings.Join(fixed, ", "))
+	case len(diffs) > 0:
+		fmt.Fprintf(&sb, "%d file(s) need formatting (lint with fix: true applies it):\n", len(diffs))
+		sb.WriteString(strings.Join(diffs, ""))
+	}
+	if len(problems) > 0 {
+		fmt.Fprintf(&sb, "%d lint problem(s):\n  %s\n", len(problems), strings.Join(problems, "\n  "))
+	}
+	if len(failures) > 0 {
+		sb.WriteString("Could not check:\n  " + strings.Join(failures, "\n  ") + "\n")
+	}
+	if sb.Len() == 0 {
+		fmt.Fprintf(&sb, "No issues in %d file(s).\n", len(files))
+	}
+	var tools []string
+	for name := range used {
+		tools = append(tools, name)
+	}
+	slices.Sort(tools)
+	if len(tools) > 0 {
+		fmt.Fprintf(&sb, "Checked with %s.", strings.Join(tools, ", "))
+	}
+	if len(missing) > 0 {
+		var names []string
+		for name := range missing {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		fmt.Fprintf(&sb, " Not installed: %s.", strings.Join(names, ", "))
+	}
+	if truncated {
+		fmt.Fprintf(&sb, " Only the first %d files were checked.", lintMaxFiles)
+	}
+
+	report := strings.TrimSpace(sb.String())
+	if len(report) > lintMaxReport {
+		report = report[:lintMaxReport] + "\n... [truncated]"
+	}
+	return report, nil
+}
+
+// lintFiles expands paths (directories walked, hidden and dependency dirs
+// skipped) to files some step handles. Without paths: files changed in git,
+// plus staged dry-run changes.
+func lintFiles(r *ToolRegistry, paths []string) ([]string, error) {
+	if len(paths) == 0 {
+		out, err := exec.Command("git", "status", "--porcelain", "--untracked-files=all").Output()
+		if err != nil {
+			return nil, fmt.Errorf("not a git repository; pass paths")
+		}
+		for _, line := range strings.Split(string(out), "\n") {
+			if len(line) < 4 || strings.Contains(line[:2], "D") {
+				continue
+			}
+			p := line[3:]
+			if _, after, ok := strings.Cut(p, " -> "); ok {
+				p = after
+			}
+			paths = append(paths, strings.Trim(p, `"`))
+		}
+		if r.DryRun != nil {
+			for _, c := range r.DryRun.changes {
+				if !c.Deleted {
+					paths = append(paths, c.Path)
+				}
+			}
+		}
+	}
+
+	var files []string
+	seen := map[string]bool{}
+	add := func(p string) {
+		if lintable(p) && !seen[filepath.Clean(p)] {
+			seen[filepath.Clean(p)] = true
+			files = append(files, p)
+		}
+	}
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil || !info.IsDir() {
+			add(p) // missing files are reported when read (or are staged)
+			continue
+		}
+		filepath.WalkDir(p, func(path string, d os.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if d.IsDir() {
+				if path != p && (strings.HasPrefix(d.Name(), ".") || slices.Contains(skipDirs, d.Name())) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			add(path)
+			return nil
+		})
+	}
+	return files, nil
+}
+
+func lintable(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, step := range lintSteps {
+		if slices.Contains(step.exts, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// lintBinary finds the first installed of bins, preferring the project's
+// node_modules/.bin for JavaScript tools.
+func lintBinary(bins []string) string {
+	for _, bin := range bins {
+		local := filepath.Join("node_modules", ".bin", bin)
+		if fileExists(local) {
+			abs, _ := filepath.Abs(local)
+			return abs
+		}
+		if path, err := exec.LookPath(bin); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// runLintStep pipes src through bin and returns stdout and stderr. Linters
+// exit non-zero when they find problems, so only a formatter's exit status
+// counts as a failure.
+func runLintStep(bin string, args []string, src string) (string, string, error) {
+	ctx, cancel := context.WithTimeout(toolCtx, 60*time.Second)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, bin, args...)
+	cmd.Stdin = strings.NewReader(src)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	return stdout.String(), stderr.String(), err
+}
+
+func firstLines(s string, n int) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	if len(lines) > n {
+		lines = lines[:n]
+	}
+	return strings.Join(lines, "; ")
+}
+
+// fileContent is path as the agent sees it: staged content in dry-run.
+func (r *ToolRegistry) fileContent(path string) (string, error) {
+	if r.DryRun != nil {
+		return r.DryRun.current(path)
+	}
+	data, err := os.ReadFile(path)
+	return string(data), err
+}
+
+// writeFormatted writes formatted content, or stages it in dry-run.
+func (r *ToolRegistry) writeFormatted(path, content string) error {
+	if r.DryRun != nil {
+		r.DryRun.stage(path, content, false, false)
+		return nil
+	}
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	return os.WriteFile(path, []byte(content), mode)
+}
+
+// formatOnWrite runs the file's formatter after a write_file, edit_file or
+// patch (tools.format_on_write) and returns a note for the tool result.
+func (r *ToolRegistry) formatOnWrite(path string) string {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, step := range lintSteps {
+		if !step.format || !slices.Contains(step.exts, ext) {
+			continue
+		}
+		bin := lintBinary(step.bins)
+		if bin == "" {
+			return ""
+		}
+		src, err := r.fileContent(path)
+		if err != nil {
+			return ""
+		}
+		name := filepath.Base(bin)
+		out, errOut, err := runLintStep(bin, step.args(name, path), src)
+		switch {
+		case err != nil:
+			return fmt.Sprintf("\n(%s failed, file left as written: %s)", name, firstLines(strings.ReplaceAll(errOut, "<standard input>", path), 3))
+		case out == src:
+			return ""
+		}
+		if err := r.writeFormatted(path, out); err != nil {
+			return ""
+		}
+		return fmt.Sprintf("\n(formatted with %s; re-read the file before editing it again)", name)
+	}
+	return ""
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+func registerNotebookTools(r *ToolRegistry) {
+	r.Register(ToolDef{
+		Name: "read_notebook",
+		Description: "Read a Jupyter notebook (.ipynb) as numbered cells. Outputs are summarized, not included, " +
+			"unless outputs is true (text only; images and other binary data are never shown). Use this instead of read_file for notebooks.",
+		Parameters: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"path":    map[string]any{"type": "string", "description": "Notebook path"},
+				"outputs": map[string]any{"type": "boolean", "description": "Include text outputs, truncated (default false)"},
+			},
+			"required": []string{"path"},
+		},
+	}, toolReadNotebook, false)
+
+	r.Register(ToolDef{
+		Name: "edit_notebook_cell",
+		Description: "Replace, insert, or delete one cell of a Jupyter notebook, keeping its metadata intact. " +
+			"Cell indices are those shown by read_notebook. Replacing a code cell clears its outputs. Never use write_file on notebooks.",
+		Parameters: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"path":  map[string]any{"type": "string", "description": "Notebook path"},
+				"index": map[string]any{"type": "integer", "description": "Cell index (0-based). For insert, the new cell goes at this index; the cell count appends."},
+				"action": map[string]any{
+					"type":        "string",
+					"enum":        []string{"replace", "insert", "delete"},
+					"description": "replace (default), insert, or delete",
+				},
+				"source": map[string]any{"type": "string", "description": "New cell source (replace, insert)"},
+				"cell_type": map[string]any{
+					"type":        "string",
+					"enum":        []string{"code", "markdown", "raw"},
+					"description": "Cell type for insert (default code), or to change it on replace",
+				},
+			},
+			"required": []string{"path", "index"},
+		},
+	}, toolEditNotebookCell, true)
+}
+
+// notebook keeps every field it doesn't touch as raw JSON, so metadata,
+// widget state, and attachments survive an edit unchanged.
+type notebook struct {
+	fields map[string]json.RawMessage
+	cells  []map[string]json.RawMessage
+}
+
+func parseNotebook(data []byte) (*notebook, error) {
+	nb := &notebook{}
+	if err := json.Unmarshal(data, &nb.fields); err != nil {
+		return nil, fmt.Errorf("not a notebook: %v", err)
+	}
+	raw, ok := nb.fields["cells"]
+	if !ok {
+		return nil, fmt.Errorf("not a notebook: no cells")
+	}
+	if err := json.Unmarshal(raw, &nb.cells); err != nil {
+		return nil, fmt.Errorf("not a notebook: %v", err)
+	}
+	return nb, nil
+}
+
+// marshal writes the notebook the way Jupyter does: one-space indent,
+// sorted keys, no HTML escaping, trailing newline.
+func (nb *notebook) marshal() ([]byte, error) {
+	cells, err := json.Marshal(nb.cells)
+	if err != nil {
+		return nil, err
+	}
+	nb.fields["cells"] = cells
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", " ")
+	if err := enc.Encode(nb.fields); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// needsCellIDs reports whether the format (4.5+) requires an id on each cell.
+func (nb *notebook) needsCellIDs() bool {
+	var major, minor int
+	json.Unmarshal(nb.fields["nbformat"], &major)
+	json.Unmarshal(nb.fields["nbformat_minor"], &minor)
+	return major > 4 || (major == 4 && minor >= 5)
+}
+
+func (nb *notebook) kernel() string {
+	var meta struct {
+		Kernelspec struct {
+			Name string `json:"name"`
+		} `json:"kernelspec"`
+		LanguageInfo struct {
+			Name string `json:"name"`
+		} `json:"language_info"`
+	}
+	json.Unmarshal(nb.fields["metadata"], &meta)
+	if meta.Kernelspec.Name != "" {
+		return meta.Kernelspec.Name
+	}
+	return meta.LanguageInfo.Name
+}
+
+func cellString(cell map[string]json.RawMessage, key string) string {
+	var s string
+	json.Unmarshal(cell[key], &s)
+	return s
+}
+
+// cellSource joins a cell's source, which nbformat allows as a string or a
+// list of lines.
+func cellSource(cell map[string]json.RawMessage) string {
+	var lines []string
+	if json.Unmarshal(cell["source"], &lines) == nil {
+		return strings.Join(lines, "")
+	}
+	return cellString(cell, "source")
+}
+
+// sourceLines splits source into nbformat lines: each keeps its "\n"
+// except the last.
+func sourceLines(source string) []string {
+	lines := strings.SplitAfter(source, "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if lines == nil {
+		lines = []string{}
+	}
+	return lines
+}
+
+type notebookOutput struct {
+	OutputType string                     `json:"output_type"`
+	Name       string                     `json:"name"`
+	Text       json.RawMessage            `json:"text"`
+	Data       map[string]json.RawMessage `json:"data"`
+	Ename      string                     `json:"ename"`
+	Evalue     string                     `json:"evalue"`
+}
+
+// joinText reads an output's text, a string or a list of lines.
+func joinText(raw json.RawMessage) string {
+	var lines []string
+	if json.Unmarshal(raw, &lines) == nil {
+		return strings.Join(lines, "")
+	}
+	var s string
+	json.Unmarshal(raw, &s)
+	return s
+}
+
+// renderOutputs summarizes a code cell's outputs, or shows their text.
+func renderOutputs(raw json.RawMessage, full bool) string {
+	var outputs []notebookOutput
+	if json.Unmarshal(raw, &outputs) != nil || len(outputs) == 0 {
+		return ""
+	}
+	var kinds []string
+	var text strings.Builder
+	for _, o := range outputs {
+		switch o.OutputType {
+		case "stream":
+			kinds = append(kinds, o.Name)
+			text.WriteString(joinText(o.Text))
+		case "error":
+			kinds = append(kinds, "error "+o.Ename)
+			text.WriteString(o.Ename + ": " + o.Evalue + "\n")
+		default: // execute_result, display_data
+			mimes := make([]string, 0, len(o.Data))
+			for m := range o.Data {
+				mimes = append(mimes, m)
+			}
+			sort.Strings(mimes)
+			kinds = append(kinds, strings.Join(mimes, "+"))
+			if t, ok := o.Data["text/plain"]; ok {
+				text.WriteString(joinText(t))
+				if !strings.HasSuffix(text.String(), "\n") {
+					text.WriteString("\n")
+				}
+			} else {
+				text.WriteString("[" + strings.Join(mimes, ", ") + "]\n")
+			}
+		}
+	}
+	s := fmt.Sprintf("  outputs: %s\n", strings.Join(kinds, ", "))
+	if full {
+		t := text.String()
+		if len(t) > 2000 {
+			t = t[:2000] + "\n... (truncated)\n"
+		}
+		s += "  --- output ---\n" + t
+		if !strings.HasSuffix(s, "\n") {
+			s += "\n"
+		}
+	}
+	return s
+}
+
+// renderNotebook shows the cells for the model, with indices and without
+// base64 payloads.
+func renderNotebook(path string, data []byte, outputs bool) (string, error) {
+	nb, err := parseNotebook(data)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s: %d cells", path, len(nb.cells))
+	if k := nb.kernel(); k != "" {
+		fmt.Fprintf(&sb, " (%s)", k)
+	}
+	sb.WriteString("\n")
+	for i, cell := range nb.cells {
+		typ := cellString(cell, "cell_type")
+		header := fmt.Sprintf("\n[%d] %s", i, typ)
+		if typ == "code" {
+			var count *int
+			json.Unmarshal(cell["execution_count"], &count)
+			if count != nil {
+				header += fmt.Sprintf(" (In [%d])", *count)
+			}
+		}
+		sb.WriteString(header + "\n")
+		src := cellSource(cell)
+		sb.WriteString(src)
+		if src != "" && !strings.HasSuffix(src, "\n") {
+			sb.WriteString("\n")
+		}
+		if typ == "code" {
+			sb.WriteString(renderOutputs(cell["outputs"], outputs))
+		}
+	}
+	return sb.String(), nil
+}
+
+type notebookEdit struct {
+	Path     string `json:"path"`
+	Index    int    `json:"index"`
+	Action   string `json:"action"`
+	Source   string `json:"source"`
+	CellType string `json:"cell_type"`
+}
+
+func rawJSON(v any) json.RawMessage {
+	b, _ := json.Marshal(v)
+	return b
+}
+
+// setCellType converts a cell, adding or dropping the code-only fields.
+func setCellType(cell map[string]json.RawMessage, typ string) {
+	cell["cell_type"] = rawJSON(typ)
+	if typ == "code" {
+		cell["outputs"] = rawJSON([]any{})
+		cell["execution_count"] = rawJSON(nil)
+	} else {
+		delete(cell, "outputs")
+		delete(cell, "execution_count")
+	}
+}
+
+// editNotebook applies one cell edit and returns the new file and a summary.
+func editNotebook(data []byte, p notebookEdit) ([]byte, string, error) {
+	nb, err := parseNotebook(data)
+	if err != nil {
+		return nil, "", err
+	}
+	if p.Action == "" {
+		p.Action = "replace"
+	}
+	limit := len(nb.cells)
+	if p.Action == "insert" {
+		limit++ // insert may append
+	}
+	if p.Index < 0 || p.Index >= limit {
+		return nil, "", fmt.Errorf("index %d out of range (notebook has %d cells)", p.Index, len(nb.cells))
+	}
+
+	var summary string
+	switch p.Action {
+	case "delete":
+		typ := cellString(nb.cells[p.Index], "cell_type")
+		nb.cells = append(nb.cells[:p.Index], nb.cells[p.Index+1:]...)
+		summary = fmt.Sprintf("deleted cell %d (%s)", p.Index, typ)
+	case "insert":
+		typ := p.CellType
+		if typ == "" {
+			typ = "code"
+		}
+		cell := map[string]json.RawMessage{
+			"metadata": rawJSON(map[string]any{}),
+			"source":   rawJSON(sourceLines(p.Source)),
+		}
+		setCellType(cell, typ)
+		if nb.needsCellIDs() {
+			id := make([]byte, 4)
+			rand.Read(id)
+			cell["id"] = rawJSON(hex.EncodeToString(id))
+		}
+		nb.cells = append(nb.cells[:p.Index], append([]map[string]json.RawMessage{cell}, nb.cells[p.Index:]...)...)
+		summary = fmt.Sprintf("inserted %s cell at %d", typ, p.Index)
+	default:
+		cell := nb.cells[p.Index]
+		cell["source"] = rawJSON(sourceLines(p.Source))
+		typ := cellString(cell, "cell_type")
+		if p.CellType != "" && p.CellType != typ {
+			typ = p.CellType
+			setCellType(cell, typ)
+		} else if typ == "code" {
+			setCellType(cell, typ) // outputs no longer match the source
+		}
+		summary = fmt.Sprintf("replaced cell %d (%s)", p.Index, typ)
+	}
+
+	out, err := nb.marshal()
+	if err != nil {
+		return nil, "", err
+	}
+	return out, fmt.Sprintf("%s; notebook now has %d cells", summary, len(nb.cells)), nil
+}
+
+func toolReadNotebook(args json.RawMessage) (string, error) {
+	var params struct {
+		Path    string `json:"path"`
+		Outputs bool   `json:"outputs"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(params.Path)
+	if err != nil {
+		return fmt.Sprintf("error reading notebook: %v", err), nil
+	}
+	out, err := renderNotebook(params.Path, data, params.Outputs)
+	if err != nil {
+		return fmt.Sprintf("error: %s: %v", params.Path, err), nil
+	}
+	return out, nil
+}
+
+func toolEditNotebookCell(args json.RawMessage) (string, error) {
+	var params notebookEdit
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", err
+	}
+	info, err := os.Stat(params.Path)
+	if err != nil {
+		return fmt.Sprintf("error reading notebook: %v", err), nil
+	}
+	data, err := os.ReadFile(params.Path)
+	if err != nil {
+		return fmt.Sprintf("error reading notebook: %v", err), nil
+	}
+	out, summary, err := editNotebook(data, params)
+	if err != nil {
+		return fmt.Sprintf("error: %s: %v", params.Path, err), nil
+	}
+	if err := os.WriteFile(params.Path, out, info.Mode().Perm()); err != nil {
+		return fmt.Sprintf("error writing notebook: %v", err), nil
+	}
+	return fmt.Sprintf("%s in %s", summary, params.Path), nil
+}
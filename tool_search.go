@@ -1,9 +1,12 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"regexp"
 	"strings"
@@ -63,7 +66,13 @@ func toolGrep(args json.RawMessage) (string, error) {
 
 	var results strings.Builder
 	matchCount := 0
-	const maxMatches = 200
+
+	if rg, err := exec.LookPath("rg"); err == nil {
+		if n, ok := grepRipgrep(rg, params.Pattern, searchPath, params.Include, &results); ok {
+			return grepResult(&results, n), nil
+		}
+		results.Reset()
+	}
 
 	filepath.Walk(searchPath, func(path string, info os.FileInfo, err error) error {
 		if err != nil || info.IsDir() {
@@ -122,13 +131,93 @@ func toolGrep(args json.RawMessage) (string, error) {
 		return nil
 	})
 
+	return grepResult(&results, matchCount), nil
+}
+
+// maxMatches caps grep output, whichever backend runs.
+const maxMatches = 200
+
+func grepResult(results *strings.Builder, matchCount int) string {
 	if matchCount == 0 {
-		return "no matches found", nil
+		return "no matches found"
 	}
 	if matchCount >= maxMatches {
-		fmt.Fprintf(&results, "\n... [truncated at %d matches]", maxMatches)
+		fmt.Fprintf(results, "\n... [truncated at %d matches]", maxMatches)
 	}
-	return results.String(), nil
+	return results.String()
+}
+
+// rgText is ripgrep's JSON string form: text, or base64 bytes when not UTF-8.
+type rgText struct {
+	Text  string `json:"text"`
+	Bytes []byte `json:"bytes"`
+}
+
+func (t rgText) String() string {
+	if t.Bytes != nil {
+		return string(t.Bytes)
+	}
+	return t.Text
+}
+
+// grepRipgrep runs the search with ripgrep, writing matches in the same
+// path:line: text format as the built-in walker. Like the walker it skips
+// hidden files, binaries, node_modules and vendor; it also honors .gitignore.
+// ok is false when rg fails outright, so the caller can fall back.
+func grepRipgrep(rg, pattern, path, include string, results *strings.Builder) (matchCount int, ok bool) {
+	ctx, cancel := context.WithCancel(toolCtx)
+	defer cancel()
+
+	args := []string{"--json", "--no-messages", "--glob", "!node_modules/", "--glob", "!vendor/"}
+	if include != "" {
+		args = append(args, "--glob", include)
+	}
+	args = append(args, "-e", pattern)
+	if path != "." {
+		args = append(args, "--", path) // rg searches "." by default and prints paths without the ./ prefix
+	}
+
+	cmd := exec.CommandContext(ctx, rg, args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return 0, false
+	}
+	if err := cmd.Start(); err != nil {
+		return 0, false
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() && matchCount < maxMatches {
+		var ev struct {
+			Type string `json:"type"`
+			Data struct {
+				Path       rgText `json:"path"`
+				Lines      rgText `json:"lines"`
+				LineNumber int    `json:"line_number"`
+			} `json:"data"`
+		}
+		if json.Unmarshal(scanner.Bytes(), &ev) != nil || ev.Type != "match" {
+			continue
+		}
+		line := strings.TrimRight(ev.Data.Lines.String(), "\r\n")
+		fmt.Fprintf(results, "%s:%d: %s\n", ev.Data.Path, ev.Data.LineNumber, line)
+		matchCount++
+	}
+	if matchCount >= maxMatches {
+		cancel() // enough; stop rg instead of draining the rest
+	}
+	err = cmd.Wait()
+
+	// Exit status 1 means no matches; 2 means errors, which only matter
+	// when nothing was found (e.g. a regex rg rejects but Go accepts).
+	if matchCount > 0 || ctx.Err() != nil {
+		return matchCount, true
+	}
+	if exit, isExit := err.(*exec.ExitError); err == nil || (isExit && exit.ExitCode() == 1) {
+		return 0, true
+	}
+	return 0, false
 }
 
 func toolFindFiles(args json.RawMessage) (string, error) {
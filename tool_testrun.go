@@ -0,0 +1,472 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// testFrameworks are the runners run_tests knows how to parse.
+var testFrameworks = []string{"go", "pytest", "jest", "cargo"}
+
+const (
+	testTimeout     = 600 // default seconds for a run
+	testMaxFailures = 20  // failing names listed in the summary
+	testExcerpt     = 40  // lines of the first failure shown
+)
+
+func registerTestTools(r *ToolRegistry) {
+	r.Register(ToolDef{
+		Name:        "run_tests",
+		Description: "Run the project's tests (go test, pytest, jest, cargo test; detected from the project) and return a compact summary: pass/fail counts, failing test names, and the first failure's output. The full log is saved to the scratch directory. Prefer this over running tests with bash.",
+		Parameters: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"framework": map[string]any{"type": "string", "enum": testFrameworks, "description": "Test runner to use (default: detected)"},
+				"path":      map[string]any{"type": "string", "description": "What to test: a Go package pattern (default ./...), a pytest or jest file/directory, or a cargo package name"},
+				"filter":    map[string]any{"type": "string", "description": "Only run matching tests: go -run regex, pytest -k expression, jest -t pattern, cargo name filter"},
+				"workdir":   map[string]any{"type": "string", "description": "Project directory (default: current)"},
+				"timeout":   map[string]any{"type": "integer", "description": "Timeout in seconds (default 600)"},
+			},
+		},
+	}, func(args json.RawMessage) (string, error) {
+		return toolRunTests(r, args)
+	}, true)
+}
+
+// testRun is a parsed test run.
+type testRun struct {
+	passed, failed, skipped int
+	failures                []string // failing test names, in order
+	excerpt                 string   // output of the first failure
+	parsed                  bool     // the runner's output was understood
+}
+
+func toolRunTests(r *ToolRegistry, args json.RawMessage) (string, error) {
+	var params struct {
+		Framework string `json:"framework"`
+		Path      string `json:"path"`
+		Filter    string `json:"filter"`
+		Workdir   string `json:"workdir"`
+		Timeout   int    `json:"timeout"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", err
+	}
+	root := params.Workdir
+	if root == "" {
+		root = "."
+	}
+	framework := params.Framework
+	if framework == "" {
+		if framework = detectTestFramework(root); framework == "" {
+			return "error: no go.mod, Cargo.toml, jest config or pytest setup found; pass framework, or run the tests with bash", nil
+		}
+	}
+
+	var argv []string
+	var report string // jest writes its JSON report here
+	switch framework {
+	case "go":
+		argv = []string{"go", "test", "-json"}
+		if params.Filter != "" {
+			argv = append(argv, "-run", params.Filter)
+		}
+		argv = append(argv, orDefault(params.Path, "./..."))
+	case "cargo":
+		argv = []string{"cargo", "test"}
+		if params.Path != "" {
+			argv = append(argv, "-p", params.Path)
+		}
+		if params.Filter != "" {
+			argv = append(argv, params.Filter)
+		}
+	case "pytest":
+		argv = []string{"python3", "-m", "pytest", "-q", "-rfE", "--tb=short", "-p", "no:cacheprovider"}
+		if _, err := exec.LookPath("pytest"); err == nil {
+			argv = append([]string{"pytest"}, argv[3:]...)
+		}
+		if params.Filter != "" {
+			argv = append(argv, "-k", params.Filter)
+		}
+		if params.Path != "" {
+			argv = append(argv, params.Path)
+		}
+	case "jest":
+		f, err := os.CreateTemp(r.Scratch, "jest-*.json")
+		if err != nil {
+			return "", err
+		}
+		f.Close()
+		report, _ = filepath.Abs(f.Name())
+		defer os.Remove(report)
+		argv = append(jestCommand(root), "--json", "--outputFile="+report, "--ci")
+		if params.Filter != "" {
+			argv = append(argv, "-t", params.Filter)
+		}
+		if params.Path != "" {
+			argv = append(argv, params.Path)
+		}
+	default:
+		return fmt.Sprintf("error: unknown framework %q (%s)", framework, strings.Join(testFrameworks, ", ")), nil
+	}
+
+	timeout := testTimeout
+	if params.Timeout > 0 {
+		timeout = params.Timeout
+	}
+	ctx, cancel := context.WithTimeout(toolCtx, time.Duration(timeout)*time.Second)
+	defer cancel()
+	start := time.Now()
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Dir = root
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err := cmd.Run()
+	elapsed := time.Since(start).Round(100 * time.Millisecond)
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Sprintf("%s\n[timed out after %ds]", tailLines(out.String(), testExcerpt), timeout), nil
+	}
+	if _, ok := err.(*exec.ExitError); err != nil && !ok {
+		return fmt.Sprintf("error: running %s: %v", argv[0], err), nil
+	}
+
+	var run testRun
+	switch framework {
+	case "go":
+		run = parseGoTest(out.Bytes())
+	case "cargo":
+		run = parseCargoTest(out.String())
+	case "pytest":
+		run = parsePytest(out.String())
+	case "jest":
+		data, _ := os.ReadFile(report)
+		run = parseJest(data, root)
+	}
+
+	var sb strings.Builder
+	status := "PASS"
+	if err != nil || run.failed > 0 {
+		status = "FAIL"
+	}
+	shown := strings.Join(argv, " ")
+	if report != "" {
+		shown = strings.Replace(shown, " --outputFile="+report, "", 1)
+	}
+	fmt.Fprintf(&sb, "%s: %s", shown, status)
+	if run.parsed {
+		fmt.Fprintf(&sb, " — %d passed, %d failed", run.passed, run.failed)
+		if run.skipped > 0 {
+			fmt.Fprintf(&sb, ", %d skipped", run.skipped)
+		}
+	}
+	fmt.Fprintf(&sb, " (%s)\n", elapsed)
+	if len(run.failures) > 0 {
+		sb.WriteString("Failed:\n")
+		for i, name := range run.failures {
+			if i == testMaxFailures {
+				fmt.Fprintf(&sb, "  ... and %d more\n", len(run.failures)-i)
+				break
+			}
+			sb.WriteString("  " + name + "\n")
+		}
+	}
+	switch {
+	case run.excerpt != "":
+		fmt.Fprintf(&sb, "First failure (%s):\n%s\n", run.failures[0], indentLines(headLines(run.excerpt, testExcerpt)))
+	case err != nil:
+		// A build error or a crash: no test results to summarize
+		sb.WriteString("Output:\n" + indentLines(tailLines(out.String(), testExcerpt)) + "\n")
+	}
+	if r.Scratch != "" {
+		log := filepath.Join(r.Scratch, fmt.Sprintf("tests-%s.log", time.Now().Format("150405")))
+		if os.WriteFile(log, out.Bytes(), 0644) == nil {
+			fmt.Fprintf(&sb, "Full output (%d lines): %s\n", strings.Count(out.String(), "\n"), log)
+		}
+	}
+	return strings.TrimRight(sb.String(), "\n"), nil
+}
+
+// detectTestFramework picks the runner for the project at root.
+func detectTestFramework(root string) string {
+	switch {
+	case fileExists(filepath.Join(root, "go.mod")):
+		return "go"
+	case fileExists(filepath.Join(root, "Cargo.toml")):
+		return "cargo"
+	case usesJest(root):
+		return "jest"
+	case testRunner(root, readPyproject(root)) == "pytest",
+		fileExists(filepath.Join(root, "pyproject.toml")), fileExists(filepath.Join(root, "setup.py")):
+		return "pytest"
+	}
+	return ""
+}
+
+// usesJest reports whether package.json depends on jest or tests with it.
+func usesJest(root string) bool {
+	var pkg struct {
+		Scripts         map[string]string `json:"scripts"`
+		Dependencies    map[string]string `json:"dependencies"`
+		DevDependencies map[string]string `json:"devDependencies"`
+	}
+	data, err := os.ReadFile(filepath.Join(root, "package.json"))
+	if err != nil || json.Unmarshal(data, &pkg) != nil {
+		return false
+	}
+	_, dev := pkg.DevDependencies["jest"]
+	_, dep := pkg.Dependencies["jest"]
+	return dev || dep || strings.Contains(pkg.Scripts["test"], "jest")
+}
+
+// jestCommand runs the project's own jest through its package manager.
+func jestCommand(root string) []string {
+	switch nodePackageManager(root) {
+	case "pnpm":
+		return []string{"pnpm", "exec", "jest"}
+	case "yarn":
+		return []string{"yarn", "jest"}
+	case "bun":
+		return []string{"bunx", "jest"}
+	}
+	return []string{"npx", "jest"}
+}
+
+// parseGoTest reads `go test -json` events. Output is kept per test so the
+// first failure's log can be shown without the RUN/PASS noise.
+func parseGoTest(data []byte) testRun {
+	var run testRun
+	logs := make(map[string]*strings.Builder)
+	var plain strings.Builder // before Go 1.24, build errors come as text
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for sc.Scan() {
+		var ev struct {
+			Action      string
+			Package     string
+			ImportPath  string // build-output
+			FailedBuild string
+			Test        string
+			Output      string
+		}
+		if json.Unmarshal(sc.Bytes(), &ev) != nil || ev.Action == "" {
+			plain.Write(sc.Bytes())
+			plain.WriteByte('\n')
+			continue
+		}
+		run.parsed = true
+		name := ev.Package
+		switch {
+		case ev.Test != "":
+			name += "." + ev.Test
+		case ev.Action == "build-output":
+			name = ev.ImportPath
+		}
+		switch ev.Action {
+		case "output", "build-output":
+			trimmed := strings.TrimSpace(ev.Output)
+			if strings.HasPrefix(trimmed, "=== ") || strings.HasPrefix(trimmed, "--- ") {
+				continue
+			}
+			if logs[name] == nil {
+				logs[name] = &strings.Builder{}
+			}
+			logs[name].WriteString(strings.TrimPrefix(ev.Output, "    ")) // t.Log indent
+		case "pass":
+			if ev.Test != "" {
+				run.passed++
+			}
+		case "skip":
+			if ev.Test != "" {
+				run.skipped++
+			}
+		case "fail":
+			if ev.Test == "" && hasPrefixIn(run.failures, ev.Package+".") {
+				continue // the package fails because its tests did
+			}
+			if ev.Test == "" && (ev.FailedBuild != "" || plain.Len() > 0) {
+				name += " (build failed)"
+				logs[name] = logs[ev.FailedBuild]
+				if logs[name] == nil {
+					logs[name] = &plain
+				}
+			}
+			run.failures = append(run.failures, name)
+		}
+	}
+	// A parent test fails with its subtest; count and name the subtest
+	var failures []string
+	for _, name := range run.failures {
+		if !hasPrefixIn(run.failures, name+"/") {
+			failures = append(failures, name)
+		}
+	}
+	run.failures = failures
+	run.failed = len(failures)
+	if len(run.failures) > 0 && logs[run.failures[0]] != nil {
+		run.excerpt = strings.TrimRight(logs[run.failures[0]].String(), "\n")
+	}
+	return run
+}
+
+func hasPrefixIn(names []string, prefix string) bool {
+	for _, n := range names {
+		if strings.HasPrefix(n, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	cargoResult = regexp.MustCompile(`(?m)^test result: \w+\. (\d+) passed; (\d+) failed; (\d+) ignored`)
+	cargoFailed = regexp.MustCompile(`(?m)^test (\S+) \.\.\. FAILED$`)
+	cargoStdout = regexp.MustCompile(`(?m)^---- (\S+) stdout ----$`)
+	cargoEnd    = regexp.MustCompile(`(?m)^(---- |failures:$)`)
+)
+
+// parseCargoTest sums the "test result:" line of each test binary and takes
+// the first failure's captured stdout (its panic message).
+func parseCargoTest(out string) testRun {
+	var run testRun
+	for _, m := range cargoResult.FindAllStringSubmatch(out, -1) {
+		run.parsed = true
+		p, _ := strconv.Atoi(m[1])
+		f, _ := strconv.Atoi(m[2])
+		s, _ := strconv.Atoi(m[3])
+		run.passed, run.failed, run.skipped = run.passed+p, run.failed+f, run.skipped+s
+	}
+	for _, m := range cargoFailed.FindAllStringSubmatch(out, -1) {
+		run.failures = append(run.failures, m[1])
+	}
+	if loc := cargoStdout.FindStringSubmatchIndex(out); loc != nil && len(run.failures) > 0 {
+		rest := out[loc[1]:]
+		if end := cargoEnd.FindStringIndex(rest); end != nil {
+			rest = rest[:end[0]]
+		}
+		rest, _, _ = strings.Cut(rest, "\nstack backtrace:") // RUST_BACKTRACE
+		run.excerpt = strings.TrimSpace(rest)
+	}
+	return run
+}
+
+var (
+	pytestCount   = regexp.MustCompile(`(\d+) (passed|failed|errors?|skipped|xfailed|xpassed)`)
+	pytestSummary = regexp.MustCompile(`(?m)^=*\s*((?:\d+ \w+,? ?)+) in [\d.]+s`)
+	pytestFailed  = regexp.MustCompile(`(?m)^(?:FAILED|ERROR) (\S+)`)
+	pytestSection = regexp.MustCompile(`(?m)^_{3,} (.+?) _{3,}$`)
+	pytestEnd     = regexp.MustCompile(`(?m)^(_{3,} |={3,})`)
+)
+
+// parsePytest reads the final "N failed, M passed in Xs" line, the -rfE
+// short summary for names, and the first --tb=short traceback section.
+func parsePytest(out string) testRun {
+	var run testRun
+	all := pytestSummary.FindAllStringSubmatch(out, -1)
+	if len(all) > 0 {
+		run.parsed = true
+		for _, m := range pytestCount.FindAllStringSubmatch(all[len(all)-1][1], -1) {
+			n, _ := strconv.Atoi(m[1])
+			switch m[2] {
+			case "passed", "xfailed":
+				run.passed += n
+			case "failed", "error", "errors", "xpassed":
+				run.failed += n
+			case "skipped":
+				run.skipped += n
+			}
+		}
+	}
+	for _, m := range pytestFailed.FindAllStringSubmatch(out, -1) {
+		run.failures = append(run.failures, m[1])
+	}
+	if loc := pytestSection.FindStringIndex(out); loc != nil && len(run.failures) > 0 {
+		rest := out[loc[1]:]
+		if end := pytestEnd.FindStringIndex(rest); end != nil {
+			rest = rest[:end[0]]
+		}
+		run.excerpt = strings.TrimSpace(rest)
+	}
+	return run
+}
+
+// parseJest reads the report written by --json --outputFile.
+func parseJest(data []byte, root string) testRun {
+	var report struct {
+		NumPassedTests  int `json:"numPassedTests"`
+		NumFailedTests  int `json:"numFailedTests"`
+		NumPendingTests int `json:"numPendingTests"`
+		TestResults     []struct {
+			Name             string `json:"name"`
+			Message          string `json:"message"`
+			AssertionResults []struct {
+				FullName        string   `json:"fullName"`
+				Status          string   `json:"status"`
+				FailureMessages []string `json:"failureMessages"`
+			} `json:"assertionResults"`
+		} `json:"testResults"`
+	}
+	var run testRun
+	if json.Unmarshal(data, &report) != nil {
+		return run
+	}
+	run.parsed = true
+	run.passed, run.failed, run.skipped = report.NumPassedTests, report.NumFailedTests, report.NumPendingTests
+	root, _ = filepath.Abs(root)
+	for _, file := range report.TestResults {
+		name := file.Name
+		if rel, err := filepath.Rel(root, name); err == nil {
+			name = rel
+		}
+		failedAny := false
+		for _, a := range file.AssertionResults {
+			if a.Status != "failed" {
+				continue
+			}
+			failedAny = true
+			run.failures = append(run.failures, name+" › "+a.FullName)
+			if run.excerpt == "" {
+				run.excerpt = strings.Join(a.FailureMessages, "\n")
+			}
+		}
+		// A suite that fails to load has a message but no assertions
+		if !failedAny && file.Message != "" {
+			run.failures = append(run.failures, name)
+			if run.excerpt == "" {
+				run.excerpt = file.Message
+			}
+		}
+	}
+	run.excerpt = ansiEscape.ReplaceAllString(run.excerpt, "")
+	return run
+}
+
+func headLines(s string, n int) string {
+	lines := strings.Split(s, "\n")
+	if len(lines) <= n {
+		return s
+	}
+	return strings.Join(lines[:n], "\n") + fmt.Sprintf("\n... (%d more lines)", len(lines)-n)
+}
+
+func tailLines(s string, n int) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	if len(lines) <= n {
+		return strings.Join(lines, "\n")
+	}
+	return fmt.Sprintf("... (%d lines before)\n", len(lines)-n) + strings.Join(lines[len(lines)-n:], "\n")
+}
+
+func indentLines(s string) string {
+	return "  " + strings.ReplaceAll(s, "\n", "\n  ")
+}
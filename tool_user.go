@@ -5,17 +5,26 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
+
+	"golang.org/x/term"
 )
 
 func registerUserTools(r *ToolRegistry) {
 	r.Register(ToolDef{
 		Name:        "ask_user",
-		Description: "Ask the user a question and wait for their response.",
+		Description: "Ask the user a question and wait for their response. Pass options to present numbered choices the user picks by number.",
 		Parameters: map[string]any{
 			"type": "object",
 			"properties": map[string]any{
 				"question": map[string]any{"type": "string", "description": "Question to ask the user"},
+				"options": map[string]any{
+					"type":        "array",
+					"items":       map[string]any{"type": "string"},
+					"description": "Choices to present as a numbered list (optional)",
+				},
+				"allow_free_text": map[string]any{"type": "boolean", "description": "With options, also accept a typed answer instead of a number (default false)"},
 			},
 			"required": []string{"question"},
 		},
@@ -25,24 +34,61 @@ func registerUserTools(r *ToolRegistry) {
 // askUserMode is set by the agent to control ask_user behavior
 var askUserMode Mode = ModePlan
 
+// askUserPolicy decides whether ask_user reaches the user in action mode:
+// "options" (default) asks only questions that carry options, "always"
+// asks everything, "never" auto-answers everything. Set from config.
+var askUserPolicy = "options"
+
+// askUserInteractive is false when no one is at the terminal (serve mode).
+var askUserInteractive = true
+
 func toolAskUser(args json.RawMessage) (string, error) {
 	var params struct {
-		Question string `json:"question"`
+		Question      string   `json:"question"`
+		Options       []string `json:"options"`
+		AllowFreeText bool     `json:"allow_free_text"`
 	}
 	if err := json.Unmarshal(args, &params); err != nil {
 		return "", err
 	}
 
-	// In action mode, auto-proceed
+	// In action mode, auto-proceed unless config says this question needs the user
 	if askUserMode == ModeAction {
-		return "proceed", nil
+		ask := askUserPolicy == "always" || (askUserPolicy == "options" && len(params.Options) > 0)
+		if !ask {
+			return "proceed", nil
+		}
+	}
+	if !askUserInteractive || (!term.IsTerminal(int(os.Stdin.Fd())) && len(params.Options) > 0) {
+		return "no response (no interactive user); choose the most reasonable option yourself", nil
 	}
 
-	fmt.Printf("\n%s\n> ", params.Question)
+	askUserNotify(params.Question)
+	fmt.Printf("\n%s\n", params.Question)
+	for i, opt := range params.Options {
+		fmt.Printf("  %d. %s\n", i+1, opt)
+	}
+	if len(params.Options) > 0 && params.AllowFreeText {
+		fmt.Println("  (or type your own answer)")
+	}
 
 	scanner := bufio.NewScanner(os.Stdin)
-	if scanner.Scan() {
-		return strings.TrimSpace(scanner.Text()), nil
+	for {
+		fmt.Print("> ")
+		if !scanner.Scan() {
+			return "no response", nil
+		}
+		answer := strings.TrimSpace(scanner.Text())
+		if len(params.Options) == 0 {
+			return answer, nil
+		}
+
+		if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(params.Options) {
+			return params.Options[n-1], nil
+		}
+		if params.AllowFreeText && answer != "" {
+			return answer, nil
+		}
+		fmt.Printf("Enter a number from 1 to %d.\n", len(params.Options))
 	}
-	return "no response", nil
 }
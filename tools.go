@@ -1,51 +1,154 @@
 package main
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
 
 type ToolHandler func(args json.RawMessage) (string, error)
 
+// ToolResult is the outcome of a tool call. IsError marks calls that failed
+// or were blocked, so providers can flag the result as an error rather than
+// leave the model to guess from the text.
+type ToolResult struct {
+	Content  string
+	IsError  bool
+	Metadata map[string]any // "status" (error, invalid, blocked, timeout, exit), "exit_code"
+}
+
+// bashExit matches the exit note toolBash appends on failure.
+var bashExit = regexp.MustCompile(`\n\[exit: exit status (\d+)\]$`)
+
+// toolResult classifies a handler's return. Handlers report most failures as
+// "error: ..." text with a nil error; those count as errors too.
+func toolResult(content string, err error) ToolResult {
+	if err != nil {
+		return ToolResult{Content: fmt.Sprintf("error: %v", err), IsError: true, Metadata: map[string]any{"status": "error"}}
+	}
+	status := ""
+	switch {
+	case strings.HasPrefix(content, "error:"):
+		status = "error"
+	case strings.HasPrefix(content, "blocked:"), strings.HasPrefix(content, "denied:"):
+		status = "blocked"
+	case strings.Contains(content, "\n[timed out after "):
+		status = "timeout"
+	}
+	if m := bashExit.FindStringSubmatch(content); m != nil && status == "" {
+		code, _ := strconv.Atoi(m[1])
+		return ToolResult{Content: content, IsError: true, Metadata: map[string]any{"status": "exit", "exit_code": code}}
+	}
+	if status == "" {
+		return ToolResult{Content: content}
+	}
+	return ToolResult{Content: content, IsError: true, Metadata: map[string]any{"status": status}}
+}
+
+// Status is the result's metadata status, "ok" for a success.
+func (t ToolResult) Status() string {
+	if s, ok := t.Metadata["status"].(string); ok {
+		return s
+	}
+	return "ok"
+}
+
 type ToolRegistry struct {
 	defs     []ToolDef
 	handlers map[string]ToolHandler
+	// Parameter schemas, checked before a handler runs
+	schemas map[string]map[string]any
+	// Names of tools loaded from plugin manifests
+	plugins []string
 	// Tools that are blocked in plan mode
 	writeTools map[string]bool
 	// Tools denied by config
 	deniedTools map[string]bool
+	// Allow list from config, nil when unset; Register denies tools outside it
+	allowed map[string]bool
+	// Command rules for bash/start_process
+	commands CommandPolicy
+	// Host rules for http_request
+	http HTTPPolicy
+	// Per-tool allow/deny/ask levels with argument constraints
+	permissions map[string]ToolPermission
+	// Paths the file and exec tools may touch
+	paths PathPolicy
+	// Confirm asks the user a yes/no question; nil means no one to ask (deny)
+	Confirm func(question string) bool
+	// DryRun stages file writes instead of touching disk; nil when off
+	DryRun *DryRun
+	// Safety escalates destructive shell commands to Confirm; nil when off
+	Safety *SafetyCheck
+	// ShowDiff displays what a file-editing tool changed; nil to skip
+	ShowDiff func(path, before, after string)
+	// FormatOnWrite runs the formatter on files the file-editing tools write
+	FormatOnWrite bool
+	// Scratch is the session's temporary-file directory; "" when unset
+	Scratch string
 }
 
+// fileEditTools change one file's content, named by their "path" argument.
+var fileEditTools = map[string]bool{"write_file": true, "edit_file": true, "patch": true}
+
 func NewToolRegistry(toolsCfg ToolsConfig) *ToolRegistry {
 	r := &ToolRegistry{
 		handlers:    make(map[string]ToolHandler),
+		schemas:     make(map[string]map[string]any),
 		writeTools:  make(map[string]bool),
 		deniedTools: make(map[string]bool),
+		commands:    toolsCfg.Commands,
+		http:        toolsCfg.HTTP,
+		permissions: toolsCfg.Permissions,
+		paths:       toolsCfg.Paths,
 	}
-	r.registerAll()
-	for _, name := range toolsCfg.Deny {
-		r.deniedTools[name] = true
-	}
-	// If allow list is set, deny everything not in it
+	// If allow list is set, deny everything not in it, including tools
+	// NewAgent registers after this returns
 	if len(toolsCfg.Allow) > 0 {
-		allowed := make(map[string]bool)
+		r.allowed = make(map[string]bool)
 		for _, name := range toolsCfg.Allow {
-			allowed[name] = true
+			r.allowed[name] = true
 		}
-		for _, def := range r.defs {
-			if !allowed[def.Name] {
-				r.deniedTools[def.Name] = true
-			}
+	}
+	for _, name := range toolsCfg.Deny {
+		r.deniedTools[name] = true
+	}
+	// An unconstrained deny hides the tool like the deny list; constrained
+	// ones are checked per call
+	for name, p := range toolsCfg.Permissions {
+		if p.Policy == "deny" && len(p.Paths) == 0 && len(p.Args) == 0 {
+			r.deniedTools[name] = true
 		}
 	}
+	r.registerAll()
+	if toolsCfg.Clipboard {
+		registerClipboardTools(r)
+	}
 	return r
 }
 
 func (r *ToolRegistry) Register(def ToolDef, handler ToolHandler, isWrite bool) {
 	r.defs = append(r.defs, def)
 	r.handlers[def.Name] = handler
+	r.schemas[def.Name] = def.Parameters
+	if r.allowed != nil && !r.allowed[def.Name] {
+		r.deniedTools[def.Name] = true
+	}
 	if isWrite {
 		r.writeTools[def.Name] = true
 	}
 }
 
+// Override replaces the handler for an already registered tool.
+func (r *ToolRegistry) Override(name string, handler ToolHandler) {
+	if _, ok := r.handlers[name]; ok {
+		r.handlers[name] = handler
+	}
+}
+
 func (r *ToolRegistry) Definitions() []ToolDef {
 	if len(r.deniedTools) == 0 {
 		return r.defs
@@ -59,19 +162,124 @@ func (r *ToolRegistry) Definitions() []ToolDef {
 	return filtered
 }
 
-func (r *ToolRegistry) Execute(name string, args json.RawMessage, mode Mode) (string, error) {
+func (r *ToolRegistry) Execute(name string, args json.RawMessage, mode Mode) ToolResult {
 	if r.deniedTools[name] {
-		return "blocked: tool denied by config", nil
+		return toolResult("blocked: tool denied by config", nil)
+	}
+	scratch := r.inScratch(name, args)
+	if mode == ModePlan && (r.writeTools[name] || writesRemote(name, args) || lintFixes(name, args)) && !scratch {
+		return toolResult("blocked: not allowed in plan mode", nil)
+	}
+	if _, ok := r.handlers[name]; ok {
+		if err := validateArgs(r.schemas[name], args); err != nil {
+			return ToolResult{
+				Content:  fmt.Sprintf("error: invalid arguments for %s: %v", name, err),
+				IsError:  true,
+				Metadata: map[string]any{"status": "invalid"},
+			}
+		}
+	}
+	if !scratch {
+		if msg := r.checkPaths(name, args); msg != "" {
+			return toolResult(msg, nil)
+		}
+	}
+	msg, approved := r.checkPermission(name, args)
+	if msg != "" {
+		return toolResult(msg, nil)
 	}
-	if mode == ModePlan && r.writeTools[name] {
-		return "blocked: not allowed in plan mode", nil
+	msg, confirmed := r.checkCommandPolicy(name, args, approved)
+	if msg != "" {
+		return toolResult(msg, nil)
+	}
+	// A confirm answer showed the exact command; an ask answer only skips
+	// the score, since the dangerous rules ask with the reason spelled out
+	if !confirmed {
+		if msg := r.checkSafety(name, args, approved); msg != "" {
+			return toolResult(msg, nil)
+		}
+	}
+	if r.DryRun != nil && !scratch {
+		if result, ok, err := r.DryRun.handle(name, args); ok {
+			if err == nil && r.FormatOnWrite && fileEditTools[name] && !strings.HasPrefix(result, "error:") {
+				result += r.formatOnWrite(argPath(args))
+			}
+			return toolResult(result, err)
+		}
 	}
 
 	handler, ok := r.handlers[name]
 	if !ok {
-		return "", nil
+		return toolResult(fmt.Sprintf("error: unknown tool %q", name), nil)
+	}
+	if (r.ShowDiff != nil || r.FormatOnWrite) && fileEditTools[name] && !scratch {
+		return toolResult(r.executeFileEdit(handler, args))
+	}
+	return toolResult(handler(args))
+}
+
+// executeFileEdit runs a file-editing handler, formats the file when
+// FormatOnWrite is set, and shows the resulting change.
+func (r *ToolRegistry) executeFileEdit(handler ToolHandler, args json.RawMessage) (string, error) {
+	path := argPath(args)
+	before, _ := os.ReadFile(path)
+
+	result, err := handler(args)
+	if err != nil || path == "" || strings.HasPrefix(result, "error:") {
+		return result, err
+	}
+	if r.FormatOnWrite {
+		result += r.formatOnWrite(path)
+	}
+	if after, rerr := os.ReadFile(path); rerr == nil && string(after) != string(before) && r.ShowDiff != nil {
+		r.ShowDiff(path, string(before), string(after))
+	}
+	return result, err
+}
+
+// argPath is a tool call's "path" argument.
+func argPath(args json.RawMessage) string {
+	var params struct {
+		Path string `json:"path"`
 	}
-	return handler(args)
+	json.Unmarshal(args, &params)
+	return params.Path
+}
+
+// argCommand is the command of a bash or start_process call, "" for other tools.
+func argCommand(name string, args json.RawMessage) string {
+	if !commandTools[name] {
+		return ""
+	}
+	var params struct {
+		Command string `json:"command"`
+	}
+	json.Unmarshal(args, &params)
+	return params.Command
+}
+
+// ToolInfo describes a registered tool for listings.
+type ToolInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Write       bool   `json:"write"`                // blocked in plan mode
+	Denied      bool   `json:"denied"`               // removed by deny/allow policy
+	Permission  string `json:"permission,omitempty"` // tools.permissions entry, e.g. "ask"
+}
+
+// List returns every registered tool with its policy status, in registration order.
+func (r *ToolRegistry) List() []ToolInfo {
+	var result []ToolInfo
+	for _, def := range r.defs {
+		result = append(result, ToolInfo{
+			Name:        def.Name,
+			Description: def.Description,
+			Write:       r.writeTools[def.Name],
+			Denied:      r.deniedTools[def.Name],
+			Permission:  r.permissionLabel(def.Name),
+		})
+	}
+	return result
 }
 
 func (r *ToolRegistry) IsWriteTool(name string) bool {
@@ -80,8 +288,33 @@ func (r *ToolRegistry) IsWriteTool(name string) bool {
 
 func (r *ToolRegistry) registerAll() {
 	registerFSTools(r)
+	registerHashTools(r)
 	registerExecTools(r)
+	registerTestTools(r)
+	registerBuildTools(r)
+	registerLintTools(r)
 	registerSearchTools(r)
 	registerDiffTools(r)
+	registerNotebookTools(r)
+	registerArchiveTools(r)
 	registerUserTools(r)
+	registerHTTPTools(r)
+	registerPluginTools(r)
+}
+
+// Available reports whether a tool is registered and not denied.
+func (r *ToolRegistry) Available(name string) bool {
+	_, ok := r.handlers[name]
+	return ok && !r.deniedTools[name]
+}
+
+// Plugins returns the names of plugin tools that aren't denied.
+func (r *ToolRegistry) Plugins() []string {
+	var names []string
+	for _, name := range r.plugins {
+		if !r.deniedTools[name] {
+			names = append(names, name)
+		}
+	}
+	return names
 }
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// traceHTTP (--trace) also logs raw provider HTTP requests and responses.
+var traceHTTP bool
+
+// logMu serializes writes to the log file: HTTP traces come from SDK goroutines.
+var logMu sync.Mutex
+
+// logPath is today's turn log, .simpleagent/<agent>/logs/2006-01-02.jsonl.
+func logPath() string {
+	return filepath.Join(agentDir, "logs", time.Now().Format("2006-01-02")+".jsonl")
+}
+
+// writeLog appends one JSON record to today's log.
+func writeLog(rec any) {
+	if agentDir == "" {
+		return
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return
+	}
+	logMu.Lock()
+	defer logMu.Unlock()
+	path := logPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	f.Write(append(data, '\n'))
+}
+
+// llmLogRecord is one model call.
+type llmLogRecord struct {
+	Time         time.Time `json:"time"`
+	Type         string    `json:"type"` // "llm"
+	Session      string    `json:"session"`
+	Provider     string    `json:"provider"`
+	Model        string    `json:"model"`
+	Mode         string    `json:"mode"`
+	Messages     int       `json:"messages"`
+	Tools        int       `json:"tools"`
+	SystemChars  int       `json:"system_chars"`
+	InputTokens  int       `json:"input_tokens,omitempty"`
+	OutputTokens int       `json:"output_tokens,omitempty"`
+	CacheRead    int       `json:"cache_read,omitempty"`
+	CacheWrite   int       `json:"cache_write,omitempty"`
+	Estimated    bool      `json:"estimated,omitempty"`
+	StopReason   string    `json:"stop_reason,omitempty"`
+	ToolCalls    int       `json:"tool_calls,omitempty"`
+	DurationMS   int64     `json:"duration_ms"`
+	Error        string    `json:"error,omitempty"`
+}
+
+// toolLogRecord is one tool execution.
+type toolLogRecord struct {
+	Time        time.Time       `json:"time"`
+	Type        string          `json:"type"` // "tool"
+	Session     string          `json:"session"`
+	ID          string          `json:"id"`
+	Name        string          `json:"name"`
+	Args        json.RawMessage `json:"args"`
+	ResultBytes int             `json:"result_bytes"`
+	DurationMS  int64           `json:"duration_ms"`
+	Status      string          `json:"status"` // ok, error, invalid, blocked, timeout, interrupted, exit
+	ExitCode    int             `json:"exit_code,omitempty"`
+}
+
+// turnLogRecord is one user turn: a message until the final answer, a
+// pause or an interrupt.
+type turnLogRecord struct {
+	Time       time.Time `json:"time"`
+	Type       string    `json:"type"` // "turn"
+	Session    string    `json:"session"`
+	LLMCalls   int       `json:"llm_calls"`
+	DurationMS int64     `json:"duration_ms"`
+	Paused     bool      `json:"paused,omitempty"`
+}
+
+// logTurn records a finished turn for `stats`.
+func (a *Agent) logTurn(start time.Time, llmCalls int) {
+	if !a.cfg.Logs {
+		return
+	}
+	writeLog(turnLogRecord{
+		Time:       start,
+		Type:       "turn",
+		Session:    a.session.ID,
+		LLMCalls:   llmCalls,
+		DurationMS: time.Since(start).Milliseconds(),
+		Paused:     a.paused,
+	})
+}
+
+// logLLMCall records a model call in the log and as a span. usage may be
+// nil (error, or no reply).
+func (a *Agent) logLLMCall(start time.Time, system string, tools int, usage *Usage, reply Message, err error) {
+	if !a.cfg.Logs && a.otel == nil {
+		return
+	}
+	rec := llmLogRecord{
+		Time:        start,
+		Type:        "llm",
+		Session:     a.session.ID,
+		Provider:    a.llm.Name(),
+		Model:       a.llmModel,
+		Mode:        a.mode.String(),
+		Messages:    len(a.session.Messages),
+		Tools:       tools,
+		SystemChars: len(system),
+		ToolCalls:   len(reply.ToolCalls),
+		DurationMS:  time.Since(start).Milliseconds(),
+	}
+	if usage != nil {
+		rec.InputTokens, rec.OutputTokens = usage.InputTokens, usage.OutputTokens
+		rec.CacheRead, rec.CacheWrite = usage.CacheReadTokens, usage.CacheCreationTokens
+		rec.Estimated, rec.StopReason = usage.Estimated, usage.StopReason
+	}
+	if err != nil {
+		rec.Error = err.Error()
+	}
+	if a.cfg.Logs {
+		writeLog(rec)
+	}
+	a.otel.llmSpan(rec)
+}
+
+// logToolCall records a tool execution in the log and as a span. args are
+// the transcript's (redacted) args.
+func (a *Agent) logToolCall(tc ToolCall, args json.RawMessage, start time.Time, res ToolResult, interrupted bool) {
+	if !a.cfg.Logs && a.otel == nil {
+		return
+	}
+	rec := toolLogRecord{
+		Time:        start,
+		Type:        "tool",
+		Session:     a.session.ID,
+		ID:          tc.ID,
+		Name:        tc.Name,
+		Args:        json.RawMessage(a.redactor.Redact(string(args))),
+		ResultBytes: len(res.Content),
+		DurationMS:  time.Since(start).Milliseconds(),
+		Status:      res.Status(),
+	}
+	if !json.Valid(rec.Args) {
+		rec.Args, _ = json.Marshal(string(args))
+	}
+	if interrupted {
+		rec.Status = "interrupted"
+	}
+	if code, ok := res.Metadata["exit_code"].(int); ok && rec.Status == "exit" {
+		rec.ExitCode = code
+	}
+	if a.cfg.Logs {
+		writeLog(rec)
+	}
+	a.otel.toolSpan(rec)
+}
+
+// httpLogRecord is a raw provider request and response (--trace).
+type httpLogRecord struct {
+	Time           time.Time `json:"time"`
+	Type           string    `json:"type"` // "http"
+	Method         string    `json:"method"`
+	URL            string    `json:"url"`
+	Status         int       `json:"status,omitempty"`
+	Request        string    `json:"request,omitempty"`
+	Response       string    `json:"response,omitempty"`
+	ResponseBase64 string    `json:"response_base64,omitempty"` // binary (Bedrock event stream)
+	DurationMS     int64     `json:"duration_ms"`
+	Error          string    `json:"error,omitempty"`
+}
+
+// providerHTTPClient returns the client a provider should use. Its transport
+// carries the provider's proxy and TLS settings (transport.go) and timeouts
+// (timeout.go); with --trace it logs every request and response body; for
+// anthropic and openai it also records rate-limit headers (ratelimit.go).
+func providerHTTPClient(provider string, pc ProviderConfig) (*http.Client, error) {
+	rt, err := providerTransport(provider, pc)
+	if err != nil {
+		return nil, err
+	}
+	if d := providerTimeout(pc.RequestTimeout, defaultRequestTimeout); d > 0 {
+		rt = timeoutTransport{provider: provider, idle: d, base: rt}
+	}
+	if traceHTTP {
+		rt = traceTransport{rt}
+	}
+	if tracksRateLimits(provider) {
+		rt = rateTransport{provider: provider, base: rt}
+	}
+	return &http.Client{Transport: rt}, nil
+}
+
+type traceTransport struct {
+	base http.RoundTripper
+}
+
+func (t traceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rec := &httpLogRecord{Time: time.Now(), Type: "http", Method: req.Method, URL: req.URL.String()}
+	if req.Body != nil {
+		body, _ := io.ReadAll(req.Body)
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		rec.Request = string(body)
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		rec.Error = err.Error()
+		rec.DurationMS = time.Since(rec.Time).Milliseconds()
+		writeLog(rec)
+		return nil, err
+	}
+	rec.Status = resp.StatusCode
+	// Streams are logged once the SDK finishes reading them.
+	resp.Body = &tracedBody{ReadCloser: resp.Body, rec: rec}
+	return resp, nil
+}
+
+// tracedBody copies what the SDK reads and logs it on Close.
+type tracedBody struct {
+	io.ReadCloser
+	rec  *httpLogRecord
+	buf  bytes.Buffer
+	once sync.Once
+}
+
+func (b *tracedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.buf.Write(p[:n])
+	if err != nil && err != io.EOF {
+		b.rec.Error = err.Error()
+	}
+	return n, err
+}
+
+func (b *tracedBody) Close() error {
+	b.once.Do(func() {
+		b.rec.DurationMS = time.Since(b.rec.Time).Milliseconds()
+		if utf8.Valid(b.buf.Bytes()) {
+			b.rec.Response = b.buf.String()
+		} else {
+			b.rec.ResponseBase64 = base64.StdEncoding.EncodeToString(b.buf.Bytes())
+		}
+		writeLog(b.rec)
+	})
+	return b.ReadCloser.Close()
+}
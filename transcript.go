@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// liveTranscript is set by --transcript or "transcript": true. Every session
+// save then rewrites the session as markdown, so it can be kept open in an
+// editor or shared as it grows.
+var liveTranscript bool
+
+// transcriptPath is .simpleagent/<agent>/transcript-<session-id>.md.
+func transcriptPath(sessionID string) string {
+	return filepath.Join(agentDir, "transcript-"+sessionID+".md")
+}
+
+// writeTranscript replaces the session's transcript file. It writes a temp
+// file and renames it over, so a reader never sees half a file.
+func writeTranscript(s *Session) error {
+	path := transcriptPath(s.ID)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(renderTranscript(s)), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// renderTranscript formats a session as markdown: a heading per speaker,
+// tool calls as their arguments, and tool output folded in <details>.
+func renderTranscript(s *Session) string {
+	var b strings.Builder
+	title := s.Summary
+	if title == "" {
+		title = "Session " + s.ID
+	}
+	fmt.Fprintf(&b, "# %s\n\n", title)
+	model := s.Provider
+	if s.Model != "" {
+		model += "/" + s.Model
+	}
+	fmt.Fprintf(&b, "_%s · %s · started %s · updated %s_\n", s.ID, model, s.CreatedAt, s.UpdatedAt)
+
+	names := make(map[string]string) // tool call ID → tool name
+	prev := ""
+	for _, m := range s.Messages {
+		switch m.Role {
+		case "user":
+			b.WriteString("\n## You\n\n")
+			b.WriteString(strings.TrimSpace(m.Content) + "\n")
+		case "assistant":
+			if prev != "assistant" && prev != "tool" {
+				b.WriteString("\n## Assistant\n")
+			}
+			if text := strings.TrimSpace(m.Content); text != "" {
+				b.WriteString("\n" + text + "\n")
+			}
+			for _, tc := range m.ToolCalls {
+				names[tc.ID] = tc.Name
+				fmt.Fprintf(&b, "\n**▶ %s**\n\n%s", tc.Name, fenced("json", indentArgs(tc.Args)))
+			}
+		case "tool":
+			label := names[m.ToolCallID]
+			if m.IsError {
+				label += " (error)"
+			}
+			lines := strings.Count(strings.TrimRight(m.Content, "\n"), "\n") + 1
+			fmt.Fprintf(&b, "\n<details><summary>%s — %d line(s)</summary>\n\n%s\n</details>\n", label, lines, fenced("", m.Content))
+		}
+		prev = m.Role
+	}
+	return b.String()
+}
+
+// fenced wraps text in a code fence longer than any backtick run inside it.
+func fenced(lang, text string) string {
+	fence := "```"
+	for strings.Contains(text, fence) {
+		fence += "`"
+	}
+	return fence + lang + "\n" + strings.TrimRight(text, "\n") + "\n" + fence + "\n"
+}
+
+// indentArgs pretty-prints tool call arguments, leaving invalid JSON as is.
+func indentArgs(args json.RawMessage) string {
+	var v any
+	if json.Unmarshal(args, &v) != nil {
+		return string(args)
+	}
+	out, _ := json.MarshalIndent(v, "", "  ")
+	return string(out)
+}
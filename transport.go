@@ -0,0 +1,66 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// providerTransport is the transport under a provider's client. It is the
+// default one (which honors HTTPS_PROXY/NO_PROXY) unless the provider sets
+// proxy, ca_cert, insecure_skip_verify or connect_timeout.
+func providerTransport(provider string, pc ProviderConfig) (http.RoundTripper, error) {
+	connect := providerTimeout(pc.ConnectTimeout, defaultConnectTimeout)
+	if pc.Proxy == "" && pc.CACert == "" && !pc.InsecureSkipVerify && connect == defaultConnectTimeout {
+		return http.DefaultTransport, nil // already dials with a 30s timeout
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.DialContext = (&net.Dialer{Timeout: connect, KeepAlive: 30 * time.Second}).DialContext
+	t.TLSHandshakeTimeout = connect
+
+	switch pc.Proxy {
+	case "":
+	case "none":
+		t.Proxy = nil
+	default:
+		u, err := url.Parse(pc.Proxy)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("providers.%s.proxy: %q is not a proxy URL (http://host:port)", provider, pc.Proxy)
+		}
+		t.Proxy = http.ProxyURL(u)
+	}
+
+	if pc.CACert != "" || pc.InsecureSkipVerify {
+		t.TLSClientConfig = &tls.Config{InsecureSkipVerify: pc.InsecureSkipVerify}
+	}
+	if pc.CACert != "" {
+		pool, err := caPool(pc.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("providers.%s.ca_cert: %w", provider, err)
+		}
+		t.TLSClientConfig.RootCAs = pool
+	}
+	return t, nil
+}
+
+// caPool is the system roots plus the PEM certificates in path, for proxies
+// that re-sign TLS with a corporate CA.
+func caPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(expandHome(path))
+	if err != nil {
+		return nil, err
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no PEM certificates in %s", path)
+	}
+	return pool, nil
+}
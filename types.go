@@ -21,6 +21,8 @@ type Message struct {
 	Content    string     `json:"content"`
 	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
 	ToolCallID string     `json:"tool_call_id,omitempty"`
+	IsError    bool       `json:"is_error,omitempty"`    // tool results: the call failed or was blocked
+	DurationMs int64      `json:"duration_ms,omitempty"` // wall time of the LLM call (assistant) or the tool run (tool)
 }
 
 type ToolCall struct {
@@ -45,8 +47,35 @@ type StreamChunk struct {
 }
 
 type Usage struct {
-	InputTokens  int
-	OutputTokens int
+	InputTokens         int    `json:"input_tokens"` // uncached prompt tokens
+	OutputTokens        int    `json:"output_tokens"`
+	CacheCreationTokens int    `json:"cache_creation_tokens,omitempty"` // prompt tokens written to the cache
+	CacheReadTokens     int    `json:"cache_read_tokens,omitempty"`     // prompt tokens served from the cache
+	StopReason          string `json:"stop_reason,omitempty"`           // end_turn, tool_use, max_tokens, ...
+	Estimated           bool   `json:"estimated,omitempty"`             // computed locally, provider sent none
+}
+
+// PromptTokens is the full prompt size, cached or not.
+func (u Usage) PromptTokens() int {
+	return u.InputTokens + u.CacheCreationTokens + u.CacheReadTokens
+}
+
+// Truncated reports whether the reply was cut off by max_tokens.
+func (u Usage) Truncated() bool {
+	return u.StopReason == "max_tokens"
+}
+
+// AgentEvent is a structured view of one step of the agent loop.
+// Used in place of terminal output when the agent runs behind serve mode.
+type AgentEvent struct {
+	Type   string          `json:"type"` // text, tool_call, tool_result, usage, warning, paused, error
+	Text   string          `json:"text,omitempty"`
+	ID     string          `json:"id,omitempty"`
+	Name   string          `json:"name,omitempty"`
+	Args   json.RawMessage `json:"args,omitempty"`
+	Result string          `json:"result,omitempty"`
+	Error  bool            `json:"is_error,omitempty"` // tool_result of a failed or blocked call
+	Usage  *Usage          `json:"usage,omitempty"`
 }
 
 type ToolDef struct {
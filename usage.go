@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ModelPrice is a model's price in USD per million tokens.
+type ModelPrice struct {
+	Input      float64 `json:"input"`
+	Output     float64 `json:"output"`
+	CacheRead  float64 `json:"cache_read,omitempty"`
+	CacheWrite float64 `json:"cache_write,omitempty"`
+}
+
+// modelPrices are list prices, matched as a substring of the model ID (the
+// longest match wins), so Bedrock and OpenRouter IDs resolve too. They are
+// estimates for budgeting; budget.prices overrides or extends them.
+var modelPrices = map[string]ModelPrice{
+	"claude-opus-4":     {Input: 15, Output: 75, CacheRead: 1.50, CacheWrite: 18.75},
+	"claude-sonnet-4":   {Input: 3, Output: 15, CacheRead: 0.30, CacheWrite: 3.75},
+	"claude-3-7-sonnet": {Input: 3, Output: 15, CacheRead: 0.30, CacheWrite: 3.75},
+	"claude-3-5-sonnet": {Input: 3, Output: 15, CacheRead: 0.30, CacheWrite: 3.75},
+	"claude-haiku-4":    {Input: 1, Output: 5, CacheRead: 0.10, CacheWrite: 1.25},
+	"claude-3-5-haiku":  {Input: 0.80, Output: 4, CacheRead: 0.08, CacheWrite: 1},
+	"gpt-4o":            {Input: 2.50, Output: 10, CacheRead: 1.25},
+	"gpt-4o-mini":       {Input: 0.15, Output: 0.60, CacheRead: 0.075},
+	"gpt-4.1":           {Input: 2, Output: 8, CacheRead: 0.50},
+	"gpt-4.1-mini":      {Input: 0.40, Output: 1.60, CacheRead: 0.10},
+	"gpt-4.1-nano":      {Input: 0.10, Output: 0.40, CacheRead: 0.025},
+	"o3":                {Input: 2, Output: 8, CacheRead: 0.50},
+	"o4-mini":           {Input: 1.10, Output: 4.40, CacheRead: 0.275},
+	"gemini-2.5-pro":    {Input: 1.25, Output: 10, CacheRead: 0.31},
+	"gemini-2.5-flash":  {Input: 0.30, Output: 2.50, CacheRead: 0.075},
+	"gemini-2.0-flash":  {Input: 0.10, Output: 0.40, CacheRead: 0.025},
+}
+
+// priceFor looks up a model's price; ok is false when it's unknown. Local
+// models (ollama) and the mock provider are free.
+func priceFor(provider, model string, overrides map[string]ModelPrice) (ModelPrice, bool) {
+	if provider == "ollama" || provider == "mock" {
+		return ModelPrice{}, true
+	}
+	best, found := "", false
+	var price ModelPrice
+	for _, table := range []map[string]ModelPrice{modelPrices, overrides} {
+		for key, p := range table {
+			// Overrides win ties: they're checked second with >=.
+			if strings.Contains(model, key) && len(key) >= len(best) {
+				best, price, found = key, p, true
+			}
+		}
+	}
+	return price, found
+}
+
+// usageCost prices one call in USD.
+func usageCost(u *Usage, p ModelPrice) float64 {
+	return (float64(u.InputTokens)*p.Input +
+		float64(u.OutputTokens)*p.Output +
+		float64(u.CacheReadTokens)*p.CacheRead +
+		float64(u.CacheCreationTokens)*p.CacheWrite) / 1e6
+}
+
+// usageRecord is one LLM call in the usage ledger.
+type usageRecord struct {
+	Time       time.Time `json:"time"`
+	Session    string    `json:"session"`
+	Project    string    `json:"project,omitempty"` // working directory
+	Provider   string    `json:"provider"`
+	Model      string    `json:"model"`
+	Input      int       `json:"input"`
+	Output     int       `json:"output"`
+	CacheRead  int       `json:"cache_read,omitempty"`
+	CacheWrite int       `json:"cache_write,omitempty"`
+	CostUSD    float64   `json:"cost_usd"`
+	Unpriced   bool      `json:"unpriced,omitempty"` // model not in the price table
+}
+
+// usageLedgerPath is the user-wide ledger for t's month,
+// ~/.simpleagent/usage/2006-01.jsonl. All agents and sessions append to it.
+func usageLedgerPath(t time.Time) string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".simpleagent", "usage", t.Format("2006-01")+".jsonl")
+}
+
+// recordUsage appends one call to the ledger. Lines are written with a
+// single O_APPEND write, so concurrent simpleagent processes don't interleave.
+func recordUsage(rec usageRecord) {
+	path := usageLedgerPath(rec.Time)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	data, _ := json.Marshal(rec)
+	f.Write(append(data, '\n'))
+}
+
+// readUsage returns ledger records from since (local time) onwards.
+func readUsage(since time.Time) []usageRecord {
+	var recs []usageRecord
+	for month := time.Date(since.Year(), since.Month(), 1, 0, 0, 0, 0, time.Local); !month.After(time.Now()); month = month.AddDate(0, 1, 0) {
+		f, err := os.Open(usageLedgerPath(month))
+		if err != nil {
+			continue
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var rec usageRecord
+			if json.Unmarshal(scanner.Bytes(), &rec) == nil && !rec.Time.Before(since) {
+				recs = append(recs, rec)
+			}
+		}
+		f.Close()
+	}
+	sort.Slice(recs, func(i, j int) bool { return recs[i].Time.Before(recs[j].Time) })
+	return recs
+}
+
+// usageToday sums today's (local day) ledger across all sessions.
+func usageToday() (tokens int, cost float64) {
+	now := time.Now()
+	for _, rec := range readUsage(time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)) {
+		tokens += rec.Input + rec.Output + rec.CacheRead + rec.CacheWrite
+		cost += rec.CostUSD
+	}
+	return tokens, cost
+}
+
+// recordCall writes one LLM call of this agent to the ledger.
+func (a *Agent) recordCall(usage *Usage) {
+	price, ok := priceFor(a.llm.Name(), a.llmModel, a.cfg.Budget.Prices)
+	cwd, _ := os.Getwd()
+	recordUsage(usageRecord{
+		Time:       time.Now(),
+		Session:    a.session.ID,
+		Project:    cwd,
+		Provider:   a.llm.Name(),
+		Model:      a.llmModel,
+		Input:      usage.InputTokens,
+		Output:     usage.OutputTokens,
+		CacheRead:  usage.CacheReadTokens,
+		CacheWrite: usage.CacheCreationTokens,
+		CostUSD:    usageCost(usage, price),
+		Unpriced:   !ok,
+	})
+}
+
+// checkBudget runs before each LLM call. Crossing budget.warn_percent of a
+// daily limit, and then the limit itself, each print one warning per day.
+// With hard_stop, a reached limit pauses the turn instead of calling the model.
+func (a *Agent) checkBudget() bool {
+	b := a.cfg.Budget
+	if b.DailyTokens <= 0 && b.DailyUSD <= 0 {
+		return true
+	}
+	tokens, cost := usageToday()
+
+	pct := 0.0
+	var parts []string
+	if b.DailyTokens > 0 {
+		pct = max(pct, float64(tokens)*100/float64(b.DailyTokens))
+		parts = append(parts, fmt.Sprintf("%.1fk/%.0fk tokens", float64(tokens)/1000, float64(b.DailyTokens)/1000))
+	}
+	if b.DailyUSD > 0 {
+		pct = max(pct, cost*100/b.DailyUSD)
+		parts = append(parts, fmt.Sprintf("$%.2f/$%.2f", cost, b.DailyUSD))
+	}
+	summary := strings.Join(parts, ", ")
+
+	if pct >= 100 && b.HardStop {
+		a.paused = true
+		a.session.Save()
+		msg := "daily usage limit reached (" + summary + "); budget.hard_stop is on"
+		if a.sink != nil {
+			a.sink(AgentEvent{Type: "paused", Text: msg})
+		} else {
+			fmt.Printf("\033[31m⛔ %s — raise budget in config.json, then /continue\033[0m\n", msg)
+		}
+		return false
+	}
+
+	level := 0
+	switch {
+	case pct >= 100:
+		level = 2
+	case pct >= float64(b.WarnPercent):
+		level = 1
+	}
+	day := time.Now().Format("2006-01-02")
+	if level == 0 || (a.budgetWarned.day == day && a.budgetWarned.level >= level) {
+		return true
+	}
+	a.budgetWarned.day, a.budgetWarned.level = day, level
+
+	msg := fmt.Sprintf("daily usage at %.0f%% of budget (%s)", pct, summary)
+	if level == 2 {
+		msg = "daily budget exceeded (" + summary + ")"
+	}
+	if a.sink != nil {
+		a.sink(AgentEvent{Type: "warning", Text: msg})
+	} else {
+		fmt.Printf("\033[33m⚠ %s\033[0m\n", msg)
+	}
+	return true
+}
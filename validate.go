@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// validateArgs checks tool call args against the tool's parameter schema
+// before the handler runs: args must be an object, required properties
+// present, and declared properties of the declared type (enum and array
+// items included). Undeclared properties pass, like the "unredacted" escape
+// hatch. The error lists every problem so the model can fix them in one go.
+func validateArgs(schema map[string]any, args json.RawMessage) error {
+	if schema == nil {
+		return nil
+	}
+	if len(bytes.TrimSpace(args)) == 0 || string(bytes.TrimSpace(args)) == "null" {
+		args = json.RawMessage("{}")
+	}
+	dec := json.NewDecoder(bytes.NewReader(args))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return fmt.Errorf("arguments are not valid JSON: %v", err)
+	}
+	var problems []string
+	checkSchema(schema, v, "", &problems)
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// checkSchema appends a problem for each way v violates schema. path is the
+// property path ("" for the arguments object itself).
+func checkSchema(schema map[string]any, v any, path string, problems *[]string) {
+	name := path
+	if name == "" {
+		name = "arguments"
+	}
+	if types := schemaList(schema["type"]); len(types) > 0 && !slices.ContainsFunc(types, func(t string) bool { return hasType(v, t) }) {
+		*problems = append(*problems, fmt.Sprintf("%s must be %s, got %s", name, strings.Join(types, " or "), describeJSON(v)))
+		return
+	}
+	if enum := schemaList(schema["enum"]); len(enum) > 0 {
+		if s, ok := v.(string); ok && !slices.Contains(enum, s) {
+			*problems = append(*problems, fmt.Sprintf("%s must be one of %s, got %q", name, strings.Join(enum, ", "), s))
+		}
+	}
+
+	switch v := v.(type) {
+	case map[string]any:
+		props, _ := schema["properties"].(map[string]any)
+		for _, req := range schemaList(schema["required"]) {
+			if val, ok := v[req]; !ok || val == nil {
+				*problems = append(*problems, fmt.Sprintf("missing required %q", joinPath(path, req)))
+			}
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		for _, k := range keys {
+			sub, ok := props[k].(map[string]any)
+			if !ok || v[k] == nil {
+				continue // undeclared, or null meaning "not set"
+			}
+			checkSchema(sub, v[k], joinPath(path, k), problems)
+		}
+	case []any:
+		items, ok := schema["items"].(map[string]any)
+		if !ok {
+			return
+		}
+		for i, item := range v {
+			checkSchema(items, item, fmt.Sprintf("%s[%d]", name, i), problems)
+		}
+	}
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// schemaList reads a string or list of strings from a schema keyword. Built-in
+// schemas use []string; ones decoded from JSON manifests use []any.
+func schemaList(v any) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []string:
+		return v
+	case []any:
+		var out []string
+		for _, x := range v {
+			if s, ok := x.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// hasType reports whether a decoded JSON value is of JSON Schema type t.
+func hasType(v any, t string) bool {
+	switch t {
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "number":
+		_, ok := v.(json.Number)
+		return ok
+	case "integer":
+		// Handlers decode into Go ints, which reject 2.0 and 1e3
+		n, ok := v.(json.Number)
+		if !ok {
+			return false
+		}
+		_, err := n.Int64()
+		return err == nil
+	case "array":
+		_, ok := v.([]any)
+		return ok
+	case "object":
+		_, ok := v.(map[string]any)
+		return ok
+	case "null":
+		return v == nil
+	}
+	return true // unknown type keyword: don't reject
+}
+
+// describeJSON names a value's type for error messages, with a short preview.
+func describeJSON(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return fmt.Sprintf("string %q", truncate(v, 40))
+	case bool:
+		return fmt.Sprintf("boolean %v", v)
+	case json.Number:
+		return "number " + v.String()
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Messages reach disk in two steps: Append writes each one to
+// sessions/<id>.wal as it happens, and Save rewrites the whole session and
+// drops the log. LoadSession replays what a crash left in it, so a crash
+// mid-turn loses at most the message being produced.
+
+// walEntry is one line of the log: a message and its index in Messages, so
+// a replay never duplicates or misplaces what the session file already has.
+type walEntry struct {
+	N       int     `json:"n"`
+	Message Message `json:"message"`
+}
+
+func walPath(sessionID string) string {
+	return filepath.Join(sessionsDir(), sessionID+".wal")
+}
+
+// Append adds messages to the session and logs them. A session that has
+// never been stored is saved whole instead, so it can be found after a crash.
+func (s *Session) Append(msgs ...Message) {
+	start := len(s.Messages)
+	s.Messages = append(s.Messages, msgs...)
+	if !s.stored {
+		s.Save()
+		return
+	}
+	if checkSessionOwner(s.ID) != nil {
+		return // another process owns the session and its log now
+	}
+	if err := appendWAL(s.ID, start, msgs); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: session log: %v\n", err)
+	}
+}
+
+// appendWAL writes one line per message and syncs, so the lines survive a
+// crash of the machine as well as of the process.
+func appendWAL(sessionID string, start int, msgs []Message) error {
+	path := walPath(sessionID)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	for i, m := range msgs {
+		line, err := json.Marshal(walEntry{N: start + i, Message: m})
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(append(line, '\n')); err != nil {
+			return err
+		}
+	}
+	return f.Sync()
+}
+
+// replayWAL appends logged messages that continue s.Messages and returns how
+// many there were. Entries the session file already has are skipped, a later
+// entry for the same index replaces an earlier one, and a torn last line (the
+// crash hit mid-write) or a gap ends the replay.
+func replayWAL(s *Session) int {
+	f, err := os.Open(walPath(s.ID))
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	saved := len(s.Messages)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var e walEntry
+		if json.Unmarshal(scanner.Bytes(), &e) != nil || e.N > len(s.Messages) {
+			break
+		}
+		if e.N < saved {
+			continue
+		}
+		s.Messages = append(s.Messages[:e.N], e.Message)
+	}
+	if len(s.Messages) == saved {
+		return 0
+	}
+	// Calls the crash cut off still need results, or providers reject the history
+	results := make(map[string]bool)
+	for _, m := range s.Messages[saved:] {
+		if m.Role == "tool" {
+			results[m.ToolCallID] = true
+		}
+	}
+	for _, m := range s.Messages[saved:] {
+		for _, tc := range m.ToolCalls {
+			if !results[tc.ID] {
+				s.Messages = append(s.Messages, Message{
+					Role:       "tool",
+					Content:    "not run: simpleagent stopped before this tool finished",
+					ToolCallID: tc.ID,
+					IsError:    true,
+				})
+			}
+		}
+	}
+	return len(s.Messages) - saved
+}
+
+// clearWAL drops the log once a save holds everything in it.
+func clearWAL(sessionID string) {
+	os.Remove(walPath(sessionID))
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	experimentalsys "github.com/tetratelabs/wazero/experimental/sys"
+	"github.com/tetratelabs/wazero/experimental/sysfs"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/tetratelabs/wazero/sys"
+)
+
+// WASM plugins run a WASI (preview1) module in-process with wazero instead
+// of an executable. The module sees nothing of the host beyond its stdin
+// (the args JSON), stdout, stderr, SIMPLEAGENT_TOOL, the clock and random
+// numbers: directories and hosts must be granted in the manifest, and
+// memory and run time are capped.
+//
+// Network access goes through two functions the module imports from
+// "simpleagent":
+//
+//	http(req_ptr, req_len i32) -> i32   request JSON {method, url, headers, body};
+//	                                    returns the length of the response JSON
+//	http_result(ptr i32)                copies that response into memory at ptr
+//
+// The response is {status, headers, body} or {error}.
+
+const (
+	defaultWasmMemoryMB = 64
+	maxWasmMemoryMB     = 4096
+	wasmHTTPMaxBody     = 1 << 20
+	wasmHTTPMaxRequest  = 1 << 20
+)
+
+// wasmMagic starts every binary WASM module.
+var wasmMagic = []byte("\x00asm")
+
+// checkWasmGrants validates the WASM-only manifest fields; they are errors
+// on an executable plugin, which can't be restricted.
+func (p *pluginManifest) checkWasmGrants() error {
+	if p.Wasm == "" {
+		if len(p.Dirs) > 0 || len(p.Net) > 0 || p.MemoryMB != 0 {
+			return fmt.Errorf("dirs, net and memory_mb only apply to wasm plugins")
+		}
+		return nil
+	}
+	if p.Command != "" {
+		return fmt.Errorf("set command or wasm, not both")
+	}
+	if p.MemoryMB < 0 || p.MemoryMB > maxWasmMemoryMB {
+		return fmt.Errorf("memory_mb must be 1-%d", maxWasmMemoryMB)
+	}
+	for _, d := range p.Dirs {
+		if host, _ := splitWasmDir(d); host == "" {
+			return fmt.Errorf("dirs: empty directory in %q", d)
+		}
+	}
+	for _, h := range p.Net {
+		if h == "" || strings.ContainsAny(h, "/:") {
+			return fmt.Errorf("net: %q must be a host name like example.com or *.example.com", h)
+		}
+	}
+	return nil
+}
+
+// resolveWasm points p.path at the module, relative to the manifest.
+func (p *pluginManifest) resolveWasm(manifest string) error {
+	path := p.Wasm
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(manifest), path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("wasm: %v", err)
+	}
+	defer f.Close()
+	magic := make([]byte, len(wasmMagic))
+	if _, err := io.ReadFull(f, magic); err != nil || !bytes.Equal(magic, wasmMagic) {
+		return fmt.Errorf("%s is not a WASM module", path)
+	}
+	p.path, _ = filepath.Abs(path)
+	return nil
+}
+
+// splitWasmDir splits a dirs entry, "path" or "path:ro", into the host
+// directory and whether the mount is read-only.
+func splitWasmDir(entry string) (string, bool) {
+	if dir, ok := strings.CutSuffix(entry, ":ro"); ok {
+		return dir, true
+	}
+	return entry, false
+}
+
+// wasmPlugin is a loaded WASM plugin. The runtime and compiled module are
+// created on the first call and reused; each call gets a fresh instance.
+type wasmPlugin struct {
+	p      pluginManifest
+	policy HTTPPolicy // tools.http applies on top of the manifest's net list
+
+	once     sync.Once
+	runtime  wazero.Runtime
+	compiled wazero.CompiledModule
+	err      error
+}
+
+// wasmCall is one call's state, reached from host functions through the context.
+type wasmCall struct {
+	plugin *wasmPlugin
+	result []byte // last http response, until http_result copies it
+}
+
+type wasmCallKey struct{}
+
+func newWasmPlugin(p pluginManifest, policy HTTPPolicy) *wasmPlugin {
+	return &wasmPlugin{p: p, policy: policy}
+}
+
+func (w *wasmPlugin) load() error {
+	w.once.Do(func() {
+		ctx := context.Background()
+		mb := w.p.MemoryMB
+		if mb == 0 {
+			mb = defaultWasmMemoryMB
+		}
+		cfg := wazero.NewRuntimeConfig().
+			WithMemoryLimitPages(uint32(mb) * 16). // 64 KiB pages
+			WithCloseOnContextDone(true)
+		rt := wazero.NewRuntimeWithConfig(ctx, cfg)
+		if _, err := wasi_snapshot_preview1.Instantiate(ctx, rt); err != nil {
+			w.err = err
+			return
+		}
+		_, err := rt.NewHostModuleBuilder("simpleagent").
+			NewFunctionBuilder().WithFunc(wasmHTTP).Export("http").
+			NewFunctionBuilder().WithFunc(wasmHTTPResult).Export("http_result").
+			Instantiate(ctx)
+		if err != nil {
+			w.err = err
+			return
+		}
+		code, err := os.ReadFile(w.p.path)
+		if err != nil {
+			w.err = err
+			return
+		}
+		if w.compiled, w.err = rt.CompileModule(ctx, code); w.err != nil {
+			return
+		}
+		w.runtime = rt
+	})
+	return w.err
+}
+
+// fsConfig mounts the granted directories, each at its path as written
+// (relative ones under /, which is also the module's working directory).
+func (w *wasmPlugin) fsConfig() (wazero.FSConfig, error) {
+	cfg := wazero.NewFSConfig()
+	for _, entry := range w.p.Dirs {
+		dir, ro := splitWasmDir(entry)
+		host, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, err
+		}
+		if info, err := os.Stat(host); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("dirs: %s is not a directory", dir)
+		}
+		guest := filepath.ToSlash(filepath.Clean(dir))
+		if !filepath.IsAbs(dir) {
+			guest = "/" + strings.TrimPrefix(guest, ".")
+		}
+		var fs experimentalsys.FS = noSymlinkFS{sysfs.DirFS(host)}
+		if ro {
+			fs = &sysfs.ReadFS{FS: fs}
+		}
+		cfg = cfg.(sysfs.FSConfig).WithSysFSMount(fs, guest)
+	}
+	return cfg, nil
+}
+
+// noSymlinkFS keeps a module from creating symlinks, which the host would
+// follow out of the granted directory.
+type noSymlinkFS struct {
+	experimentalsys.FS
+}
+
+func (noSymlinkFS) Symlink(string, string) experimentalsys.Errno {
+	return experimentalsys.EPERM
+}
+
+// run instantiates the module with args on stdin. Results read like an
+// executable plugin's: stdout, then stderr and the exit status on failure.
+func (w *wasmPlugin) run(args json.RawMessage) (string, error) {
+	if len(bytes.TrimSpace(args)) == 0 {
+		args = json.RawMessage("{}")
+	}
+	if err := w.load(); err != nil {
+		return fmt.Sprintf("error: loading %s: %v", w.p.path, err), nil
+	}
+	fsCfg, err := w.fsConfig()
+	if err != nil {
+		return fmt.Sprintf("error: %v", err), nil
+	}
+	timeout := w.p.Timeout
+	if timeout <= 0 {
+		timeout = defaultPluginTimeout
+	}
+	ctx, cancel := context.WithTimeout(toolCtx, time.Duration(timeout)*time.Second)
+	defer cancel()
+	ctx = context.WithValue(ctx, wasmCallKey{}, &wasmCall{plugin: w})
+
+	const maxOutput = 50000
+	stdout := &cappedBuffer{max: maxOutput + 1}
+	stderr := &cappedBuffer{max: maxOutput + 1}
+	cfg := wazero.NewModuleConfig().
+		WithName("").
+		WithArgs(w.p.Name).
+		WithEnv("SIMPLEAGENT_TOOL", w.p.Name).
+		WithEnv("PWD", "/"). // relative paths resolve against the mounts, as in fsConfig
+		WithStdin(bytes.NewReader(args)).
+		WithStdout(stdout).
+		WithStderr(stderr).
+		WithSysWalltime().
+		WithSysNanotime().
+		WithSysNanosleep().
+		WithRandSource(rand.Reader).
+		WithFSConfig(fsCfg)
+	mod, err := w.runtime.InstantiateModule(ctx, w.compiled, cfg)
+	if mod != nil {
+		mod.Close(context.Background())
+	}
+	var exit *sys.ExitError
+	if errors.As(err, &exit) {
+		err = nil
+		if exit.ExitCode() != 0 {
+			err = fmt.Errorf("exit status %d", exit.ExitCode())
+		}
+	}
+
+	result := stdout.String()
+	if err != nil {
+		if stderr.Len() > 0 {
+			if result != "" {
+				result += "\n"
+			}
+			result += "STDERR:\n" + stderr.String()
+		}
+		if ctx.Err() == context.DeadlineExceeded {
+			result += fmt.Sprintf("\n[timed out after %ds]", timeout)
+		} else {
+			result += fmt.Sprintf("\n[exit: %v]", err)
+		}
+	}
+	if result == "" {
+		result = "(no output)"
+	}
+	if len(result) > maxOutput {
+		result = result[:maxOutput] + "\n... [truncated]"
+	}
+	return result, nil
+}
+
+// cappedBuffer keeps the first max bytes written and drops the rest, so a
+// runaway module can't fill the host's memory.
+type cappedBuffer struct {
+	bytes.Buffer
+	max int
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.Len(); room > 0 {
+		b.Buffer.Write(p[:min(len(p), room)])
+	}
+	return len(p), nil
+}
+
+// checkHost reports why the module may not reach host, or "" when it may.
+func (w *wasmPlugin) checkHost(host string) string {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if !slices.ContainsFunc(w.p.Net, func(pat string) bool { return matchHostPattern(pat, host) }) {
+		return "host " + host + " not in the plugin's net list"
+	}
+	return w.policy.Check(host)
+}
+
+// wasmHTTP is the http host function.
+func wasmHTTP(ctx context.Context, m api.Module, ptr, n uint32) uint32 {
+	call := ctx.Value(wasmCallKey{}).(*wasmCall)
+	var resp any
+	if n > wasmHTTPMaxRequest {
+		resp = map[string]string{"error": "request too large"}
+	} else if req, ok := m.Memory().Read(ptr, n); !ok {
+		resp = map[string]string{"error": "request out of memory bounds"}
+	} else {
+		resp = call.plugin.doHTTP(ctx, req)
+	}
+	call.result, _ = json.Marshal(resp)
+	return uint32(len(call.result))
+}
+
+// wasmHTTPResult is the http_result host function.
+func wasmHTTPResult(ctx context.Context, m api.Module, ptr uint32) {
+	call := ctx.Value(wasmCallKey{}).(*wasmCall)
+	if !m.Memory().Write(ptr, call.result) {
+		panic("http_result: buffer out of memory bounds")
+	}
+	call.result = nil
+}
+
+type wasmHTTPResponse struct {
+	Status  int               `json:"status,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+	Error   string            `json:"error,omitempty"`
+}
+
+// doHTTP makes one request for the module. Redirects are checked like the
+// first host; the body is capped at wasmHTTPMaxBody.
+func (w *wasmPlugin) doHTTP(ctx context.Context, data []byte) wasmHTTPResponse {
+	var req struct {
+		Method  string            `json:"method"`
+		URL     string            `json:"url"`
+		Headers map[string]string `json:"headers"`
+		Body    string            `json:"body"`
+	}
+	if err := json.Unmarshal(data, &req); err != nil {
+		return wasmHTTPResponse{Error: "bad request JSON: " + err.Error()}
+	}
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return wasmHTTPResponse{Error: "url must be an absolute http:// or https:// URL"}
+	}
+	if msg := w.checkHost(u.Hostname()); msg != "" {
+		return wasmHTTPResponse{Error: "blocked: " + msg}
+	}
+
+	var body io.Reader
+	if req.Body != "" {
+		body = strings.NewReader(req.Body)
+	}
+	hreq, err := http.NewRequestWithContext(ctx, strings.ToUpper(orDefault(req.Method, "GET")), u.String(), body)
+	if err != nil {
+		return wasmHTTPResponse{Error: err.Error()}
+	}
+	hreq.Header.Set("User-Agent", "simpleagent")
+	for k, v := range req.Headers {
+		hreq.Header.Set(k, v)
+	}
+	client := &http.Client{
+		CheckRedirect: func(next *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			if msg := w.checkHost(next.URL.Hostname()); msg != "" {
+				return errors.New("redirect blocked: " + msg)
+			}
+			return nil
+		},
+	}
+	resp, err := client.Do(hreq)
+	if err != nil {
+		return wasmHTTPResponse{Error: err.Error()}
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, wasmHTTPMaxBody))
+	if err != nil {
+		return wasmHTTPResponse{Error: "reading body: " + err.Error()}
+	}
+	headers := make(map[string]string, len(resp.Header))
+	for k := range resp.Header {
+		headers[k] = resp.Header.Get(k)
+	}
+	return wasmHTTPResponse{Status: resp.StatusCode, Headers: headers, Body: string(respBody)}
+}
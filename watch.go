@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// watchPoll is how often the tree is rescanned for changes.
+	watchPoll = 500 * time.Millisecond
+	// watchSettle is how long files must stay quiet before a run starts, so
+	// a save-all or a checkout triggers one run rather than dozens.
+	watchSettle = 300 * time.Millisecond
+)
+
+// fileStamp is what a change looks like to the watcher.
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+// watchGlobs compiles comma-separated glob patterns. "*" and "?" stay within
+// one path segment and "**" spans directories; a pattern without a slash
+// matches the base name anywhere in the tree, like find_files.
+func watchGlobs(spec string) ([]*regexp.Regexp, error) {
+	var res []*regexp.Regexp
+	for _, p := range strings.Split(spec, ",") {
+		p = strings.TrimPrefix(filepath.ToSlash(strings.TrimSpace(p)), "./")
+		if p == "" {
+			continue
+		}
+		if !strings.Contains(p, "/") {
+			p = "**/" + p
+		}
+		var sb strings.Builder
+		sb.WriteString("^")
+		for i := 0; i < len(p); i++ {
+			switch c := p[i]; {
+			case strings.HasPrefix(p[i:], "**/"):
+				sb.WriteString("(.*/)?")
+				i += 2
+			case strings.HasPrefix(p[i:], "**"):
+				sb.WriteString(".*")
+				i++
+			case c == '*':
+				sb.WriteString("[^/]*")
+			case c == '?':
+				sb.WriteString("[^/]")
+			default:
+				sb.WriteString(regexp.QuoteMeta(string(c)))
+			}
+		}
+		sb.WriteString("$")
+		re, err := regexp.Compile(sb.String())
+		if err != nil {
+			return nil, fmt.Errorf("bad glob %q: %w", p, err)
+		}
+		res = append(res, re)
+	}
+	if len(res) == 0 {
+		return nil, fmt.Errorf("no glob patterns given")
+	}
+	return res, nil
+}
+
+// watchSnapshot stamps every file under the working directory matching one
+// of globs. Hidden directories and skipDirs are not descended into.
+func watchSnapshot(globs []*regexp.Regexp) map[string]fileStamp {
+	snap := make(map[string]fileStamp)
+	filepath.WalkDir(".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			name := d.Name()
+			if path != "." && (strings.HasPrefix(name, ".") || slices.Contains(skipDirs, name)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel := filepath.ToSlash(path)
+		if !slices.ContainsFunc(globs, func(re *regexp.Regexp) bool { return re.MatchString(rel) }) {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			snap[rel] = fileStamp{info.Size(), info.ModTime()}
+		}
+		return nil
+	})
+	return snap
+}
+
+// watchDiff lists the paths added, removed or modified between two snapshots.
+func watchDiff(old, cur map[string]fileStamp) []string {
+	var changed []string
+	for p, s := range cur {
+		if o, ok := old[p]; !ok || o != s {
+			changed = append(changed, p)
+		}
+	}
+	for p := range old {
+		if _, ok := cur[p]; !ok {
+			changed = append(changed, p)
+		}
+	}
+	slices.Sort(changed)
+	return changed
+}
+
+// runWatch calls run every time a file matching spec changes, forever.
+// Changes are debounced until the tree settles, and runs never overlap:
+// edits made while a run is in progress, including the agent's own, are
+// folded into the baseline rather than triggering another run.
+func runWatch(spec string, run func(changed []string)) error {
+	globs, err := watchGlobs(spec)
+	if err != nil {
+		return err
+	}
+	snap := watchSnapshot(globs)
+	fmt.Printf("\033[2mWatching %d file(s) matching %s — Ctrl+C to stop\033[0m\n", len(snap), spec)
+
+	for {
+		time.Sleep(watchPoll)
+		cur := watchSnapshot(globs)
+		changed := watchDiff(snap, cur)
+		if len(changed) == 0 {
+			continue
+		}
+		// Wait for the burst to finish, picking up late writes.
+		for {
+			time.Sleep(watchSettle)
+			next := watchSnapshot(globs)
+			if len(watchDiff(cur, next)) == 0 {
+				break
+			}
+			cur = next
+		}
+		changed = watchDiff(snap, cur)
+		if len(changed) == 0 {
+			snap = cur
+			continue
+		}
+
+		shown := changed
+		if len(shown) > 5 {
+			shown = append(shown[:5:5], fmt.Sprintf("and %d more", len(changed)-5))
+		}
+		fmt.Printf("\n\033[36m[%s] changed: %s\033[0m\n", time.Now().Format("15:04:05"), strings.Join(shown, ", "))
+		run(changed)
+		snap = watchSnapshot(globs)
+		fmt.Printf("\033[2mWatching %s…\033[0m\n", spec)
+	}
+}